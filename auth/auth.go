@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+/**
+* API authentication
+* Manager and worker APIs require a shared bearer token when one is configured.
+* Clients (the manager talking to workers, and the CLI) attach it through Transport.
+ */
+
+// Environment variable the --auth-token flag defaults to, so the token stays out of process listings
+const TokenEnv = "CUBE_AUTH_TOKEN"
+
+const bearerPrefix = "Bearer "
+
+type errResponse struct {
+	HTTPStatusCode int
+	Message        string
+}
+
+// Middleware rejects requests that do not carry the bearer token. An empty token disables authentication.
+func Middleware(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if token == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), bearerPrefix)
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="cube"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(errResponse{HTTPStatusCode: http.StatusUnauthorized, Message: "missing or invalid bearer token"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Transport adds the bearer token to every outgoing request
+type Transport struct {
+	Token string
+	Base  http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if t.Token == "" {
+		return base.RoundTrip(r)
+	}
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", bearerPrefix+t.Token)
+	return base.RoundTrip(r)
+}
+
+// NewClient returns an HTTP client authenticating with token
+func NewClient(token string) *http.Client {
+	return &http.Client{Transport: &Transport{Token: token}}
+}
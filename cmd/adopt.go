@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/spf13/cobra"
+
+	managerApi "cube/manager/api"
+	"cube/task"
+)
+
+func init() {
+	rootCmd.AddCommand(adoptCmd)
+	adoptCmd.Flags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
+	adoptCmd.Flags().StringP("worker", "w", "", "Worker the container runs on")
+	adoptCmd.Flags().StringP("container", "c", "", "ID of the container to adopt")
+	adoptCmd.Flags().StringP("name", "n", "", "Name of the imported task (defaults to the container name)")
+	adoptCmd.MarkFlagRequired("worker")
+	adoptCmd.MarkFlagRequired("container")
+}
+
+var adoptCmd = &cobra.Command{
+	Use:   "adopt",
+	Short: "Import an existing container as a task.",
+	Long:  `The adopt command creates a task from a container already running on a worker, so Cube manages its lifecycle from then on.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, _ := cmd.Flags().GetString("manager")
+		worker, _ := cmd.Flags().GetString("worker")
+		containerID, _ := cmd.Flags().GetString("container")
+		name, _ := cmd.Flags().GetString("name")
+
+		data, err := json.Marshal(managerApi.AdoptRequest{Worker: worker, ContainerID: containerID, Name: name})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		url := fmt.Sprintf("http://%s/adopt", manager)
+		resp, err := apiClient(cmd).Post(url, "application/json", bytes.NewBuffer(data))
+		if err != nil {
+			log.Fatalf("Error connecting to %v: %v", url, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated {
+			e := managerApi.ErrResponse{}
+			json.NewDecoder(resp.Body).Decode(&e)
+			log.Fatalf("Error adopting container: %s", e.Message)
+		}
+
+		t := task.Task{}
+		json.NewDecoder(resp.Body).Decode(&t)
+		log.Printf("Container %s adopted as task %v", containerID, t.ID)
+	},
+}
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"cube/auth"
+	"cube/features"
+	"cube/manager"
+	managerApi "cube/manager/api"
+	"cube/platform"
+	"cube/rpc"
+	"cube/supervisor"
+	"cube/systemd"
+	"cube/task"
+	"cube/validation"
+	"cube/worker"
+	workerApi "cube/worker/api"
+)
+
+func init() {
+	rootCmd.AddCommand(allInOneCmd)
+	addLogFlags(allInOneCmd)
+	addConfigFlag(allInOneCmd)
+	allInOneCmd.Flags().StringP("host", "H", "0.0.0.0", "Hostname or IP address")
+	allInOneCmd.Flags().Int("manager-port", 5555, "Port on which the manager listens")
+	allInOneCmd.Flags().Int("worker-port", 5556, "Port on which the worker listens")
+	allInOneCmd.Flags().StringP("name", "n", "worker-all-in-one", "Name of the worker")
+	addSchedulerFlags(allInOneCmd)
+	allInOneCmd.Flags().StringP("dbType", "d", "memory", "Type of datastore to use for events and tasks (\"memory\" or \"persistent\")")
+	allInOneCmd.Flags().String("data-dir", "", "Directory for persistent datastores (defaults to the platform data directory)")
+	addStoreFlags(allInOneCmd)
+	addNotifyFlags(allInOneCmd)
+	allInOneCmd.Flags().String("runtime", task.DockerRuntime, fmt.Sprintf("Container runtime to run tasks with (one of %v)", task.Runtimes))
+	allInOneCmd.Flags().String("transport", rpc.HTTPTransport, fmt.Sprintf("Transport used between the manager and the worker (one of %v)", rpc.Transports))
+	allInOneCmd.Flags().StringToString("labels", nil, "Node labels tasks can select through NodeSelector and Constraints (e.g. zone=eu-west,gpu=true)")
+	allInOneCmd.Flags().StringSlice("capabilities", nil, "Capabilities of this node tasks can require, in addition to those of the build (e.g. gpu)")
+	allInOneCmd.Flags().StringSlice("allowed-bind-paths", nil, "Host directories tasks may bind mount (bind mounts are refused when empty)")
+	allInOneCmd.Flags().String("registry-config", "", "JSON file with the credentials of private registries, keyed by registry domain")
+	allInOneCmd.Flags().Duration("task-retention", 24*time.Hour, "How long finished tasks are kept by the manager and worker before being deleted (0 keeps them forever)")
+	allInOneCmd.Flags().Int("max-job-output", task.DefaultMaxResultOutput, "Bytes of stdout and of stderr kept in the result of a finished job")
+	allInOneCmd.Flags().Int("concurrency", 4, "Maximum number of queued tasks the worker runs concurrently")
+	allInOneCmd.Flags().Int("max-tasks", 0, "Most active tasks the worker accepts, enforced by the schedulers too (0 for no limit)")
+	allInOneCmd.Flags().String("feature-gates", "", "Comma separated list of Feature=bool pairs (e.g. PushUpdates=true,Services=false)")
+	allInOneCmd.Flags().Duration("shutdown-timeout", 30*time.Second, "Time to wait for in-flight requests on shutdown")
+}
+
+var allInOneCmd = &cobra.Command{
+	Use:   "all-in-one",
+	Short: "Run a manager and a worker in a single process.",
+	Long: `The all-in-one command runs a manager and a single worker in one supervised process.
+It is intended for development and single node setups, and supports the same
+scheduler, datastore and feature gate settings as the manager and worker commands.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		applyConfigFile(cmd)
+		host, _ := cmd.Flags().GetString("host")
+		managerPort, _ := cmd.Flags().GetInt("manager-port")
+		workerPort, _ := cmd.Flags().GetInt("worker-port")
+		name, _ := cmd.Flags().GetString("name")
+		dbType, _ := cmd.Flags().GetString("dbType")
+		dataDir, _ := cmd.Flags().GetString("data-dir")
+		featureGates, _ := cmd.Flags().GetString("feature-gates")
+		shutdownTimeout, _ := cmd.Flags().GetDuration("shutdown-timeout")
+		runtime, _ := cmd.Flags().GetString("runtime")
+		concurrency, _ := cmd.Flags().GetInt("concurrency")
+		maxTasks, _ := cmd.Flags().GetInt("max-tasks")
+		taskRetention, _ := cmd.Flags().GetDuration("task-retention")
+		maxJobOutput, _ := cmd.Flags().GetInt("max-job-output")
+		allowedBindPaths, _ := cmd.Flags().GetStringSlice("allowed-bind-paths")
+		capabilities, _ := cmd.Flags().GetStringSlice("capabilities")
+		registryConfig, _ := cmd.Flags().GetString("registry-config")
+		labels, _ := cmd.Flags().GetStringToString("labels")
+		transport, _ := cmd.Flags().GetString("transport")
+		token := authToken(cmd)
+		logger := setupLogging(cmd, "cube")
+
+		if err := features.Gates.Set(featureGates); err != nil {
+			fatal(logger, "Invalid --feature-gates", "error", err)
+		}
+		profile := schedulerProfile(cmd, logger)
+		runtimeClient, err := task.NewRuntimeClient(runtime)
+		if err != nil {
+			fatal(logger, "Invalid --runtime", "error", err)
+		}
+		client := auth.NewClient(token)
+		workerClient, err := rpc.NewWorkerClient(transport, token, client)
+		if err != nil {
+			fatal(logger, "Invalid --transport", "error", err)
+		}
+		dataDir, err = platform.DataDir(dataDir)
+		if err != nil {
+			fatal(logger, "Unable to create data directory", "error", err)
+		}
+		setupStoreEncryption(cmd, logger)
+
+		// The manager is shut down before the worker so it can still dispatch its pending tasks
+		ws, ms := supervisor.New(), supervisor.New()
+		workerCtx, stopWorker := context.WithCancel(context.Background())
+		managerCtx, stopManager := context.WithCancel(context.Background())
+
+		logger.Info("Starting worker")
+		w := worker.New(name, dbType, dataDir)
+		w.Runtime = runtime
+		w.RuntimeClient = runtimeClient
+		w.Concurrency = concurrency
+		if maxTasks < 0 {
+			fatal(logger, "Invalid --max-tasks, expected zero or more", "max-tasks", maxTasks)
+		}
+		w.MaxTasks = maxTasks
+		w.TaskRetention = taskRetention
+		if maxJobOutput < 0 {
+			fatal(logger, "Invalid --max-job-output, expected zero or more", "max-job-output", maxJobOutput)
+		}
+		w.MaxResultOutput = maxJobOutput
+		w.AllowedBindPaths = allowedBindPaths
+		if registryConfig != "" {
+			registries, err := task.LoadRegistries(registryConfig)
+			if err != nil {
+				fatal(logger, "Invalid --registry-config", "error", err)
+			}
+			w.Registries = registries
+		}
+		if errs := validation.ValidateLabels("--labels", labels); errs != nil {
+			fatal(logger, "Invalid --labels", "error", errs)
+		}
+		w.Labels = labels
+		if errs := validation.ValidateCapabilities("--capabilities", capabilities); errs != nil {
+			fatal(logger, "Invalid --capabilities", "error", errs)
+		}
+		w.Capabilities = capabilities
+		w.Manager = fmt.Sprintf("localhost:%d", managerPort)
+		w.Address = fmt.Sprintf("localhost:%d", workerPort)
+		w.Client = auth.NewClient(token)
+		if err := w.RecoverContainers(); err != nil {
+			logger.Error("Error recovering task containers", "error", err)
+		}
+		wapi := workerApi.Api{Address: host, Port: workerPort, Worker: w, AuthToken: token, Transport: transport}
+		ws.Go("worker.RunTasks", func() { w.RunTasks(workerCtx) })
+		ws.Go("worker.CollectStats", func() { w.CollectStats(workerCtx) })
+		ws.Go("worker.CollectTaskStats", func() { w.CollectTaskStats(workerCtx) })
+		ws.Go("worker.UpdateTasks", func() { w.UpdateTasks(workerCtx) })
+		ws.Go("worker.PushUpdates", func() { w.PushUpdates(workerCtx) })
+		ws.Go("worker.SendHeartbeats", func() { w.SendHeartbeats(workerCtx) })
+		ws.Go("worker.ProbeTasks", func() { w.ProbeTasks(workerCtx) })
+		ws.Go("worker.CollectGarbage", func() { w.CollectGarbage(workerCtx) })
+		ws.Go("worker.WatchContainers", func() { w.WatchContainers(workerCtx) })
+		workerServed, err := wapi.Start()
+		if err != nil {
+			fatal(logger, "Unable to start worker API", "error", err)
+		}
+
+		logger.Info("Starting manager")
+		workers := []string{fmt.Sprintf("localhost:%d", workerPort)}
+		m, err := manager.New(workers, profile.Name, dbType, dataDir, "", client, workerClient)
+		if err != nil {
+			fatal(logger, "Unable to start manager", "dbType", dbType, "error", err)
+		}
+		m.SetScheduler(profile, profile.Name)
+		m.TaskRetention = taskRetention
+		notifier := setupNotifications(cmd, logger, m)
+		mapi := managerApi.Api{Address: host, Port: managerPort, Manager: m, AuthToken: token}
+		ms.Go("manager.ProcessTasks", func() { m.ProcessTasks(managerCtx) })
+		ms.Go("manager.UpdateTasks", func() { m.UpdateTasks(managerCtx) })
+		ms.Go("manager.DoHealthChecks", func() { m.DoHealthChecks(managerCtx) })
+		ms.Go("manager.UpdateNodeStats", func() { m.UpdateNodeStats(managerCtx) })
+		ms.Go("manager.ReconcileServices", func() { m.ReconcileServices(managerCtx) })
+		ms.Go("manager.ReconcileDeployments", func() { m.ReconcileDeployments(managerCtx) })
+		ms.Go("manager.RunCronJobs", func() { m.RunCronJobs(managerCtx) })
+		ms.Go("manager.CollectGarbage", func() { m.CollectGarbage(managerCtx) })
+		if notifier != nil {
+			ms.Go("notify.Run", func() { notifier.Run(managerCtx) })
+		}
+		managerServed, err := mapi.Start()
+		if err != nil {
+			fatal(logger, "Unable to start manager API", "error", err)
+		}
+
+		go m.Watchdog.Run()
+		if err := systemd.Notify(systemd.Ready); err != nil {
+			logger.Error("Error notifying systemd", "error", err)
+		}
+		logger.Info("Started manager and worker APIs", "manager", fmt.Sprintf("http://%s:%d", host, managerPort), "worker", fmt.Sprintf("http://%s:%d", host, workerPort))
+
+		sig, err := waitForShutdown(managerServed, workerServed)
+		if err != nil {
+			fatal(logger, "API stopped serving", "error", err)
+		}
+		logger.Info("Shutting down", "signal", sig)
+		systemd.Notify(systemd.Stopping)
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := mapi.Stop(shutdownCtx); err != nil {
+			logger.Error("Error stopping manager API", "error", err)
+		}
+		stopManager()
+		if !waitContext(shutdownCtx, ms.Wait) {
+			logger.Warn("Timed out waiting for manager loops to finish")
+		}
+		if err := wapi.Stop(shutdownCtx); err != nil {
+			logger.Error("Error stopping worker API", "error", err)
+		}
+		stopWorker()
+		if !waitContext(shutdownCtx, ws.Wait) {
+			logger.Warn("Timed out waiting for worker loops to finish")
+		}
+		m.Close()
+		w.Db.Close()
+		runtimeClient.Close()
+		logger.Info("Shutdown complete")
+	},
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"cube/worker"
+)
+
+func init() {
+	workerCmd.AddCommand(cleanupCmd)
+	cleanupCmd.Flags().StringP("worker", "w", "localhost:5556", "Worker to clean up")
+}
+
+var cleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Remove orphaned task containers from a worker.",
+	Long: `The cleanup command removes the containers a worker started for tasks it no longer knows
+about, leaked by failed task state transitions. Workers also do this periodically.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		address, _ := cmd.Flags().GetString("worker")
+
+		url := fmt.Sprintf("http://%s/containers/cleanup", address)
+		resp, err := apiClient(cmd).Post(url, "application/json", nil)
+		if err != nil {
+			log.Fatalf("Error connecting to %v: %v", address, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("Error cleaning up containers: %s", apiError(resp))
+		}
+
+		var removed []worker.Container
+		if err := json.NewDecoder(resp.Body).Decode(&removed); err != nil {
+			log.Fatalf("Unable to decode worker response: %v", err)
+		}
+		if len(removed) == 0 {
+			log.Printf("No orphaned containers on %s", address)
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
+		fmt.Fprintln(w, "CONTAINER\tNAME\tTASK\tSTATUS\t")
+		for _, c := range removed {
+			fmt.Fprintf(w, "%s\t%s\t%v\t%s\t\n", c.ID[:min(12, len(c.ID))], c.Name, c.TaskID, c.Status)
+		}
+		w.Flush()
+	},
+}
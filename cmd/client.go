@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"cube/auth"
+	managerApi "cube/manager/api"
+)
+
+// authToken returns the --auth-token flag, falling back to the environment
+func authToken(cmd *cobra.Command) string {
+	if token, _ := cmd.Flags().GetString("auth-token"); token != "" {
+		return token
+	}
+	return os.Getenv(auth.TokenEnv)
+}
+
+// apiClient returns an HTTP client authenticating with the configured token
+func apiClient(cmd *cobra.Command) *http.Client {
+	return auth.NewClient(authToken(cmd))
+}
+
+// apiError returns the message of an error response from the manager, or its status
+func apiError(resp *http.Response) string {
+	e := managerApi.ErrResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Message == "" {
+		return resp.Status
+	}
+	if len(e.Errors) == 0 {
+		return e.Message
+	}
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = "\n  " + fe.Error()
+	}
+	return fmt.Sprintf("%s (%s):%s", http.StatusText(e.HTTPStatusCode), e.Code, strings.Join(msgs, ""))
+}
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+/**
+* Configuration files
+* Long running commands read flag values from the file passed to --config, keyed by
+* flag name, e.g. for a manager:
+*   workers: [worker-1:5556, worker-2:5556]
+*   scheduler-profile: epvm
+*   dbType: persistent
+*   health-check-interval: 30s
+* YAML, TOML and JSON files are supported, by extension. Flags given on the command
+* line take precedence over the file, unknown keys are rejected.
+ */
+
+// addConfigFlag registers the --config flag of long running commands
+func addConfigFlag(cmd *cobra.Command) {
+	cmd.Flags().String("config", "", "YAML, TOML or JSON file with flag values keyed by flag name, flags on the command line take precedence")
+}
+
+// applyConfigFile sets the flags not given on the command line from the --config
+// file, exiting when it cannot be read or holds invalid values
+func applyConfigFile(cmd *cobra.Command) {
+	file, _ := cmd.Flags().GetString("config")
+	if file == "" {
+		return
+	}
+	if err := loadConfigFile(cmd.Flags(), file); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --config %s: %v\n", file, err)
+		os.Exit(1)
+	}
+}
+
+func loadConfigFile(flags *pflag.FlagSet, file string) error {
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return err
+	}
+
+	var errs []error
+	known := make(map[string]bool)
+	flags.VisitAll(func(f *pflag.Flag) {
+		known[strings.ToLower(f.Name)] = true
+		if f.Changed || f.Name == "config" || !v.IsSet(f.Name) {
+			return
+		}
+		value, err := flagValue(f, v.Get(f.Name))
+		if err == nil {
+			err = flags.Set(f.Name, value)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", f.Name, err))
+		}
+	})
+	for _, key := range v.AllKeys() {
+		// Map flags such as labels are flattened to labels.<key>
+		if name, _, _ := strings.Cut(key, "."); !known[name] {
+			errs = append(errs, fmt.Errorf("%s: unknown key", key))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// commandLineFlags returns the names of the flags given on the command line, it
+// must be called before applyConfigFile sets the others
+func commandLineFlags(cmd *cobra.Command) map[string]bool {
+	changed := make(map[string]bool)
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		changed[f.Name] = true
+	})
+	return changed
+}
+
+// reloadConfigFile sets the named flags again from the --config file, those the file
+// no longer sets go back to their default. Flags in cmdline, given on the command
+// line, keep their value.
+func reloadConfigFile(cmd *cobra.Command, cmdline map[string]bool, names ...string) error {
+	file, _ := cmd.Flags().GetString("config")
+	if file == "" {
+		return nil
+	}
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, name := range names {
+		f := cmd.Flags().Lookup(name)
+		if f == nil || cmdline[name] {
+			continue
+		}
+		var err error
+		switch sv, ok := f.Value.(pflag.SliceValue); {
+		case !v.IsSet(name):
+			err = resetFlag(f)
+		case ok:
+			// Setting a slice flag again appends to it
+			var items []string
+			if items, err = cast.ToStringSliceE(v.Get(name)); err == nil {
+				err = sv.Replace(items)
+			}
+		default:
+			var value string
+			if value, err = flagValue(f, v.Get(name)); err == nil {
+				err = f.Value.Set(value)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// resetFlag sets f back to its default value
+func resetFlag(f *pflag.Flag) error {
+	sv, ok := f.Value.(pflag.SliceValue)
+	if !ok {
+		return f.Value.Set(f.DefValue)
+	}
+	// Slice defaults are printed as [a,b]
+	items := []string{}
+	if def := strings.Trim(f.DefValue, "[]"); def != "" {
+		items = strings.Split(def, ",")
+	}
+	return sv.Replace(items)
+}
+
+// checkIntervals exits unless the named duration flags are positive
+func checkIntervals(cmd *cobra.Command, logger *slog.Logger, names ...string) {
+	for _, name := range names {
+		if d, _ := cmd.Flags().GetDuration(name); d <= 0 {
+			fatal(logger, "Invalid --"+name+", must be positive", "interval", d)
+		}
+	}
+}
+
+// flagValue converts a value read from a configuration file to the string form
+// parsed by the flag
+func flagValue(f *pflag.Flag, value any) (string, error) {
+	switch f.Value.Type() {
+	case "stringSlice":
+		items, err := cast.ToStringSliceE(value)
+		if err != nil {
+			return "", err
+		}
+		return strings.Join(items, ","), nil
+	case "stringToString":
+		m, err := cast.ToStringMapStringE(value)
+		if err != nil {
+			return "", err
+		}
+		pairs := make([]string, 0, len(m))
+		for k, v := range m {
+			pairs = append(pairs, k+"="+v)
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ","), nil
+	}
+	return cast.ToStringE(value)
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"cube/task"
+	"cube/validation"
+)
+
+func init() {
+	rootCmd.AddCommand(deployCmd)
+	deployCmd.Flags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
+	deployCmd.Flags().StringP("filename", "f", "task.json", "Task template specification file")
+	deployCmd.Flags().String("name", "", "Deployment name, deploying to an existing name rolls it out")
+	deployCmd.Flags().Int("replicas", 1, "Number of replicas to run")
+	deployCmd.Flags().Int("max-unavailable", 0, "Replicas that may be unavailable during a rollout")
+	deployCmd.Flags().Int("max-surge", 1, "Replicas that may be started above --replicas during a rollout")
+	deployCmd.Flags().Bool("wait", false, "Wait for the rollout to complete")
+	deployCmd.MarkFlagRequired("name")
+}
+
+var deployCmd = &cobra.Command{
+	Use:   "deploy",
+	Short: "Deploy replicas of a task.",
+	Long: `The deploy command creates a deployment running replicas of a task template. Deploying
+a new template under the name of an existing deployment performs a rolling update, replacing
+the replicas within --max-unavailable and --max-surge as the new ones become healthy.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, _ := cmd.Flags().GetString("manager")
+		filename, _ := cmd.Flags().GetString("filename")
+		wait, _ := cmd.Flags().GetBool("wait")
+
+		d := task.Deployment{}
+		d.Name, _ = cmd.Flags().GetString("name")
+		d.Replicas, _ = cmd.Flags().GetInt("replicas")
+		d.MaxUnavailable, _ = cmd.Flags().GetInt("max-unavailable")
+		d.MaxSurge, _ = cmd.Flags().GetInt("max-surge")
+
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			log.Fatalf("Unable to read file: %v", err)
+		}
+		if err := json.Unmarshal(data, &d.Template); err != nil {
+			log.Fatalf("Unable to parse task specification: %v", err)
+		}
+		if errs := validation.ValidateDeployment(d); errs != nil {
+			for _, e := range errs {
+				log.Printf("Invalid deployment: %v", e)
+			}
+			os.Exit(1)
+		}
+
+		body, err := json.Marshal(d)
+		if err != nil {
+			log.Fatal(err)
+		}
+		client := apiClient(cmd)
+		resp, err := client.Post(fmt.Sprintf("http://%s/deployments", manager), "application/json", bytes.NewBuffer(body))
+		if err != nil {
+			log.Fatalf("Error connecting to %v: %v", manager, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+			log.Fatalf("Error deploying: %s", apiError(resp))
+		}
+
+		deployed := task.Deployment{}
+		if err := json.NewDecoder(resp.Body).Decode(&deployed); err != nil {
+			log.Fatalf("Unable to decode manager response: %v", err)
+		}
+		log.Printf("Deployment %s (%v) is at revision %d", deployed.Name, deployed.ID, deployed.Revision)
+
+		if wait {
+			waitForRollout(client, manager, deployed)
+		}
+	},
+}
+
+// waitForRollout polls the manager until the deployment's revision is rolled out
+func waitForRollout(client *http.Client, manager string, d task.Deployment) {
+	for {
+		resp, err := client.Get(fmt.Sprintf("http://%s/deployments/%s", manager, d.ID))
+		if err != nil {
+			log.Fatalf("Error connecting to %v: %v", manager, err)
+		}
+		current := task.Deployment{}
+		if resp.StatusCode != http.StatusOK {
+			msg := apiError(resp)
+			resp.Body.Close()
+			log.Fatalf("Error getting deployment %v: %s", d.ID, msg)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&current)
+		resp.Body.Close()
+		if err != nil {
+			log.Fatalf("Unable to decode manager response: %v", err)
+		}
+
+		if current.Revision != d.Revision {
+			log.Fatalf("Deployment %s moved on to revision %d", d.Name, current.Revision)
+		}
+		log.Printf("%d/%d replicas updated, %d ready", current.UpdatedReplicas, current.Replicas, current.ReadyReplicas)
+		if current.Status == task.DeploymentComplete {
+			log.Printf("Deployment %s rolled out", d.Name)
+			return
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"cube/logging"
+)
+
+// addLogFlags registers the logging flags of long running commands
+func addLogFlags(cmd *cobra.Command) {
+	cmd.Flags().String("log-level", "info", fmt.Sprintf("Minimum level of log records (one of %v)", logging.Levels))
+	cmd.Flags().String("log-format", logging.TextFormat, fmt.Sprintf("Format of log records (one of %v)", logging.Formats))
+}
+
+// setupLogging applies the logging flags and returns the logger of the named component
+func setupLogging(cmd *cobra.Command, component string) *slog.Logger {
+	level, _ := cmd.Flags().GetString("log-level")
+	format, _ := cmd.Flags().GetString("log-format")
+	if err := logging.Setup(os.Stdout, level, format); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging flags: %v\n", err)
+		os.Exit(1)
+	}
+	return logging.For(component)
+}
+
+// fatal logs an error record and exits
+func fatal(logger *slog.Logger, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
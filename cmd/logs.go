@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"cube/utils"
+)
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+	logsCmd.Flags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
+	logsCmd.Flags().StringP("selector", "l", "", "Label selector of the tasks to show logs for (e.g. app=web)")
+	logsCmd.Flags().BoolP("follow", "f", false, "Follow log output")
+	logsCmd.Flags().String("tail", "all", "Number of lines to show from the end of each task's logs")
+	logsCmd.Flags().Bool("prefix", false, "Prefix each line with the task name")
+}
+
+// ANSI colors cycled through for task name prefixes
+var prefixColors = []string{"31", "32", "33", "34", "35", "36", "91", "92", "93", "94", "95", "96"}
+
+var logsCmd = &cobra.Command{
+	Use:   "logs [TASK_ID]",
+	Short: "Show logs of tasks.",
+	Long: `The logs command streams the logs of a single task, or of all tasks matching a label selector
+merged into a single stream by the manager. Following a single task relays its output live from
+its worker, the container's stderr going to stderr, and reconnects when the connection drops
+until the container exits.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, _ := cmd.Flags().GetString("manager")
+		selector, _ := cmd.Flags().GetString("selector")
+		follow, _ := cmd.Flags().GetBool("follow")
+		tail, _ := cmd.Flags().GetString("tail")
+		prefix, _ := cmd.Flags().GetBool("prefix")
+
+		if follow && len(args) == 1 {
+			followTaskLogs(apiClient(cmd), manager, args[0], tail)
+			return
+		}
+
+		q := url.Values{}
+		q.Set("follow", fmt.Sprintf("%t", follow))
+		q.Set("tail", tail)
+
+		path := "logs"
+		if len(args) == 1 {
+			path = fmt.Sprintf("tasks/%s/logs", args[0])
+			prefix = false
+		} else {
+			q.Set("selector", selector)
+			q.Set("prefix", fmt.Sprintf("%t", prefix))
+		}
+
+		resp, err := apiClient(cmd).Get(fmt.Sprintf("http://%s/%s?%s", manager, path, q.Encode()))
+		if err != nil {
+			log.Fatalf("Error connecting to %v: %v", manager, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("Error getting logs: %s", apiError(resp))
+		}
+
+		color := prefix && isTerminal(os.Stdout)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if color {
+				line = colorizePrefix(line)
+			}
+			fmt.Println(line)
+		}
+	},
+}
+
+// followTaskLogs prints the log stream of a task until its container exits
+func followTaskLogs(client *http.Client, manager string, taskID string, tail string) {
+	for {
+		resp, err := client.Get(fmt.Sprintf("http://%s/tasks/%s/logs/stream?tail=%s", manager, taskID, url.QueryEscape(tail)))
+		if err != nil {
+			log.Fatalf("Error connecting to %v: %v", manager, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("Error getting logs: %s", apiError(resp))
+		}
+
+		ended := false
+		failure := ""
+		utils.ReadSSE(resp.Body, func(event string, data string) error {
+			switch event {
+			case "stdout":
+				fmt.Println(data)
+			case "stderr":
+				fmt.Fprintln(os.Stderr, data)
+			case "error":
+				failure = data
+			case "end":
+				ended = true
+			}
+			return nil
+		})
+		resp.Body.Close()
+		if ended {
+			return
+		}
+		if failure != "" {
+			log.Fatalf("Error streaming logs: %s", failure)
+		}
+		// The connection dropped, only show new output after reconnecting
+		log.Printf("Log stream interrupted, reconnecting")
+		tail = "0"
+		time.Sleep(time.Second)
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// colorizePrefix colors a leading "[task-name]" with a color derived from the name
+func colorizePrefix(line string) string {
+	if !strings.HasPrefix(line, "[") {
+		return line
+	}
+	end := strings.Index(line, "]")
+	if end < 0 {
+		return line
+	}
+	h := fnv.New32a()
+	h.Write([]byte(line[1:end]))
+	c := prefixColors[h.Sum32()%uint32(len(prefixColors))]
+	return fmt.Sprintf("\x1b[%sm%s\x1b[0m%s", c, line[:end+1], line[end+1:])
+}
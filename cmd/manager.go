@@ -1,20 +1,63 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 
-	"cube/logging"
+	"cube/auth"
+	"cube/features"
 	"cube/manager"
 	managerApi "cube/manager/api"
+	"cube/platform"
+	"cube/rpc"
+	"cube/store"
+	"cube/systemd"
 )
 
 func init() {
 	rootCmd.AddCommand(managerCmd)
+	addLogFlags(managerCmd)
+	addConfigFlag(managerCmd)
 	managerCmd.Flags().StringP("host", "H", "0.0.0.0", "Hostname or IP address")
 	managerCmd.Flags().IntP("port", "p", 5555, "Port on which to listen")
 	managerCmd.Flags().StringSliceP("workers", "w", []string{"localhost:5556"}, "List of workers on which the manager will schedule tasks.")
-	managerCmd.Flags().StringP("scheduler", "s", "epvm", "Name of scheduler to use.")
-	managerCmd.Flags().StringP("dbType", "d", "memory", "Type of datastore to use for events and tasks (\"memory\" or \"persistent\")")
+	addSchedulerFlags(managerCmd)
+	managerCmd.Flags().StringP("dbType", "d", "memory", "Type of datastore to use for events and tasks (\"memory\", \"persistent\", \"sqlite\" or \"postgres\")")
+	managerCmd.Flags().String("db-dsn", "", "Data source name of the sqlite or postgres database (defaults to cube.db in the data directory for sqlite)")
+	managerCmd.Flags().String("data-dir", "", "Directory for persistent datastores (defaults to the platform data directory)")
+	addStoreFlags(managerCmd)
+	addNotifyFlags(managerCmd)
+	managerCmd.Flags().Int("max-in-flight", 4, "Maximum number of task events dispatched to workers concurrently")
+	managerCmd.Flags().Int("max-missed-heartbeats", 3, "Consecutive failed stats calls before a worker is marked down and its tasks rescheduled")
+	managerCmd.Flags().Int("node-restart-budget", 5, "Task restarts per node within 10 minutes before the node is considered flapping")
+	managerCmd.Flags().Int("max-restarts-per-node", 3, "Failed restarts of a task on the same node before it is rescheduled on another node (0 always restarts it in place)")
+	managerCmd.Flags().Duration("process-interval", 10*time.Second, "How often pending tasks are dispatched to workers")
+	managerCmd.Flags().Duration("update-interval", 15*time.Second, "How often task states are polled from workers")
+	managerCmd.Flags().Duration("health-check-interval", 60*time.Second, "How often failed tasks are checked for restarts")
+	managerCmd.Flags().Duration("stats-interval", 15*time.Second, "How often node stats are collected from workers")
+	managerCmd.Flags().Duration("task-retention", 24*time.Hour, "How long finished tasks and their events are kept before being deleted (0 keeps them forever)")
+	managerCmd.Flags().Duration("idempotency-ttl", 24*time.Hour, "How long task submissions are deduplicated by their Idempotency-Key header or task event ID (0 disables it)")
+	managerCmd.Flags().Float64("submit-rate", 0, "Task submissions admitted per second, others are refused with 429 Too Many Requests (0 disables rate limiting)")
+	managerCmd.Flags().Int("submit-burst", 10, "Task submissions admitted at once above --submit-rate")
+	managerCmd.Flags().Int("max-pending", 0, "Pending tasks waiting to be dispatched above which submissions are refused with 429 Too Many Requests (0 for no limit)")
+	managerCmd.Flags().Duration("max-unschedulable-age", time.Hour, "How long a task no worker can run is retried before it fails (0 retries forever)")
+	managerCmd.Flags().String("transport", rpc.HTTPTransport, fmt.Sprintf("Transport used for calls to workers (one of %v), workers must serve the same transport", rpc.Transports))
+	managerCmd.Flags().Bool("refuse-skewed-workers", false, "Do not schedule tasks on workers outside the supported version skew window")
+	managerCmd.Flags().String("feature-gates", "", "Comma separated list of Feature=bool pairs (e.g. PushUpdates=true,Services=false)")
+	managerCmd.Flags().Bool("ha", false, "Elect a leader among the managers sharing --data-dir, or the postgres --db-dsn, the others serve the API read-only until they take over")
+	managerCmd.Flags().String("advertise-address", "", "Address other managers forward requests to when this manager leads (defaults to the hostname and --port)")
+	managerCmd.Flags().Duration("lease-ttl", manager.DefaultLeaseTTL, "How long the leader lease lasts without being renewed")
+	managerCmd.Flags().Duration("shutdown-timeout", 30*time.Second, "Time to wait for in-flight requests and pending tasks on shutdown")
 }
 
 var managerCmd = &cobra.Command{
@@ -24,22 +67,210 @@ var managerCmd = &cobra.Command{
 - Accepting tasks from users
 - Scheduling tasks onto worker nodes
 - Rescheduling tasks in the event of a node failure
-- Periodically polling workers to get task updates`,
+- Periodically polling workers to get task updates
+
+SIGHUP, or POST /config/reload, reloads the workers and the scheduler settings
+from --config and --scheduler-config without restarting.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		cmdline := commandLineFlags(cmd)
+		applyConfigFile(cmd)
 		host, _ := cmd.Flags().GetString("host")
 		port, _ := cmd.Flags().GetInt("port")
 		workers, _ := cmd.Flags().GetStringSlice("workers")
-		scheduler, _ := cmd.Flags().GetString("scheduler")
 		dbType, _ := cmd.Flags().GetString("dbType")
+		dbDSN, _ := cmd.Flags().GetString("db-dsn")
+		refuseSkewed, _ := cmd.Flags().GetBool("refuse-skewed-workers")
+		dataDir, _ := cmd.Flags().GetString("data-dir")
+		restartBudget, _ := cmd.Flags().GetInt("node-restart-budget")
+		maxNodeRestarts, _ := cmd.Flags().GetInt("max-restarts-per-node")
+		maxInFlight, _ := cmd.Flags().GetInt("max-in-flight")
+		maxMissed, _ := cmd.Flags().GetInt("max-missed-heartbeats")
+		taskRetention, _ := cmd.Flags().GetDuration("task-retention")
+		maxUnschedulableAge, _ := cmd.Flags().GetDuration("max-unschedulable-age")
+		idempotencyTTL, _ := cmd.Flags().GetDuration("idempotency-ttl")
+		submitRate, _ := cmd.Flags().GetFloat64("submit-rate")
+		submitBurst, _ := cmd.Flags().GetInt("submit-burst")
+		maxPending, _ := cmd.Flags().GetInt("max-pending")
+		featureGates, _ := cmd.Flags().GetString("feature-gates")
+		shutdownTimeout, _ := cmd.Flags().GetDuration("shutdown-timeout")
+		transport, _ := cmd.Flags().GetString("transport")
+		ha, _ := cmd.Flags().GetBool("ha")
+		advertise, _ := cmd.Flags().GetString("advertise-address")
+		leaseTTL, _ := cmd.Flags().GetDuration("lease-ttl")
+		processInterval, _ := cmd.Flags().GetDuration("process-interval")
+		updateInterval, _ := cmd.Flags().GetDuration("update-interval")
+		healthCheckInterval, _ := cmd.Flags().GetDuration("health-check-interval")
+		statsInterval, _ := cmd.Flags().GetDuration("stats-interval")
+		token := authToken(cmd)
+		logger := setupLogging(cmd, "manager")
+
+		if err := features.Gates.Set(featureGates); err != nil {
+			fatal(logger, "Invalid --feature-gates", "error", err)
+		}
+		profile := schedulerProfile(cmd, logger)
+		checkIntervals(cmd, logger, "process-interval", "update-interval", "health-check-interval", "stats-interval")
+
+		logger.Info("Starting manager")
+		logger.Info("Feature gates", "gates", features.Gates.String())
+		dataDir, err := platform.DataDir(dataDir)
+		if err != nil {
+			fatal(logger, "Unable to create data directory", "error", err)
+		}
+		setupStoreEncryption(cmd, logger)
+		if dbType == store.Postgres && dbDSN == "" {
+			fatal(logger, "--dbType=postgres requires --db-dsn")
+		}
+
+		if token == "" {
+			logger.Warn("No --auth-token set, the manager API accepts unauthenticated requests")
+		}
+		client := auth.NewClient(token)
+		workerClient, err := rpc.NewWorkerClient(transport, token, client)
+		if err != nil {
+			fatal(logger, "Invalid --transport", "error", err)
+		}
+
+		var elector *manager.Elector
+		if ha {
+			if dbType != "persistent" && dbType != store.Postgres {
+				fatal(logger, "--ha requires --dbType=persistent on a data directory shared by the managers, or --dbType=postgres")
+			}
+			if advertise == "" {
+				hostname, _ := os.Hostname()
+				advertise = fmt.Sprintf("%s:%d", hostname, port)
+			}
+			var lease store.LeaseStore = store.NewLease(filepath.Join(dataDir, "leader.lease"), 0600)
+			if dbType == store.Postgres {
+				lease = openSQLLease(logger, dbType, dbDSN)
+			}
+			elector = manager.NewElector(lease, uuid.NewString(), advertise, leaseTTL)
+			if !campaign(logger, elector, managerApi.Follower{Address: host, Port: port, Elector: elector, AuthToken: token}) {
+				return
+			}
+		}
+
+		m, err := manager.New(workers, profile.Name, dbType, dataDir, dbDSN, client, workerClient)
+		if err != nil {
+			fatal(logger, "Unable to start manager", "dbType", dbType, "error", err)
+		}
+		m.SetScheduler(profile, profile.Name)
+		m.RefuseSkewedWorkers = refuseSkewed
+		m.NodeRestartBudget = restartBudget
+		m.MaxRestartsPerNode = maxNodeRestarts
+		m.MaxInFlight = maxInFlight
+		m.MaxMissedHeartbeats = maxMissed
+		m.TaskRetention = taskRetention
+		m.MaxUnschedulableAge = maxUnschedulableAge
+		m.IdempotencyTTL = idempotencyTTL
+		if submitRate < 0 || submitBurst < 1 || maxPending < 0 {
+			fatal(logger, "Invalid submission limits, expected --submit-rate and --max-pending of zero or more and a --submit-burst of at least one",
+				"submit-rate", submitRate, "submit-burst", submitBurst, "max-pending", maxPending)
+		}
+		m.SetSubmitLimit(submitRate, submitBurst)
+		m.MaxPending = maxPending
+		m.ProcessInterval = processInterval
+		m.UpdateInterval = updateInterval
+		m.HealthCheckInterval = healthCheckInterval
+		m.StatsInterval = statsInterval
+		m.LoadConfig = managerConfigLoader(cmd, cmdline)
+		notifier := setupNotifications(cmd, logger, m)
+		api := managerApi.Api{Address: host, Port: port, Manager: m, AuthToken: token, Elector: elector}
+
+		ctx, stopLoops := context.WithCancel(context.Background())
+		if elector != nil {
+			// Stop at once rather than schedule next to a new leader
+			go elector.Hold(ctx, func() { fatal(logger, "Lost the leader lease, exiting") })
+		}
+		loopFuncs := []func(context.Context){m.ProcessTasks, m.UpdateTasks, m.DoHealthChecks, m.UpdateNodeStats, m.ReconcileServices, m.ReconcileDeployments, m.RunCronJobs, m.CollectGarbage}
+		if notifier != nil {
+			loopFuncs = append(loopFuncs, notifier.Run)
+		}
+		var loops sync.WaitGroup
+		for _, loop := range loopFuncs {
+			loops.Add(1)
+			go func() {
+				defer loops.Done()
+				loop(ctx)
+			}()
+		}
+		go m.Watchdog.Run()
+		go reloadOnSignal(ctx, logger, m)
+		logger.Info("Starting manager API", "address", fmt.Sprintf("http://%s:%d", host, port))
+		served, err := api.Start()
+		if err != nil {
+			fatal(logger, "Unable to start manager API", "error", err)
+		}
+		if err := systemd.Notify(systemd.Ready); err != nil {
+			logger.Error("Error notifying systemd", "error", err)
+		}
 
-		logging.Info.Println("Starting manager...")
-		m := manager.New(workers, scheduler, dbType)
-		api := managerApi.Api{Address: host, Port: port, Manager: m}
-		go m.ProcessTasks()
-		go m.UpdateTasks()
-		go m.DoHealthChecks()
-		go m.UpdateNodeStats()
-		logging.Info.Printf("Starting manager API on http://%s:%d", host, port)
-		api.Start()
+		sig, err := waitForShutdown(served)
+		if err != nil {
+			fatal(logger, "Manager API stopped serving", "error", err)
+		}
+		logger.Info("Shutting down", "signal", sig)
+		systemd.Notify(systemd.Stopping)
+
+		// Stop accepting tasks first, then let the loops drain the pending queue
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := api.Stop(shutdownCtx); err != nil {
+			logger.Error("Error stopping manager API", "error", err)
+		}
+		stopLoops()
+		if !waitContext(shutdownCtx, loops.Wait) {
+			logger.Warn("Timed out waiting for manager loops to finish")
+		}
+		m.Close()
+		if elector != nil {
+			elector.Resign()
+		}
+		logger.Info("Shutdown complete")
 	},
 }
+
+// campaign serves the follower API until this manager holds the leader lease,
+// reporting false when it was stopped by a signal first
+func campaign(logger *slog.Logger, elector *manager.Elector, follower managerApi.Follower) bool {
+	logger.Info("Starting follower API", "address", fmt.Sprintf("http://%s:%d", follower.Address, follower.Port), "manager", elector.ID)
+	served, err := follower.Start()
+	if err != nil {
+		fatal(logger, "Unable to start follower API", "error", err)
+	}
+	systemd.Notify(systemd.Ready)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case err := <-served:
+			fatal(logger, "Follower API stopped serving", "error", err)
+		case <-ctx.Done():
+		}
+	}()
+	err = elector.Campaign(ctx)
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := follower.Stop(shutdownCtx); err != nil {
+		logger.Error("Error stopping follower API", "error", err)
+	}
+	if err != nil {
+		logger.Info("Shutdown complete")
+		return false
+	}
+	return true
+}
+
+// openSQLLease keeps the leader lease in the database the managers share
+func openSQLLease(logger *slog.Logger, dbType string, dsn string) *store.SQLLease {
+	db, err := store.OpenSQL(dbType, dsn)
+	if err != nil {
+		fatal(logger, "Unable to open leader lease", "error", err)
+	}
+	lease, err := store.NewSQLLease(db, dbType)
+	if err != nil {
+		fatal(logger, "Unable to open leader lease", "error", err)
+	}
+	return lease
+}
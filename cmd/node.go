@@ -1,41 +1,222 @@
 package cmd
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
+	"strings"
 	"text/tabwriter"
+	"time"
 
+	"github.com/docker/go-units"
 	"github.com/spf13/cobra"
 
+	"cube/manager"
 	"cube/node"
 )
 
 func init() {
 	rootCmd.AddCommand(nodeCmd)
 	nodeCmd.Flags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
+	nodeCmd.AddCommand(nodeListCmd)
+	nodeListCmd.Flags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
+	nodeCmd.AddCommand(nodeDescribeCmd)
+	nodeDescribeCmd.Flags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
+	nodeCmd.AddCommand(drainCmd)
+	drainCmd.Flags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
+	drainCmd.Flags().Bool("evict", false, "Reschedule the node's tasks to other nodes")
+	drainCmd.Flags().Bool("undo", false, "Lift the drain and enable scheduling again")
+	nodeCmd.AddCommand(uncordonCmd)
+	uncordonCmd.Flags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
 }
 
 var nodeCmd = &cobra.Command{
 	Use:   "node",
 	Short: "Node command to list nodes.",
-	Long:  `The node command allows a user to get the information about the nodes in the cluster.`,
+	Long: `The node command allows a user to get the information about the nodes in the cluster.
+Without a subcommand it lists the nodes, like node list.`,
+	Run: listNodes,
+}
+
+var nodeListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the nodes of the cluster.",
+	Long:  `The list command prints the capacity, allocation, task count and health of every node.`,
+	Args:  cobra.NoArgs,
+	Run:   listNodes,
+}
+
+func listNodes(cmd *cobra.Command, args []string) {
+	manager, _ := cmd.Flags().GetString("manager")
+
+	url := fmt.Sprintf("http://%s/nodes", manager)
+	resp, err := apiClient(cmd).Get(url)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	var nodes []node.Info
+	json.Unmarshal(body, &nodes)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
+	fmt.Fprintln(w, "NAME\tSTATUS\tCPUS\tCPU ALLOCATED\tCPU USED\tMEMORY (MiB)\tDISK (GiB)\tROLE\tTASKS\tLAST STATS\t")
+	for _, n := range nodes {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%.2f\t%.2f\t%d\t%d\t%s\t%d\t%s\t\n", n.Name, nodeStatus(n), n.Cores, n.CpuAllocated, n.TaskCpuUsage, n.Memory/1000, n.Disk/1000/1000/1000, n.Role, n.TaskCount, lastStats(n))
+	}
+	w.Flush()
+}
+
+var nodeDescribeCmd = &cobra.Command{
+	Use:   "describe NAME",
+	Short: "Show the details of a node.",
+	Long: `The describe command prints a node's capacity and allocation, its health,
+the tasks placed on it and its recent events.`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		manager, _ := cmd.Flags().GetString("manager")
+		// Named apart from the manager package, which defines the response
+		addr, _ := cmd.Flags().GetString("manager")
 
-		url := fmt.Sprintf("http://%s/nodes", manager)
-		resp, _ := http.Get(url)
+		url := fmt.Sprintf("http://%s/nodes/%s", addr, args[0])
+		resp, err := apiClient(cmd).Get(url)
+		if err != nil {
+			log.Fatalf("Error connecting to %v: %v", addr, err)
+		}
 		defer resp.Body.Close()
-		body, _ := io.ReadAll(resp.Body)
-		var nodes []*node.Node
-		json.Unmarshal(body, &nodes)
-		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
-		fmt.Fprintln(w, "NAME\tMEMORY (MiB)\tDISK (GiB)\tROLE\tTASKS\t")
-		for _, node := range nodes {
-			fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%d\t\n", node.Name, node.Memory/1000, node.Disk/1000/1000/1000, node.Role, node.TaskCount)
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("Error describing node %v: %s", args[0], apiError(resp))
+		}
+		var n manager.NodeDetail
+		json.NewDecoder(resp.Body).Decode(&n)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "Name:\t%s\n", n.Name)
+		fmt.Fprintf(w, "Api:\t%s\n", n.Api)
+		fmt.Fprintf(w, "Role:\t%s\n", n.Role)
+		fmt.Fprintf(w, "Version:\t%s\n", n.Version)
+		if n.OS != "" {
+			fmt.Fprintf(w, "Platform:\t%s/%s\n", n.OS, n.Arch)
+		}
+		fmt.Fprintf(w, "Status:\t%s\n", nodeStatus(n.Info))
+		fmt.Fprintf(w, "Last stats:\t%s\n", lastStats(n.Info))
+		fmt.Fprintf(w, "Labels:\t%s\n", formatLabels(n.Labels))
+		fmt.Fprintf(w, "Capabilities:\t%s\n", strings.Join(n.Capabilities, ","))
+		fmt.Fprintln(w, "Capacity:\t")
+		fmt.Fprintf(w, "  CPUs:\t%d, %.2f allocated, %.2f used by tasks, %.0f%% busy\n", n.Cores, n.CpuAllocated, n.TaskCpuUsage, n.CpuUsage*100)
+		fmt.Fprintf(w, "  Memory:\t%d MiB, %d MiB allocated, %d MiB used by tasks\n", n.Memory/1000, n.MemoryAllocated/1000, n.TaskMemoryUsage/1024/1024)
+		fmt.Fprintf(w, "  Disk:\t%d GiB, %d GiB allocated\n", n.Disk/1000/1000/1000, n.DiskAllocated/1000/1000/1000)
+		if n.Gpus > 0 {
+			fmt.Fprintf(w, "  GPUs:\t%d, %d allocated\n", n.Gpus, n.GpusAllocated)
+		}
+		maxTasks := "unlimited"
+		if n.MaxTasks > 0 {
+			maxTasks = fmt.Sprint(n.MaxTasks)
+		}
+		fmt.Fprintf(w, "  Tasks:\t%d, %d allocated, max %s\n", n.TaskCount, n.TasksAllocated, maxTasks)
+		fmt.Fprintln(w, "Health:\t")
+		fmt.Fprintf(w, "  Missed heartbeats:\t%d\n", n.MissedHeartbeats)
+		fmt.Fprintf(w, "  Flapping:\t%t\n", n.Flapping)
+		fmt.Fprintf(w, "  Version skewed:\t%t\n", n.VersionSkewed)
+		fmt.Fprintf(w, "  Queue length:\t%d\n", n.QueueLength)
+		fmt.Fprintf(w, "  Running containers:\t%d\n", n.RunningContainers)
+		if n.RuntimeError != "" {
+			fmt.Fprintf(w, "  Runtime error:\t%s\n", n.RuntimeError)
+		}
+		w.Flush()
+
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
+		fmt.Fprintln(w, "TASK ID\tNAME\tSTATE\tIMAGE\tRESTARTS\t")
+		for _, t := range n.Tasks {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t\n", t.ID, t.Name, t.State, t.Image, t.RestartCount)
 		}
 		w.Flush()
+
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
+		fmt.Fprintln(w, "TIME\tREASON\tMESSAGE\t")
+		for _, e := range n.Events {
+			fmt.Fprintf(w, "%s ago\t%s\t%s\t\n", units.HumanDuration(time.Since(e.Timestamp)), e.Reason, e.Message)
+		}
+		w.Flush()
+	},
+}
+
+var drainCmd = &cobra.Command{
+	Use:   "drain NAME",
+	Short: "Drain a node for maintenance.",
+	Long: `The drain command cordons a node so no new tasks are scheduled on it.
+With --evict its running tasks are rescheduled to other nodes, --undo lifts the drain.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, _ := cmd.Flags().GetString("manager")
+		evict, _ := cmd.Flags().GetBool("evict")
+		undo, _ := cmd.Flags().GetBool("undo")
+
+		data, _ := json.Marshal(node.DrainRequest{Drained: !undo, Evict: evict && !undo})
+		url := fmt.Sprintf("http://%s/nodes/%s/drain", manager, args[0])
+		req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(data))
+		if err != nil {
+			log.Fatalf("Error creating request %v: %v", url, err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := apiClient(cmd).Do(req)
+		if err != nil {
+			log.Fatalf("Error connecting to %v: %v", manager, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("Error draining node %v: %s", args[0], apiError(resp))
+		}
+		var n node.Info
+		json.NewDecoder(resp.Body).Decode(&n)
+		log.Printf("Node %v is %s.", n.Name, nodeStatus(n))
+	},
+}
+
+var uncordonCmd = &cobra.Command{
+	Use:   "uncordon NAME",
+	Short: "Enable scheduling on a drained node.",
+	Long:  `The uncordon command lifts the drain of a node, like drain --undo.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, _ := cmd.Flags().GetString("manager")
+
+		url := fmt.Sprintf("http://%s/nodes/%s/uncordon", manager, args[0])
+		req, err := http.NewRequest(http.MethodPut, url, nil)
+		if err != nil {
+			log.Fatalf("Error creating request %v: %v", url, err)
+		}
+		resp, err := apiClient(cmd).Do(req)
+		if err != nil {
+			log.Fatalf("Error connecting to %v: %v", manager, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("Error uncordoning node %v: %s", args[0], apiError(resp))
+		}
+		var n node.Info
+		json.NewDecoder(resp.Body).Decode(&n)
+		log.Printf("Node %v is %s.", n.Name, nodeStatus(n))
 	},
 }
+
+// lastStats returns how long ago the manager last got the stats of a node
+func lastStats(n node.Info) string {
+	if n.LastStats.IsZero() {
+		return "never"
+	}
+	return fmt.Sprintf("%s ago", units.HumanDuration(time.Since(n.LastStats)))
+}
+
+// nodeStatus returns the liveness of a node, flagging cordoned nodes
+func nodeStatus(n node.Info) string {
+	status := string(n.Status)
+	if n.Cordoned {
+		status += ",SchedulingDisabled"
+	}
+	return status
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"cube/manager"
+	"cube/notify"
+)
+
+// notifySecretEnv holds the webhook signing secret when --notify-secret is not set
+const notifySecretEnv = "CUBE_NOTIFY_SECRET"
+
+// addNotifyFlags registers the task notification flags of commands running a manager
+func addNotifyFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("notify-url", nil, "Webhook URLs notified when tasks fail, complete or use up their restart budget")
+	cmd.Flags().String("notify-secret", "", "Secret --notify-url payloads are signed with (defaults to $"+notifySecretEnv+")")
+	cmd.Flags().String("notify-config", "", "JSON file with webhook, Slack and email receivers of task notifications")
+}
+
+// setupNotifications subscribes the configured receivers to task notifications of
+// m, returning nil when there are none
+func setupNotifications(cmd *cobra.Command, logger *slog.Logger, m *manager.Manager) *notify.Notifier {
+	urls, _ := cmd.Flags().GetStringSlice("notify-url")
+	secret, _ := cmd.Flags().GetString("notify-secret")
+	configFile, _ := cmd.Flags().GetString("notify-config")
+	if secret == "" {
+		secret = os.Getenv(notifySecretEnv)
+	}
+
+	// Receivers are outside the cluster, they do not get the cluster token
+	n := notify.New()
+	if configFile != "" {
+		cfg, err := notify.LoadConfig(configFile)
+		if err != nil {
+			fatal(logger, "Invalid --notify-config", "error", err)
+		}
+		cfg.Apply(n, nil)
+	}
+	for _, u := range urls {
+		if err := notify.ValidURL(u); err != nil {
+			fatal(logger, "Invalid --notify-url", "error", err)
+		}
+		n.Subscribe(&notify.Webhook{URL: u, Secret: secret})
+	}
+	if !n.Enabled() {
+		return nil
+	}
+	m.EnableNotifications(n)
+	logger.Info("Task notifications enabled")
+	return n
+}
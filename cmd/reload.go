@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"cube/manager"
+)
+
+// Flags of the manager a reload applies
+var reloadableFlags = []string{"workers", "scheduler-profile", "scheduler-config"}
+
+// managerConfigLoader returns the manager's LoadConfig, reading the workers and the
+// scheduler again from the --config and --scheduler-config files
+func managerConfigLoader(cmd *cobra.Command, cmdline map[string]bool) func() (manager.ReloadConfig, error) {
+	return func() (manager.ReloadConfig, error) {
+		if err := reloadConfigFile(cmd, cmdline, reloadableFlags...); err != nil {
+			return manager.ReloadConfig{}, err
+		}
+		profile, err := loadSchedulerProfile(cmd)
+		if err != nil {
+			return manager.ReloadConfig{}, err
+		}
+		workers, _ := cmd.Flags().GetStringSlice("workers")
+		return manager.ReloadConfig{Workers: workers, Scheduler: profile, SchedulerType: profile.Name}, nil
+	}
+}
+
+// reloadOnSignal reloads the manager's configuration on every SIGHUP until ctx is done
+func reloadOnSignal(ctx context.Context, logger *slog.Logger, m *manager.Manager) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	defer signal.Stop(sig)
+	for {
+		select {
+		case <-sig:
+			logger.Info("Reloading configuration", "signal", "SIGHUP")
+			if _, err := m.ReloadConfig(); err != nil {
+				logger.Error("Error reloading configuration, keeping the current one", "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
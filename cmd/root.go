@@ -8,6 +8,8 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+
+	"cube/auth"
 )
 
 
@@ -42,6 +44,7 @@ func init() {
 	// will be global for your application.
 
 	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.cube.yaml)")
+	rootCmd.PersistentFlags().String("auth-token", "", "Bearer token for the manager and worker APIs (defaults to $"+auth.TokenEnv+")")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -2,21 +2,30 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/spf13/cobra"
+
+	"cube/task"
+	"cube/validation"
 )
 
 func init() {
 	rootCmd.AddCommand(runCmd)
 	runCmd.Flags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
 	runCmd.Flags().StringP("filename", "f", "task.json", "Task specification file")
+	runCmd.Flags().Bool("wait", false, "Wait for the task to finish and exit with its exit code")
+	runCmd.Flags().Bool("attach", false, "Stream the task's logs while waiting (implies --wait)")
 }
 
 func fileExists(filename string) bool {
@@ -32,6 +41,8 @@ var runCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		manager, _ := cmd.Flags().GetString("manager")
 		filename, _ := cmd.Flags().GetString("filename")
+		wait, _ := cmd.Flags().GetBool("wait")
+		attach, _ := cmd.Flags().GetBool("attach")
 
 		fullFilePath, err := filepath.Abs(filename)
 		if err != nil {
@@ -51,17 +62,99 @@ var runCmd = &cobra.Command{
 		}
 		log.Printf("Data: %v\n", string(data))
 
+		te := task.TaskEvent{}
+		if err := json.Unmarshal(data, &te); err != nil {
+			log.Fatalf("Unable to parse task specification: %v", err)
+		}
+		if errs := validation.ValidateTaskEvent(te); errs != nil {
+			for _, e := range errs {
+				log.Printf("Invalid task: %v", e)
+			}
+			os.Exit(1)
+		}
+
+		client := apiClient(cmd)
 		url := fmt.Sprintf("http://%s/tasks", manager)
-		resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+		resp, err := client.Post(url, "application/json", bytes.NewBuffer(data))
 		if err != nil {
-			log.Panic(err)
+			log.Fatalf("Error connecting to %v: %v", manager, err)
 		}
+		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusCreated {
-			log.Printf("Error sending request: %v", resp.StatusCode)
+			log.Fatalf("Error submitting task: %s", apiError(resp))
 		}
-
-		defer resp.Body.Close()
 		log.Println("Successfully sent task request to manager")
+
+		if !wait && !attach {
+			return
+		}
+		t := task.Task{}
+		if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+			log.Fatalf("Unable to decode manager response: %v", err)
+		}
+		os.Exit(waitForTask(client, manager, t.ID, attach))
 	},
 }
+
+// waitForTask polls the manager until the task finishes, optionally streaming its logs,
+// and returns the exit code the CLI should exit with
+func waitForTask(client *http.Client, manager string, id uuid.UUID, attach bool) int {
+	attached := false
+	for {
+		t, err := fetchTask(client, manager, id)
+		if err != nil {
+			log.Printf("Error getting task %v: %v", id, err)
+		}
+
+		if t != nil {
+			if attach && !attached && t.ContainerID != "" && t.State >= task.Running {
+				attached = true
+				streamTaskLogs(client, manager, id)
+			}
+
+			switch t.State {
+			case task.Completed:
+				return t.ExitCode
+			case task.Failed:
+				if t.ExitCode != 0 {
+					return t.ExitCode
+				}
+				return 1
+			case task.Stopped:
+				// Stopped through the API before finishing
+				return 1
+			}
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func fetchTask(client *http.Client, manager string, id uuid.UUID) (*task.Task, error) {
+	resp, err := client.Get(fmt.Sprintf("http://%s/tasks", manager))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var tasks []*task.Task
+	if err := json.NewDecoder(resp.Body).Decode(&tasks); err != nil {
+		return nil, err
+	}
+	for _, t := range tasks {
+		if t.ID == id {
+			return t, nil
+		}
+	}
+	return nil, nil
+}
+
+func streamTaskLogs(client *http.Client, manager string, id uuid.UUID) {
+	resp, err := client.Get(fmt.Sprintf("http://%s/tasks/%s/logs?follow=true", manager, id))
+	if err != nil {
+		log.Printf("Error attaching to task %v: %v", id, err)
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(os.Stdout, resp.Body)
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"cube/scheduler"
+)
+
+// addSchedulerFlags registers the scheduler flags of the commands running a manager
+func addSchedulerFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("scheduler-profile", "s", "epvm", fmt.Sprintf("Scheduler profile composing filter and score plugins (built in: %s, more can be defined in --scheduler-config)", strings.Join(scheduler.BuiltinProfiles(), ", ")))
+	cmd.Flags().String("scheduler-config", "", "JSON file with scheduler settings, e.g. the E-PVM cost weights and custom profiles")
+	cmd.Flags().String("scheduler", "", "Name of scheduler to use")
+	cmd.Flags().MarkDeprecated("scheduler", "use --scheduler-profile instead")
+}
+
+// schedulerProfile builds the profile selected by the scheduler flags, exiting when
+// the configuration or the profile is invalid
+func schedulerProfile(cmd *cobra.Command, logger *slog.Logger) *scheduler.Profile {
+	profile, err := loadSchedulerProfile(cmd)
+	if err != nil {
+		fatal(logger, "Invalid scheduler settings", "error", err)
+	}
+	return profile
+}
+
+// loadSchedulerProfile builds the profile selected by the scheduler flags, reading
+// --scheduler-config again
+func loadSchedulerProfile(cmd *cobra.Command) (*scheduler.Profile, error) {
+	name, _ := cmd.Flags().GetString("scheduler-profile")
+	if old, _ := cmd.Flags().GetString("scheduler"); old != "" && !cmd.Flags().Changed("scheduler-profile") {
+		name = old
+	}
+	cfg := scheduler.DefaultConfig()
+	if file, _ := cmd.Flags().GetString("scheduler-config"); file != "" {
+		var err error
+		if cfg, err = scheduler.LoadConfig(file); err != nil {
+			return nil, fmt.Errorf("--scheduler-config: %v", err)
+		}
+	}
+	profile, err := scheduler.NewProfile(name, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("--scheduler-profile: %v", err)
+	}
+	return profile, nil
+}
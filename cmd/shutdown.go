@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// waitForShutdown blocks until the process receives SIGINT or SIGTERM, returning the
+// signal, or until one of the servers fails, returning its error
+func waitForShutdown(servers ...<-chan error) (os.Signal, error) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	failed := make(chan error, len(servers))
+	for _, s := range servers {
+		go func() {
+			if err, ok := <-s; ok {
+				failed <- err
+			}
+		}()
+	}
+	select {
+	case s := <-sig:
+		return s, nil
+	case err := <-failed:
+		return nil, err
+	}
+}
+
+// waitContext runs wait and blocks until it returns or ctx expires,
+// reporting whether wait completed in time
+func waitContext(ctx context.Context, wait func()) bool {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
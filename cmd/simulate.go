@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"cube/scheduler"
+	"cube/scheduler/simulator"
+)
+
+func init() {
+	rootCmd.AddCommand(simulateCmd)
+	simulateCmd.Flags().String("scenario", "", "JSON file with the nodes and tasks to simulate (defaults to a small mixed cluster)")
+	simulateCmd.Flags().String("scheduler-config", "", "JSON file with scheduler settings, e.g. the E-PVM cost weights and custom profiles")
+	simulateCmd.Flags().Float64("background-cpu", 0, "Random CPU usage, as a share of each node's cores, added to the tasks' requests in node stats")
+	simulateCmd.Flags().Float64("background-memory", 0, "Random memory usage, as a share of each node's memory, added to the tasks' requests in node stats")
+	simulateCmd.Flags().Uint64("seed", 1, "Seed of the random node stats")
+	simulateCmd.Flags().Int("max-failures", 10, "Failed tasks listed per scheduler profile")
+	simulateCmd.Flags().Bool("json", false, "Print the reports as JSON")
+}
+
+var simulateCmd = &cobra.Command{
+	Use:   "simulate [PROFILE...]",
+	Short: "Compare scheduler profiles on a synthetic cluster.",
+	Long: fmt.Sprintf(`The simulate command places the tasks of a scenario on synthetic nodes with each
+scheduler profile, every built-in one without arguments (%s), and reports
+where the tasks landed and why the others could not be placed. No manager or
+worker is involved. A scenario lists node and task specs, e.g.
+
+  {"Nodes": [{"Name": "small", "Count": 3, "Cores": 2, "Memory": 4294967296, "Disk": 53687091200}],
+   "Tasks": [{"Count": 10, "Lifetime": 5, "Task": {"Name": "job", "Image": "alpine", "Cpu": 0.5}}]}
+
+Tasks are submitted in order, a task with a Lifetime finishes after that many
+more submissions and frees its resources.`, strings.Join(scheduler.BuiltinProfiles(), ", ")),
+	Run: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("scenario")
+		backgroundCpu, _ := cmd.Flags().GetFloat64("background-cpu")
+		backgroundMemory, _ := cmd.Flags().GetFloat64("background-memory")
+		seed, _ := cmd.Flags().GetUint64("seed")
+		maxFailures, _ := cmd.Flags().GetInt("max-failures")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		scenario := simulator.DefaultScenario()
+		if file != "" {
+			var err error
+			if scenario, err = simulator.LoadScenario(file); err != nil {
+				log.Fatalf("Invalid --scenario: %v", err)
+			}
+		}
+		cfg := scheduler.DefaultConfig()
+		if file, _ := cmd.Flags().GetString("scheduler-config"); file != "" {
+			var err error
+			if cfg, err = scheduler.LoadConfig(file); err != nil {
+				log.Fatalf("Invalid --scheduler-config: %v", err)
+			}
+		}
+		if len(args) == 0 {
+			args = scheduler.BuiltinProfiles()
+		}
+
+		// Every profile gets the same workload and the same stats
+		workload := scenario.Workload()
+		var reports []simulator.Report
+		for _, name := range args {
+			profile, err := scheduler.NewProfile(name, cfg)
+			if err != nil {
+				log.Fatal(err)
+			}
+			sim := simulator.Simulation{Name: name, Scheduler: profile, Nodes: scenario.GenerateNodes()}
+			if backgroundCpu > 0 || backgroundMemory > 0 {
+				sim.Stats = simulator.NewRandomStats(seed, backgroundCpu, backgroundMemory)
+			}
+			reports = append(reports, sim.Run(workload))
+		}
+
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(reports)
+			return
+		}
+		for i, r := range reports {
+			if i > 0 {
+				fmt.Println()
+			}
+			r.Write(os.Stdout, maxFailures)
+		}
+	},
+}
@@ -4,13 +4,16 @@ import (
 	"cube/task"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"strings"
 	"text/tabwriter"
 	"time"
 
+	"github.com/docker/go-connections/nat"
 	"github.com/docker/go-units"
 	"github.com/spf13/cobra"
 )
@@ -18,31 +21,61 @@ import (
 func init() {
 	rootCmd.AddCommand(statusCmd)
 	statusCmd.Flags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
+	statusCmd.Flags().StringP("selector", "l", "", "Only show tasks matching a label selector (e.g. app=web)")
+	statusCmd.Flags().BoolP("quiet", "q", false, "Only show task IDs")
+	statusCmd.Flags().Bool("show-labels", false, "Show the labels of the tasks in the last column")
 }
 
 var statusCmd = &cobra.Command{
-	Use:   "status",
+	Use:   "status [TASK_ID...]",
 	Short: "Status command to list tasks.",
-	Long:  `The status command allows a user to get the status of tasks from the Cube manager.`,
+	Long: `The status command allows a user to get the status of tasks from the Cube manager,
+optionally restricted to the given task IDs or a label selector.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		manager, _ := cmd.Flags().GetString("manager")
+		selector, _ := cmd.Flags().GetString("selector")
+		quiet, _ := cmd.Flags().GetBool("quiet")
+		showLabels, _ := cmd.Flags().GetBool("show-labels")
 
-		url := fmt.Sprintf("http://%s/tasks", manager)
-		resp, _ := http.Get(url)
-		body, err := io.ReadAll(resp.Body)
+		if _, err := task.ParseSelector(selector); err != nil {
+			log.Fatalf("Invalid selector: %v", err)
+		}
+
+		// The manager filters the tasks by the selector
+		u := fmt.Sprintf("http://%s/tasks", manager)
+		if selector != "" {
+			u += "?label=" + url.QueryEscape(selector)
+		}
+		resp, err := apiClient(cmd).Get(u)
 		if err != nil {
-			log.Fatal(err)
+			log.Fatalf("Error connecting to %v: %v", manager, err)
 		}
 		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("Error getting tasks: %s", apiError(resp))
+		}
 
 		var tasks []*task.Task
-		err = json.Unmarshal(body, &tasks)
-		if err != nil {
+		if err := json.NewDecoder(resp.Body).Decode(&tasks); err != nil {
 			log.Fatal(err)
 		}
 
+		tasks = slices.DeleteFunc(tasks, func(t *task.Task) bool {
+			return len(args) > 0 && !slices.Contains(args, t.ID.String())
+		})
+		if quiet {
+			for _, t := range tasks {
+				fmt.Println(t.ID)
+			}
+			return
+		}
+
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
-		fmt.Fprintln(w, "ID\tNAME\tCREATED\tSTATE\tCONTAINERNAME\tIMAGE\t")
+		header := "ID\tNAME\tCREATED\tSTATE\tQOS\tCPU %\tMEMORY (MiB)\tCONTAINERNAME\tIMAGE\tPORTS\t"
+		if showLabels {
+			header += "LABELS\t"
+		}
+		fmt.Fprintln(w, header)
 		for _, task := range tasks {
 			var start string
 			if task.StartTime.IsZero() {
@@ -51,9 +84,45 @@ var statusCmd = &cobra.Command{
 				start = fmt.Sprintf("%s ago", units.HumanDuration(time.Now().UTC().Sub(task.StartTime)))
 			}
 
-			state := task.State.String()[task.State]
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t\n", task.ID, task.Name, start, state, task.Name, task.Image)
+			cpu, memory := "-", "-"
+			if task.Usage != nil {
+				cpu = fmt.Sprintf("%.1f", task.Usage.CpuPercent)
+				memory = fmt.Sprintf("%d", task.Usage.MemoryUsage/1024/1024)
+			}
+			state := task.State.String()
+			if task.FailureReason != "" {
+				state = fmt.Sprintf("%s (%s)", state, task.FailureReason)
+			} else if len(task.Conditions) > 0 {
+				state = fmt.Sprintf("%s (%s)", state, task.Conditions[0].Type)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t", task.ID, task.Name, start, state, task.QoSClass, cpu, memory, task.ContainerName, task.Image, formatPorts(task.HostPorts))
+			if showLabels {
+				fmt.Fprintf(w, "%s\t", formatLabels(task.Labels))
+			}
+			fmt.Fprintln(w)
 		}
 		w.Flush()
 	},
 }
+
+// formatPorts renders host port bindings like docker ps, e.g. "0.0.0.0:32768->80/tcp"
+func formatPorts(ports nat.PortMap) string {
+	var out []string
+	for port, bindings := range ports {
+		for _, b := range bindings {
+			out = append(out, fmt.Sprintf("%s:%s->%s", b.HostIP, b.HostPort, port))
+		}
+	}
+	slices.Sort(out)
+	return strings.Join(out, ", ")
+}
+
+// formatLabels renders labels sorted by key, e.g. "app=web,tier=frontend"
+func formatLabels(labels map[string]string) string {
+	out := make([]string, 0, len(labels))
+	for k, v := range labels {
+		out = append(out, k+"="+v)
+	}
+	slices.Sort(out)
+	return strings.Join(out, ",")
+}
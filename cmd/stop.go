@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/spf13/cobra"
 )
@@ -14,28 +15,37 @@ func init() {
 }
 
 var stopCmd = &cobra.Command{
-	Use:   "stop",
+	Use:   "stop TASK_ID [TASK_ID...]",
 	Short: "Stop a running task.",
-	Long:  `The stop command stops a running task.`,
+	Long:  `The stop command stops one or more running tasks.`,
 	Args:  cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		manager, _ := cmd.Flags().GetString("manager")
-		url := fmt.Sprintf("http://%s/tasks/%s", manager, args[0])
-		client := &http.Client{}
-		req, err := http.NewRequest("DELETE", url, nil)
-		if err != nil {
-			log.Printf("Error creating request %v: %v", url, err)
-		}
+		client := apiClient(cmd)
 
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Printf("Error connecting to %v: %v", url, err)
-		}
+		failed := false
+		for _, id := range args {
+			url := fmt.Sprintf("http://%s/tasks/%s", manager, id)
+			req, err := http.NewRequest("DELETE", url, nil)
+			if err != nil {
+				log.Fatalf("Error creating request %v: %v", url, err)
+			}
 
-		if resp.StatusCode != http.StatusNoContent {
-			log.Printf("Error sending request: %v", err)
+			resp, err := client.Do(req)
+			if err != nil {
+				log.Fatalf("Error connecting to %v: %v", manager, err)
+			}
+			if resp.StatusCode != http.StatusNoContent {
+				log.Printf("Error stopping task %v: %s", id, apiError(resp))
+				resp.Body.Close()
+				failed = true
+				continue
+			}
+			resp.Body.Close()
+			log.Printf("Task %v is stopping.", id)
+		}
+		if failed {
+			os.Exit(1)
 		}
-
-		log.Printf("Task %v has been stopped.", args[0])
 	},
 }
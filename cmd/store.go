@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+
+	"cube/platform"
+	"cube/store"
+)
+
+func init() {
+	rootCmd.AddCommand(storeCmd)
+	storeCmd.AddCommand(compactCmd)
+	compactCmd.Flags().String("data-dir", "", "Directory of the persistent datastores (defaults to the platform data directory)")
+}
+
+// addStoreFlags registers the persistent store flags of long running commands
+func addStoreFlags(cmd *cobra.Command) {
+	cmd.Flags().String("store-key-file", "", fmt.Sprintf("File with the base64 encoded 32 byte key persistent datastores are encrypted with (defaults to $%s)", store.KeyEnv))
+}
+
+// setupStoreEncryption loads the store encryption key, exiting when it is invalid
+func setupStoreEncryption(cmd *cobra.Command, logger *slog.Logger) {
+	keyFile, _ := cmd.Flags().GetString("store-key-file")
+	encrypted, err := store.ConfigureEncryption(keyFile)
+	if err != nil {
+		fatal(logger, "Invalid store encryption key", "error", err)
+	}
+	if encrypted {
+		logger.Info("Persistent datastores are encrypted")
+	}
+}
+
+var storeCmd = &cobra.Command{
+	Use:   "store",
+	Short: "Persistent datastore maintenance.",
+	Long:  `The store command groups maintenance commands for the persistent datastores.`,
+}
+
+var compactCmd = &cobra.Command{
+	Use:   "compact [FILE...]",
+	Short: "Compact persistent datastores.",
+	Long: `The compact command rewrites persistent datastores to reclaim the space left by
+deleted tasks and events. Without arguments every .db file in the data directory is
+compacted. The manager or worker using a datastore must be stopped first.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		files := args
+		if len(files) == 0 {
+			dataDir, _ := cmd.Flags().GetString("data-dir")
+			dataDir, err := platform.DataDir(dataDir)
+			if err != nil {
+				log.Fatalf("Unable to open data directory: %v", err)
+			}
+			files, _ = filepath.Glob(filepath.Join(dataDir, "*.db"))
+			if len(files) == 0 {
+				log.Printf("No datastores found in %s.", dataDir)
+				return
+			}
+		}
+
+		failed := false
+		for _, f := range files {
+			result, err := store.Compact(f)
+			if err != nil {
+				log.Printf("Error compacting %s: %v", f, err)
+				failed = true
+				continue
+			}
+			log.Printf("Compacted %s from %s to %s.", f, units.BytesSize(float64(result.Before)), units.BytesSize(float64(result.After)))
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
@@ -4,22 +4,60 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 
+	"cube/auth"
+	"cube/features"
+	"cube/platform"
+	"cube/rpc"
+	"cube/stats"
+	"cube/systemd"
+	"cube/task"
+	"cube/validation"
 	"cube/worker"
 	workerApi "cube/worker/api"
 )
 
 func init() {
 	rootCmd.AddCommand(workerCmd)
+	addLogFlags(workerCmd)
+	addConfigFlag(workerCmd)
 	workerCmd.Flags().StringP("host", "H", "0.0.0.0", "Hostname or IP address")
 	workerCmd.Flags().IntP("port", "p", 5556, "Port on which to listen")
 	workerCmd.Flags().StringP("name", "n", fmt.Sprintf("worker-%s", uuid.New().String()), "Name of the worker")
 	workerCmd.Flags().StringP("dbtype", "d", "memory", "Type of datastore to use for tasks (\"memory\" or \"persistent\")")
+	workerCmd.Flags().String("data-dir", "", "Directory for persistent datastores (defaults to the platform data directory)")
+	addStoreFlags(workerCmd)
+	workerCmd.Flags().Float64("eviction-threshold", 90, "Host memory used percent above which BestEffort and Burstable tasks are evicted (0 disables)")
+	workerCmd.Flags().String("runtime", task.DockerRuntime, fmt.Sprintf("Container runtime to run tasks with (one of %v)", task.Runtimes))
+	workerCmd.Flags().String("transport", rpc.HTTPTransport, fmt.Sprintf("Transport the manager calls this worker with (one of %v), grpc is served next to the HTTP API", rpc.Transports))
+	workerCmd.Flags().StringToString("labels", nil, "Node labels tasks can select through NodeSelector and Constraints (e.g. zone=eu-west,gpu=true)")
+	workerCmd.Flags().StringSlice("capabilities", nil, "Capabilities of this node tasks can require, in addition to those of the build (e.g. gpu)")
+	workerCmd.Flags().StringSlice("allowed-bind-paths", nil, "Host directories tasks may bind mount (bind mounts are refused when empty)")
+	workerCmd.Flags().String("registry-config", "", "JSON file with the credentials of private registries, keyed by registry domain")
+	workerCmd.Flags().Duration("run-interval", 10*time.Second, "How often queued tasks are checked when the queue is idle")
+	workerCmd.Flags().Duration("update-interval", 15*time.Second, "How often the states of running containers are inspected")
+	workerCmd.Flags().Duration("stats-interval", 15*time.Second, "How often host stats are collected")
+	workerCmd.Flags().Int("stats-history", stats.DefaultHistorySize, "Number of host stats samples kept for /stats/history")
+	workerCmd.Flags().Duration("task-stats-interval", 15*time.Second, "How often the resource usage of task containers is sampled")
+	workerCmd.Flags().Duration("task-retention", 24*time.Hour, "How long finished tasks and their containers are kept before being deleted (0 keeps them forever)")
+	workerCmd.Flags().Int("max-job-output", task.DefaultMaxResultOutput, "Bytes of stdout and of stderr kept in the result of a finished job")
+	workerCmd.Flags().Bool("reuse-containers", true, "Adopt the running, healthy container a previous attempt left for a task instead of replacing it")
+	workerCmd.Flags().Int("concurrency", 4, "Maximum number of queued tasks the worker runs concurrently")
+	workerCmd.Flags().Int("max-tasks", 0, "Most active tasks the worker accepts, enforced by the schedulers too (0 for no limit)")
+	workerCmd.Flags().String("manager", "", "Manager to push heartbeats, and task state changes with the PushUpdates feature gate, to")
+	workerCmd.Flags().String("advertise-address", "", "Address the manager reaches this worker at, as listed in its --workers (defaults to host:port, with localhost for 0.0.0.0)")
+	workerCmd.Flags().String("feature-gates", "", "Comma separated list of Feature=bool pairs (e.g. PushUpdates=true,Services=false)")
+	workerCmd.Flags().Duration("shutdown-timeout", 30*time.Second, "Time to wait for in-flight requests and queued tasks on shutdown")
 }
 
 // workerCmd represents the worker command
@@ -28,18 +66,156 @@ var workerCmd = &cobra.Command{
 	Short: "Cube Worker node CLI",
 	Long:  `The Cube Worker is responsible for running Cube Tasks and inform a Cube Manager about Task state.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		applyConfigFile(cmd)
 		host, _ := cmd.Flags().GetString("host")
 		port, _ := cmd.Flags().GetInt("port")
 		name, _ := cmd.Flags().GetString("name")
 		dbType, _ := cmd.Flags().GetString("dbtype")
+		featureGates, _ := cmd.Flags().GetString("feature-gates")
+		dataDir, _ := cmd.Flags().GetString("data-dir")
+		evictionThreshold, _ := cmd.Flags().GetFloat64("eviction-threshold")
+		shutdownTimeout, _ := cmd.Flags().GetDuration("shutdown-timeout")
+		runtime, _ := cmd.Flags().GetString("runtime")
+		concurrency, _ := cmd.Flags().GetInt("concurrency")
+		maxTasks, _ := cmd.Flags().GetInt("max-tasks")
+		reuseContainers, _ := cmd.Flags().GetBool("reuse-containers")
+		taskRetention, _ := cmd.Flags().GetDuration("task-retention")
+		maxJobOutput, _ := cmd.Flags().GetInt("max-job-output")
+		allowedBindPaths, _ := cmd.Flags().GetStringSlice("allowed-bind-paths")
+		capabilities, _ := cmd.Flags().GetStringSlice("capabilities")
+		registryConfig, _ := cmd.Flags().GetString("registry-config")
+		labels, _ := cmd.Flags().GetStringToString("labels")
+		managerAddress, _ := cmd.Flags().GetString("manager")
+		advertiseAddress, _ := cmd.Flags().GetString("advertise-address")
+		transport, _ := cmd.Flags().GetString("transport")
+		runInterval, _ := cmd.Flags().GetDuration("run-interval")
+		updateInterval, _ := cmd.Flags().GetDuration("update-interval")
+		statsInterval, _ := cmd.Flags().GetDuration("stats-interval")
+		taskStatsInterval, _ := cmd.Flags().GetDuration("task-stats-interval")
+		statsHistory, _ := cmd.Flags().GetInt("stats-history")
+		token := authToken(cmd)
+		logger := setupLogging(cmd, "worker")
 
-		log.Println("Starting worker.")
-		w := worker.New(name, dbType)
-		api := workerApi.Api{Address: host, Port: port, Worker: w}
-		go w.RunTasks()
-		go w.CollectStats()
-		go w.UpdateTasks()
-		log.Printf("Starting worker API on http://%s:%d", host, port)
-		api.Start()
+		if err := features.Gates.Set(featureGates); err != nil {
+			fatal(logger, "Invalid --feature-gates", "error", err)
+		}
+		checkIntervals(cmd, logger, "run-interval", "update-interval", "stats-interval", "task-stats-interval")
+
+		logger.Info("Starting worker")
+		logger.Info("Feature gates", "gates", features.Gates.String())
+		dataDir, err := platform.DataDir(dataDir)
+		if err != nil {
+			fatal(logger, "Unable to create data directory", "error", err)
+		}
+		setupStoreEncryption(cmd, logger)
+
+		w := worker.New(name, dbType, dataDir)
+		w.EvictionThreshold = evictionThreshold
+		w.RunInterval = runInterval
+		w.UpdateInterval = updateInterval
+		w.StatsInterval = statsInterval
+		if statsHistory < 1 {
+			fatal(logger, "Invalid --stats-history, expected at least one sample", "stats-history", statsHistory)
+		}
+		w.StatsHistory = stats.NewHistory(statsHistory)
+		w.TaskStatsInterval = taskStatsInterval
+		runtimeClient, err := task.NewRuntimeClient(runtime)
+		if err != nil {
+			fatal(logger, "Invalid --runtime", "error", err)
+		}
+		w.Runtime = runtime
+		w.RuntimeClient = runtimeClient
+		if !slices.Contains(rpc.Transports, transport) {
+			fatal(logger, "Invalid --transport", "transport", transport, "expected", rpc.Transports)
+		}
+		w.Concurrency = concurrency
+		if maxTasks < 0 {
+			fatal(logger, "Invalid --max-tasks, expected zero or more", "max-tasks", maxTasks)
+		}
+		w.MaxTasks = maxTasks
+		w.ReuseContainers = reuseContainers
+		w.TaskRetention = taskRetention
+		if maxJobOutput < 0 {
+			fatal(logger, "Invalid --max-job-output, expected zero or more", "max-job-output", maxJobOutput)
+		}
+		w.MaxResultOutput = maxJobOutput
+		w.AllowedBindPaths = allowedBindPaths
+		if registryConfig != "" {
+			registries, err := task.LoadRegistries(registryConfig)
+			if err != nil {
+				fatal(logger, "Invalid --registry-config", "error", err)
+			}
+			w.Registries = registries
+		}
+		if errs := validation.ValidateLabels("--labels", labels); errs != nil {
+			fatal(logger, "Invalid --labels", "error", errs)
+		}
+		w.Labels = labels
+		if errs := validation.ValidateCapabilities("--capabilities", capabilities); errs != nil {
+			fatal(logger, "Invalid --capabilities", "error", errs)
+		}
+		w.Capabilities = capabilities
+		w.Manager = managerAddress
+		w.Address = advertiseAddress
+		if w.Address == "" {
+			w.Address = advertisedAddress(host, port)
+		}
+		w.Client = auth.NewClient(token)
+		if token == "" {
+			logger.Warn("No --auth-token set, the worker API accepts unauthenticated requests")
+		}
+		// Adopt the containers of a previous run before the loops inspect them
+		if err := w.RecoverContainers(); err != nil {
+			logger.Error("Error recovering task containers", "error", err)
+		}
+		api := workerApi.Api{Address: host, Port: port, Worker: w, AuthToken: token, Transport: transport}
+
+		ctx, stopLoops := context.WithCancel(context.Background())
+		var loops sync.WaitGroup
+		for _, loop := range []func(context.Context){w.RunTasks, w.CollectStats, w.CollectTaskStats, w.UpdateTasks, w.PushUpdates, w.SendHeartbeats, w.ProbeTasks, w.CollectGarbage, w.WatchContainers} {
+			loops.Add(1)
+			go func() {
+				defer loops.Done()
+				loop(ctx)
+			}()
+		}
+		go w.Watchdog.Run()
+		logger.Info("Starting worker API", "address", fmt.Sprintf("http://%s:%d", host, port))
+		served, err := api.Start()
+		if err != nil {
+			fatal(logger, "Unable to start worker API", "error", err)
+		}
+		if err := systemd.Notify(systemd.Ready); err != nil {
+			logger.Error("Error notifying systemd", "error", err)
+		}
+
+		sig, err := waitForShutdown(served)
+		if err != nil {
+			fatal(logger, "Worker API stopped serving", "error", err)
+		}
+		logger.Info("Shutting down", "signal", sig)
+		systemd.Notify(systemd.Stopping)
+
+		// Stop accepting tasks first, then let the loops drain the task queue
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := api.Stop(shutdownCtx); err != nil {
+			logger.Error("Error stopping worker API", "error", err)
+		}
+		stopLoops()
+		if !waitContext(shutdownCtx, loops.Wait) {
+			logger.Info("Timed out waiting for worker loops to finish")
+		}
+		w.Db.Close()
+		runtimeClient.Close()
+		logger.Info("Shutdown complete")
 	},
 }
+
+// advertisedAddress is the default address pushed updates identify the worker by
+func advertisedAddress(host string, port int) string {
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"reflect"
+	"runtime"
+	"time"
+)
+
+// Build information, overridden at build time via
+// -ldflags "-X cube/config.Version=... -X cube/config.GitCommit=... -X cube/config.BuildDate=..."
+var (
+	Version   = "dev"
+	GitCommit = "unknown"
+	BuildDate = "unknown"
+)
+
+const redactedValue = "********"
+
+type BuildInfo struct {
+	Version   string
+	GitCommit string
+	BuildDate string
+	GoVersion string
+}
+
+func GetBuildInfo() BuildInfo {
+	return BuildInfo{
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+}
+
+/**
+* Settings
+* The effective configuration of a manager or worker, as served by GET /config.
+* Fields tagged with `redact:"true"` are masked by Redacted before leaving the process.
+ */
+type Settings struct {
+	Component    string
+	Name         string `json:",omitempty"`
+	Scheduler    string `json:",omitempty"`
+	DbType       string
+	DbDSN        string            `json:",omitempty" redact:"true"`
+	Runtime      string            `json:",omitempty"`
+	Labels       map[string]string `json:",omitempty"`
+	Workers      []string          `json:",omitempty"`
+	Intervals    map[string]string `json:",omitempty"`
+	FeatureGates map[string]bool   `json:",omitempty"`
+	Build        BuildInfo
+}
+
+// Intervals converts the named loop durations to their string representation
+func Intervals(intervals map[string]time.Duration) map[string]string {
+	out := make(map[string]string, len(intervals))
+	for k, v := range intervals {
+		out[k] = v.String()
+	}
+	return out
+}
+
+// Redacted returns a copy of the settings with all secret fields masked
+func (s Settings) Redacted() Settings {
+	v := reflect.ValueOf(&s).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("redact") != "true" {
+			continue
+		}
+		f := v.Field(i)
+		if f.Kind() == reflect.String && f.String() != "" {
+			f.SetString(redactedValue)
+		}
+	}
+	return s
+}
+
+/**
+* Version skew
+* Workers advertise their component version, API version and capabilities
+* on every API response; the manager compares them against its own.
+ */
+const (
+	ApiVersion        = 1
+	MaxApiVersionSkew = 1
+
+	VersionHeader      = "X-Cube-Version"
+	ApiVersionHeader   = "X-Cube-Api-Version"
+	CapabilitiesHeader = "X-Cube-Capabilities"
+	// Node labels as comma separated key=value pairs
+	LabelsHeader = "X-Cube-Labels"
+	// Number of items matching a paged list request
+	TotalCountHeader = "X-Total-Count"
+	// Key deduplicating retried task submissions, and the header set on the
+	// response to a submission already made with it
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// Capabilities advertised by a worker of this build
+var Capabilities = []string{"stats", "config", "containers", "logs", "volumes"}
+
+// ApiVersionSupported reports whether a peer's API version is within the supported skew window
+func ApiVersionSupported(v int) bool {
+	return v <= ApiVersion && v >= ApiVersion-MaxApiVersionSkew
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSettingsRedacted(t *testing.T) {
+	const dsn = "postgres://cube:hunter2@db:5432/cube"
+	s := Settings{Component: "manager", Scheduler: "epvm", DbType: "postgres", DbDSN: dsn, Workers: []string{"worker-1:5556"}}
+
+	r := s.Redacted()
+	if r.DbDSN != redactedValue {
+		t.Errorf("DbDSN = %q, want %q", r.DbDSN, redactedValue)
+	}
+	if r.Component != s.Component || r.Scheduler != s.Scheduler || r.DbType != s.DbType || !reflect.DeepEqual(r.Workers, s.Workers) {
+		t.Errorf("Redacted changed fields not tagged for redaction: %+v", r)
+	}
+	if s.DbDSN != dsn {
+		t.Errorf("Redacted changed the settings it was called on, DbDSN = %q", s.DbDSN)
+	}
+	out, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "hunter2") {
+		t.Errorf("redacted settings leak the password: %s", out)
+	}
+
+	// Unset secrets stay empty, so they are left out of the response
+	if r := (Settings{Component: "manager"}).Redacted(); r.DbDSN != "" {
+		t.Errorf("empty DbDSN redacted to %q", r.DbDSN)
+	}
+}
+
+// Redacted only masks strings, a secret of another kind would be served as is
+func TestRedactTagsOnStrings(t *testing.T) {
+	st := reflect.TypeOf(Settings{})
+	for i := 0; i < st.NumField(); i++ {
+		f := st.Field(i)
+		if f.Tag.Get("redact") == "true" && f.Type.Kind() != reflect.String {
+			t.Errorf("field %s is tagged for redaction but is a %s", f.Name, f.Type.Kind())
+		}
+	}
+}
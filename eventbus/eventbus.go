@@ -0,0 +1,135 @@
+package eventbus
+
+import (
+	"slices"
+	"sync"
+
+	"cube/logging"
+	"cube/task"
+)
+
+var logger = logging.For("eventbus")
+
+/**
+* Event bus
+* Manager subsystems publish what happens to tasks on the bus instead of calling
+* the subsystems interested in it: the dispatch loop, the task updates reported by
+* workers, the health checks and the API are publishers, the event history writer,
+* the notifier and the metrics are subscribers. Every subscriber has its own
+* buffered channel drained by its own goroutine, in publish order, so publishing
+* never waits for a consumer. Events published to a subscriber whose buffer is full
+* are dropped and reported to OnDrop.
+ */
+type Topic string
+
+const (
+	// A task was submitted through the API
+	TaskSubmitted Topic = "task.submitted"
+	// The dispatch loop tried to send a task to a worker, Reason holds the result
+	TaskDispatched Topic = "task.dispatched"
+	// A task moved from Previous to its current state
+	TaskTransitioned Topic = "task.transitioned"
+	// A task failed its health probes on Worker
+	TaskUnhealthy Topic = "task.unhealthy"
+	// A task was restarted on Worker
+	TaskRestarted Topic = "task.restarted"
+	// An entry for the task event history, Error holds the reason behind it
+	TaskRecorded Topic = "task.recorded"
+)
+
+// Events a subscriber can queue before the following ones are dropped
+const BufferSize = 1024
+
+type Event struct {
+	Topic Topic
+	task.TaskEvent
+	// State the task left, for TaskTransitioned
+	Previous task.State `json:",omitempty"`
+	// Outcome of the publisher's action, e.g. the dispatch result
+	Reason string `json:",omitempty"`
+}
+
+// Handler consumes the events of a subscription
+type Handler func(e Event)
+
+type subscriber struct {
+	name string
+	// Topics delivered to the subscriber, all of them when empty
+	topics []Topic
+	events chan Event
+}
+
+func (s *subscriber) wants(t Topic) bool {
+	return len(s.topics) == 0 || slices.Contains(s.topics, t)
+}
+
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers []*subscriber
+	closed      bool
+	wg          sync.WaitGroup
+
+	// OnDrop is called with the events a subscriber had no room for
+	OnDrop func(subscriber string, e Event)
+}
+
+func New() *Bus {
+	return &Bus{}
+}
+
+// Subscribe calls h with the events of the topics, all of them when none are given,
+// until the bus is closed
+func (b *Bus) Subscribe(name string, h Handler, topics ...Topic) {
+	s := &subscriber{name: name, topics: topics, events: make(chan Event, BufferSize)}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		logger.Warn("Bus is closed, ignoring subscriber", "subscriber", name)
+		return
+	}
+	b.subscribers = append(b.subscribers, s)
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		for e := range s.events {
+			h(e)
+		}
+	}()
+}
+
+// Publish queues e for the subscribers of its topic without waiting for them
+func (b *Bus) Publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return
+	}
+	for _, s := range b.subscribers {
+		if !s.wants(e.Topic) {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+			logger.Warn("Subscriber is falling behind, dropping event", "subscriber", s.name, "topic", e.Topic, "task_id", e.Task.ID)
+			if b.OnDrop != nil {
+				b.OnDrop(s.name, e)
+			}
+		}
+	}
+}
+
+// Close stops accepting events and waits for the subscribers to handle the queued ones
+func (b *Bus) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	for _, s := range b.subscribers {
+		close(s.events)
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+}
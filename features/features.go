@@ -0,0 +1,123 @@
+package features
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/**
+* Feature gates
+* Large new subsystems ship disabled by default and are switched on per cluster with
+* --feature-gates=PushUpdates=true,Services=false
+ */
+type Feature string
+
+const (
+	PushUpdates Feature = "PushUpdates"
+	Services    Feature = "Services"
+	Namespaces  Feature = "Namespaces"
+	CronJobs    Feature = "CronJobs"
+	Preemption  Feature = "Preemption"
+	Deployments Feature = "Deployments"
+	TaskGroups  Feature = "TaskGroups"
+)
+
+var defaultFeatures = map[Feature]bool{
+	PushUpdates: false,
+	Services:    false,
+	Namespaces:  false,
+	CronJobs:    false,
+	Preemption:  false,
+	Deployments: false,
+	TaskGroups:  false,
+}
+
+type FeatureGate struct {
+	mu      sync.RWMutex
+	enabled map[Feature]bool
+}
+
+func NewFeatureGate() *FeatureGate {
+	enabled := make(map[Feature]bool, len(defaultFeatures))
+	for f, v := range defaultFeatures {
+		enabled[f] = v
+	}
+	return &FeatureGate{enabled: enabled}
+}
+
+// Gates is the process-wide feature gate consulted by manager and worker code
+var Gates = NewFeatureGate()
+
+// Enabled is a shorthand for Gates.Enabled
+func Enabled(f Feature) bool {
+	return Gates.Enabled(f)
+}
+
+// Set parses a comma separated list of Feature=bool pairs
+func (g *FeatureGate) Set(spec string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("missing bool value for feature gate %s", k)
+		}
+		f := Feature(strings.TrimSpace(k))
+		if _, known := defaultFeatures[f]; !known {
+			return fmt.Errorf("unknown feature gate %s", f)
+		}
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return fmt.Errorf("invalid value %s for feature gate %s", v, f)
+		}
+		g.enabled[f] = b
+	}
+	return nil
+}
+
+func (g *FeatureGate) Enabled(f Feature) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.enabled[f]
+}
+
+// Map returns the state of every known feature gate
+func (g *FeatureGate) Map() map[string]bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	out := make(map[string]bool, len(g.enabled))
+	for f, v := range g.enabled {
+		out[string(f)] = v
+	}
+	return out
+}
+
+// EnabledList returns the sorted names of the enabled feature gates
+func (g *FeatureGate) EnabledList() []string {
+	var out []string
+	for f, v := range g.Map() {
+		if v {
+			out = append(out, f)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (g *FeatureGate) String() string {
+	m := g.Map()
+	pairs := make([]string, 0, len(m))
+	for f, v := range m {
+		pairs = append(pairs, fmt.Sprintf("%s=%t", f, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -1,16 +1,106 @@
 package logging
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
 )
 
-var Info *log.Logger
-var Warning *log.Logger
-var Error *log.Logger
+/**
+* Structured logging
+* Components log through slog loggers returned by For, which tag every record with
+* the component name. Records carry fields such as task_id, worker and state rather
+* than formatting them into the message. Setup selects the level and the text or
+* JSON output once flags are parsed; loggers created before that pick it up as well.
+ */
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
+)
+
+var (
+	Formats = []string{TextFormat, JSONFormat}
+	Levels  = []string{"debug", "info", "warn", "error"}
+)
+
+var (
+	level   = new(slog.LevelVar)
+	current atomic.Pointer[slog.Handler]
+)
 
 func init() {
-	Info = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
-	Warning = log.New(os.Stdout, "WARNING: ", log.Ldate|log.Ltime|log.Lshortfile)
-	Error = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+	h := newHandler(os.Stdout, TextFormat)
+	current.Store(&h)
+}
+
+// Setup sends log records at or above level to w, formatted as text or json
+func Setup(w io.Writer, lvl string, format string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(lvl)); err != nil || !slices.Contains(Levels, strings.ToLower(lvl)) {
+		return fmt.Errorf("unknown log level %q, expected one of %v", lvl, Levels)
+	}
+	if !slices.Contains(Formats, format) {
+		return fmt.Errorf("unknown log format %q, expected one of %v", format, Formats)
+	}
+	level.Set(l)
+	h := newHandler(w, format)
+	current.Store(&h)
+	// Route the standard library logger through the same handler
+	slog.SetDefault(For("cube"))
+	return nil
+}
+
+// For returns the logger of the named component
+func For(component string) *slog.Logger {
+	return slog.New(handler{}).With("component", component)
+}
+
+func newHandler(w io.Writer, format string) slog.Handler {
+	opts := &slog.HandlerOptions{
+		AddSource: true,
+		Level:     level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			// file:line, the same as the previous log.Lshortfile output
+			if src, ok := a.Value.Any().(*slog.Source); ok && a.Key == slog.SourceKey {
+				a.Value = slog.StringValue(fmt.Sprintf("%s:%d", filepath.Base(src.File), src.Line))
+			}
+			return a
+		},
+	}
+	if format == JSONFormat {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// handler forwards records to the handler installed by Setup, replaying the
+// attributes and groups added to the logger
+type handler struct {
+	wrap []func(slog.Handler) slog.Handler
+}
+
+func (h handler) Enabled(ctx context.Context, l slog.Level) bool {
+	return l >= level.Level()
+}
+
+func (h handler) Handle(ctx context.Context, r slog.Record) error {
+	next := *current.Load()
+	for _, w := range h.wrap {
+		next = w(next)
+	}
+	return next.Handle(ctx, r)
+}
+
+func (h handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return handler{wrap: append(slices.Clip(h.wrap), func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })}
+}
+
+func (h handler) WithGroup(name string) slog.Handler {
+	return handler{wrap: append(slices.Clip(h.wrap), func(next slog.Handler) slog.Handler { return next.WithGroup(name) })}
 }
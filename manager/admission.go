@@ -0,0 +1,57 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/node"
+	"cube/task"
+)
+
+/**
+* Admission refusals
+* Workers refuse tasks which do not fit in their remaining resources. The manager
+* then places the task again, skipping the workers which refused it for a while
+* since their stats may still show room for it.
+ */
+const refusalBackoff = time.Minute
+
+// refuse records that worker refused task id for lack of resources
+func (m *Manager) refuse(id uuid.UUID, worker string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.refusals[id] == nil {
+		m.refusals[id] = make(map[string]time.Time)
+	}
+	m.refusals[id][worker] = time.Now()
+}
+
+// clearRefusals forgets the refusals of a task once a worker accepted it
+func (m *Manager) clearRefusals(id uuid.UUID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.refusals, id)
+}
+
+// withoutRefusals drops the nodes which refused t within the refusal backoff
+func (m *Manager) withoutRefusals(t task.Task, nodes []*node.Node) []*node.Node {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	refused := m.refusals[t.ID]
+	if len(refused) == 0 {
+		return nodes
+	}
+	now := time.Now()
+	var allowed []*node.Node
+	for _, n := range nodes {
+		if at, ok := refused[n.Name]; ok {
+			if now.Sub(at) < refusalBackoff {
+				continue
+			}
+			delete(refused, n.Name)
+		}
+		allowed = append(allowed, n)
+	}
+	return allowed
+}
@@ -0,0 +1,64 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"cube/task"
+	workerApi "cube/worker/api"
+)
+
+// AdoptContainer asks a worker to import an existing container as a task and
+// starts tracking that task on the manager.
+// Docker does not allow relabelling an existing container, so the adopted container is
+// tracked by its ID until Cube restarts it.
+func (m *Manager) AdoptContainer(worker string, containerID string, name string) (*task.Task, error) {
+	n := m.workerNode(worker)
+	if n == nil {
+		return nil, fmt.Errorf("unknown worker %s", worker)
+	}
+	if len(n.Capabilities) > 0 && !n.HasCapability("containers") {
+		return nil, fmt.Errorf("worker %s does not support adopting containers", worker)
+	}
+
+	data, err := json.Marshal(workerApi.AdoptRequest{Name: name})
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("http://%s/containers/%s/adopt", worker, containerID)
+	resp, err := m.Client.Post(url, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %v: %v", worker, err)
+	}
+	defer resp.Body.Close()
+
+	d := json.NewDecoder(resp.Body)
+	if resp.StatusCode != http.StatusCreated {
+		e := workerApi.ErrResponse{}
+		err := d.Decode(&e)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding response: %v", err)
+		}
+		return nil, fmt.Errorf("response error (%d): %s", e.HTTPStatusCode, e.Message)
+	}
+
+	t := task.Task{}
+	err = d.Decode(&t)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding response: %v", err)
+	}
+
+	err = m.TaskDb.Put(t.ID.String(), &t)
+	if err != nil {
+		return nil, err
+	}
+	m.assignTask(t.ID, worker)
+	m.reserve(n, t)
+	m.countTask(n, 1)
+
+	logger.Info("Adopted container", "container_id", containerID, "worker", worker, "task_id", t.ID)
+	return &t, nil
+}
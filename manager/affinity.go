@@ -0,0 +1,53 @@
+package manager
+
+import (
+	"cube/node"
+	"cube/task"
+)
+
+/**
+* Task affinity
+* Affinity and AntiAffinity select tasks by their labels: a task with Affinity is only
+* placed on nodes running a live matching task, one with AntiAffinity never is.
+* Placements are made one at a time under scheduleMu, so replicas dispatched together
+* see where the others went.
+ */
+
+// applyAffinity narrows nodes down to those satisfying t's Affinity and AntiAffinity
+func (m *Manager) applyAffinity(t task.Task, nodes []*node.Node) []*node.Node {
+	if t.Affinity == "" && t.AntiAffinity == "" {
+		return nodes
+	}
+	affinity, _ := task.ParseSelector(t.Affinity)
+	antiAffinity, _ := task.ParseSelector(t.AntiAffinity)
+
+	near := make(map[string]bool)
+	avoid := make(map[string]bool)
+	for _, other := range m.GetTasks() {
+		if other.ID == t.ID || !other.State.Active() {
+			continue
+		}
+		w, ok := m.workerFor(other.ID)
+		if !ok {
+			continue
+		}
+		if t.Affinity != "" && affinity.Matches(other.Labels) {
+			near[w] = true
+		}
+		if t.AntiAffinity != "" && antiAffinity.Matches(other.Labels) {
+			avoid[w] = true
+		}
+	}
+
+	var filtered []*node.Node
+	for _, n := range nodes {
+		if t.Affinity != "" && !near[n.Name] {
+			continue
+		}
+		if avoid[n.Name] {
+			continue
+		}
+		filtered = append(filtered, n)
+	}
+	return filtered
+}
@@ -1,12 +1,21 @@
 package managerApi
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 
+	"cube/auth"
+	"cube/logging"
 	"cube/manager"
+	"cube/openapi"
+	"cube/task"
+	"cube/utils"
+	"cube/validation"
 )
 
 type Api struct {
@@ -14,26 +23,167 @@ type Api struct {
 	Port    int
 	Manager *manager.Manager
 	Router  *chi.Mux
+	Server  *http.Server
+	// Bearer token required on every request, empty disables authentication
+	AuthToken string
+	// Set when managers elect a leader, see manager.Elector
+	Elector *manager.Elector
 }
 
+var logger = logging.For("manager")
+
 type ErrResponse struct {
 	HTTPStatusCode int
 	Message        string
+	// Machine readable reason of rejected submissions, one of the Code constants,
+	// and the fields at fault
+	Code   string                  `json:",omitempty"`
+	Errors []validation.FieldError `json:",omitempty"`
+}
+
+const (
+	CodeMalformed            = "malformed"
+	CodeInvalid              = "invalid"
+	CodeDuplicate            = "duplicate"
+	CodeDependencyCycle      = "dependency_cycle"
+	CodeIdempotencyKeyReused = "idempotency_key_reused"
+	CodeQuotaExceeded        = "quota_exceeded"
+	CodeRateLimited          = "rate_limited"
+	CodeQueueFull            = "queue_full"
+)
+
+// rejectSubmission answers a rejected task, service, deployment or cron job submission
+func rejectSubmission(w http.ResponseWriter, status int, code string, msg string, errs validation.Errors) {
+	logger.Warn(msg, "code", code)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encode(w, ErrResponse{HTTPStatusCode: status, Message: msg, Code: code, Errors: errs})
+}
+
+// encode writes v as the JSON response body. Every response goes through it, so the
+// registry credentials of the tasks and templates in it are always redacted.
+func encode(w io.Writer, v any) error {
+	if d, ok := v.(*manager.NodeDetail); ok && d != nil {
+		r := *d
+		r.Tasks = task.Redact(d.Tasks).([]*task.Task)
+		v = &r
+	}
+	return json.NewEncoder(w).Encode(task.Redact(v))
 }
 
 // Server
 func (a *Api) initRouter() {
 	a.Router = chi.NewRouter()
+	a.Router.Use(openapi.Middleware(spec, a.Router))
+	a.Router.Use(auth.Middleware(a.AuthToken))
 	a.Router.Route("/tasks", func(r chi.Router) {
 		r.Post("/", a.StartTaskHandler)
 		r.Get("/", a.GetTasksHandler)
 		r.Route("/{taskID}", func(r chi.Router) {
+			r.Get("/", a.GetTaskHandler)
 			r.Delete("/", a.StopTaskHandler)
+			r.Patch("/", a.UpdateTaskHandler)
+			r.Get("/logs", a.GetTaskLogsHandler)
+			r.Get("/logs/stream", a.GetTaskLogStreamHandler)
+			r.Get("/events", a.GetTaskEventsHandler)
+			r.Get("/dependencies", a.GetTaskDependenciesHandler)
+			r.Get("/stats", a.GetTaskStatsHandler)
+			r.Get("/scheduling", a.GetTaskSchedulingHandler)
+			r.Get("/result", a.GetTaskResultHandler)
+		})
+	})
+	a.Router.Route("/schedule", func(r chi.Router) {
+		r.Post("/dry-run", a.DryRunHandler)
+	})
+	a.Router.Route("/services", func(r chi.Router) {
+		r.Post("/", a.CreateServiceHandler)
+		r.Get("/", a.GetServicesHandler)
+		r.Route("/{serviceID}", func(r chi.Router) {
+			r.Get("/", a.GetServiceHandler)
+			r.Delete("/", a.DeleteServiceHandler)
+		})
+	})
+	a.Router.Route("/deployments", func(r chi.Router) {
+		r.Post("/", a.DeployHandler)
+		r.Get("/", a.GetDeploymentsHandler)
+		r.Route("/{deploymentID}", func(r chi.Router) {
+			r.Get("/", a.GetDeploymentHandler)
+			r.Delete("/", a.DeleteDeploymentHandler)
+		})
+	})
+	a.Router.Route("/groups", func(r chi.Router) {
+		r.Post("/", a.CreateTaskGroupHandler)
+		r.Get("/", a.GetTaskGroupsHandler)
+		r.Route("/{groupID}", func(r chi.Router) {
+			r.Get("/", a.GetTaskGroupHandler)
+			r.Delete("/", a.DeleteTaskGroupHandler)
 		})
 	})
+	a.Router.Route("/cronjobs", func(r chi.Router) {
+		r.Post("/", a.CreateCronJobHandler)
+		r.Get("/", a.GetCronJobsHandler)
+		r.Get("/{cronJobID}", a.GetCronJobHandler)
+	})
+	a.Router.Route("/nodes", func(r chi.Router) {
+		r.Get("/", a.GetNodesHandler)
+		r.Get("/{name}", a.GetNodeHandler)
+		r.Put("/{name}/drain", a.DrainNodeHandler)
+		r.Put("/{name}/uncordon", a.UncordonNodeHandler)
+	})
+	a.Router.Route("/quotas", func(r chi.Router) {
+		r.Get("/", a.GetQuotasHandler)
+		r.Route("/{namespace}", func(r chi.Router) {
+			r.Get("/", a.GetQuotaHandler)
+			r.Put("/", a.SetQuotaHandler)
+			r.Delete("/", a.DeleteQuotaHandler)
+		})
+	})
+	a.Router.Route("/task-updates", func(r chi.Router) {
+		r.Post("/", a.PushTaskUpdateHandler)
+	})
+	a.Router.Route("/heartbeat", func(r chi.Router) {
+		r.Post("/", a.HeartbeatHandler)
+	})
+	a.Router.Route("/events", func(r chi.Router) {
+		r.Get("/", a.GetEventsHandler)
+	})
+	a.Router.Route("/timeline", func(r chi.Router) {
+		r.Get("/nodes/{name}", a.GetNodeTimelineHandler)
+		r.Get("/tasks/{taskID}", a.GetTaskTimelineHandler)
+	})
+	a.Router.Route("/logs", func(r chi.Router) {
+		r.Get("/", a.GetLogsHandler)
+	})
+	a.Router.Route("/adopt", func(r chi.Router) {
+		r.Post("/", a.AdoptContainerHandler)
+	})
+	a.Router.Get("/status", a.GetStatusHandler)
+	a.Router.Route("/config", func(r chi.Router) {
+		r.Get("/", a.GetConfigHandler)
+		r.Post("/reload", a.ReloadConfigHandler)
+	})
+	a.initV1Routes()
+	a.Router.Method(http.MethodGet, "/metrics", a.Manager.MetricsHandler())
+	if a.Elector != nil {
+		a.Router.Get("/leader", leaderHandler(a.Elector))
+	}
 }
 
-func (a *Api) Start() {
+// Start binds the API address, returning the error when it cannot, and serves in the
+// background; the returned channel receives the error serving fails with
+func (a *Api) Start() (<-chan error, error) {
 	a.initRouter()
-	http.ListenAndServe(fmt.Sprintf("%s:%d", a.Address, a.Port), a.Router)
+	a.Server = &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", a.Address, a.Port),
+		Handler: a.Router,
+	}
+	return utils.Listen(a.Server)
+}
+
+// Stop gracefully shuts the server down, waiting for in-flight requests until ctx expires
+func (a *Api) Stop(ctx context.Context) error {
+	if a.Server == nil {
+		return nil
+	}
+	return a.Server.Shutdown(ctx)
 }
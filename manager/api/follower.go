@@ -0,0 +1,105 @@
+package managerApi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+
+	"cube/auth"
+	"cube/manager"
+	"cube/utils"
+)
+
+/**
+* Follower API
+* A manager waiting for the leader lease serves the manager API read-only: reads
+* are forwarded to the leader and writes are refused with a 503 naming the leader,
+* in the X-Cube-Leader header as well, so clients can retry there.
+ */
+const leaderHeader = "X-Cube-Leader"
+
+type Follower struct {
+	Address string
+	Port    int
+	Elector *manager.Elector
+	Router  *chi.Mux
+	Server  *http.Server
+	// Bearer token required on every request, empty disables authentication
+	AuthToken string
+}
+
+func (f *Follower) initRouter() {
+	f.Router = chi.NewRouter()
+	f.Router.Use(auth.Middleware(f.AuthToken))
+	f.Router.Get("/leader", leaderHandler(f.Elector))
+	f.Router.HandleFunc("/*", f.forward)
+}
+
+// Start binds the API address and serves in the background, like Api.Start
+func (f *Follower) Start() (<-chan error, error) {
+	f.initRouter()
+	f.Server = &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", f.Address, f.Port),
+		Handler: f.Router,
+	}
+	return utils.Listen(f.Server)
+}
+
+// Stop gracefully shuts the server down, waiting for in-flight requests until ctx expires
+func (f *Follower) Stop(ctx context.Context) error {
+	if f.Server == nil {
+		return nil
+	}
+	return f.Server.Shutdown(ctx)
+}
+
+// forward proxies reads to the leader and refuses writes
+func (f *Follower) forward(w http.ResponseWriter, r *http.Request) {
+	leader, err := f.Elector.Leader()
+	if err != nil || leader.Holder == "" || leader.Holder == f.Elector.ID {
+		w.WriteHeader(503)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 503, Message: "No leader elected, retry later"})
+		return
+	}
+	w.Header().Set(leaderHeader, leader.Address)
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		msg := fmt.Sprintf("This manager is a follower, send %s requests to the leader at %s", r.Method, leader.Address)
+		w.WriteHeader(503)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 503, Message: msg})
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(&url.URL{Scheme: "http", Host: leader.Address})
+		},
+		// Stream followed logs as they come
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			logger.Warn("Error forwarding request to leader", "leader", leader.Address, "error", err)
+			w.WriteHeader(502)
+			json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 502, Message: fmt.Sprintf("Unable to reach the leader at %s", leader.Address)})
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// leaderHandler serves the current holder of the leader lease
+func leaderHandler(e *manager.Elector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		leader, err := e.Leader()
+		if err != nil {
+			w.WriteHeader(500)
+			json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 500, Message: err.Error()})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		json.NewEncoder(w).Encode(leader)
+	}
+}
@@ -2,71 +2,873 @@ package managerApi
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 
+	"cube/config"
+	"cube/eventbus"
+	"cube/manager"
+	"cube/manager/dag"
+	"cube/node"
+	"cube/store"
 	"cube/task"
+	"cube/utils"
+	"cube/validation"
 )
 
 func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
 
 	te := task.TaskEvent{}
 	err := d.Decode(&te)
 	if err != nil {
-		msg := fmt.Sprintf("Error unmarshalling body: %v\n", err)
-		log.Printf(msg)
+		rejectSubmission(w, 400, CodeMalformed, fmt.Sprintf("Error unmarshalling body: %v", err), nil)
+		return
+	}
+	a.submitTask(w, r, te, func(t task.Task) any { return t })
+}
+
+// submitTask validates and adds the task of te, answering with the task submitted
+// as translated by render
+func (a *Api) submitTask(w http.ResponseWriter, r *http.Request, te task.TaskEvent, render func(task.Task) any) {
+	if errs := validation.ValidateTaskEvent(te); errs != nil {
+		rejectSubmission(w, 400, CodeInvalid, fmt.Sprintf("Invalid task: %v", errs), errs)
+		return
+	}
+
+	key := manager.IdempotencyKey(r.Header.Get(config.IdempotencyKeyHeader), te)
+	submitted, replayed, err := a.Manager.SubmitTask(key, te)
+	if err != nil {
+		var cycle *dag.CycleError
+		var throttled *manager.ThrottledError
+		switch {
+		case errors.As(err, &throttled):
+			// Whole seconds, rounded up so clients do not retry early
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			code := CodeRateLimited
+			if errors.Is(err, manager.ErrQueueFull) {
+				code = CodeQueueFull
+			}
+			rejectSubmission(w, 429, code, fmt.Sprintf("Task rejected: %v", err), nil)
+		case errors.Is(err, manager.ErrIdempotencyKeyReused):
+			rejectSubmission(w, 422, CodeIdempotencyKeyReused, fmt.Sprintf("Invalid task: %v", err), nil)
+		case errors.Is(err, manager.ErrQuotaExceeded):
+			rejectSubmission(w, 403, CodeQuotaExceeded, fmt.Sprintf("Task rejected: %v", err),
+				validation.Errors{{Field: "Task.Namespace", Message: err.Error()}})
+		case errors.Is(err, manager.ErrDuplicateTask):
+			rejectSubmission(w, 409, CodeDuplicate, fmt.Sprintf("Invalid task: %v", err),
+				validation.Errors{{Field: "Task.ID", Message: fmt.Sprintf("task %v already exists", te.Task.ID)}})
+		case errors.As(err, &cycle):
+			rejectSubmission(w, 400, CodeDependencyCycle, fmt.Sprintf("Invalid task: %v", err),
+				validation.Errors{{Field: "Task.DependsOn", Message: err.Error()}})
+		default:
+			rejectSubmission(w, 400, CodeInvalid, fmt.Sprintf("Invalid task: %v", err), nil)
+		}
+		return
+	}
+	if replayed {
+		logger.Info("Task already submitted with idempotency key", "task_id", submitted.ID, "key", key)
+		w.Header().Set(config.IdempotentReplayedHeader, "true")
+		w.WriteHeader(201)
+		encode(w, render(submitted))
+		return
+	}
+	a.Manager.Bus.Publish(eventbus.Event{Topic: eventbus.TaskSubmitted, TaskEvent: te})
+	logger.Info("Added task", "task_id", te.Task.ID)
+	w.WriteHeader(201)
+	encode(w, render(submitted))
+}
+
+func (a *Api) UpdateTaskHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+	if err != nil {
 		w.WriteHeader(400)
-		e := ErrResponse{
-			HTTPStatusCode: 400,
-			Message:        msg,
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: "Invalid task ID"})
+		return
+	}
+
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	u := task.Update{}
+	if err := d.Decode(&u); err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body: %v", err)
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	next, err := a.Manager.UpdateTask(tID, u)
+	if err != nil {
+		status := 404
+		var invalid validation.Errors
+		switch {
+		case errors.Is(err, manager.ErrTaskNotRunning):
+			status = 409
+		case errors.As(err, &invalid):
+			rejectSubmission(w, 400, CodeInvalid, err.Error(), invalid)
+			return
 		}
-		json.NewEncoder(w).Encode(e)
+		logger.Warn("Error updating task", "task_id", tID, "error", err)
+		w.WriteHeader(status)
+		encode(w, ErrResponse{HTTPStatusCode: status, Message: err.Error()})
 		return
 	}
 
-	a.Manager.AddTask(te)
-	log.Printf("Added task %v\n", te.Task.ID)
-	w.WriteHeader(201)
-	json.NewEncoder(w).Encode(te.Task)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(202)
+	encode(w, next)
 }
 
 func (a *Api) GetTasksHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := store.ParseTaskQuery(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: err.Error()})
+		return
+	}
+	tasks, total, err := a.Manager.QueryTasks(q)
+	if err != nil {
+		logger.Error("Error querying tasks", "error", err)
+		w.WriteHeader(500)
+		encode(w, ErrResponse{HTTPStatusCode: 500, Message: err.Error()})
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(config.TotalCountHeader, strconv.Itoa(total))
 	w.WriteHeader(200)
-	json.NewEncoder(w).Encode(a.Manager.GetTasks())
+	encode(w, tasks)
 }
 
 func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
-	taskID := chi.URLParam(r, "taskID")
-	if taskID == "" {
-		log.Printf("No taskID passed in request.\n")
+	tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+	if err != nil {
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: "Invalid task ID"})
+		return
+	}
+
+	stopped, err := a.Manager.StopTask(tID)
+	if err != nil {
+		msg := fmt.Sprintf("No task with ID %v found", tID)
+		logger.Warn(msg)
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: msg})
+		return
+	}
+
+	logger.Info("Stop requested", "task_id", stopped.ID, "state", stopped.State.String())
+	w.WriteHeader(204)
+}
+
+func (a *Api) GetConfigHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, a.Manager.Settings().Redacted())
+}
+
+// GetStatusHandler returns the depth of the pending task queue and the submission limits
+func (a *Api) GetStatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, a.Manager.Status())
+}
+
+// ReloadConfigHandler applies the manager's configuration again, as SIGHUP does
+func (a *Api) ReloadConfigHandler(w http.ResponseWriter, r *http.Request) {
+	res, err := a.Manager.ReloadConfig()
+	if err != nil {
+		status := 400
+		switch {
+		case errors.Is(err, manager.ErrReloadUnsupported):
+			status = 501
+		case errors.Is(err, manager.ErrWorkerInUse):
+			status = 409
+		}
+		logger.Warn("Error reloading configuration", "error", err)
+		w.WriteHeader(status)
+		encode(w, ErrResponse{HTTPStatusCode: status, Message: err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, res)
+}
+
+type AdoptRequest struct {
+	Worker      string
+	ContainerID string
+	Name        string
+}
+
+func (a *Api) AdoptContainerHandler(w http.ResponseWriter, r *http.Request) {
+	req := AdoptRequest{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Worker == "" || req.ContainerID == "" {
+		msg := "Request must include Worker and ContainerID"
+		if err != nil {
+			msg = fmt.Sprintf("Error unmarshalling body: %v", err)
+		}
+		logger.Warn(msg)
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	t, err := a.Manager.AdoptContainer(req.Worker, req.ContainerID, req.Name)
+	if err != nil {
+		msg := fmt.Sprintf("Error adopting container %s: %v", req.ContainerID, err)
+		logger.Warn(msg)
+		w.WriteHeader(409)
+		encode(w, ErrResponse{HTTPStatusCode: 409, Message: msg})
+		return
+	}
+
+	w.WriteHeader(201)
+	encode(w, t)
+}
+
+func (a *Api) GetLogsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	selector, err := task.ParseSelector(q.Get("selector"))
+	if err != nil {
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: err.Error()})
+		return
+	}
+
+	opts := manager.LogOptions{
+		Follow: q.Get("follow") == "true",
+		Tail:   q.Get("tail"),
+		Prefix: q.Get("prefix") == "true",
+	}
+	if !utils.ValidLogTail(opts.Tail) {
+		msg := fmt.Sprintf("Invalid tail %q, expected a number of lines or \"all\"", opts.Tail)
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	err = a.Manager.StreamLogs(r.Context(), selector, opts, utils.NewFlushWriter(w))
+	if err != nil {
+		logger.Warn("Error streaming logs", "error", err)
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: err.Error()})
+	}
+}
+
+// Events
+// PushTaskUpdateHandler receives task state changes pushed by workers
+func (a *Api) PushTaskUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	te := task.TaskEvent{}
+	if err := json.NewDecoder(r.Body).Decode(&te); err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body: %v", err)
+		logger.Warn(msg)
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	if err := a.Manager.ApplyTaskUpdate(te); err != nil {
+		code := 400
+		if errors.Is(err, manager.ErrPushUpdatesDisabled) {
+			code = 404
+		}
+		w.WriteHeader(code)
+		encode(w, ErrResponse{HTTPStatusCode: code, Message: err.Error()})
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// HeartbeatHandler records a heartbeat pushed by a worker
+func (a *Api) HeartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	hb := node.Heartbeat{}
+	if err := json.NewDecoder(r.Body).Decode(&hb); err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body: %v", err)
+		logger.Warn(msg)
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	resp, err := a.Manager.ReceiveHeartbeat(hb)
+	if err != nil {
+		logger.Warn("Error recording heartbeat", "worker", hb.Worker, "error", err)
+		code := 400
+		if errors.Is(err, manager.ErrNodeNotFound) {
+			code = 404
+		}
+		w.WriteHeader(code)
+		encode(w, ErrResponse{HTTPStatusCode: code, Message: err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, resp)
+}
+
+func (a *Api) GetEventsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, a.Manager.GetEvents())
+}
+
+func (a *Api) GetTaskEventsHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+	if err != nil {
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: "Invalid task ID"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, a.Manager.GetTaskEvents(tID))
+}
+
+// Nodes
+func (a *Api) GetNodesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, a.Manager.GetNodes())
+}
+
+func (a *Api) GetNodeHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	n, err := a.Manager.GetNode(name)
+	if err != nil {
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, n)
+}
+
+func (a *Api) DrainNodeHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	req := node.DrainRequest{}
+	if err := d.Decode(&req); err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body: %v\n", err)
+		logger.Warn(msg)
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	n, err := a.Manager.DrainNode(name, req)
+	if err != nil {
+		logger.Warn("Error draining node", "worker", name, "error", err)
+		status := 502
+		if errors.Is(err, manager.ErrNodeNotFound) {
+			status = 404
+		}
+		w.WriteHeader(status)
+		encode(w, ErrResponse{HTTPStatusCode: status, Message: err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, n)
+}
+
+func (a *Api) UncordonNodeHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	n, err := a.Manager.UncordonNode(name)
+	if err != nil {
+		logger.Warn("Error uncordoning node", "worker", name, "error", err)
+		status := 502
+		if errors.Is(err, manager.ErrNodeNotFound) {
+			status = 404
+		}
+		w.WriteHeader(status)
+		encode(w, ErrResponse{HTTPStatusCode: status, Message: err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, n)
+}
+
+func (a *Api) GetTaskDependenciesHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+	if err != nil {
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: "Invalid task ID"})
+		return
+	}
+
+	deps, err := a.Manager.GetTaskDependencies(tID)
+	if err != nil {
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: fmt.Sprintf("No task with ID %v found", tID)})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, deps)
+}
+
+// GetTaskHandler returns a task with the state of its container, inspected by its worker
+func (a *Api) GetTaskHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+	if err != nil {
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: "Invalid task ID"})
+		return
+	}
+
+	in, err := a.Manager.InspectTask(r.Context(), tID)
+	if err != nil {
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: fmt.Sprintf("No task with ID %v found", tID)})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, in)
+}
+
+func (a *Api) GetTaskStatsHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+	if err != nil {
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: "Invalid task ID"})
+		return
+	}
+
+	usage, err := a.Manager.GetTaskStats(tID)
+	if err != nil {
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: fmt.Sprintf("No task with ID %v found", tID)})
+		return
+	}
+	if usage == nil {
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: fmt.Sprintf("No resource usage sampled for task %v yet", tID)})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, usage)
+}
+
+func (a *Api) GetTaskSchedulingHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+	if err != nil {
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: "Invalid task ID"})
+		return
+	}
+
+	d, err := a.Manager.GetSchedulingDecision(tID)
+	if err != nil {
+		msg := fmt.Sprintf("No task with ID %v found", tID)
+		if errors.Is(err, manager.ErrNoDecision) {
+			msg = fmt.Sprintf("Task %v was not scheduled yet", tID)
+		}
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: msg})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, d)
+}
+
+// GetTaskResultHandler returns the output and exit code of a finished job
+func (a *Api) GetTaskResultHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+	if err != nil {
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: "Invalid task ID"})
+		return
+	}
+
+	result, err := a.Manager.GetTaskResult(tID)
+	if err != nil {
+		status, msg := 404, err.Error()
+		switch {
+		case errors.Is(err, manager.ErrNotAJob):
+			status = 400
+		case errors.Is(err, manager.ErrJobNotFinished):
+			status = 409
+		case !errors.Is(err, manager.ErrResultNotFound):
+			msg = fmt.Sprintf("No task with ID %v found", tID)
+		}
+		w.WriteHeader(status)
+		encode(w, ErrResponse{HTTPStatusCode: status, Message: msg})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, result)
+}
+
+// Timeline
+func (a *Api) GetNodeTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	to := time.Now().UTC()
+	from := to.Add(-1 * time.Hour)
+
+	var err error
+	if v := r.URL.Query().Get("from"); v != "" {
+		from, err = time.Parse(time.RFC3339, v)
+	}
+	if v := r.URL.Query().Get("to"); v != "" && err == nil {
+		to, err = time.Parse(time.RFC3339, v)
+	}
+	if err != nil {
+		msg := fmt.Sprintf("Invalid time range, expected RFC3339 timestamps: %v", err)
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, a.Manager.Timeline.Node(name, from, to))
+}
+
+func (a *Api) GetTaskTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+	if err != nil {
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: "Invalid task ID"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, a.Manager.Timeline.TaskPlacements(tID))
+}
+
+func (a *Api) GetTaskLogsHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+	if err != nil {
 		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: "Invalid task ID"})
+		return
+	}
+
+	q := r.URL.Query()
+	opts := manager.LogOptions{
+		Follow: q.Get("follow") == "true",
+		Tail:   q.Get("tail"),
+	}
+	if !utils.ValidLogTail(opts.Tail) {
+		msg := fmt.Sprintf("Invalid tail %q, expected a number of lines or \"all\"", opts.Tail)
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	err = a.Manager.StreamTaskLogs(r.Context(), tID, opts, utils.NewFlushWriter(w))
+	if err != nil {
+		logger.Warn("Error streaming task logs", "task_id", tID, "error", err)
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: err.Error()})
+	}
+}
+
+// GetTaskLogStreamHandler relays the server-sent event stream of a task's logs from its worker
+func (a *Api) GetTaskLogStreamHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+	if err != nil {
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: "Invalid task ID"})
+		return
+	}
+	tail := r.URL.Query().Get("tail")
+	if !utils.ValidLogTail(tail) {
+		msg := fmt.Sprintf("Invalid tail %q, expected a number of lines or \"all\"", tail)
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	stream, err := a.Manager.OpenTaskLogStream(r.Context(), tID, tail)
+	if err != nil {
+		logger.Warn("Error opening task log stream", "task_id", tID, "error", err)
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: err.Error()})
+		return
+	}
+	defer stream.Close()
+
+	utils.SetSSEHeaders(w)
+	w.WriteHeader(200)
+	io.Copy(utils.NewFlushWriter(w), stream)
+}
+
+// Services
+func (a *Api) CreateServiceHandler(w http.ResponseWriter, r *http.Request) {
+	s := task.Service{}
+	err := json.NewDecoder(r.Body).Decode(&s)
+	if err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body: %v", err)
+		logger.Warn(msg)
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+	if errs := validation.ValidateTask(s.Template, "Template."); errs != nil {
+		rejectSubmission(w, 400, CodeInvalid, fmt.Sprintf("Invalid service template: %v", errs), errs)
+		return
+	}
+
+	created, err := a.Manager.CreateService(s)
+	if err != nil {
+		code := 400
+		if errors.Is(err, manager.ErrServicesDisabled) {
+			code = 404
+		}
+		w.WriteHeader(code)
+		encode(w, ErrResponse{HTTPStatusCode: code, Message: err.Error()})
+		return
+	}
+
+	w.WriteHeader(201)
+	encode(w, created)
+}
+
+func (a *Api) GetServicesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, a.Manager.GetServices())
+}
+
+func (a *Api) GetServiceHandler(w http.ResponseWriter, r *http.Request) {
+	sID, _ := uuid.Parse(chi.URLParam(r, "serviceID"))
+	s, ok := a.Manager.GetService(sID)
+	if !ok {
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: fmt.Sprintf("No service with ID %v found", sID)})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, s)
+}
+
+func (a *Api) DeleteServiceHandler(w http.ResponseWriter, r *http.Request) {
+	sID, _ := uuid.Parse(chi.URLParam(r, "serviceID"))
+	err := a.Manager.DeleteService(sID)
+	if err != nil {
+		logger.Warn("Error deleting service", "service_id", sID, "error", err)
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: err.Error()})
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// DryRunHandler reports where a task would be placed without scheduling it
+func (a *Api) DryRunHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	t := task.Task{}
+	if err := d.Decode(&t); err != nil {
+		rejectSubmission(w, 400, CodeMalformed, fmt.Sprintf("Error unmarshalling body: %v", err), nil)
+		return
+	}
+	if errs := validation.ValidateTask(t, ""); errs != nil {
+		rejectSubmission(w, 400, CodeInvalid, fmt.Sprintf("Invalid task: %v", errs), errs)
+		return
 	}
 
-	tID, _ := uuid.Parse(taskID)
-	taskToStop, err := a.Manager.TaskDb.Get(tID.String())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, a.Manager.DryRun(t))
+}
+
+// Deployments
+func (a *Api) DeployHandler(w http.ResponseWriter, r *http.Request) {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	d := task.Deployment{}
+	if err := dec.Decode(&d); err != nil {
+		rejectSubmission(w, 400, CodeMalformed, fmt.Sprintf("Error unmarshalling body: %v", err), nil)
+		return
+	}
+	if errs := validation.ValidateDeployment(d); errs != nil {
+		rejectSubmission(w, 400, CodeInvalid, fmt.Sprintf("Invalid deployment: %v", errs), errs)
+		return
+	}
+
+	deployed, created, err := a.Manager.Deploy(d)
 	if err != nil {
-		log.Printf("No task with ID %v found", tID)
+		code := 400
+		if errors.Is(err, manager.ErrDeploymentsDisabled) {
+			code = 404
+		}
+		w.WriteHeader(code)
+		encode(w, ErrResponse{HTTPStatusCode: code, Message: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(201)
+	} else {
+		w.WriteHeader(200)
+	}
+	encode(w, deployed)
+}
+
+func (a *Api) GetDeploymentsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, a.Manager.GetDeployments())
+}
+
+func (a *Api) GetDeploymentHandler(w http.ResponseWriter, r *http.Request) {
+	dID, _ := uuid.Parse(chi.URLParam(r, "deploymentID"))
+	d, ok := a.Manager.GetDeployment(dID)
+	if !ok {
 		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: fmt.Sprintf("No deployment with ID %v found", dID)})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, d)
+}
+
+func (a *Api) DeleteDeploymentHandler(w http.ResponseWriter, r *http.Request) {
+	dID, _ := uuid.Parse(chi.URLParam(r, "deploymentID"))
+	if err := a.Manager.DeleteDeployment(dID); err != nil {
+		logger.Warn("Error deleting deployment", "deployment_id", dID, "error", err)
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: err.Error()})
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// Task groups
+func (a *Api) CreateTaskGroupHandler(w http.ResponseWriter, r *http.Request) {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	g := task.TaskGroup{}
+	if err := dec.Decode(&g); err != nil {
+		rejectSubmission(w, 400, CodeMalformed, fmt.Sprintf("Error unmarshalling body: %v", err), nil)
+		return
+	}
+	if errs := validation.ValidateTaskGroup(g); errs != nil {
+		rejectSubmission(w, 400, CodeInvalid, fmt.Sprintf("Invalid task group: %v", errs), errs)
+		return
 	}
 
-	te := task.TaskEvent{
-		ID:        uuid.New(),
-		State:     task.Completed,
-		Timestamp: time.Now(),
+	created, err := a.Manager.CreateTaskGroup(g)
+	if err != nil {
+		code := 400
+		if errors.Is(err, manager.ErrTaskGroupsDisabled) {
+			code = 404
+		}
+		w.WriteHeader(code)
+		encode(w, ErrResponse{HTTPStatusCode: code, Message: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(201)
+	encode(w, created)
+}
+
+func (a *Api) GetTaskGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, a.Manager.GetTaskGroups())
+}
+
+func (a *Api) GetTaskGroupHandler(w http.ResponseWriter, r *http.Request) {
+	gID, _ := uuid.Parse(chi.URLParam(r, "groupID"))
+	g, ok := a.Manager.GetTaskGroup(gID)
+	if !ok {
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: fmt.Sprintf("No task group with ID %v found", gID)})
+		return
 	}
-	// we need to make a copy so we are not modifying the task in the datastore
-	taskCopy := *taskToStop.(*task.Task)
-	taskCopy.State = task.Completed
-	te.Task = taskCopy
-	a.Manager.AddTask(te)
 
-	log.Printf("Added task event %v to stop task %v\n", te.ID, taskCopy.ID.String())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, g)
+}
+
+func (a *Api) DeleteTaskGroupHandler(w http.ResponseWriter, r *http.Request) {
+	gID, _ := uuid.Parse(chi.URLParam(r, "groupID"))
+	if err := a.Manager.DeleteTaskGroup(gID); err != nil {
+		logger.Warn("Error deleting task group", "group_id", gID, "error", err)
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: err.Error()})
+		return
+	}
 	w.WriteHeader(204)
 }
+
+// Cron jobs
+func (a *Api) CreateCronJobHandler(w http.ResponseWriter, r *http.Request) {
+	te := task.TaskEvent{}
+	err := json.NewDecoder(r.Body).Decode(&te)
+	if err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body: %v", err)
+		logger.Warn(msg)
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+	if errs := validation.ValidateCronJob(te); errs != nil {
+		rejectSubmission(w, 400, CodeInvalid, fmt.Sprintf("Invalid cron job: %v", errs), errs)
+		return
+	}
+
+	created, err := a.Manager.CreateCronJob(te)
+	if err != nil {
+		code := 400
+		if errors.Is(err, manager.ErrCronJobsDisabled) {
+			code = 404
+		}
+		w.WriteHeader(code)
+		encode(w, ErrResponse{HTTPStatusCode: code, Message: err.Error()})
+		return
+	}
+
+	w.WriteHeader(201)
+	encode(w, created)
+}
+
+func (a *Api) GetCronJobsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, a.Manager.GetCronJobs())
+}
+
+func (a *Api) GetCronJobHandler(w http.ResponseWriter, r *http.Request) {
+	cID, _ := uuid.Parse(chi.URLParam(r, "cronJobID"))
+	c, ok := a.Manager.GetCronJob(cID)
+	if !ok {
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: fmt.Sprintf("No cron job with ID %v found", cID)})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, c)
+}
@@ -0,0 +1,74 @@
+package managerApi
+
+import (
+	"cube/config"
+	"cube/manager"
+	v1 "cube/manager/api/v1"
+	"cube/node"
+	"cube/openapi"
+	"cube/store"
+	"cube/task"
+	"cube/timeline"
+	"cube/utils"
+)
+
+// Operations of the manager API, see openapi.Spec
+var spec = openapi.Spec{
+	Title:   "Cube manager API",
+	Version: config.Version,
+	Error:   ErrResponse{},
+	Operations: map[string]openapi.Operation{
+		"POST /tasks":                        {Summary: "Submit a task", Request: task.TaskEvent{}, Response: task.Task{}, Status: 201},
+		"GET /tasks":                         {Summary: "List tasks", Query: []string{"state", "image", "label", "namespace", "sort", "limit", "offset"}, Response: []task.Task{}},
+		"GET /tasks/{taskID}":                {Summary: "Inspect a task and its container", Response: task.Inspection{}},
+		"DELETE /tasks/{taskID}":             {Summary: "Stop a task", Status: 204},
+		"PATCH /tasks/{taskID}":              {Summary: "Roll a task out to a new revision", Request: task.Update{}, Response: task.Task{}, Status: 202},
+		"GET /tasks/{taskID}/logs":           {Summary: "Stream the logs of a task", Query: []string{"follow", "tail"}, ContentType: "text/plain"},
+		"GET /tasks/{taskID}/logs/stream":    {Summary: "Follow the logs of a task as server-sent events", Query: []string{"tail"}, ContentType: utils.SSEContentType},
+		"GET /tasks/{taskID}/events":         {Summary: "List the events of a task", Response: []task.TaskEvent{}},
+		"GET /tasks/{taskID}/dependencies":   {Summary: "Get the dependencies and dependents of a task", Response: manager.TaskDependencies{}},
+		"GET /tasks/{taskID}/stats":          {Summary: "Get the resource usage of a task", Response: task.ContainerStats{}},
+		"GET /tasks/{taskID}/scheduling":     {Summary: "Explain where the scheduler placed a task and why", Response: manager.SchedulingDecision{}},
+		"GET /tasks/{taskID}/result":         {Summary: "Get the output and exit code of a finished job", Response: task.Result{}},
+		"POST /schedule/dry-run":             {Summary: "Preview where a task would be placed", Request: task.Task{}, Response: manager.Explanation{}},
+		"POST /services":                     {Summary: "Create a service", Request: task.Service{}, Response: task.Service{}, Status: 201},
+		"GET /services":                      {Summary: "List services", Response: []task.Service{}},
+		"GET /services/{serviceID}":          {Summary: "Get a service", Response: task.Service{}},
+		"DELETE /services/{serviceID}":       {Summary: "Delete a service and stop its replicas", Status: 204},
+		"POST /deployments":                  {Summary: "Create or roll out a deployment", Request: task.Deployment{}, Response: task.Deployment{}, Status: 201},
+		"GET /deployments":                   {Summary: "List deployments", Response: []task.Deployment{}},
+		"GET /deployments/{deploymentID}":    {Summary: "Get a deployment", Response: task.Deployment{}},
+		"DELETE /deployments/{deploymentID}": {Summary: "Delete a deployment and stop its replicas", Status: 204},
+		"POST /groups":                       {Summary: "Create a task group placed on one worker", Request: task.TaskGroup{}, Response: task.TaskGroup{}, Status: 201},
+		"GET /groups":                        {Summary: "List task groups", Response: []task.TaskGroup{}},
+		"GET /groups/{groupID}":              {Summary: "Get a task group", Response: task.TaskGroup{}},
+		"DELETE /groups/{groupID}":           {Summary: "Delete a task group and stop its members", Status: 204},
+		"POST /cronjobs":                     {Summary: "Create a cron job", Request: task.TaskEvent{}, Response: task.CronJob{}, Status: 201},
+		"GET /cronjobs":                      {Summary: "List cron jobs", Response: []task.CronJob{}},
+		"GET /cronjobs/{cronJobID}":          {Summary: "Get a cron job", Response: task.CronJob{}},
+		"POST /v1/tasks":                     {Summary: "Submit a task", Request: v1.SubmitTaskRequest{}, Response: v1.Task{}, Status: 201},
+		"GET /v1/tasks":                      {Summary: "List tasks", Query: []string{"state", "image", "label", "namespace", "sort", "limit", "offset"}, Response: []v1.Task{}},
+		"GET /v1/tasks/{taskID}":             {Summary: "Get a task", Response: v1.Task{}},
+		"DELETE /v1/tasks/{taskID}":          {Summary: "Stop a task", Status: 204},
+		"GET /nodes":                         {Summary: "List worker nodes", Response: []node.Info{}},
+		"GET /nodes/{name}":                  {Summary: "Get a node with its tasks and recent events", Response: manager.NodeDetail{}},
+		"PUT /nodes/{name}/drain":            {Summary: "Drain or undrain a node", Request: node.DrainRequest{}, Response: node.Info{}},
+		"PUT /nodes/{name}/uncordon":         {Summary: "Lift the drain of a node and enable scheduling on it", Response: node.Info{}},
+		"GET /quotas":                        {Summary: "List namespace quotas and their usage", Response: []manager.QuotaStatus{}},
+		"GET /quotas/{namespace}":            {Summary: "Get the quota of a namespace and its usage", Response: manager.QuotaStatus{}},
+		"PUT /quotas/{namespace}":            {Summary: "Create or replace the quota of a namespace", Request: task.Quota{}, Response: manager.QuotaStatus{}},
+		"DELETE /quotas/{namespace}":         {Summary: "Delete the quota of a namespace", Status: 204},
+		"POST /task-updates":                 {Summary: "Receive a task state change pushed by a worker", Request: task.TaskEvent{}, Status: 204},
+		"POST /heartbeat":                    {Summary: "Receive a heartbeat pushed by a worker", Request: node.Heartbeat{}, Response: node.HeartbeatResponse{}},
+		"GET /events":                        {Summary: "List task events", Response: []task.TaskEvent{}},
+		"GET /timeline/nodes/{name}":         {Summary: "Get the utilization timeline of a node", Query: []string{"from", "to"}, Response: timeline.NodeTimeline{}},
+		"GET /timeline/tasks/{taskID}":       {Summary: "Get the placement history of a task", Response: []timeline.Placement{}},
+		"GET /logs":                          {Summary: "Stream the logs of the tasks matching a selector", Query: []string{"selector", "follow", "tail", "prefix"}, ContentType: "text/plain"},
+		"POST /adopt":                        {Summary: "Import a container running on a worker as a task", Request: AdoptRequest{}, Response: task.Task{}, Status: 201},
+		"GET /status":                        {Summary: "Get the depth of the pending task queue and the submission limits", Response: manager.Status{}},
+		"GET /config":                        {Summary: "Get the manager's effective settings", Response: config.Settings{}},
+		"POST /config/reload":                {Summary: "Reload the workers and scheduler settings from the configuration files", Response: manager.ReloadResult{}},
+		"GET /metrics":                       {Summary: "Prometheus metrics", ContentType: "text/plain"},
+		"GET /leader":                        {Summary: "Get the holder of the leader lease", Response: store.LeaseRecord{}},
+	},
+}
@@ -0,0 +1,89 @@
+package managerApi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"cube/manager"
+	"cube/task"
+	"cube/validation"
+)
+
+// quotaError answers with err, 404 when the quota or the Namespaces gate is missing
+func quotaError(w http.ResponseWriter, err error) {
+	code := 500
+	if errors.Is(err, manager.ErrNamespacesDisabled) || errors.Is(err, manager.ErrQuotaNotFound) {
+		code = 404
+	}
+	w.WriteHeader(code)
+	encode(w, ErrResponse{HTTPStatusCode: code, Message: err.Error()})
+}
+
+func (a *Api) GetQuotasHandler(w http.ResponseWriter, r *http.Request) {
+	quotas, err := a.Manager.GetQuotas()
+	if err != nil {
+		quotaError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, quotas)
+}
+
+func (a *Api) GetQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := a.Manager.GetQuota(chi.URLParam(r, "namespace"))
+	if err != nil {
+		quotaError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, q)
+}
+
+// SetQuotaHandler creates or replaces the quota of the namespace in the path
+func (a *Api) SetQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	q := task.Quota{}
+	if err := d.Decode(&q); err != nil {
+		rejectSubmission(w, 400, CodeMalformed, fmt.Sprintf("Error unmarshalling body: %v", err), nil)
+		return
+	}
+	ns := chi.URLParam(r, "namespace")
+	if q.Namespace != "" && q.Namespace != ns {
+		rejectSubmission(w, 400, CodeInvalid, fmt.Sprintf("Invalid quota: namespace %q does not match the path", q.Namespace),
+			validation.Errors{{Field: "Namespace", Message: fmt.Sprintf("must be %q or empty", ns)}})
+		return
+	}
+	q.Namespace = ns
+	if errs := validation.ValidateQuota(q); errs != nil {
+		rejectSubmission(w, 400, CodeInvalid, fmt.Sprintf("Invalid quota: %v", errs), errs)
+		return
+	}
+
+	status, err := a.Manager.SetQuota(q)
+	if err != nil {
+		if !errors.Is(err, manager.ErrNamespacesDisabled) {
+			logger.Error("Error setting quota", "namespace", ns, "error", err)
+		}
+		quotaError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, status)
+}
+
+func (a *Api) DeleteQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	if err := a.Manager.DeleteQuota(chi.URLParam(r, "namespace")); err != nil {
+		quotaError(w, err)
+		return
+	}
+	w.WriteHeader(204)
+}
@@ -0,0 +1,82 @@
+package managerApi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"cube/config"
+	v1 "cube/manager/api/v1"
+	"cube/store"
+	"cube/task"
+)
+
+// initV1Routes serves the task routes under /v1 with the bodies of package v1.
+// The unversioned routes keep serving the internal types for the CLI.
+func (a *Api) initV1Routes() {
+	a.Router.Route(v1.Prefix, func(r chi.Router) {
+		r.Route("/tasks", func(r chi.Router) {
+			r.Post("/", a.StartTaskV1Handler)
+			r.Get("/", a.GetTasksV1Handler)
+			r.Route("/{taskID}", func(r chi.Router) {
+				r.Get("/", a.GetTaskV1Handler)
+				r.Delete("/", a.StopTaskHandler)
+			})
+		})
+	})
+}
+
+func (a *Api) StartTaskV1Handler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	req := v1.SubmitTaskRequest{}
+	if err := d.Decode(&req); err != nil {
+		rejectSubmission(w, 400, CodeMalformed, fmt.Sprintf("Error unmarshalling body: %v", err), nil)
+		return
+	}
+	a.submitTask(w, r, req.TaskEvent(), func(t task.Task) any { return v1.FromTask(t) })
+}
+
+func (a *Api) GetTasksV1Handler(w http.ResponseWriter, r *http.Request) {
+	q, err := store.ParseTaskQuery(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: err.Error()})
+		return
+	}
+	tasks, total, err := a.Manager.QueryTasks(q)
+	if err != nil {
+		logger.Error("Error querying tasks", "error", err)
+		w.WriteHeader(500)
+		encode(w, ErrResponse{HTTPStatusCode: 500, Message: err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(config.TotalCountHeader, strconv.Itoa(total))
+	w.WriteHeader(200)
+	encode(w, v1.FromTasks(tasks))
+}
+
+func (a *Api) GetTaskV1Handler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+	if err != nil {
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: "Invalid task ID"})
+		return
+	}
+
+	t, err := a.Manager.GetTask(tID)
+	if err != nil {
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: fmt.Sprintf("No task with ID %v found", tID)})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, v1.FromTask(*t))
+}
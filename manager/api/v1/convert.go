@@ -0,0 +1,257 @@
+package v1
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/google/uuid"
+
+	"cube/task"
+)
+
+// TaskEvent translates a submission to the task event the manager adds, the
+// task is validated like any other submission
+func (r SubmitTaskRequest) TaskEvent() task.TaskEvent {
+	id := r.ID
+	if id == uuid.Nil {
+		id = uuid.New()
+	}
+	return task.TaskEvent{
+		ID:        id,
+		State:     task.Running,
+		Timestamp: time.Now(),
+		Task:      r.Task.task(),
+	}
+}
+
+func (s TaskSpec) task() task.Task {
+	t := task.Task{
+		ID:              s.ID,
+		Name:            s.Name,
+		State:           task.Pending,
+		Image:           s.Image,
+		ImagePullPolicy: task.ImagePullPolicy(s.ImagePullPolicy),
+		Platform:        s.Platform,
+		Cmd:             s.Cmd,
+		Env:             s.Env,
+		Labels:          s.Labels,
+		Namespace:       s.Namespace,
+		Kind:            task.Kind(s.Kind),
+		Cpu:             s.Cpu,
+		Memory:          s.Memory,
+		Disk:            s.Disk,
+		CpuLimit:        s.CpuLimit,
+		MemoryLimit:     s.MemoryLimit,
+		CpusetCpus:      s.CpusetCpus,
+		Priority:        s.Priority,
+		NodeSelector:    s.NodeSelector,
+		Constraints:     s.Constraints,
+		Affinity:        s.Affinity,
+		AntiAffinity:    s.AntiAffinity,
+		Capabilities:    s.Capabilities,
+		Networks:        s.Networks,
+		HealthCheck:     s.HealthCheck,
+		StopTimeout:     s.StopTimeout,
+		Timeout:         s.Timeout,
+		Deadline:        s.Deadline,
+		DependsOn:       s.DependsOn,
+	}
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	for _, d := range s.Devices {
+		t.DeviceRequests = append(t.DeviceRequests, task.DeviceRequest(d))
+	}
+	for _, m := range s.Mounts {
+		t.Mounts = append(t.Mounts, task.Mount{Type: task.MountType(m.Type), Source: m.Source, Target: m.Target, ReadOnly: m.ReadOnly})
+	}
+	// Bound ports are exposed by the worker, the others are published on random host ports
+	for _, p := range s.Ports {
+		if p.HostPort != "" {
+			if t.PortBindings == nil {
+				t.PortBindings = make(map[string]string)
+			}
+			t.PortBindings[p.ContainerPort] = p.HostPort
+			continue
+		}
+		if t.ExposedPorts == nil {
+			t.ExposedPorts = make(nat.PortSet)
+		}
+		t.ExposedPorts[withProto(p.ContainerPort)] = struct{}{}
+	}
+	if s.RegistryAuth != nil {
+		auth := task.RegistryAuth(*s.RegistryAuth)
+		t.RegistryAuth = &auth
+	}
+	if s.RestartPolicy != nil {
+		t.RestartPolicy = task.RestartPolicy{
+			Name:              task.RestartMode(s.RestartPolicy.Name),
+			MaxRetries:        s.RestartPolicy.MaxRetries,
+			BackoffSeconds:    s.RestartPolicy.BackoffSeconds,
+			MaxBackoffSeconds: s.RestartPolicy.MaxBackoffSeconds,
+			RestartOnDeadline: s.RestartPolicy.RestartOnDeadline,
+		}
+	}
+	t.Probe = s.Probe.task()
+	t.StartupProbe = s.StartupProbe.task()
+	if h := s.ContainerHealthcheck; h != nil {
+		hc := task.ContainerHealthcheck(*h)
+		t.ContainerHealthcheck = &hc
+	}
+	return t
+}
+
+func (p *Probe) task() *task.Probe {
+	if p == nil {
+		return nil
+	}
+	return &task.Probe{
+		Type:                task.ProbeType(p.Type),
+		Path:                p.Path,
+		Port:                p.Port,
+		Command:             p.Command,
+		IntervalSeconds:     p.IntervalSeconds,
+		TimeoutSeconds:      p.TimeoutSeconds,
+		FailureThreshold:    p.FailureThreshold,
+		InitialDelaySeconds: p.InitialDelaySeconds,
+	}
+}
+
+func probeFromTask(p *task.Probe) *Probe {
+	if p == nil {
+		return nil
+	}
+	return &Probe{
+		Type:                string(p.Type),
+		Path:                p.Path,
+		Port:                p.Port,
+		Command:             p.Command,
+		IntervalSeconds:     p.IntervalSeconds,
+		TimeoutSeconds:      p.TimeoutSeconds,
+		FailureThreshold:    p.FailureThreshold,
+		InitialDelaySeconds: p.InitialDelaySeconds,
+	}
+}
+
+// withProto returns a container port with its protocol, tcp when it has none
+func withProto(port string) nat.Port {
+	if !strings.Contains(port, "/") {
+		port += "/tcp"
+	}
+	return nat.Port(port)
+}
+
+// FromTask translates a task to its v1 representation, masking its registry secrets
+func FromTask(t task.Task) Task {
+	t = t.Redacted()
+	out := Task{
+		TaskSpec: TaskSpec{
+			ID:              t.ID,
+			Name:            t.Name,
+			Image:           t.Image,
+			ImagePullPolicy: string(t.ImagePullPolicy),
+			Platform:        t.Platform,
+			Cmd:             t.Cmd,
+			Env:             t.Env,
+			Labels:          t.Labels,
+			Namespace:       t.Namespace,
+			Kind:            string(t.Kind),
+			Cpu:             t.Cpu,
+			Memory:          t.Memory,
+			Disk:            t.Disk,
+			CpuLimit:        t.CpuLimit,
+			MemoryLimit:     t.MemoryLimit,
+			CpusetCpus:      t.CpusetCpus,
+			Priority:        t.Priority,
+			NodeSelector:    t.NodeSelector,
+			Constraints:     t.Constraints,
+			Affinity:        t.Affinity,
+			AntiAffinity:    t.AntiAffinity,
+			Capabilities:    t.Capabilities,
+			Networks:        t.Networks,
+			HealthCheck:     t.HealthCheck,
+			StopTimeout:     t.StopTimeout,
+			Timeout:         t.Timeout,
+			Deadline:        t.Deadline,
+			DependsOn:       t.DependsOn,
+			RestartPolicy: &RestartPolicy{
+				Name:              string(t.RestartPolicy.Name),
+				MaxRetries:        t.RestartPolicy.MaxRetries,
+				BackoffSeconds:    t.RestartPolicy.BackoffSeconds,
+				MaxBackoffSeconds: t.RestartPolicy.MaxBackoffSeconds,
+				RestartOnDeadline: t.RestartPolicy.RestartOnDeadline,
+			},
+		},
+		State:         t.State.String(),
+		QoSClass:      string(t.QoSClass),
+		ContainerName: t.ContainerName,
+		Health:        string(t.Health),
+		FailureReason: string(t.FailureReason),
+		Error:         t.Error,
+		ErrorCode:     string(t.ErrorCode),
+		StartTime:     t.StartTime,
+		FinishTime:    t.FinishTime,
+		ExitCode:      t.ExitCode,
+		OOMKilled:     t.OOMKilled,
+		OutputTail:    t.OutputTail,
+		RestartCount:  t.RestartCount,
+		NextRestart:   t.NextRestart,
+		Revision:      t.Revision,
+	}
+	if *out.RestartPolicy == (RestartPolicy{}) {
+		out.RestartPolicy = nil
+	}
+	for _, d := range t.DeviceRequests {
+		out.Devices = append(out.Devices, DeviceRequest(d))
+	}
+	for _, m := range t.Mounts {
+		out.Mounts = append(out.Mounts, Mount{Type: string(m.Type), Source: m.Source, Target: m.Target, ReadOnly: m.ReadOnly})
+	}
+	for p := range t.ExposedPorts {
+		out.Ports = append(out.Ports, Port{ContainerPort: string(p)})
+	}
+	for p, hostPort := range t.PortBindings {
+		out.Ports = append(out.Ports, Port{ContainerPort: p, HostPort: hostPort})
+	}
+	slices.SortFunc(out.Ports, func(a, b Port) int { return strings.Compare(a.ContainerPort, b.ContainerPort) })
+	for p, bindings := range t.HostPorts {
+		for _, b := range bindings {
+			out.HostPorts = append(out.HostPorts, PublishedPort{ContainerPort: string(p), HostIP: b.HostIP, HostPort: b.HostPort})
+		}
+	}
+	slices.SortFunc(out.HostPorts, func(a, b PublishedPort) int {
+		return strings.Compare(a.ContainerPort+"/"+a.HostIP, b.ContainerPort+"/"+b.HostIP)
+	})
+	if t.RegistryAuth != nil {
+		auth := RegistryAuth(*t.RegistryAuth)
+		out.RegistryAuth = &auth
+	}
+	out.Probe = probeFromTask(t.Probe)
+	out.StartupProbe = probeFromTask(t.StartupProbe)
+	if h := t.ContainerHealthcheck; h != nil {
+		hc := ContainerHealthcheck(*h)
+		out.ContainerHealthcheck = &hc
+	}
+	for _, c := range t.Conditions {
+		out.Conditions = append(out.Conditions, Condition{Type: string(c.Type), Message: c.Message, Since: c.Since, Attempts: c.Attempts, NextAttempt: c.NextAttempt})
+	}
+	if t.Usage != nil {
+		u := Usage(*t.Usage)
+		out.Usage = &u
+	}
+	for _, p := range t.Placements {
+		out.Placements = append(out.Placements, Placement{Worker: p.Worker, Time: p.Time, Reason: p.Reason})
+	}
+	return out
+}
+
+// FromTasks translates a list of tasks, see FromTask
+func FromTasks(tasks []*task.Task) []Task {
+	out := make([]Task, 0, len(tasks))
+	for _, t := range tasks {
+		out = append(out, FromTask(*t))
+	}
+	return out
+}
@@ -0,0 +1,184 @@
+package v1
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+/**
+* Manager API v1
+* Request and response bodies of the /v1 routes. They are kept apart from the
+* internal task.Task, which is stored and sent to workers and changes with them,
+* and only use plain types: ports are listed instead of Docker's nat.PortSet and
+* nat.PortMap, states are named. Fields are only ever added to v1, as optional
+* ones, breaking changes go to a new version. See FromTask and
+* SubmitTaskRequest.TaskEvent for the translation to and from the internal model.
+ */
+const Prefix = "/v1"
+
+// SubmitTaskRequest is the body of POST /v1/tasks
+type SubmitTaskRequest struct {
+	// Identifies the submission when no Idempotency-Key header is sent, generated when empty
+	ID   uuid.UUID
+	Task TaskSpec
+}
+
+// TaskSpec is what a client asks for, echoed back in Task
+type TaskSpec struct {
+	// Generated when empty
+	ID              uuid.UUID
+	Name            string
+	Image           string
+	ImagePullPolicy string            `json:",omitempty"`
+	Platform        string            `json:",omitempty"`
+	Cmd             []string          `json:",omitempty"`
+	Env             []string          `json:",omitempty"`
+	Labels          map[string]string `json:",omitempty"`
+	Namespace       string            `json:",omitempty"`
+	Kind            string            `json:",omitempty"`
+	// Resources: requests, limits, pinned CPUs and devices
+	Cpu         float64         `json:",omitempty"`
+	Memory      int64           `json:",omitempty"`
+	Disk        int64           `json:",omitempty"`
+	CpuLimit    float64         `json:",omitempty"`
+	MemoryLimit int64           `json:",omitempty"`
+	CpusetCpus  string          `json:",omitempty"`
+	Devices     []DeviceRequest `json:",omitempty"`
+	Priority    int             `json:",omitempty"`
+	// Placement
+	NodeSelector map[string]string `json:",omitempty"`
+	Constraints  []string          `json:",omitempty"`
+	Affinity     string            `json:",omitempty"`
+	AntiAffinity string            `json:",omitempty"`
+	Capabilities []string          `json:",omitempty"`
+	// Networking and storage
+	Ports    []Port   `json:",omitempty"`
+	Networks []string `json:",omitempty"`
+	Mounts   []Mount  `json:",omitempty"`
+	// Credentials of a private registry, secrets are masked in responses
+	RegistryAuth *RegistryAuth `json:",omitempty"`
+	// Lifecycle
+	RestartPolicy *RestartPolicy `json:",omitempty"`
+	HealthCheck   string         `json:",omitempty"`
+	Probe         *Probe         `json:",omitempty"`
+	// Probe that must succeed before Probe runs, for slow-starting apps
+	StartupProbe *Probe `json:",omitempty"`
+	// Healthcheck run by the container runtime, like a Dockerfile HEALTHCHECK
+	ContainerHealthcheck *ContainerHealthcheck `json:",omitempty"`
+	StopTimeout          int                   `json:",omitempty"`
+	Timeout              int                   `json:",omitempty"`
+	Deadline             time.Time             `json:",omitempty"`
+	DependsOn            []uuid.UUID           `json:",omitempty"`
+}
+
+// Port exposes a container port, e.g. "80" or "53/udp", on HostPort or on a
+// random host port when HostPort is empty
+type Port struct {
+	ContainerPort string
+	HostPort      string `json:",omitempty"`
+}
+
+// PublishedPort is a host port a container port was published on
+type PublishedPort struct {
+	ContainerPort string
+	HostIP        string `json:",omitempty"`
+	HostPort      string
+}
+
+type Mount struct {
+	Type     string
+	Source   string `json:",omitempty"`
+	Target   string
+	ReadOnly bool `json:",omitempty"`
+}
+
+type DeviceRequest struct {
+	Driver       string   `json:",omitempty"`
+	Count        int      `json:",omitempty"`
+	DeviceIDs    []string `json:",omitempty"`
+	Capabilities []string `json:",omitempty"`
+}
+
+type RegistryAuth struct {
+	Username      string `json:",omitempty"`
+	Password      string `json:",omitempty"`
+	IdentityToken string `json:",omitempty"`
+}
+
+type RestartPolicy struct {
+	Name              string `json:",omitempty"`
+	MaxRetries        int    `json:",omitempty"`
+	BackoffSeconds    int    `json:",omitempty"`
+	MaxBackoffSeconds int    `json:",omitempty"`
+	RestartOnDeadline bool   `json:",omitempty"`
+}
+
+type Probe struct {
+	Type             string
+	Path             string   `json:",omitempty"`
+	Port             string   `json:",omitempty"`
+	Command          []string `json:",omitempty"`
+	IntervalSeconds  int      `json:",omitempty"`
+	TimeoutSeconds   int      `json:",omitempty"`
+	FailureThreshold int      `json:",omitempty"`
+	// Seconds after the container started before failures are counted
+	InitialDelaySeconds int `json:",omitempty"`
+}
+
+type ContainerHealthcheck struct {
+	Test               []string
+	IntervalSeconds    int `json:",omitempty"`
+	TimeoutSeconds     int `json:",omitempty"`
+	StartPeriodSeconds int `json:",omitempty"`
+	Retries            int `json:",omitempty"`
+}
+
+// Task is a task as returned by the /v1 routes: its spec and its status
+type Task struct {
+	TaskSpec
+	State         string
+	QoSClass      string          `json:",omitempty"`
+	ContainerName string          `json:",omitempty"`
+	HostPorts     []PublishedPort `json:",omitempty"`
+	Health        string          `json:",omitempty"`
+	FailureReason string          `json:",omitempty"`
+	Error         string          `json:",omitempty"`
+	ErrorCode     string          `json:",omitempty"`
+	Conditions    []Condition     `json:",omitempty"`
+	StartTime     time.Time       `json:",omitempty"`
+	FinishTime    time.Time       `json:",omitempty"`
+	ExitCode      int
+	OOMKilled     bool      `json:",omitempty"`
+	OutputTail    string    `json:",omitempty"`
+	RestartCount  int       `json:",omitempty"`
+	NextRestart   time.Time `json:",omitempty"`
+	Revision      int       `json:",omitempty"`
+	Usage         *Usage    `json:",omitempty"`
+	// Workers the task was placed on, oldest first
+	Placements []Placement `json:",omitempty"`
+}
+
+type Condition struct {
+	Type        string
+	Message     string
+	Since       time.Time
+	Attempts    int
+	NextAttempt time.Time `json:",omitempty"`
+}
+
+// Usage is the resource usage last sampled for the task's container
+type Usage struct {
+	CpuPercent  float64
+	MemoryUsage uint64
+	MemoryLimit uint64
+	NetworkRx   uint64
+	NetworkTx   uint64
+	Timestamp   time.Time
+}
+
+type Placement struct {
+	Worker string
+	Time   time.Time
+	Reason string `json:",omitempty"`
+}
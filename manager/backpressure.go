@@ -0,0 +1,105 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+/**
+* Submission backpressure
+* Task submissions are admitted through a token bucket, SubmitRate tasks per
+* second with bursts of SubmitBurst, and refused while MaxPending task events
+* wait to be dispatched. Refused submissions are not queued, clients are told
+* when to retry instead: once the bucket has a token again, or after the next
+* dispatch round for a full queue. Retries of a submission already accepted are
+* answered without being throttled.
+ */
+
+var (
+	ErrRateLimited = errors.New("too many task submissions")
+	ErrQueueFull   = errors.New("too many pending tasks")
+)
+
+// ThrottledError is returned for a submission refused by backpressure
+type ThrottledError struct {
+	// ErrRateLimited or ErrQueueFull
+	Err error
+	// When the submission may be retried
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%v, retry after %v", e.Err, e.RetryAfter)
+}
+
+func (e *ThrottledError) Unwrap() error {
+	return e.Err
+}
+
+// Status is the manager's submission queue and its limits, served on GET /status
+type Status struct {
+	// Task events waiting to be dispatched
+	PendingTasks int
+	// Zero when the queue is unbounded
+	MaxPending int
+	// Zero when submissions are not rate limited
+	SubmitRate  float64 `json:",omitempty"`
+	SubmitBurst int     `json:",omitempty"`
+	// Submissions refused by backpressure since the manager started, by reason
+	Throttled map[string]int
+}
+
+// SetSubmitLimit admits r task submissions per second with bursts of burst, zero
+// r disables rate limiting
+func (m *Manager) SetSubmitLimit(r float64, burst int) {
+	m.submitMu.Lock()
+	defer m.submitMu.Unlock()
+	m.SubmitRate, m.SubmitBurst = r, burst
+	m.limiter = nil
+	if r > 0 {
+		m.limiter = rate.NewLimiter(rate.Limit(r), max(burst, 1))
+	}
+}
+
+// throttle refuses a submission when the pending queue is full or no token is
+// left, called with submitMu held
+func (m *Manager) throttle() error {
+	if m.MaxPending > 0 && m.PendingLen() >= m.MaxPending {
+		return m.throttled(&ThrottledError{Err: ErrQueueFull, RetryAfter: m.ProcessInterval}, "queue_full")
+	}
+	if m.limiter == nil {
+		return nil
+	}
+	r := m.limiter.Reserve()
+	if d := r.Delay(); d > 0 {
+		r.Cancel()
+		return m.throttled(&ThrottledError{Err: ErrRateLimited, RetryAfter: d}, "rate_limited")
+	}
+	return nil
+}
+
+func (m *Manager) throttled(err *ThrottledError, reason string) error {
+	m.throttledCount[reason]++
+	m.metrics.throttled.Inc(reason)
+	return err
+}
+
+// Status returns the submission queue depth and limits
+func (m *Manager) Status() Status {
+	m.submitMu.Lock()
+	defer m.submitMu.Unlock()
+	s := Status{
+		PendingTasks: m.PendingLen(),
+		MaxPending:   m.MaxPending,
+		SubmitRate:   m.SubmitRate,
+		SubmitBurst:  m.SubmitBurst,
+		Throttled:    make(map[string]int),
+	}
+	for reason, n := range m.throttledCount {
+		s.Throttled[reason] = n
+	}
+	return s
+}
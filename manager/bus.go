@@ -0,0 +1,36 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/eventbus"
+	"cube/task"
+)
+
+// subscribe connects the manager's event consumers to its bus, and publishes the
+// state transitions of the state machine on it
+func (m *Manager) subscribe() {
+	m.Bus.OnDrop = func(subscriber string, e eventbus.Event) {
+		m.metrics.busDropped.Inc(subscriber)
+	}
+	m.Bus.Subscribe("history", m.storeEvent, eventbus.TaskRecorded)
+	m.Bus.Subscribe("metrics", m.metrics.observe)
+	m.States.OnTransition(task.AnyState, task.AnyState, task.TransitionHookFunc(func(t task.Task, from task.State, to task.State) {
+		m.Bus.Publish(eventbus.Event{
+			Topic:     eventbus.TaskTransitioned,
+			TaskEvent: task.TaskEvent{ID: uuid.New(), Timestamp: time.Now().UTC(), State: to, Task: t},
+			Previous:  from,
+		})
+	}))
+}
+
+// publish publishes an event about t on the bus, reason is the outcome for the topic
+func (m *Manager) publish(topic eventbus.Topic, t task.Task, worker string, reason string) {
+	m.Bus.Publish(eventbus.Event{
+		Topic:     topic,
+		TaskEvent: task.TaskEvent{ID: uuid.New(), Timestamp: time.Now().UTC(), State: t.State, Task: t, Worker: worker},
+		Reason:    reason,
+	})
+}
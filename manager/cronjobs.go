@@ -0,0 +1,210 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/cron"
+	"cube/features"
+	"cube/task"
+	"cube/utils"
+)
+
+var ErrCronJobsDisabled = errors.New("the CronJobs feature gate is disabled")
+
+// How often cron schedules are checked for due runs
+const cronInterval = 10 * time.Second
+
+// Runs kept in a cron job's history
+const cronHistoryLimit = 20
+
+// Runs not persisted this long after their trigger are assumed dropped as unschedulable
+const cronPendingTimeout = 5 * time.Minute
+
+/**
+* Cron jobs
+* A cron job starts a new instance of its task template on every trigger of its
+* schedule. Runs are labelled with the cron job ID; a trigger firing while an
+* earlier run is still live is handled according to the job's ConcurrencyPolicy.
+ */
+func (m *Manager) CreateCronJob(te task.TaskEvent) (*task.CronJob, error) {
+	if !features.Enabled(features.CronJobs) {
+		return nil, ErrCronJobsDisabled
+	}
+	schedule, err := cron.Parse(te.CronSpec)
+	if err != nil {
+		return nil, err
+	}
+	policy := te.ConcurrencyPolicy
+	if policy == "" {
+		policy = task.AllowConcurrent
+	}
+	if !slices.Contains(task.ConcurrencyPolicies, policy) {
+		return nil, fmt.Errorf("unknown concurrency policy %q, expected one of %v", policy, task.ConcurrencyPolicies)
+	}
+
+	now := time.Now().UTC()
+	c := &task.CronJob{
+		ID:                uuid.New(),
+		Name:              te.Task.Name,
+		Schedule:          te.CronSpec,
+		ConcurrencyPolicy: policy,
+		Template:          te.Task,
+		NextRun:           schedule.Next(now),
+		CreatedAt:         now,
+	}
+
+	m.mu.Lock()
+	m.CronJobs[c.ID] = c
+	m.mu.Unlock()
+	m.saveCronJob(c)
+	logger.Info("Created cron job", "cronjob", c.Name, "cronjob_id", c.ID, "schedule", c.Schedule, "next_run", c.NextRun)
+	return c, nil
+}
+
+func (m *Manager) GetCronJobs() []task.CronJob {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	jobs := make([]task.CronJob, 0, len(m.CronJobs))
+	for _, c := range m.CronJobs {
+		jobs = append(jobs, snapshotCronJob(c))
+	}
+	slices.SortFunc(jobs, func(a, b task.CronJob) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return jobs
+}
+
+func (m *Manager) GetCronJob(id uuid.UUID) (task.CronJob, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c, ok := m.CronJobs[id]
+	if !ok {
+		return task.CronJob{}, false
+	}
+	return snapshotCronJob(c), true
+}
+
+// snapshotCronJob copies a cron job so it can be encoded while runs are recorded
+func snapshotCronJob(c *task.CronJob) task.CronJob {
+	s := *c
+	s.History = slices.Clone(c.History)
+	return s
+}
+
+// RunCronJobs starts the runs of every cron job as they become due
+func (m *Manager) RunCronJobs(ctx context.Context) {
+	m.Watchdog.Register("cronJobs", cronInterval)
+	for {
+		m.Watchdog.Beat("cronJobs")
+		if features.Enabled(features.CronJobs) {
+			m.runCronJobs(time.Now().UTC())
+		}
+		if !utils.SleepContext(ctx, cronInterval) {
+			return
+		}
+	}
+}
+
+func (m *Manager) runCronJobs(now time.Time) {
+	m.mu.RLock()
+	var due []*task.CronJob
+	for _, c := range m.CronJobs {
+		if !c.NextRun.IsZero() && !now.Before(c.NextRun) {
+			due = append(due, c)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, c := range due {
+		m.triggerCronJob(c, now)
+	}
+}
+
+// triggerCronJob starts the run due at c.NextRun, subject to the concurrency policy
+func (m *Manager) triggerCronJob(c *task.CronJob, now time.Time) {
+	schedule, err := cron.Parse(c.Schedule)
+	if err != nil {
+		logger.Error("Invalid schedule of cron job", "cronjob_id", c.ID, "error", err)
+		return
+	}
+	active, queued := m.activeCronRuns(c, now)
+
+	m.mu.Lock()
+	run := task.CronRun{ScheduledAt: c.NextRun, State: task.Pending}
+	c.NextRun = schedule.Next(now)
+	m.mu.Unlock()
+
+	if len(active)+queued > 0 {
+		switch c.ConcurrencyPolicy {
+		case task.ForbidConcurrent:
+			logger.Info("Skipping run of cron job, runs still active", "cronjob", c.Name, "active", len(active)+queued)
+			run.Skipped = true
+			m.recordCronRun(c, run)
+			return
+		case task.ReplaceConcurrent:
+			for _, t := range active {
+				logger.Info("Replacing run of cron job", "task_id", t.ID, "cronjob", c.Name)
+				m.StopTask(t.ID)
+			}
+		}
+	}
+
+	t := c.NewRun(run.ScheduledAt)
+	run.TaskID = t.ID
+	m.recordCronRun(c, run)
+	m.AddTask(task.TaskEvent{ID: uuid.New(), State: task.Scheduled, Timestamp: time.Now(), Task: t})
+	logger.Info("Started run of cron job", "task_id", t.ID, "cronjob", c.Name, "next_run", c.NextRun)
+}
+
+func (m *Manager) recordCronRun(c *task.CronJob, run task.CronRun) {
+	m.mu.Lock()
+	c.History = append(c.History, run)
+	if len(c.History) > cronHistoryLimit {
+		c.History = slices.Clone(c.History[len(c.History)-cronHistoryLimit:])
+	}
+	m.mu.Unlock()
+	m.saveCronJob(c)
+}
+
+// activeCronRuns refreshes the state of c's runs and returns the tasks still live,
+// along with the number of runs still waiting in the pending queue
+func (m *Manager) activeCronRuns(c *task.CronJob, now time.Time) ([]task.Task, int) {
+	m.mu.RLock()
+	history := slices.Clone(c.History)
+	m.mu.RUnlock()
+
+	var active []task.Task
+	queued := 0
+	states := make(map[uuid.UUID]task.State)
+	for _, run := range history {
+		if run.Skipped {
+			continue
+		}
+		res, err := m.TaskDb.Get(run.TaskID.String())
+		if err != nil {
+			// Runs never seen in the datastore are still pending, others were collected after finishing
+			if run.State == task.Pending && now.Sub(run.ScheduledAt) < cronPendingTimeout {
+				queued++
+			}
+			continue
+		}
+		t := *res.(*task.Task)
+		states[t.ID] = t.State
+		if isLive(t) {
+			active = append(active, t)
+		}
+	}
+
+	m.mu.Lock()
+	for i := range c.History {
+		if s, ok := states[c.History[i].TaskID]; ok {
+			c.History[i].State = s
+		}
+	}
+	m.mu.Unlock()
+	return active, queued
+}
@@ -0,0 +1,120 @@
+package dag
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+/**
+* Task dependency graph
+* Edges point from a task to the tasks it depends on. Dependencies may be added
+* before the tasks they name are known, so a task submitted later can close a cycle;
+* Add rejects such edges. A Graph is not safe for concurrent use.
+ */
+type Graph struct {
+	dependsOn  map[uuid.UUID][]uuid.UUID
+	dependents map[uuid.UUID][]uuid.UUID
+}
+
+func New() *Graph {
+	return &Graph{
+		dependsOn:  make(map[uuid.UUID][]uuid.UUID),
+		dependents: make(map[uuid.UUID][]uuid.UUID),
+	}
+}
+
+// CycleError is returned by Add for dependencies that would form a cycle
+type CycleError struct {
+	// Tasks on the cycle, starting and ending with the added task
+	Path []uuid.UUID
+}
+
+func (e *CycleError) Error() string {
+	ids := make([]string, len(e.Path))
+	for i, id := range e.Path {
+		ids[i] = id.String()
+	}
+	return fmt.Sprintf("dependency cycle: %s", strings.Join(ids, " -> "))
+}
+
+// Add sets the dependencies of id, replacing earlier ones. The graph is left
+// unchanged when they would form a cycle.
+func (g *Graph) Add(id uuid.UUID, dependsOn []uuid.UUID) error {
+	previous, existed := g.dependsOn[id]
+	g.unlink(id)
+	g.dependsOn[id] = slices.Clone(dependsOn)
+	if path := g.cycleFrom(id); path != nil {
+		g.unlink(id)
+		if existed {
+			g.link(id, previous)
+		}
+		return &CycleError{Path: path}
+	}
+	g.link(id, dependsOn)
+	return nil
+}
+
+// Remove drops the dependencies of id. Edges of tasks depending on id are kept.
+func (g *Graph) Remove(id uuid.UUID) {
+	g.unlink(id)
+}
+
+// DependsOn returns the tasks id depends on
+func (g *Graph) DependsOn(id uuid.UUID) []uuid.UUID {
+	return slices.Clone(g.dependsOn[id])
+}
+
+// Dependents returns the tasks depending on id
+func (g *Graph) Dependents(id uuid.UUID) []uuid.UUID {
+	return slices.Clone(g.dependents[id])
+}
+
+func (g *Graph) link(id uuid.UUID, dependsOn []uuid.UUID) {
+	g.dependsOn[id] = slices.Clone(dependsOn)
+	for _, dep := range dependsOn {
+		if !slices.Contains(g.dependents[dep], id) {
+			g.dependents[dep] = append(g.dependents[dep], id)
+		}
+	}
+}
+
+func (g *Graph) unlink(id uuid.UUID) {
+	for _, dep := range g.dependsOn[id] {
+		g.dependents[dep] = slices.DeleteFunc(g.dependents[dep], func(d uuid.UUID) bool { return d == id })
+		if len(g.dependents[dep]) == 0 {
+			delete(g.dependents, dep)
+		}
+	}
+	delete(g.dependsOn, id)
+}
+
+// cycleFrom returns a path leading from start back to itself, or nil
+func (g *Graph) cycleFrom(start uuid.UUID) []uuid.UUID {
+	visited := make(map[uuid.UUID]bool)
+	var path []uuid.UUID
+	var visit func(id uuid.UUID) bool
+	visit = func(id uuid.UUID) bool {
+		path = append(path, id)
+		for _, dep := range g.dependsOn[id] {
+			if dep == start {
+				path = append(path, dep)
+				return true
+			}
+			if !visited[dep] {
+				visited[dep] = true
+				if visit(dep) {
+					return true
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+	if visit(start) {
+		return path
+	}
+	return nil
+}
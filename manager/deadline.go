@@ -0,0 +1,19 @@
+package manager
+
+import (
+	"time"
+
+	"cube/task"
+)
+
+// failDeadline fails a task whose deadline passed before it was dispatched
+func (m *Manager) failDeadline(t task.Task) {
+	previous := t.State
+	t.State = task.Failed
+	t.FailureReason = task.ReasonDeadlineExceeded
+	t.FinishTime = time.Now().UTC()
+	m.TaskDb.Put(t.ID.String(), &t)
+	m.States.Fire(t, previous, task.Failed)
+	m.recordEvent(t, "", "deadline passed before the task was dispatched")
+	logger.Warn("Deadline of task passed before it was dispatched, failing the task", "task_id", t.ID, "deadline", t.Deadline)
+}
@@ -0,0 +1,197 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/task"
+)
+
+/**
+* Task dependencies
+* Tasks declaring DependsOn are only dispatched once every task they depend on is
+* Completed. Until then their event waits outside the pending queue, and the task is
+* stored as Pending. A dependency that fails for good, or is stopped, fails the tasks
+* waiting on it. Dependencies must be submitted eventually, unknown tasks are waited for.
+ */
+
+// Dependency of a task as served by GET /tasks/{id}/dependencies
+type Dependency struct {
+	ID    uuid.UUID
+	Name  string `json:",omitempty"`
+	State string
+}
+
+type TaskDependencies struct {
+	TaskID     uuid.UUID
+	DependsOn  []Dependency
+	Dependents []uuid.UUID
+	// Waiting for its dependencies to complete
+	Waiting bool
+}
+
+type dependencyStatus int
+
+const (
+	dependenciesPending dependencyStatus = iota
+	dependenciesCompleted
+	dependenciesFailed
+)
+
+// addDependencies records the dependencies of t, rejecting dependency cycles
+func (m *Manager) addDependencies(t task.Task) error {
+	if len(t.DependsOn) == 0 {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.deps.Add(t.ID, t.DependsOn)
+}
+
+// waitForDependencies holds back the event of a task whose dependencies did not
+// complete yet, reporting whether it was held back
+func (m *Manager) waitForDependencies(te task.TaskEvent) bool {
+	t := te.Task
+	if len(t.DependsOn) == 0 {
+		return false
+	}
+	status, dep := m.dependencyStatus(t)
+	switch status {
+	case dependenciesCompleted:
+		return false
+	case dependenciesFailed:
+		m.failOnDependency(t, dep)
+		return true
+	}
+
+	m.mu.Lock()
+	// Tasks recovered from the store are not in the graph yet
+	if err := m.deps.Add(t.ID, t.DependsOn); err != nil {
+		logger.Warn("Ignoring dependencies of task", "task_id", t.ID, "error", err)
+	}
+	_, waiting := m.waiting[t.ID]
+	m.waiting[t.ID] = te
+	m.mu.Unlock()
+
+	if !waiting {
+		t.State = task.Pending
+		m.TaskDb.Put(t.ID.String(), &t)
+		m.recordEvent(t, "", fmt.Sprintf("waiting for dependency %v", dep))
+		logger.Info("Task is waiting for its dependencies", "task_id", t.ID, "dependency", dep)
+	}
+	return true
+}
+
+// releaseWaiting dispatches the waiting tasks whose dependencies completed, and
+// fails those with a failed dependency
+func (m *Manager) releaseWaiting() {
+	for changed := true; changed; {
+		changed = false
+		m.mu.RLock()
+		waiting := make([]task.TaskEvent, 0, len(m.waiting))
+		for _, te := range m.waiting {
+			waiting = append(waiting, te)
+		}
+		m.mu.RUnlock()
+
+		for _, te := range waiting {
+			if res, err := m.TaskDb.Get(te.Task.ID.String()); err == nil && res.(*task.Task).State == task.Stopped {
+				m.stopWaiting(te.Task.ID)
+				continue
+			}
+			status, dep := m.dependencyStatus(te.Task)
+			switch status {
+			case dependenciesCompleted:
+				m.stopWaiting(te.Task.ID)
+				logger.Info("Dependencies of task completed, scheduling it", "task_id", te.Task.ID)
+				te.ID = uuid.New()
+				te.Timestamp = time.Now()
+				m.enqueue(te)
+			case dependenciesFailed:
+				m.stopWaiting(te.Task.ID)
+				m.failOnDependency(te.Task, dep)
+				// Tasks waiting on this one fail as well
+				changed = true
+			}
+		}
+	}
+}
+
+func (m *Manager) stopWaiting(id uuid.UUID) {
+	m.mu.Lock()
+	delete(m.waiting, id)
+	m.mu.Unlock()
+}
+
+// dependencyStatus reports whether the dependencies of t completed, along with the
+// first dependency that is still pending or failed
+func (m *Manager) dependencyStatus(t task.Task) (dependencyStatus, uuid.UUID) {
+	for _, id := range t.DependsOn {
+		res, err := m.TaskDb.Get(id.String())
+		if err != nil {
+			return dependenciesPending, id
+		}
+		dep := res.(*task.Task)
+		switch {
+		case dep.State == task.Completed:
+			continue
+		case dep.State == task.Stopped || dep.State == task.Failed && !isLive(*dep):
+			return dependenciesFailed, id
+		default:
+			return dependenciesPending, id
+		}
+	}
+	return dependenciesCompleted, uuid.Nil
+}
+
+func (m *Manager) failOnDependency(t task.Task, dep uuid.UUID) {
+	previous := t.State
+	t.State = task.Failed
+	t.FinishTime = time.Now().UTC()
+	m.TaskDb.Put(t.ID.String(), &t)
+	m.States.Fire(t, previous, task.Failed)
+	m.recordEvent(t, "", fmt.Sprintf("dependency %v failed", dep))
+	logger.Warn("Dependency of task failed, failing the task", "task_id", t.ID, "dependency", dep)
+}
+
+// hasWaitingDependents reports whether tasks still wait on id
+func (m *Manager) hasWaitingDependents(id uuid.UUID) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, d := range m.deps.Dependents(id) {
+		if _, ok := m.waiting[d]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTaskDependencies returns the dependencies of a task and their states
+func (m *Manager) GetTaskDependencies(id uuid.UUID) (*TaskDependencies, error) {
+	res, err := m.TaskDb.Get(id.String())
+	if err != nil {
+		return nil, err
+	}
+	t := res.(*task.Task)
+
+	m.mu.RLock()
+	_, waiting := m.waiting[id]
+	dependents := m.deps.Dependents(id)
+	m.mu.RUnlock()
+
+	deps := &TaskDependencies{TaskID: id, DependsOn: []Dependency{}, Dependents: dependents, Waiting: waiting}
+	if deps.Dependents == nil {
+		deps.Dependents = []uuid.UUID{}
+	}
+	for _, depID := range t.DependsOn {
+		d := Dependency{ID: depID, State: "Unknown"}
+		if res, err := m.TaskDb.Get(depID.String()); err == nil {
+			dep := res.(*task.Task)
+			d.Name, d.State = dep.Name, dep.State.String()
+		}
+		deps.DependsOn = append(deps.DependsOn, d)
+	}
+	return deps, nil
+}
@@ -0,0 +1,271 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/features"
+	"cube/task"
+	"cube/utils"
+)
+
+var ErrDeploymentsDisabled = errors.New("the Deployments feature gate is disabled")
+
+/**
+* Deployments
+* A deployment keeps Replicas instances of a task template running like a service,
+* and rolls out a new template deployed under the same name by replacing its
+* replicas step by step. Each step starts replicas of the new revision while all
+* replicas stay within Replicas+MaxSurge, and stops old ones while the ready
+* replicas stay at least Replicas-MaxUnavailable. New replicas only count as ready
+* once they pass their health probe, so a rollout waits for them to be healthy.
+ */
+func (m *Manager) Deploy(d task.Deployment) (*task.Deployment, bool, error) {
+	if !features.Enabled(features.Deployments) {
+		return nil, false, ErrDeploymentsDisabled
+	}
+	d.ApplyDefaults()
+
+	m.mu.Lock()
+	current := m.deploymentNamed(d.Name)
+	created := current == nil
+	if created {
+		d.ID = uuid.New()
+		d.Revision = 1
+		d.CreatedAt = time.Now().UTC()
+		d.UpdatedAt = d.CreatedAt
+		d.TaskIDs = nil
+		current = &d
+		m.Deployments[d.ID] = current
+	} else {
+		if !reflect.DeepEqual(current.Template, d.Template) {
+			current.Template = d.Template
+			current.Revision++
+		}
+		current.Replicas = d.Replicas
+		current.MaxUnavailable = d.MaxUnavailable
+		current.MaxSurge = d.MaxSurge
+		current.UpdatedAt = time.Now().UTC()
+	}
+	current.Status = task.DeploymentProgressing
+	m.mu.Unlock()
+
+	if created {
+		logger.Info("Created deployment", "deployment", d.Name, "deployment_id", d.ID, "replicas", d.Replicas)
+	} else {
+		logger.Info("Updating deployment", "deployment", d.Name, "deployment_id", current.ID, "revision", current.Revision, "replicas", d.Replicas)
+	}
+	m.rollDeployment(current)
+	return m.snapshotDeployment(current), created, nil
+}
+
+// deploymentNamed returns the deployment with the given name, callers must hold mu
+func (m *Manager) deploymentNamed(name string) *task.Deployment {
+	for _, d := range m.Deployments {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+func (m *Manager) GetDeployments() []*task.Deployment {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	deployments := make([]*task.Deployment, 0, len(m.Deployments))
+	for _, d := range m.Deployments {
+		deployments = append(deployments, d)
+	}
+	return deployments
+}
+
+func (m *Manager) GetDeployment(id uuid.UUID) (*task.Deployment, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	d, ok := m.Deployments[id]
+	return d, ok
+}
+
+// DeleteDeployment stops every replica of the deployment and forgets it
+func (m *Manager) DeleteDeployment(id uuid.UUID) error {
+	m.mu.Lock()
+	d, ok := m.Deployments[id]
+	delete(m.Deployments, id)
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("deployment %s does not exist", id)
+	}
+	m.deleteDeployment(id)
+
+	for _, tID := range d.TaskIDs {
+		res, err := m.TaskDb.Get(tID.String())
+		if err != nil || !isLive(*res.(*task.Task)) {
+			continue
+		}
+		m.StopTask(tID)
+	}
+	logger.Info("Deleted deployment, stopping its replicas", "deployment_id", id, "replicas", len(d.TaskIDs))
+	return nil
+}
+
+// ReconcileDeployments moves every deployment one rollout step forward, and
+// replaces dead replicas
+func (m *Manager) ReconcileDeployments(ctx context.Context) {
+	m.Watchdog.Register("reconcileDeployments", m.UpdateInterval)
+	for {
+		m.Watchdog.Beat("reconcileDeployments")
+		if features.Enabled(features.Deployments) {
+			for _, d := range m.GetDeployments() {
+				m.rollDeployment(d)
+			}
+		}
+		if !utils.SleepContext(ctx, m.UpdateInterval) {
+			return
+		}
+	}
+}
+
+// rollDeployment runs a single rollout step of d
+func (m *Manager) rollDeployment(d *task.Deployment) {
+	m.deployMu.Lock()
+	defer m.deployMu.Unlock()
+
+	m.mu.RLock()
+	spec := *d
+	ids := slices.Clone(d.TaskIDs)
+	m.mu.RUnlock()
+
+	var live []uuid.UUID
+	var current, old []task.Task
+	pending := 0
+	for _, id := range ids {
+		res, err := m.TaskDb.Get(id.String())
+		if err != nil {
+			// Not persisted yet, still waiting in the pending queue
+			live = append(live, id)
+			pending++
+			continue
+		}
+		t := *res.(*task.Task)
+		if !isLive(t) {
+			continue
+		}
+		live = append(live, id)
+		if spec.Current(t) {
+			current = append(current, t)
+		} else {
+			old = append(old, t)
+		}
+	}
+	updated := len(current) + pending
+
+	readyCurrent, readyOld := countReady(current), countReady(old)
+	// Replicas that may still be stopped without going below the minimum available
+	stoppable := readyCurrent + readyOld - (spec.Replicas - spec.MaxUnavailable)
+
+	var stop []uuid.UUID
+	// Replicas that are not ready do not count towards availability
+	for _, t := range old {
+		if !task.Ready(t) {
+			stop = append(stop, t.ID)
+		}
+	}
+	for _, t := range old {
+		if task.Ready(t) && stoppable > 0 {
+			stop = append(stop, t.ID)
+			stoppable--
+		}
+	}
+	// Scaled down, stop the extra replicas, those not ready first
+	excess := updated - spec.Replicas
+	slices.SortStableFunc(current, func(a, b task.Task) int { return boolCompare(task.Ready(a), task.Ready(b)) })
+	for _, t := range current {
+		if excess <= 0 {
+			break
+		}
+		if task.Ready(t) {
+			if stoppable <= 0 {
+				break
+			}
+			stoppable--
+		}
+		stop = append(stop, t.ID)
+		excess--
+		updated--
+	}
+
+	start := min(spec.Replicas-updated, spec.Replicas+spec.MaxSurge-len(live))
+
+	m.mu.Lock()
+	d.TaskIDs = slices.DeleteFunc(live, func(id uuid.UUID) bool { return slices.Contains(stop, id) })
+	m.mu.Unlock()
+	for _, id := range stop {
+		logger.Info("Stopping deployment replica", "deployment", spec.Name, "task_id", id)
+		m.StopTask(id)
+	}
+	for i := 0; i < start; i++ {
+		m.addDeploymentReplica(d)
+		updated++
+	}
+
+	status := task.DeploymentProgressing
+	if len(old) == 0 && updated == spec.Replicas && readyCurrent == spec.Replicas {
+		status = task.DeploymentComplete
+	}
+	m.mu.Lock()
+	changed := d.Status != status || d.UpdatedReplicas != updated || d.ReadyReplicas != readyCurrent+readyOld || !slices.Equal(ids, d.TaskIDs)
+	if d.Status != status && status == task.DeploymentComplete {
+		logger.Info("Deployment rolled out", "deployment", spec.Name, "revision", spec.Revision, "replicas", spec.Replicas)
+	}
+	d.Status = status
+	d.UpdatedReplicas = updated
+	d.ReadyReplicas = readyCurrent + readyOld
+	m.mu.Unlock()
+	if changed {
+		m.saveDeployment(d)
+	}
+}
+
+func (m *Manager) addDeploymentReplica(d *task.Deployment) {
+	m.mu.Lock()
+	t := d.NewReplica()
+	d.TaskIDs = append(d.TaskIDs, t.ID)
+	m.mu.Unlock()
+	m.AddTask(task.TaskEvent{ID: uuid.New(), State: task.Scheduled, Timestamp: time.Now(), Task: t})
+}
+
+func countReady(tasks []task.Task) int {
+	n := 0
+	for _, t := range tasks {
+		if task.Ready(t) {
+			n++
+		}
+	}
+	return n
+}
+
+// boolCompare orders false before true
+func boolCompare(a bool, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
+
+// snapshotDeployment copies d so it can be encoded without holding mu
+func (m *Manager) snapshotDeployment(d *task.Deployment) *task.Deployment {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	snapshot := *d
+	snapshot.TaskIDs = slices.Clone(d.TaskIDs)
+	return &snapshot
+}
@@ -0,0 +1,138 @@
+package manager
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/task"
+)
+
+/**
+* Event-driven dispatch
+* AddTask wakes the processing loop, which drains the pending queue immediately,
+* highest task priority first, and dispatches up to MaxInFlight task events
+* concurrently. Scheduling decisions are still made one at a time, only the calls to
+* workers overlap, and the events of a task are dispatched in order, one at a time,
+* so a stop cannot overtake its task's creation. ProcessInterval only acts as a fallback tick for events re-enqueued
+* after failures, unschedulable tasks backing off, and preempted tasks waiting for room.
+ */
+const defaultMaxInFlight = 4
+
+func (m *Manager) ProcessTasks(ctx context.Context) {
+	m.Watchdog.Register("processTasks", m.ProcessInterval)
+	inFlight := make(chan struct{}, max(1, m.MaxInFlight))
+	for {
+		m.Watchdog.Beat("processTasks")
+		m.releaseWaiting()
+		m.requeueUnschedulable()
+		m.dispatchPending(inFlight)
+
+		select {
+		case <-m.wake:
+		case <-time.After(m.ProcessInterval):
+			m.unpark()
+		case <-ctx.Done():
+			// Drain the queue and wait for in-flight dispatches before returning
+			m.dispatchPending(inFlight)
+			for i := 0; i < cap(inFlight); i++ {
+				inFlight <- struct{}{}
+			}
+			if n := m.PendingLen(); n > 0 {
+				logger.Warn("Shutting down with task events still pending", "pending", n)
+			}
+			return
+		}
+	}
+}
+
+// dispatchPending dispatches every queued task event, bounded by the inFlight semaphore
+func (m *Manager) dispatchPending(inFlight chan struct{}) {
+	for {
+		item, ok := m.dequeue()
+		if !ok {
+			return
+		}
+		inFlight <- struct{}{}
+		go func(item pendingItem) {
+			defer func() { <-inFlight }()
+			defer m.done(item.te.Task.ID)
+			// Waits for a reload replacing the workers or the scheduler
+			m.reloadMu.RLock()
+			m.dispatch(item.te)
+			m.reloadMu.RUnlock()
+			m.ack(item.key)
+		}(item)
+		m.Watchdog.Beat("processTasks")
+	}
+}
+
+// enqueue persists a task event, adds it to the pending queue and wakes the processing loop
+func (m *Manager) enqueue(te task.TaskEvent) {
+	key := m.persistEvent(te)
+	m.mu.Lock()
+	m.Pending.push(te, key)
+	m.mu.Unlock()
+
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dequeue pops the next task event whose task has no event in progress and claims
+// the task. The event's persisted copy must be acked and the task released with done
+// once it has been dispatched.
+func (m *Manager) dequeue() (pendingItem, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.Pending.popFirst(func(item pendingItem) bool { return !m.inProgress[item.te.Task.ID] })
+	if ok {
+		m.inProgress[item.te.Task.ID] = true
+	}
+	return item, ok
+}
+
+// done releases a task claimed by dequeue and wakes the processing loop for events
+// held back behind it
+func (m *Manager) done(id uuid.UUID) {
+	m.mu.Lock()
+	delete(m.inProgress, id)
+	m.mu.Unlock()
+
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// PendingLen returns the number of task events waiting to be dispatched
+func (m *Manager) PendingLen() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.Pending.Len()
+}
+
+// workerFor returns the worker a task has been assigned to
+func (m *Manager) workerFor(id uuid.UUID) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	w, ok := m.TaskWorkerMap[id]
+	return w, ok
+}
+
+func (m *Manager) assignTask(id uuid.UUID, worker string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.WorkerTaskMap[worker] = append(m.WorkerTaskMap[worker], id)
+	m.TaskWorkerMap[id] = worker
+}
+
+func (m *Manager) unassignTask(id uuid.UUID, worker string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.WorkerTaskMap[worker] = slices.DeleteFunc(m.WorkerTaskMap[worker], func(t uuid.UUID) bool { return t == id })
+	delete(m.TaskWorkerMap, id)
+}
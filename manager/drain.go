@@ -0,0 +1,106 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"cube/node"
+	"cube/task"
+)
+
+/**
+* Node draining
+* Workers are drained through their PUT /drain API, directly or through DrainNode.
+* The manager cordons a node once its stats report the drain: the node is left out
+* by every scheduler, and with Evict set its live tasks are moved to other nodes.
+* Evictions are retried on every heartbeat until the node runs no live task.
+ */
+
+var ErrNodeNotFound = errors.New("no such node")
+
+// DrainNode drains or undrains the named worker
+func (m *Manager) DrainNode(name string, req node.DrainRequest) (*node.Info, error) {
+	n := m.workerNode(name)
+	if n == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNodeNotFound, name)
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal drain request: %v", err)
+	}
+	httpReq, err := http.NewRequest(http.MethodPut, fmt.Sprintf("%s/drain", n.Api), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := m.Client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %v", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("worker %s rejected the drain request with status %d", name, resp.StatusCode)
+	}
+
+	// Apply the drain without waiting for the next heartbeat
+	n.Stats.Drained, n.Stats.Evict = req.Drained, req.Evict && req.Drained
+	m.updateCordon(n)
+	info := n.Info()
+	return &info, nil
+}
+
+// updateCordon applies the drain status reported in a node's latest stats
+func (m *Manager) updateCordon(n *node.Node) {
+	cordoned, evicting := n.Stats.Drained, n.Stats.Evict
+	switch {
+	case cordoned && !n.Cordoned:
+		msg := "node drained, scheduling disabled"
+		if evicting {
+			msg = "node drained, evicting its tasks"
+		}
+		m.emitNodeEvent(node.NewEvent(n.Name, node.NodeCordoned, msg))
+	case !cordoned && n.Cordoned:
+		m.emitNodeEvent(node.NewEvent(n.Name, node.NodeUncordoned, "drain lifted, scheduling enabled"))
+	}
+	n.Cordoned, n.Evicting = cordoned, evicting
+	if n.Evicting {
+		m.evictNodeTasks(n)
+	}
+}
+
+// evictNodeTasks stops the live tasks of a drained node and reschedules them
+func (m *Manager) evictNodeTasks(n *node.Node) {
+	m.mu.RLock()
+	ids := slices.Clone(m.WorkerTaskMap[n.Name])
+	m.mu.RUnlock()
+
+	for _, id := range ids {
+		res, err := m.TaskDb.Get(id.String())
+		if err != nil {
+			logger.Error("Unable to get task from node", "task_id", id, "worker", n.Name, "error", err)
+			continue
+		}
+		t, ok := res.(*task.Task)
+		if !ok {
+			logger.Error("Cannot convert result to task.Task type", "task_id", id)
+			continue
+		}
+		// Stopping tasks leave the node once the worker confirms the stop
+		if !t.State.Active() {
+			continue
+		}
+
+		// Once the task is placed elsewhere, a container the worker failed to stop
+		// is stopped when the worker reports it, like after a node came back up
+		m.stopTask(n.Name, id.String())
+		m.unassignTask(t.ID, n.Name)
+		m.release(t.ID, n.Name)
+		m.countTask(n, -1)
+		m.requeueTask(t, n.Name, "node drained, rescheduling")
+	}
+}
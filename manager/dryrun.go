@@ -0,0 +1,32 @@
+package manager
+
+import (
+	"github.com/google/uuid"
+
+	"cube/scheduler"
+	"cube/task"
+)
+
+/**
+* Scheduling dry runs
+* DryRun places a hypothetical task the way SelectWorker would, without reserving
+* or dispatching anything, and reports the score of every candidate node and why
+* the other nodes were filtered out. Useful for capacity planning and for finding
+* out why a task does not place.
+ */
+func (m *Manager) DryRun(t task.Task) Explanation {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	t.QoSClass = task.QoSClassFor(t)
+	// Taken between scheduling decisions, so the copy is consistent
+	m.scheduleMu.Lock()
+	defer m.scheduleMu.Unlock()
+	s := m.Scheduler
+	if profile, ok := s.(*scheduler.Profile); ok {
+		// Scoring may advance plugins such as round robin, work on a copy
+		s = profile.Preview()
+	}
+	_, e := m.explain(t, s)
+	return e
+}
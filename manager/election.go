@@ -0,0 +1,111 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"cube/store"
+	"cube/utils"
+)
+
+/**
+* Leader election
+* With --ha several managers share a data directory, or a Postgres database, and
+* only the one holding the leader lease opens the stores and runs the scheduling
+* loops. The others serve the API read-only, forwarding reads to the leader, and
+* campaign for the lease until the leader stops renewing it. The leader renews the lease every third of
+* its TTL and steps down once it could not renew it for two thirds of the TTL, so
+* it stops before another manager can take over. Hosts must have synchronized clocks.
+ */
+const DefaultLeaseTTL = 15 * time.Second
+
+type Elector struct {
+	Lease store.LeaseStore
+	// Unique name of this manager and the address other managers forward requests to
+	ID      string
+	Address string
+	TTL     time.Duration
+	leader  atomic.Bool
+}
+
+func NewElector(lease store.LeaseStore, id string, address string, ttl time.Duration) *Elector {
+	if ttl <= 0 {
+		ttl = DefaultLeaseTTL
+	}
+	return &Elector{Lease: lease, ID: id, Address: address, TTL: ttl}
+}
+
+// IsLeader reports whether this manager holds the lease
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Leader returns the current holder of the lease
+func (e *Elector) Leader() (store.LeaseRecord, error) {
+	return e.Lease.Get()
+}
+
+// Campaign blocks until this manager holds the lease, or ctx is cancelled
+func (e *Elector) Campaign(ctx context.Context) error {
+	var last string
+	for {
+		_, err := e.Lease.Acquire(e.ID, e.Address, e.TTL)
+		if err == nil {
+			e.leader.Store(true)
+			logger.Info("Acquired leader lease", "manager", e.ID, "address", e.Address)
+			return nil
+		}
+		if errors.Is(err, store.ErrLeaseHeld) {
+			if rec, err := e.Lease.Get(); err == nil && rec.Holder != last {
+				last = rec.Holder
+				logger.Info("Following leader", "leader", rec.Holder, "address", rec.Address)
+			}
+		} else {
+			logger.Warn("Error acquiring leader lease", "error", err)
+		}
+		if !utils.SleepContext(ctx, e.TTL/3) {
+			return ctx.Err()
+		}
+	}
+}
+
+// Hold renews the lease until ctx is cancelled. When the lease is taken by another
+// manager, or cannot be renewed in time, it calls lost and returns.
+func (e *Elector) Hold(ctx context.Context, lost func()) {
+	renewed := time.Now()
+	for {
+		if !utils.SleepContext(ctx, e.TTL/3) {
+			return
+		}
+		_, err := e.Lease.Acquire(e.ID, e.Address, e.TTL)
+		switch {
+		case err == nil:
+			renewed = time.Now()
+			continue
+		case errors.Is(err, store.ErrLeaseHeld):
+			logger.Error("Leader lease taken over by another manager", "manager", e.ID)
+		case time.Since(renewed) < e.TTL*2/3:
+			logger.Warn("Error renewing leader lease", "error", err)
+			continue
+		default:
+			logger.Error("Unable to renew leader lease in time", "error", err)
+		}
+		e.leader.Store(false)
+		lost()
+		return
+	}
+}
+
+// Resign gives the lease up so another manager can take over right away
+func (e *Elector) Resign() {
+	if !e.leader.Swap(false) {
+		return
+	}
+	if err := e.Lease.Release(e.ID); err != nil {
+		logger.Error("Error releasing leader lease", "error", err)
+		return
+	}
+	logger.Info("Released leader lease", "manager", e.ID)
+}
@@ -0,0 +1,53 @@
+package manager
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/eventbus"
+	"cube/task"
+)
+
+// recordEvent publishes an observed task transition for the event history.
+// msg carries the error or reason behind the transition, if any.
+func (m *Manager) recordEvent(t task.Task, worker string, msg string) {
+	te := task.TaskEvent{
+		ID:        uuid.New(),
+		Timestamp: time.Now().UTC(),
+		State:     t.State,
+		Task:      t,
+		Worker:    worker,
+		Error:     msg,
+	}
+	m.Bus.Publish(eventbus.Event{Topic: eventbus.TaskRecorded, TaskEvent: te})
+}
+
+// storeEvent appends a recorded event to the event history
+func (m *Manager) storeEvent(e eventbus.Event) {
+	if err := m.EventDb.Put(e.ID.String(), &e.TaskEvent); err != nil {
+		logger.Error("Error storing event for task", "task_id", e.Task.ID, "error", err)
+	}
+}
+
+// GetEvents returns the task event history ordered by time
+func (m *Manager) GetEvents() []*task.TaskEvent {
+	res, err := m.EventDb.List()
+	if err != nil {
+		logger.Error("Error getting list of task events", "error", err)
+		return nil
+	}
+	events := res.([]*task.TaskEvent)
+	slices.SortStableFunc(events, func(a, b *task.TaskEvent) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+	return events
+}
+
+// GetTaskEvents returns the event history of a single task ordered by time
+func (m *Manager) GetTaskEvents(id uuid.UUID) []*task.TaskEvent {
+	return slices.DeleteFunc(m.GetEvents(), func(te *task.TaskEvent) bool {
+		return te.Task.ID != id
+	})
+}
@@ -0,0 +1,185 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/node"
+	"cube/scheduler"
+	"cube/task"
+)
+
+/**
+* Scheduling decisions
+* Every placement records the nodes considered, their scores and what they were made
+* of, the node chosen and why the other nodes were left out, so GET
+* /tasks/{id}/scheduling can answer why a task landed where it did, or why it did
+* not land anywhere. Score terms and filter reasons come from schedulers that
+* implement scheduler.Explainer. Only the latest decision of a task is kept, in
+* memory, and it goes away with the task.
+ */
+
+// ErrNoDecision is returned for a task the manager has not tried to place
+var ErrNoDecision = errors.New("no scheduling decision recorded")
+
+// Explanation is how a task was, or would be, placed
+type Explanation struct {
+	// Node the task was placed on, empty when none fits
+	Selected  string `json:",omitempty"`
+	Scheduler string
+	// Why Selected was chosen, or why no node was
+	Reason     string
+	Candidates []Candidate
+	Rejected   []Rejection
+}
+
+// Candidate is a node the task fits on and its score; the scheduler picks by score
+type Candidate struct {
+	Node  string
+	Score float64
+	// Terms of the score, the scheduler's and the manager's penalties
+	Reasons []string `json:",omitempty"`
+}
+
+// Rejection is a node filtered out before scoring and the reason
+type Rejection struct {
+	Node   string
+	Reason string
+}
+
+// SchedulingDecision is the explanation of the latest placement of a task
+type SchedulingDecision struct {
+	TaskID uuid.UUID
+	Time   time.Time
+	Explanation
+}
+
+// explain places t with s the way SelectWorker does, returning the selected node,
+// nil when none fits, and why
+func (m *Manager) explain(t task.Task, s scheduler.Scheduler) (*node.Node, Explanation) {
+	e := Explanation{Scheduler: m.SchedulerType, Candidates: []Candidate{}, Rejected: []Rejection{}}
+	reject := func(nodes []*node.Node, kept []*node.Node, reason func(n *node.Node) string) {
+		for _, n := range nodes {
+			if !slices.Contains(kept, n) {
+				e.Rejected = append(e.Rejected, Rejection{Node: n.Name, Reason: reason(n)})
+			}
+		}
+	}
+
+	schedulable := m.schedulableNodes()
+	reject(m.workerNodes(), schedulable, func(n *node.Node) string {
+		switch {
+		case n.Status == node.Down:
+			return "node is down"
+		case n.Cordoned:
+			return "node is cordoned"
+		case n.Stats.RuntimeError != "":
+			return "container runtime is unreachable: " + n.Stats.RuntimeError
+		}
+		return "worker version is skewed from the manager"
+	})
+
+	allowed := m.withoutRefusals(t, schedulable)
+	reject(schedulable, allowed, func(n *node.Node) string {
+		return "worker refused the task recently"
+	})
+
+	explainer, _ := s.(scheduler.Explainer)
+	fits := s.SelectCandidateNodes(t, allowed)
+	reject(allowed, fits, func(n *node.Node) string {
+		if explainer != nil {
+			if check, reason := explainer.Filter(t, n); check != "" {
+				return fmt.Sprintf("%s (%s filter)", reason, check)
+			}
+		}
+		return "rejected by the scheduler"
+	})
+
+	candidates := m.applyAffinity(t, fits)
+	reject(fits, candidates, func(n *node.Node) string {
+		return "excluded by the task's affinity or anti-affinity"
+	})
+	if len(candidates) == 0 {
+		e.Reason = "no node passed the filters"
+		return nil, e
+	}
+
+	var scores map[string]float64
+	reasons := make(map[string][]string)
+	if explainer != nil {
+		scores, reasons = explainer.ExplainScore(t, candidates)
+	} else {
+		scores = s.Score(t, candidates)
+	}
+	penalize := func(penalty string, apply func(scores map[string]float64)) {
+		before := maps.Clone(scores)
+		apply(scores)
+		for name, score := range scores {
+			if d := score - before[name]; d != 0 {
+				reasons[name] = append(reasons[name], fmt.Sprintf("%s: %+.4g", penalty, d))
+			}
+		}
+	}
+	penalize("best effort next to guaranteed tasks", func(scores map[string]float64) { m.applyQoSBias(t, scores) })
+	penalize("recent restarts", m.applyRestartPenalty)
+	penalize("queued tasks", m.applyQueuePenalty)
+
+	for _, n := range candidates {
+		score, ok := scores[n.Name]
+		if !ok {
+			e.Rejected = append(e.Rejected, Rejection{Node: n.Name, Reason: "not scored by the scheduler: " + strings.Join(reasons[n.Name], ", ")})
+			continue
+		}
+		e.Candidates = append(e.Candidates, Candidate{Node: n.Name, Score: score, Reasons: reasons[n.Name]})
+	}
+	selected := s.Pick(scores, candidates)
+	if selected == nil {
+		e.Reason = "no candidate could be scored"
+		return nil, e
+	}
+	e.Selected = selected.Name
+	e.Reason = fmt.Sprintf("lowest score of %d candidates", len(e.Candidates))
+	return selected, e
+}
+
+// recordDecision keeps e as the latest scheduling decision of the task
+func (m *Manager) recordDecision(id uuid.UUID, e Explanation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.decisions[id] = SchedulingDecision{TaskID: id, Time: time.Now().UTC(), Explanation: e}
+}
+
+// overrideDecision records that the task went to worker for another reason than its
+// scores, e.g. preemption or its task group
+func (m *Manager) overrideDecision(id uuid.UUID, worker string, reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.decisions[id]
+	if !ok {
+		d = SchedulingDecision{TaskID: id, Explanation: Explanation{Scheduler: m.SchedulerType, Candidates: []Candidate{}, Rejected: []Rejection{}}}
+	}
+	d.Time = time.Now().UTC()
+	d.Selected = worker
+	d.Reason = reason
+	m.decisions[id] = d
+}
+
+// GetSchedulingDecision returns the latest scheduling decision of the task
+func (m *Manager) GetSchedulingDecision(id uuid.UUID) (*SchedulingDecision, error) {
+	if _, err := m.TaskDb.Get(id.String()); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	d, ok := m.decisions[id]
+	if !ok {
+		return nil, fmt.Errorf("%w for task %v", ErrNoDecision, id)
+	}
+	return &d, nil
+}
@@ -0,0 +1,152 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/node"
+	"cube/task"
+)
+
+/**
+* Per-node restart budget
+* Restarts are attributed to the node the task was running on. Nodes exceeding the
+* budget within the window are marked flapping and heavily penalised by the scheduler.
+* A task failing MaxRestartsPerNode restarts in a row on the same node is not
+* restarted there again but rescheduled on another node, in case the node itself
+* is the problem, e.g. a full disk or a broken container runtime. The restarts, the
+* nodes' Flapping status and NodeEvents are guarded by mu.
+ */
+const (
+	restartWindow        = 10 * time.Minute
+	restartPenalty       = 0.1
+	flappingPenalty      = 10.0
+	maxNodeEvents        = 1000
+	defaultRestartBudget = 5
+
+	defaultMaxRestartsPerNode = 3
+)
+
+// recordRestart attributes a task restart to a node and updates its flapping status
+func (m *Manager) recordRestart(nodeName string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	m.nodeRestarts[nodeName] = append(pruneRestarts(m.nodeRestarts[nodeName], now), now)
+	m.updateFlappingLocked(nodeName, now)
+}
+
+// recordPlacement adds the worker which accepted a task to its placement history
+func (m *Manager) recordPlacement(id uuid.UUID, worker string, reason string) {
+	err := m.TaskDb.Update(id.String(), func(value interface{}) (interface{}, error) {
+		t, ok := value.(*task.Task)
+		if !ok {
+			return nil, fmt.Errorf("cannot convert result %v to task.Task type", value)
+		}
+		t.AddPlacement(worker, reason)
+		return t, nil
+	})
+	if err != nil {
+		logger.Error("Unable to record task placement", "task_id", id, "worker", worker, "error", err)
+	}
+}
+
+// exhaustedNode reports whether t failed enough restarts on its worker to be moved off it
+func (m *Manager) exhaustedNode(t task.Task) bool {
+	return m.MaxRestartsPerNode > 0 && t.RestartsOnWorker() >= m.MaxRestartsPerNode
+}
+
+// updateFlappingLocked prunes the node's restarts out of the window and updates its
+// flapping status, with mu held
+func (m *Manager) updateFlappingLocked(nodeName string, now time.Time) {
+	n := m.workerNodeLocked(nodeName)
+	if n == nil {
+		return
+	}
+
+	restarts := pruneRestarts(m.nodeRestarts[nodeName], now)
+	m.nodeRestarts[nodeName] = restarts
+	flapping := len(restarts) >= m.NodeRestartBudget && len(restarts) > 2*m.averageRestarts(nodeName)
+
+	switch {
+	case flapping && !n.Flapping:
+		m.emitNodeEventLocked(node.NewEvent(nodeName, node.NodeFlapping,
+			fmt.Sprintf("%d task restarts in the last %v", len(restarts), restartWindow)))
+	case !flapping && n.Flapping:
+		m.emitNodeEventLocked(node.NewEvent(nodeName, node.NodeRecovered, "restart rate back within budget"))
+	}
+	n.Flapping = flapping
+}
+
+// averageRestarts returns the mean restarts per node in the window, excluding the given
+// node, with mu held
+func (m *Manager) averageRestarts(exclude string) int {
+	total, count := 0, 0
+	for _, n := range m.WorkerNodes {
+		if n.Name == exclude {
+			continue
+		}
+		total += len(m.nodeRestarts[n.Name])
+		count++
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / count
+}
+
+func pruneRestarts(restarts []time.Time, now time.Time) []time.Time {
+	var kept []time.Time
+	for _, r := range restarts {
+		if now.Sub(r) < restartWindow {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// applyRestartPenalty raises the score of nodes proportionally to their recent restarts
+func (m *Manager) applyRestartPenalty(scores map[string]float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for name := range scores {
+		m.updateFlappingLocked(name, now)
+		scores[name] += restartPenalty * float64(len(m.nodeRestarts[name]))
+		if n := m.workerNodeLocked(name); n != nil && n.Flapping {
+			scores[name] += flappingPenalty
+		}
+	}
+}
+
+func (m *Manager) emitNodeEvent(e node.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.emitNodeEventLocked(e)
+}
+
+func (m *Manager) emitNodeEventLocked(e node.Event) {
+	logger.Warn("Node event", "worker", e.Node, "reason", e.Reason, "message", e.Message)
+	m.NodeEvents = append(m.NodeEvents, e)
+	if len(m.NodeEvents) > maxNodeEvents {
+		m.NodeEvents = m.NodeEvents[len(m.NodeEvents)-maxNodeEvents:]
+	}
+}
+
+// workerNode returns the node of the named worker, nil when there is none
+func (m *Manager) workerNode(name string) *node.Node {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.workerNodeLocked(name)
+}
+
+func (m *Manager) workerNodeLocked(name string) *node.Node {
+	for _, n := range m.WorkerNodes {
+		if n.Name == name {
+			return n
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package manager
+
+import (
+	"sync"
+	"testing"
+
+	"cube/node"
+)
+
+// Restarts are recorded by the update loop and the health checks while dispatches
+// score nodes and API handlers read node events; run with -race
+func TestFlappingConcurrentAccess(t *testing.T) {
+	const flappy, steady = "worker-1:5556", "worker-2:5556"
+	m, err := New([]string{flappy, steady, "worker-3:5556"}, "round-robin", "memory", "", "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				m.recordRestart(flappy)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				m.applyRestartPenalty(map[string]float64{flappy: 0, steady: 0})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				m.emitNodeEvent(node.NewEvent(steady, node.NodeUp, "heartbeat received"))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if _, err := m.GetNode(flappy); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	scores := map[string]float64{flappy: 0, steady: 0}
+	m.applyRestartPenalty(scores)
+	if want := 40*restartPenalty + flappingPenalty; scores[flappy] != want {
+		t.Errorf("score of %s = %v, want %v", flappy, scores[flappy], want)
+	}
+	if scores[steady] != 0 {
+		t.Errorf("score of %s = %v, want 0", steady, scores[steady])
+	}
+
+	detail, err := m.GetNode(flappy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(detail.Events) != 1 || detail.Events[0].Reason != node.NodeFlapping {
+		t.Errorf("events of %s = %v, want a single %s", flappy, detail.Events, node.NodeFlapping)
+	}
+	if !detail.Flapping {
+		t.Errorf("%s is not flapping", flappy)
+	}
+}
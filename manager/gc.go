@@ -0,0 +1,127 @@
+package manager
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/store"
+	"cube/task"
+	"cube/utils"
+)
+
+/**
+* Task garbage collection
+* Tasks that are no longer live (see isLive) are deleted, together with their event
+* history, once they finished more than TaskRetention ago. Zero keeps them forever.
+ */
+const defaultTaskRetention = 24 * time.Hour
+
+// Upper bound on the time between collections
+const maxGCInterval = 5 * time.Minute
+
+func gcInterval(retention time.Duration) time.Duration {
+	if retention <= 0 {
+		return maxGCInterval
+	}
+	return min(retention, maxGCInterval)
+}
+
+func (m *Manager) CollectGarbage(ctx context.Context) {
+	interval := gcInterval(m.TaskRetention)
+	m.Watchdog.Register("taskGC", interval)
+	for {
+		m.Watchdog.Beat("taskGC")
+		if m.TaskRetention > 0 {
+			m.collectTasks(time.Now().UTC())
+		}
+		if !utils.SleepContext(ctx, interval) {
+			return
+		}
+	}
+}
+
+// collectTasks deletes the tasks that finished before now minus TaskRetention
+func (m *Manager) collectTasks(now time.Time) {
+	collected := make(map[uuid.UUID]bool)
+	var ops []store.Op
+	for _, t := range m.GetTasks() {
+		finished := finishedAt(*t)
+		if isLive(*t) || t.State == task.Stopping || finished.IsZero() || now.Sub(finished) < m.TaskRetention {
+			continue
+		}
+		if m.hasWaitingDependents(t.ID) {
+			continue
+		}
+		collected[t.ID] = true
+		ops = append(ops, store.DeleteOp(t.ID.String()))
+	}
+	if len(ops) == 0 {
+		return
+	}
+	if err := m.TaskDb.Batch(ops); err != nil {
+		logger.Error("Error deleting finished tasks", "error", err)
+		return
+	}
+
+	for id := range collected {
+		if w, ok := m.workerFor(id); ok {
+			m.unassignTask(id, w)
+			m.release(id, w)
+		}
+	}
+	m.mu.Lock()
+	var services []*task.Service
+	for _, s := range m.Services {
+		n := len(s.TaskIDs)
+		s.TaskIDs = slices.DeleteFunc(s.TaskIDs, func(id uuid.UUID) bool { return collected[id] })
+		if len(s.TaskIDs) != n {
+			services = append(services, s)
+		}
+	}
+	var deployments []*task.Deployment
+	for _, d := range m.Deployments {
+		n := len(d.TaskIDs)
+		d.TaskIDs = slices.DeleteFunc(d.TaskIDs, func(id uuid.UUID) bool { return collected[id] })
+		if len(d.TaskIDs) != n {
+			deployments = append(deployments, d)
+		}
+	}
+	for id := range collected {
+		m.deps.Remove(id)
+		delete(m.decisions, id)
+	}
+	m.mu.Unlock()
+	m.deleteResults(collected)
+	for _, s := range services {
+		m.saveService(s)
+	}
+	for _, d := range deployments {
+		m.saveDeployment(d)
+	}
+
+	var eventOps []store.Op
+	err := m.EventDb.ForEach(func(key string, value interface{}) error {
+		if te, ok := value.(*task.TaskEvent); ok && collected[te.Task.ID] {
+			eventOps = append(eventOps, store.DeleteOp(key))
+		}
+		return nil
+	})
+	if err == nil {
+		err = m.EventDb.Batch(eventOps)
+	}
+	if err != nil {
+		logger.Error("Error deleting events of finished tasks", "error", err)
+	}
+	logger.Info("Collected finished tasks", "tasks", len(collected), "events", len(eventOps))
+}
+
+// finishedAt is when a task finished, falling back to its start for tasks that never recorded one
+func finishedAt(t task.Task) time.Time {
+	if !t.FinishTime.IsZero() {
+		return t.FinishTime
+	}
+	return t.StartTime
+}
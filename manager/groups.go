@@ -0,0 +1,188 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/features"
+	"cube/node"
+	"cube/task"
+)
+
+var ErrTaskGroupsDisabled = errors.New("the TaskGroups feature gate is disabled")
+
+/**
+* Task groups
+* The members of a group land on one worker. The first member dispatched selects a
+* node for the summed requests of the group, reserves them there for every member
+* and records it as the group's Worker, which the others follow. The group is only
+* placed anew once none of its members is left on that worker. Members restart in place, stopping a member stops the whole group,
+* and so does a member failing without restarts left.
+ */
+func (m *Manager) CreateTaskGroup(g task.TaskGroup) (*task.TaskGroup, error) {
+	if !features.Enabled(features.TaskGroups) {
+		return nil, ErrTaskGroupsDisabled
+	}
+
+	g.ID = uuid.New()
+	g.Worker = ""
+	g.CreatedAt = time.Now().UTC()
+	members := g.NewMembers()
+	g.TaskIDs = make([]uuid.UUID, 0, len(members))
+	for _, t := range members {
+		g.TaskIDs = append(g.TaskIDs, t.ID)
+	}
+
+	m.mu.Lock()
+	m.TaskGroups[g.ID] = &g
+	m.mu.Unlock()
+	m.saveTaskGroup(&g)
+
+	for i, t := range members {
+		err := m.AddTask(task.TaskEvent{ID: uuid.New(), State: task.Scheduled, Timestamp: time.Now(), Task: t})
+		if err != nil {
+			// Do not leave part of the group running
+			m.DeleteTaskGroup(g.ID)
+			return nil, fmt.Errorf("member %s: %v", g.Tasks[i].Name, err)
+		}
+	}
+	logger.Info("Created task group", "group", g.Name, "group_id", g.ID, "members", len(members))
+	return &g, nil
+}
+
+func (m *Manager) GetTaskGroups() []*task.TaskGroup {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	groups := make([]*task.TaskGroup, 0, len(m.TaskGroups))
+	for _, g := range m.TaskGroups {
+		// Copies, Worker changes under mu
+		c := *g
+		groups = append(groups, &c)
+	}
+	return groups
+}
+
+func (m *Manager) GetTaskGroup(id uuid.UUID) (*task.TaskGroup, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	g, ok := m.TaskGroups[id]
+	if !ok {
+		return nil, false
+	}
+	c := *g
+	return &c, true
+}
+
+// DeleteTaskGroup stops every member of the group and forgets it
+func (m *Manager) DeleteTaskGroup(id uuid.UUID) error {
+	m.mu.Lock()
+	g, ok := m.TaskGroups[id]
+	delete(m.TaskGroups, id)
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("task group %s does not exist", id)
+	}
+	m.deleteTaskGroup(id)
+
+	for _, tID := range g.TaskIDs {
+		if _, err := m.TaskDb.Get(tID.String()); err != nil {
+			continue
+		}
+		m.StopTask(tID)
+	}
+	logger.Info("Deleted task group, stopping its members", "group_id", id, "members", len(g.TaskIDs))
+	return nil
+}
+
+// taskGroupOf returns the group t is a member of, nil for tasks outside groups
+func (m *Manager) taskGroupOf(t task.Task) *task.TaskGroup {
+	id, err := uuid.Parse(t.Labels[task.GroupLabel])
+	if err != nil {
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.TaskGroups[id]
+}
+
+// selectGroupWorker returns the worker of g, or selects one for the whole group,
+// reserves the members' requests on it and records it as the group's worker
+func (m *Manager) selectGroupWorker(g *task.TaskGroup, t task.Task) (*node.Node, error) {
+	var members []task.Task
+	occupied := false
+	m.mu.RLock()
+	worker := g.Worker
+	m.mu.RUnlock()
+	for _, id := range g.TaskIDs {
+		res, err := m.TaskDb.Get(id.String())
+		if err != nil || !isLive(*res.(*task.Task)) {
+			continue
+		}
+		members = append(members, *res.(*task.Task))
+		if w, assigned := m.workerFor(id); id != t.ID && assigned && w == worker {
+			occupied = true
+		}
+	}
+
+	if worker != "" {
+		n := m.workerNode(worker)
+		if n != nil && slices.Contains(m.schedulableNodes(), n) {
+			m.overrideDecision(t.ID, n.Name, fmt.Sprintf("runs the other members of task group %s", g.Name))
+			return n, nil
+		}
+		// Members left on the worker keep the group there until they are moved
+		if occupied {
+			return nil, fmt.Errorf("worker %s running the other members of group %s is unavailable", worker, g.Name)
+		}
+	}
+
+	p := g.Placement()
+	p.ID = t.ID
+	n, err := m.SelectWorker(p)
+	if err != nil {
+		return nil, fmt.Errorf("no worker fits task group %s: %v", g.Name, err)
+	}
+	// Hold room for the members dispatched next, t reserves its own share
+	m.mu.Lock()
+	for _, member := range members {
+		if member.ID != t.ID {
+			m.releaseLocked(member.ID, "")
+			m.reserveLocked(n, member)
+		}
+	}
+	g.Worker = n.Name
+	saved := *g
+	m.mu.Unlock()
+	m.saveTaskGroup(&saved)
+	logger.Info("Selected worker for task group", "group", g.Name, "group_id", g.ID, "worker", n.Name)
+	return n, nil
+}
+
+// stopTaskGroup stops the other members of t's group, which runs as a unit
+func (m *Manager) stopTaskGroup(t task.Task, reason string) {
+	g := m.taskGroupOf(t)
+	if g == nil {
+		return
+	}
+	logger.Info("Stopping task group", "group", g.Name, "group_id", g.ID, "task_id", t.ID, "reason", reason)
+	for _, id := range g.TaskIDs {
+		if id == t.ID {
+			continue
+		}
+		if _, err := m.StopTask(id); err != nil {
+			logger.Warn("Error stopping task group member", "group_id", g.ID, "task_id", id, "error", err)
+		}
+	}
+}
+
+// stopFailedTaskGroup stops the group of a member that failed without restarts left
+func (m *Manager) stopFailedTaskGroup(t task.Task, from task.State, to task.State) {
+	if t.Labels[task.GroupLabel] == "" || t.RestartAllowed(time.Now()) {
+		return
+	}
+	go m.stopTaskGroup(t, "member failed")
+}
@@ -0,0 +1,88 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/task"
+)
+
+/**
+* Idempotent submissions
+* Clients retrying a POST /tasks after a network error must not start the task
+* twice. A submission is keyed by its Idempotency-Key header, or by the ID of its
+* task event without one, and the manager remembers the task each key created for
+* IdempotencyTTL. Submitting the same key again returns that task instead of
+* queueing a new one, submitting it with another task is an error. Keys are only
+* kept in memory, a restarted manager rejects retries of tasks it already stored
+* as duplicates.
+ */
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// ErrIdempotencyKeyReused is returned for a key already used to submit another task
+var ErrIdempotencyKeyReused = errors.New("idempotency key was used for another task")
+
+type submission struct {
+	task    task.Task
+	expires time.Time
+}
+
+// SubmitTask adds the task of te once per key, returning the task submitted first
+// with the key and whether it was submitted before. An empty key always adds it.
+// New submissions may be refused with a ThrottledError, see throttle.
+func (m *Manager) SubmitTask(key string, te task.TaskEvent) (task.Task, bool, error) {
+	if key == "" {
+		m.submitMu.Lock()
+		err := m.throttle()
+		m.submitMu.Unlock()
+		if err != nil {
+			return task.Task{}, false, err
+		}
+		err = m.AddTask(te)
+		return te.Task, false, err
+	}
+
+	// Held while adding, so concurrent retries wait for the first one
+	m.submitMu.Lock()
+	defer m.submitMu.Unlock()
+	now := time.Now()
+	for k, s := range m.submissions {
+		if !now.Before(s.expires) {
+			delete(m.submissions, k)
+		}
+	}
+	if s, ok := m.submissions[key]; ok {
+		if s.task.ID != te.Task.ID {
+			return task.Task{}, false, fmt.Errorf("%w: key %q submitted task %v", ErrIdempotencyKeyReused, key, s.task.ID)
+		}
+		if res, err := m.TaskDb.Get(s.task.ID.String()); err == nil {
+			return *res.(*task.Task), true, nil
+		}
+		return s.task, true, nil
+	}
+
+	if err := m.throttle(); err != nil {
+		return task.Task{}, false, err
+	}
+	if err := m.AddTask(te); err != nil {
+		return task.Task{}, false, err
+	}
+	if m.IdempotencyTTL > 0 {
+		m.submissions[key] = submission{task: te.Task, expires: now.Add(m.IdempotencyTTL)}
+	}
+	return te.Task, false, nil
+}
+
+// IdempotencyKey returns the key of a submission, its task event ID without a header
+func IdempotencyKey(header string, te task.TaskEvent) string {
+	if header != "" {
+		return header
+	}
+	if te.ID != uuid.Nil {
+		return te.ID.String()
+	}
+	return ""
+}
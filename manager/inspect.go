@@ -0,0 +1,56 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"cube/task"
+)
+
+// InspectTask returns a task with the state of its container, as inspected by the
+// task's worker. Tasks without a container, or whose worker cannot be reached, are
+// returned without it.
+func (m *Manager) InspectTask(ctx context.Context, id uuid.UUID) (*task.Inspection, error) {
+	res, err := m.TaskDb.Get(id.String())
+	if err != nil {
+		return nil, err
+	}
+	in := &task.Inspection{Task: *res.(*task.Task)}
+	worker, ok := m.workerFor(id)
+	if !ok || in.Task.ContainerID == "" {
+		return in, nil
+	}
+
+	remote, err := m.inspectOnWorker(ctx, worker, id)
+	if err != nil {
+		logger.Warn("Error inspecting task on worker", "task_id", id, "worker", worker, "error", err)
+		in.ContainerError = fmt.Sprintf("inspecting on %s: %v", worker, err)
+		return in, nil
+	}
+	in.Container, in.ContainerError = remote.Container, remote.ContainerError
+	return in, nil
+}
+
+func (m *Manager) inspectOnWorker(ctx context.Context, worker string, id uuid.UUID) (*task.Inspection, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s/tasks/%s", worker, id), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("worker returned %d", resp.StatusCode)
+	}
+	var in task.Inspection
+	if err := json.NewDecoder(resp.Body).Decode(&in); err != nil {
+		return nil, fmt.Errorf("error decoding inspection: %v", err)
+	}
+	return &in, nil
+}
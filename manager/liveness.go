@@ -0,0 +1,136 @@
+package manager
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/config"
+	"cube/node"
+	"cube/task"
+	"cube/timeline"
+)
+
+/**
+* Node liveness
+* Every stats call doubles as a heartbeat. A node missing MaxMissedHeartbeats
+* consecutive heartbeats is marked Down, excluded from scheduling, and its live
+* tasks are re-enqueued so they get placed on healthy nodes. Workers configured with
+* a manager also push heartbeats, see node.Heartbeat; the stats call of a node is
+* skipped while its last pushed heartbeat is more recent than StatsInterval.
+ */
+const defaultMaxMissedHeartbeats = 3
+
+// recordHeartbeat marks a node as alive, bringing it back Up if it was Down
+func (m *Manager) recordHeartbeat(n *node.Node) {
+	n.LastHeartbeat = time.Now().UTC()
+	n.MissedHeartbeats = 0
+	if n.Status == node.Down {
+		m.emitNodeEvent(node.NewEvent(n.Name, node.NodeUp, "heartbeat received"))
+	}
+	n.Status = node.Up
+}
+
+// ReceiveHeartbeat records a heartbeat pushed by a worker and answers with the
+// manager's version and the interval it expects heartbeats at
+func (m *Manager) ReceiveHeartbeat(hb node.Heartbeat) (*node.HeartbeatResponse, error) {
+	n := m.workerNode(hb.Worker)
+	if n == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNodeNotFound, hb.Worker)
+	}
+	if err := n.ApplyHeartbeat(hb); err != nil {
+		return nil, err
+	}
+	m.recordHeartbeat(n)
+	m.updateCordon(n)
+	m.checkVersionSkew(n)
+	m.recordUtilization(n)
+	return &node.HeartbeatResponse{
+		Version:    config.Version,
+		ApiVersion: config.ApiVersion,
+		Compatible: !n.VersionSkewed,
+		// Twice per StatsInterval, so stats calls stay skipped
+		Interval: m.StatsInterval / 2,
+	}, nil
+}
+
+// heartbeatPushed reports whether the node pushed a heartbeat within the last StatsInterval
+func (m *Manager) heartbeatPushed(n *node.Node) bool {
+	return time.Since(n.LastPushedHeartbeat) < m.StatsInterval
+}
+
+// recordMissedHeartbeat counts a failed heartbeat and marks the node Down once the threshold is reached
+func (m *Manager) recordMissedHeartbeat(n *node.Node) {
+	n.MissedHeartbeats++
+	if n.Status == node.Down || n.MissedHeartbeats < m.MaxMissedHeartbeats {
+		return
+	}
+
+	n.Status = node.Down
+	m.emitNodeEvent(node.NewEvent(n.Name, node.NodeDown,
+		fmt.Sprintf("%d consecutive heartbeats missed, last seen %v", n.MissedHeartbeats, n.LastHeartbeat)))
+	m.rescheduleNodeTasks(n)
+}
+
+// rescheduleNodeTasks moves the live tasks of a Down node back onto the pending queue
+func (m *Manager) rescheduleNodeTasks(n *node.Node) {
+	m.mu.RLock()
+	ids := slices.Clone(m.WorkerTaskMap[n.Name])
+	m.mu.RUnlock()
+
+	for _, id := range ids {
+		res, err := m.TaskDb.Get(id.String())
+		if err != nil {
+			logger.Error("Unable to get task from node", "task_id", id, "worker", n.Name, "error", err)
+			continue
+		}
+		t, ok := res.(*task.Task)
+		if !ok {
+			logger.Error("Cannot convert result to task.Task type", "task_id", id)
+			continue
+		}
+
+		m.unassignTask(t.ID, n.Name)
+		m.release(t.ID, n.Name)
+		m.Timeline.RecordPlacement(timeline.Placement{TaskID: t.ID, TaskName: t.Name, Node: n.Name, Action: timeline.Removed})
+		m.countTask(n, -1)
+		if t.State == task.Stopping {
+			// The node is gone, and the task with it
+			m.confirmStopped(t.ID, n.Name)
+			continue
+		}
+		if !t.State.Active() {
+			continue
+		}
+		m.requeueTask(t, n.Name, "node down, rescheduling")
+	}
+}
+
+// requeueTask puts a task taken off a node back onto the pending queue
+func (m *Manager) requeueTask(t *task.Task, worker string, reason string) {
+	t.State = task.Scheduled
+	t.ContainerID = ""
+	t.ContainerName = ""
+	t.HostPorts = nil
+	t.StartTime = time.Time{}
+	m.TaskDb.Put(t.ID.String(), t)
+
+	logger.Info("Rescheduling task", "task_id", t.ID, "worker", worker, "reason", reason)
+	m.recordEvent(*t, worker, reason)
+	m.enqueue(task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Scheduled,
+		Timestamp: time.Now(),
+		Task:      *t,
+		// Recorded on the task with the worker it is placed on next
+		Error: reason,
+	})
+}
+
+// isDown reports whether the named worker has been marked Down
+func (m *Manager) isDown(name string) bool {
+	n := m.workerNode(name)
+	return n != nil && n.Status == node.Down
+}
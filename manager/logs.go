@@ -0,0 +1,154 @@
+package manager
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"cube/task"
+)
+
+// Maximum number of log lines buffered between worker streams and the client
+const logBufferLines = 1000
+
+type LogOptions struct {
+	Follow bool
+	Tail   string
+	Prefix bool
+}
+
+type logLine struct {
+	task string
+	text string
+}
+
+// StreamLogs merges the logs of every task matching the selector into out,
+// optionally prefixing each line with the task name
+func (m *Manager) StreamLogs(ctx context.Context, selector task.Selector, opts LogOptions, out io.Writer) error {
+	var tasks []*task.Task
+	for _, t := range m.GetTasks() {
+		if _, ok := m.workerFor(t.ID); ok && t.ContainerID != "" && selector.Matches(t.Labels) {
+			tasks = append(tasks, t)
+		}
+	}
+	if len(tasks) == 0 {
+		return fmt.Errorf("no tasks with containers match selector %q", selector)
+	}
+	return m.mergeLogs(ctx, tasks, opts, out)
+}
+
+// StreamTaskLogs writes the logs of a single task into out
+func (m *Manager) StreamTaskLogs(ctx context.Context, id uuid.UUID, opts LogOptions, out io.Writer) error {
+	res, err := m.TaskDb.Get(id.String())
+	if err != nil {
+		return err
+	}
+	t := res.(*task.Task)
+	if _, ok := m.workerFor(t.ID); !ok || t.ContainerID == "" {
+		return fmt.Errorf("task %s has no container yet", id)
+	}
+	return m.mergeLogs(ctx, []*task.Task{t}, opts, out)
+}
+
+// OpenTaskLogStream opens the server-sent event stream following a task's logs on its worker
+func (m *Manager) OpenTaskLogStream(ctx context.Context, id uuid.UUID, tail string) (io.ReadCloser, error) {
+	res, err := m.TaskDb.Get(id.String())
+	if err != nil {
+		return nil, err
+	}
+	t := res.(*task.Task)
+	worker, ok := m.workerFor(t.ID)
+	if !ok || t.ContainerID == "" {
+		return nil, fmt.Errorf("task %s has no container yet", id)
+	}
+
+	q := url.Values{}
+	if tail != "" {
+		q.Set("tail", tail)
+	}
+	u := fmt.Sprintf("http://%s/tasks/%s/logs/stream?%s", worker, t.ID, q.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("worker %s returned %d", worker, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+func (m *Manager) mergeLogs(ctx context.Context, tasks []*task.Task, opts LogOptions, out io.Writer) error {
+	lines := make(chan logLine, logBufferLines)
+	var wg sync.WaitGroup
+	for _, t := range tasks {
+		wg.Add(1)
+		go func(t *task.Task) {
+			defer wg.Done()
+			err := m.streamTaskLogs(ctx, t, opts, lines)
+			if err != nil && ctx.Err() == nil {
+				logger.Error("Error streaming logs for task", "task_id", t.ID, "error", err)
+			}
+		}(t)
+	}
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+
+	for l := range lines {
+		if opts.Prefix {
+			fmt.Fprintf(out, "[%s] %s\n", l.task, l.text)
+		} else {
+			fmt.Fprintln(out, l.text)
+		}
+	}
+	return nil
+}
+
+func (m *Manager) streamTaskLogs(ctx context.Context, t *task.Task, opts LogOptions, lines chan<- logLine) error {
+	q := url.Values{}
+	q.Set("follow", fmt.Sprintf("%t", opts.Follow))
+	if opts.Tail != "" {
+		q.Set("tail", opts.Tail)
+	}
+	worker, _ := m.workerFor(t.ID)
+	u := fmt.Sprintf("http://%s/tasks/%s/logs?%s", worker, t.ID, q.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("worker returned %d", resp.StatusCode)
+	}
+
+	name := t.Name
+	if name == "" {
+		name = t.ID.String()
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		select {
+		case lines <- logLine{task: name, text: scanner.Text()}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return scanner.Err()
+}
@@ -1,376 +1,866 @@
 package manager
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	"strings"
+	"path/filepath"
+	"sync"
 	"time"
 
-	"github.com/docker/go-connections/nat"
-	"github.com/golang-collections/collections/queue"
 	"github.com/google/uuid"
+	"golang.org/x/time/rate"
 
+	"cube/config"
+	"cube/eventbus"
+	"cube/features"
 	"cube/logging"
+	"cube/manager/dag"
 	"cube/node"
+	"cube/rpc"
 	"cube/scheduler"
 	"cube/store"
+	"cube/systemd"
 	"cube/task"
-	workerApi "cube/worker/api"
+	"cube/timeline"
+	"cube/utils"
 )
 
+// How long placement history and utilization samples are kept
+const timelineRetention = 24 * time.Hour
+
+// Score penalty per Guaranteed task on a node when placing BestEffort tasks
+const bestEffortPenalty = 0.05
+
+var logger = logging.For("manager")
+
 type Manager struct {
-	Pending       queue.Queue
-	TaskDb        store.Store
-	EventDb       store.Store
+	// mu guards Pending, WorkerTaskMap, TaskWorkerMap, Services, newReplicas, CronJobs,
+	// TaskGroups, NodeEvents, nodeRestarts, reservations, stopRequests, deps, waiting,
+	// refusals, preempted, parked, backoff, decisions, results and inProgress
+	mu sync.RWMutex
+	// updateMu serializes task updates polled from and pushed by workers
+	updateMu sync.Mutex
+	// deployMu serializes deployment rollout steps
+	deployMu sync.Mutex
+	// scheduleMu makes scheduling decisions one at a time, so each sees the placements,
+	// reservations and scheduler state left by the last; worker calls run outside it
+	scheduleMu sync.Mutex
+	// reloadMu pauses dispatching while a reload replaces the workers and the scheduler
+	reloadMu sync.RWMutex
+	// submitMu guards submissions, the tasks submitted by idempotency key
+	submitMu    sync.Mutex
+	submissions map[string]submission
+	// Also guarded by submitMu, see SetSubmitLimit
+	limiter        *rate.Limiter
+	throttledCount map[string]int
+	wake           chan struct{}
+	Pending        PendingQueue
+	TaskDb         store.Store
+	EventDb        store.Store
+	ServiceDb      *store.ObjectStore[task.Service]
+	CronJobDb      *store.ObjectStore[task.CronJob]
+	DeploymentDb   *store.ObjectStore[task.Deployment]
+	TaskGroupDb    *store.ObjectStore[task.TaskGroup]
+	QuotaDb        *store.ObjectStore[task.Quota]
+	pendingDb      *store.ObjectStore[pendingRecord]
+	schedulerDb    *store.ObjectStore[schedulerRecord]
+	// Results of finished jobs, kept in results when there is no resultDb
+	resultDb      *store.ObjectStore[task.Result]
 	Workers       []string
 	WorkerTaskMap map[string][]uuid.UUID
 	TaskWorkerMap map[uuid.UUID]string
 	LastWorker    int
 	WorkerNodes   []*node.Node
+	Services      map[uuid.UUID]*task.Service
+	newReplicas   map[uuid.UUID]int // Replicas of each service being submitted
+	CronJobs      map[uuid.UUID]*task.CronJob
+	Deployments   map[uuid.UUID]*task.Deployment
+	TaskGroups    map[uuid.UUID]*task.TaskGroup
+	reservations  map[uuid.UUID]reservation
+	stopRequests  map[uuid.UUID]time.Time
+	// quotaMu serializes adding tasks, checked for duplicates and admitted against
+	// their namespace quota, and guards Quotas
+	quotaMu sync.Mutex
+	Quotas  map[string]*task.Quota
+	// Task dependencies, and the events of tasks waiting for them
+	deps    *dag.Graph
+	waiting map[uuid.UUID]task.TaskEvent
+	// Workers which refused a task for lack of resources, and when
+	refusals map[uuid.UUID]map[string]time.Time
+	// Tasks evicted for higher priority ones, and the events of those waiting for room
+	preempted map[uuid.UUID]bool
+	parked    map[uuid.UUID]task.TaskEvent
+	// Events of unschedulable tasks waiting out their backoff
+	backoff map[uuid.UUID]scheduleRetry
+	// Latest scheduling decision of each task, see GetSchedulingDecision
+	decisions map[uuid.UUID]SchedulingDecision
+	// Tasks with an event being dispatched, whose later events wait their turn
+	inProgress map[uuid.UUID]bool
+	// Results of finished jobs without persistent stores, see resultDb
+	results       map[uuid.UUID]*task.Result
 	Scheduler     scheduler.Scheduler
+	SchedulerType string
+	// State of the scheduler's plugins last saved, see SetScheduler
+	schedulerState map[string]string
+	DbType         string
+	// Data source name of the SQL store, may hold the database password
+	DbDSN string
+	// Client used for worker API calls, authenticating with the cluster token
+	Client *http.Client
+	// Client used for task calls to workers, over HTTP or gRPC depending on --transport
+	WorkerClient rpc.WorkerClient
+	Watchdog     *systemd.Watchdog
+	NodeEvents   []node.Event
+	Timeline     *timeline.Timeline
+	// Task state transitions, with hooks run as workers report state changes
+	States *task.StateMachine
+	// Task events published by the manager loops and the API, see eventbus.Bus
+	Bus          *eventbus.Bus
+	metrics      *managerMetrics
+	nodeRestarts map[string][]time.Time
+	// Task restarts per node within the restart window before it is considered flapping
+	NodeRestartBudget int
+	// Failed restarts of a task on one node before it is rescheduled on another, zero never moves it
+	MaxRestartsPerNode int
+	// Consecutive failed stats calls before a node is marked Down
+	MaxMissedHeartbeats int
+	// Maximum task events dispatched concurrently
+	MaxInFlight int
+	// How long finished tasks are kept, zero keeps them forever
+	TaskRetention time.Duration
+	// How long a task may stay unschedulable before it fails, zero retries forever
+	MaxUnschedulableAge time.Duration
+	// How long submissions are deduplicated by idempotency key, zero disables it
+	IdempotencyTTL time.Duration
+	// Task submissions admitted per second and their burst, see SetSubmitLimit
+	SubmitRate  float64
+	SubmitBurst int
+	// Most task events waiting to be dispatched before submissions are refused, zero for no limit
+	MaxPending int
+	// Exclude workers outside the supported version skew window from scheduling
+	RefuseSkewedWorkers bool
+	// Reads the workers and scheduler again for ReloadConfig, nil when reloading is not supported
+	LoadConfig func() (ReloadConfig, error)
+	// Background loop intervals
+	ProcessInterval     time.Duration
+	UpdateInterval      time.Duration
+	HealthCheckInterval time.Duration
+	StatsInterval       time.Duration
 }
 
-func New(workers []string, schedulerType string, dbType string) *Manager {
-	// Constructor
+// New creates a manager of the given workers, with its task and event stores opened.
+// Persistent stores are kept in dataDir, every store in the database at dsn for the
+// store.SQLTypes. It fails when the task or event store cannot be opened.
+func New(workers []string, schedulerType string, dbType string, dataDir string, dsn string, client *http.Client, workerClient rpc.WorkerClient) (*Manager, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if workerClient == nil {
+		workerClient = &rpc.HTTPClient{Client: client}
+	}
+	statsClient, _ := workerClient.(rpc.StatsClient)
 	workerTaskMap := make(map[string][]uuid.UUID)
 	taskWorkerMap := make(map[uuid.UUID]string)
 
 	var nodes []*node.Node
-	for worker := range workers {
-		workerTaskMap[workers[worker]] = []uuid.UUID{}
-
-		nAPI := fmt.Sprintf("http://%v", workers[worker])
-		n := node.NewNode(workers[worker], nAPI, "worker")
-		nodes = append(nodes, n)
+	for _, worker := range workers {
+		workerTaskMap[worker] = []uuid.UUID{}
+		nodes = append(nodes, newWorkerNode(worker, client, statsClient))
 	}
 
-	var s scheduler.Scheduler
-	switch schedulerType {
-	case "epvm":
-		s = &scheduler.Epvm{Name: "epvm"}
-	case "greedy":
-		s = &scheduler.Greedy{Name: "greedy"}
-	default:
-		s = &scheduler.RoundRobin{Name: "round-robin"}
+	// Profiles defined in a scheduler configuration are set by the caller
+	s, err := scheduler.NewProfile(schedulerType, scheduler.DefaultConfig())
+	if err != nil {
+		schedulerType = "round-robin"
+		s, _ = scheduler.NewProfile(schedulerType, scheduler.DefaultConfig())
 	}
 
 	var ts store.Store
 	var es store.Store
-	var err error
+	// The database the other state is kept in with a SQL store
+	var db *sql.DB
 	switch dbType {
 	case "memory":
 		ts = store.NewInMemoryTaskStore()
 		es = store.NewInMemoryTaskEventStore()
 	case "persistent":
-		ts, err = store.NewTaskStore("tasks.db", 0600, "tasks")
+		tasks, err := store.NewTaskStore(filepath.Join(dataDir, "tasks.db"), 0600, "tasks")
 		if err != nil {
-			logging.Error.Printf("Unable to create task store: %v", err)
+			return nil, fmt.Errorf("unable to create task store: %w", err)
 		}
-
-		es, err = store.NewTaskStore("events.db", 0600, "events")
+		events, err := store.NewTaskEventStore(filepath.Join(dataDir, "events.db"), 0600, "events")
 		if err != nil {
-			logging.Error.Printf("Unable to create task event store: %v", err)
+			tasks.Close()
+			return nil, fmt.Errorf("unable to create task event store: %w", err)
+		}
+		ts, es = tasks, events
+	case store.SQLite, store.Postgres:
+		if dsn == "" && dbType == store.SQLite {
+			dsn = filepath.Join(dataDir, "cube.db")
 		}
+		db, ts, es, err = openSQLStores(dbType, dsn)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open SQL task and event stores: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown store type %q", dbType)
+	}
+
+	m := &Manager{
+		wake:           make(chan struct{}, 1),
+		MaxInFlight:    defaultMaxInFlight,
+		Workers:        workers,
+		TaskDb:         ts,
+		EventDb:        es,
+		WorkerTaskMap:  workerTaskMap,
+		TaskWorkerMap:  taskWorkerMap,
+		WorkerNodes:    nodes,
+		Services:       make(map[uuid.UUID]*task.Service),
+		newReplicas:    make(map[uuid.UUID]int),
+		CronJobs:       make(map[uuid.UUID]*task.CronJob),
+		Deployments:    make(map[uuid.UUID]*task.Deployment),
+		TaskGroups:     make(map[uuid.UUID]*task.TaskGroup),
+		reservations:   make(map[uuid.UUID]reservation),
+		stopRequests:   make(map[uuid.UUID]time.Time),
+		Quotas:         make(map[string]*task.Quota),
+		deps:           dag.New(),
+		waiting:        make(map[uuid.UUID]task.TaskEvent),
+		refusals:       make(map[uuid.UUID]map[string]time.Time),
+		preempted:      make(map[uuid.UUID]bool),
+		parked:         make(map[uuid.UUID]task.TaskEvent),
+		backoff:        make(map[uuid.UUID]scheduleRetry),
+		decisions:      make(map[uuid.UUID]SchedulingDecision),
+		inProgress:     make(map[uuid.UUID]bool),
+		results:        make(map[uuid.UUID]*task.Result),
+		submissions:    make(map[string]submission),
+		throttledCount: make(map[string]int),
+		Scheduler:      s,
+		Watchdog:       systemd.NewWatchdog(),
+		Timeline:       timeline.New(timelineRetention),
+		States:         task.NewStateMachine(),
+		Bus:            eventbus.New(),
+		SchedulerType:  schedulerType,
+		DbType:         dbType,
+		DbDSN:          dsn,
+		Client:         client,
+		WorkerClient:   workerClient,
+
+		nodeRestarts:      make(map[string][]time.Time),
+		NodeRestartBudget: defaultRestartBudget,
+
+		MaxRestartsPerNode: defaultMaxRestartsPerNode,
+
+		MaxMissedHeartbeats: defaultMaxMissedHeartbeats,
+		TaskRetention:       defaultTaskRetention,
+		MaxUnschedulableAge: defaultMaxUnschedulableAge,
+		IdempotencyTTL:      defaultIdempotencyTTL,
+
+		ProcessInterval:     10 * time.Second,
+		UpdateInterval:      15 * time.Second,
+		HealthCheckInterval: 60 * time.Second,
+		StatsInterval:       15 * time.Second,
+	}
+	m.metrics = newManagerMetrics(m)
+	m.subscribe()
+	m.States.OnTransition(task.AnyState, task.Failed, task.TransitionHookFunc(m.stopFailedTaskGroup))
+	m.States.OnTransition(task.AnyState, task.Completed, task.TransitionHookFunc(m.fetchResultOnFinish))
+	m.States.OnTransition(task.AnyState, task.Failed, task.TransitionHookFunc(m.fetchResultOnFinish))
+	if dbType == "persistent" || store.IsSQL(dbType) {
+		m.openStateStores(dataDir, db)
+		m.loadState()
+		m.replayPending()
+		m.recoverState()
 	}
+	return m, nil
+}
 
-	return &Manager{
-		Pending:       *queue.New(),
-		Workers:       workers,
-		TaskDb:        ts,
-		EventDb:       es,
-		WorkerTaskMap: workerTaskMap,
-		TaskWorkerMap: taskWorkerMap,
-		WorkerNodes:   nodes,
-		Scheduler:     s,
+func (m *Manager) Settings() config.Settings {
+	return config.Settings{
+		Component:    "manager",
+		Scheduler:    m.SchedulerType,
+		DbType:       m.DbType,
+		DbDSN:        m.DbDSN,
+		Workers:      m.workers(),
+		FeatureGates: features.Gates.Map(),
+		Intervals: config.Intervals(map[string]time.Duration{
+			"processTasks": m.ProcessInterval,
+			"updateTasks":  m.UpdateInterval,
+			"healthChecks": m.HealthCheckInterval,
+			"nodeStats":    m.StatsInterval,
+			"taskGC":       gcInterval(m.TaskRetention),
+			"cronJobs":     cronInterval,
+		}),
+		Build: config.GetBuildInfo(),
 	}
 }
 
 func (m *Manager) SelectWorker(t task.Task) (*node.Node, error) {
-	candidates := m.Scheduler.SelectCandidateNodes(t, m.WorkerNodes)
-	if candidates == nil {
-		msg := fmt.Sprintf("No available candidates match resource request for task %v", t.ID)
-		err := errors.New(msg)
+	selectedNode, e := m.explain(t, m.Scheduler)
+	m.recordDecision(t.ID, e)
+	m.saveSchedulerState()
+	if selectedNode == nil {
+		return nil, fmt.Errorf("no worker selected for task %v: %s", t.ID, e.Reason)
+	}
+
+	return selectedNode, nil
+}
+
+// GetNodes returns the capacity and health of every worker node
+func (m *Manager) GetNodes() []node.Info {
+	tasks := m.GetTasks()
+	// Allocations are updated under mu
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	nodes := make([]node.Info, 0, len(m.WorkerNodes))
+	for _, n := range m.WorkerNodes {
+		nodes = append(nodes, n.Info())
+	}
+	// Add up the usage the workers last sampled for their running tasks
+	for _, t := range tasks {
+		if t.State != task.Running || t.Usage == nil {
+			continue
+		}
+		for i := range nodes {
+			if nodes[i].Name == m.TaskWorkerMap[t.ID] {
+				nodes[i].TaskCpuUsage += t.Usage.CpuPercent / 100
+				nodes[i].TaskMemoryUsage += t.Usage.MemoryUsage
+			}
+		}
+	}
+	return nodes
+}
+
+// GetTaskStats returns the resource usage last sampled for a task, nil when its
+// worker did not sample it yet
+func (m *Manager) GetTaskStats(id uuid.UUID) (*task.ContainerStats, error) {
+	res, err := m.TaskDb.Get(id.String())
+	if err != nil {
 		return nil, err
 	}
+	return res.(*task.Task).Usage, nil
+}
 
-	scores := m.Scheduler.Score(t, candidates)
-	if scores == nil {
-		return nil, fmt.Errorf("no scores returned to task %v", t)
+// schedulableNodes returns the worker nodes the scheduler may consider
+func (m *Manager) schedulableNodes() []*node.Node {
+	var nodes []*node.Node
+	for _, n := range m.workerNodes() {
+		if n.Status == node.Down || n.Cordoned {
+			continue
+		}
+		if m.RefuseSkewedWorkers && n.VersionSkewed {
+			continue
+		}
+		if n.Stats.RuntimeError != "" {
+			continue
+		}
+		nodes = append(nodes, n)
 	}
-	selectedNode := m.Scheduler.Pick(scores, candidates)
+	return nodes
+}
 
-	return selectedNode, nil
+// ErrDuplicateTask is returned by AddTask for a task ID the manager already knows
+var ErrDuplicateTask = errors.New("task already exists")
+
+func (m *Manager) AddTask(te task.TaskEvent) error {
+	// Held until the task is stored, so concurrent submissions count each other
+	// and the same task cannot be added twice
+	m.quotaMu.Lock()
+	defer m.quotaMu.Unlock()
+	if _, err := m.TaskDb.Get(te.Task.ID.String()); err == nil {
+		return fmt.Errorf("%w: %v", ErrDuplicateTask, te.Task.ID)
+	}
+	if err := m.admitQuota(te.Task); err != nil {
+		return err
+	}
+	if err := m.addDependencies(te.Task); err != nil {
+		return err
+	}
+	te.Task.QoSClass = task.QoSClassFor(te.Task)
+	m.persistPending(te.Task)
+	m.enqueue(te)
+	return nil
 }
 
-func (m *Manager) AddTask(te task.TaskEvent) {
-	m.Pending.Enqueue(te)
+// applyQoSBias pushes BestEffort tasks away from nodes running Guaranteed workloads
+func (m *Manager) applyQoSBias(t task.Task, scores map[string]float64) {
+	if task.QoSClassFor(t) != task.BestEffort {
+		return
+	}
+
+	guaranteed := make(map[string]int)
+	for _, pt := range m.GetTasks() {
+		if pt.State == task.Running && pt.QoSClass == task.Guaranteed {
+			w, _ := m.workerFor(pt.ID)
+			guaranteed[w]++
+		}
+	}
+	for name := range scores {
+		scores[name] += bestEffortPenalty * float64(guaranteed[name])
+	}
 }
 
 func (m *Manager) GetTasks() []*task.Task {
 	tasks, err := m.TaskDb.List()
 	if err != nil {
-		logging.Error.Printf("Error getting list of tasks: %v\n", err)
+		logger.Error("Error getting list of tasks", "error", err)
 		return nil
 	}
 	return tasks.([]*task.Task)
 }
 
-func (m *Manager) UpdateTasks() {
-	for {
-		logging.Info.Println("Checking for task updates from workers")
-		for _, worker := range m.Workers {
-			logging.Info.Printf("Checking worker %v for task updates", worker)
-			url := fmt.Sprintf("http://%s/tasks", worker)
-			resp, err := http.Get(url)
-			if err != nil {
-				logging.Error.Printf("Error connecting to %v: %v", worker, err)
-				continue
-			}
+// GetTask returns the stored task with the given ID
+func (m *Manager) GetTask(id uuid.UUID) (*task.Task, error) {
+	res, err := m.TaskDb.Get(id.String())
+	if err != nil {
+		return nil, err
+	}
+	t, ok := res.(*task.Task)
+	if !ok {
+		return nil, fmt.Errorf("cannot convert result %v to task.Task type", res)
+	}
+	return t, nil
+}
 
-			if resp.StatusCode != http.StatusOK {
-				logging.Error.Printf("Error sending request: %v", err)
+// QueryTasks returns the page of tasks matching q and the number of matching tasks
+func (m *Manager) QueryTasks(q store.TaskQuery) ([]*task.Task, int, error) {
+	return store.QueryTasks(m.TaskDb, q)
+}
+
+func (m *Manager) UpdateTasks(ctx context.Context) {
+	interval := m.pollInterval()
+	m.Watchdog.Register("updateTasks", interval)
+	for {
+		m.Watchdog.Beat("updateTasks")
+		logger.Info("Checking for task updates from workers")
+		for _, worker := range m.workers() {
+			if m.isDown(worker) {
+				logger.Info("Skipping task updates for down worker", "worker", worker)
 				continue
 			}
-
-			d := json.NewDecoder(resp.Body)
-			var tasks []*task.Task
-			err = d.Decode(&tasks)
+			logger.Info("Checking worker for task updates", "worker", worker)
+			tasks, err := m.WorkerClient.ListTasks(ctx, worker)
 			if err != nil {
-				logging.Error.Printf("Error unmarshalling tasks: %s", err.Error())
+				logger.Error("Error getting tasks from worker", "worker", worker, "error", err)
 				continue
 			}
 
 			for _, t := range tasks {
-				logging.Info.Printf("Attempting to update task %v", t.ID)
-
-				res, err := m.TaskDb.Get(t.ID.String())
-				if err != nil {
-					log.Printf("%s\n", err)
-					continue
-				}
-				taskPersisted, ok := res.(*task.Task)
-				if !ok {
-					logging.Error.Printf("Cannot convert result %v to task.Task type\n", res)
-					continue
-				}
-
-				if taskPersisted.State != t.State {
-					taskPersisted.State = t.State
-				}
-
-				taskPersisted.StartTime = t.StartTime
-				taskPersisted.FinishTime = t.FinishTime
-				taskPersisted.ContainerID = t.ContainerID
-				taskPersisted.HostPorts = t.HostPorts
-				m.TaskDb.Put(taskPersisted.ID.String(), taskPersisted)
+				m.applyTaskUpdate(worker, t)
 			}
+			m.confirmMissing(worker, tasks)
+		}
+		logger.Info("Task updates completed")
+		logger.Debug("Sleeping", "interval", interval)
+		if !utils.SleepContext(ctx, interval) {
+			return
 		}
-		logging.Info.Println("Task updates completed")
-		logging.Info.Println("Sleeping for 15 seconds")
-		time.Sleep(15 * time.Second)
 	}
 }
 
-func (m *Manager) ProcessTasks() {
-	for {
-		logging.Info.Printf("Processing any tasks in the queue")
-		m.SendWork()
-		logging.Info.Printf("Sleeping for 10 seconds")
-		time.Sleep(10 * time.Second)
-	}
-}
+// applyTaskUpdate merges the state a worker reports for a task into the manager's copy
+func (m *Manager) applyTaskUpdate(worker string, t *task.Task) {
+	m.updateMu.Lock()
+	defer m.updateMu.Unlock()
 
-func (m *Manager) stopTask(worker string, taskID string) {
-	client := &http.Client{}
-	url := fmt.Sprintf("http://%s/tasks/%s", worker, taskID)
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		logging.Error.Printf("Error creating request to delete task %s: %v", taskID, err)
-		return
-	}
+	logger.Debug("Attempting to update task", "task_id", t.ID, "worker", worker, "state", t.State.String())
 
-	resp, err := client.Do(req)
-	if err != nil {
-		logging.Error.Printf("Error connecting to worker at %s: %v", url, err)
+	// Tasks rescheduled away while this worker was down are stale copies
+	if assigned, ok := m.workerFor(t.ID); ok && assigned != worker {
+		if t.State.Active() {
+			logger.Info("Stopping task, it was rescheduled to another worker", "task_id", t.ID, "worker", worker, "assigned", assigned)
+			m.stopTask(worker, t.ID.String())
+		}
 		return
 	}
 
-	if resp.StatusCode != 204 {
-		logging.Error.Printf("Error sending request: %v", err)
+	if _, ok := m.workerFor(t.ID); !ok && !isLive(*t) {
+		// Finished tasks the manager already collected
+		return
+	} else if !ok && m.isPreempted(t.ID) {
+		// The worker has yet to stop a task preempted from it
 		return
 	}
 
-	logging.Info.Printf("Task %s has been scheduled to be stopped", taskID)
-}
-
-func (m *Manager) SendWork() {
-	if m.Pending.Len() > 0 {
-		e := m.Pending.Dequeue()
-		te := e.(task.TaskEvent)
-		err := m.EventDb.Put(te.ID.String(), &te)
-		if err != nil {
-			logging.Error.Printf("Error attempting to store task event %s: %s\n", te.ID.String(), err)
-			return
+	var stateChanged, revisionChanged, restarted bool
+	var previous task.State
+	var updated task.Task
+	err := m.TaskDb.Update(t.ID.String(), func(value interface{}) (interface{}, error) {
+		taskPersisted, ok := value.(*task.Task)
+		if !ok {
+			return nil, fmt.Errorf("cannot convert result %v to task.Task type", value)
 		}
-		logging.Info.Printf("Pulled %v off pending queue", te)
 
-		taskWorker, ok := m.TaskWorkerMap[te.Task.ID]
-		if ok {
-			res, err := m.TaskDb.Get(te.Task.ID.String())
-			if err != nil {
-				logging.Error.Printf("Unable to schedule task: %s", err)
-				return
+		state := t.State
+		if taskPersisted.State == task.Stopping {
+			// Stopping tasks only change once the worker confirms the container is gone
+			switch t.State {
+			case task.Completed, task.Failed, task.Stopped:
+				state = task.Stopped
+			default:
+				state = task.Stopping
 			}
-
-			persistedTask, ok := res.(*task.Task)
-			if !ok {
-				logging.Error.Println("Unable to convert task to task.Task type")
-				return
-			}
-
-			if te.State == task.Completed && task.ValidStateTransition(persistedTask.State, te.State) {
-				m.stopTask(taskWorker, te.Task.ID.String())
-				return
-			}
-
-			logging.Warning.Printf(
-				"Invalid request: existing task %s is in state %v and cannot transition to the completed state",
-				persistedTask.ID.String(), persistedTask.State,
-			)
-			return
 		}
+		previous = taskPersisted.State
+		stateChanged = previous != state
+		taskPersisted.State = state
+		taskPersisted.StartTime = t.StartTime
+		taskPersisted.FinishTime = t.FinishTime
+		taskPersisted.ContainerID = t.ContainerID
+		taskPersisted.ContainerName = t.ContainerName
+		taskPersisted.HostPorts = t.HostPorts
+		taskPersisted.ExitCode = t.ExitCode
+		taskPersisted.OutputTail = t.OutputTail
+		taskPersisted.Health = t.Health
+		taskPersisted.FailureReason = t.FailureReason
+		taskPersisted.Error = t.Error
+		taskPersisted.ErrorCode = t.ErrorCode
+		taskPersisted.OOMKilled = t.OOMKilled
+		taskPersisted.Usage = t.Usage
+		// Workers restart exited containers in place, counting the restarts
+		restarted = t.RestartCount > taskPersisted.RestartCount
+		taskPersisted.RestartCount = max(taskPersisted.RestartCount, t.RestartCount)
+		if t.State != task.Failed {
+			// Restarts of failed tasks are scheduled by the manager
+			taskPersisted.NextRestart = t.NextRestart
+		}
+		revisionChanged = t.Revision > taskPersisted.Revision
+		if revisionChanged {
+			// A rolling update completed on the worker
+			taskPersisted.Revision = t.Revision
+			taskPersisted.Image = t.Image
+			taskPersisted.Env = t.Env
+			taskPersisted.Cpu = t.Cpu
+			taskPersisted.Memory = t.Memory
+			taskPersisted.Disk = t.Disk
+			taskPersisted.CpuLimit = t.CpuLimit
+			taskPersisted.MemoryLimit = t.MemoryLimit
+			taskPersisted.QoSClass = t.QoSClass
+		}
+		updated = *taskPersisted
+		return taskPersisted, nil
+	})
+	if err != nil {
+		logger.Error("Error updating task", "task_id", t.ID, "error", err)
+		return
+	}
 
-		t := te.Task
-		w, err := m.SelectWorker(t)
-		if err != nil {
-			logging.Error.Printf("Error selecting worker for task %s: %v", t.ID, err)
+	if updated.State == task.Stopping {
+		m.retryStop(worker, t.ID)
+	}
+	if stateChanged {
+		m.States.Fire(updated, previous, updated.State)
+		if t.State == task.Completed || t.State == task.Failed {
+			m.release(t.ID, worker)
+		}
+		if updated.State == task.Stopped {
+			m.forgetStopped(t.ID, worker)
+			m.recordEvent(updated, worker, "stopped")
 			return
 		}
+		if t.State == task.Failed && t.Health == task.Unhealthy {
+			m.publish(eventbus.TaskUnhealthy, updated, worker, "")
+		}
+		var msg string
+		if restarted && t.State == task.Restarting {
+			m.recordRestart(worker)
+			m.publish(eventbus.TaskRestarted, updated, worker, "")
+			msg = fmt.Sprintf("exited with code %d, restart #%d at %v", t.ExitCode, t.RestartCount, t.NextRestart.Format(time.RFC3339))
+		} else if t.State == task.Failed && t.OOMKilled {
+			msg = "was killed for running out of memory"
+		} else if t.State == task.Failed && t.FailureReason == task.ReasonDeadlineExceeded {
+			msg = "exceeded its deadline"
+		} else if t.State == task.Failed && t.ExitCode != 0 {
+			msg = fmt.Sprintf("exited with code %d", t.ExitCode)
+		} else if t.State == task.Failed && t.Health == task.Unhealthy {
+			msg = "failed health checks"
+		} else if t.State == task.Failed && t.Error != "" {
+			msg = fmt.Sprintf("failed to start: %s", t.Error)
+		}
+		m.recordEvent(*t, worker, msg)
+		if t.State == task.Completed || t.State == task.Failed {
+			m.releaseWaiting()
+		}
+	}
+	if revisionChanged {
+		if n := m.workerNode(worker); n != nil {
+			m.reserve(n, updated)
+		}
+	}
+}
 
-		logging.Info.Printf("Selected worker %s for task %s", w.Name, t.ID)
+// stopTask asks a worker to stop a task, reporting whether the worker no longer has it
+func (m *Manager) stopTask(worker string, taskID string) bool {
+	id, err := uuid.Parse(taskID)
+	if err != nil {
+		logger.Error("Invalid task ID", "task_id", taskID, "error", err)
+		return false
+	}
 
-		m.WorkerTaskMap[w.Name] = append(m.WorkerTaskMap[w.Name], te.Task.ID)
-		m.TaskWorkerMap[t.ID] = w.Name
+	err = m.WorkerClient.StopTask(context.Background(), worker, id)
+	if errors.Is(err, rpc.ErrTaskNotFound) {
+		logger.Info("Task is not on worker anymore", "task_id", taskID, "worker", worker)
+		return true
+	}
+	var rejected *rpc.RejectedError
+	if errors.As(err, &rejected) {
+		logger.Error("Error stopping task", "task_id", taskID, "worker", worker, "status", rejected.Code)
+		return false
+	}
+	if err != nil {
+		logger.Error("Error connecting to worker", "worker", worker, "error", err)
+		return false
+	}
 
-		t.State = task.Scheduled
-		m.TaskDb.Put(t.ID.String(), &t)
+	m.release(id, worker)
+	m.Timeline.RecordPlacement(timeline.Placement{TaskID: id, Node: worker, Action: timeline.Removed})
+	logger.Info("Task has been scheduled to be stopped", "task_id", taskID, "worker", worker)
+	return false
+}
 
-		data, err := json.Marshal(te)
+func (m *Manager) SendWork() {
+	item, ok := m.dequeue()
+	if !ok {
+		logger.Debug("No work in the queue")
+		return
+	}
+	m.dispatch(item.te)
+	m.ack(item.key)
+	m.done(item.te.Task.ID)
+}
+
+// dispatch records the task event and sends it to the task's worker,
+// selecting one through the scheduler for new tasks
+func (m *Manager) dispatch(te task.TaskEvent) {
+	m.Bus.Publish(eventbus.Event{Topic: eventbus.TaskRecorded, TaskEvent: te})
+	logger.Info("Pulled task event off pending queue", "event_id", te.ID, "task_id", te.Task.ID, "state", te.State.String())
+
+	taskWorker, ok := m.workerFor(te.Task.ID)
+	if ok {
+		res, err := m.TaskDb.Get(te.Task.ID.String())
 		if err != nil {
-			logging.Warning.Printf("Unable to marshal task object: %v.", t)
+			logger.Error("Unable to schedule task", "task_id", te.Task.ID, "error", err)
+			return
 		}
 
-		url := fmt.Sprintf("http://%s/tasks", w.Name)
-		resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
-		if err != nil {
-			logging.Error.Printf("Error connecting to %v: %v", w, err)
-			m.Pending.Enqueue(t)
+		persistedTask, ok := res.(*task.Task)
+		if !ok {
+			logger.Error("Unable to convert task to task.Task type", "task_id", te.Task.ID)
 			return
 		}
 
-		d := json.NewDecoder(resp.Body)
-		if resp.StatusCode != http.StatusCreated {
-			e := workerApi.ErrResponse{}
-			err := d.Decode(&e)
-			if err != nil {
-				logging.Error.Printf("Error decoding response: %s\n", err.Error())
-				return
+		if te.State == task.Completed && m.States.Valid(persistedTask.State, te.State) {
+			if m.stopTask(taskWorker, te.Task.ID.String()) {
+				m.confirmStopped(te.Task.ID, taskWorker)
 			}
-			logging.Error.Printf("Response error (%d): %s", e.HTTPStatusCode, e.Message)
 			return
 		}
 
-		t = task.Task{}
-		err = d.Decode(&t)
-		if err != nil {
-			logging.Error.Printf("Error decoding response: %s\n", err.Error())
+		if te.State == task.Running && persistedTask.State == task.Running && te.Task.Revision > persistedTask.Revision {
+			m.rollout(taskWorker, te)
 			return
 		}
-		w.TaskCount++
-		logging.Info.Printf("Received response from worker: %#v\n", t)
-	} else {
-		logging.Info.Printf("No work in the queue")
+
+		logger.Warn("Invalid request: existing task cannot transition to the completed state",
+			"task_id", persistedTask.ID, "state", persistedTask.State.String())
+		return
 	}
-}
 
-// Task HealthChecks and Restarts (Chapter 09)
-// 1. Individual Task Health Check
-func getHostPort(ports nat.PortMap) *string {
-	for k, _ := range ports {
-		return &ports[k][0].HostPort
+	t := te.Task
+	if res, err := m.TaskDb.Get(t.ID.String()); err == nil && res.(*task.Task).State == task.Stopped {
+		logger.Info("Dropping task, it was stopped while waiting to be scheduled", "task_id", t.ID)
+		m.forgetPreempted(t.ID)
+		// Task group members may hold a reservation made for their group
+		m.release(t.ID, "")
+		return
+	}
+	if !t.Deadline.IsZero() && !time.Now().Before(t.Deadline) {
+		m.failDeadline(t)
+		m.forgetPreempted(t.ID)
+		return
+	}
+	if m.waitForDependencies(te) {
+		return
+	}
+	m.scheduleMu.Lock()
+	start := time.Now()
+	group := m.taskGroupOf(t)
+	var w *node.Node
+	var err error
+	if group != nil {
+		w, err = m.selectGroupWorker(group, t)
+	} else {
+		w, err = m.SelectWorker(t)
+	}
+	// Evicting for a single member would split its group
+	if err != nil && group == nil {
+		if n := m.preempt(t); n != nil {
+			w, err = n, nil
+			m.overrideDecision(t.ID, n.Name, "preempted lower priority tasks to make room")
+		}
+	}
+	m.metrics.schedulingDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.scheduleMu.Unlock()
+		m.clearRefusals(t.ID)
+		m.publish(eventbus.TaskDispatched, t, "", "unschedulable")
+		if m.park(te) {
+			logger.Warn("No room for preempted task, waiting for resources", "task_id", t.ID)
+			return
+		}
+		m.retryUnschedulable(te, err)
+		return
 	}
-	return nil
-}
 
-func (m *Manager) checkTaskHealth(t task.Task) error {
-	logging.Info.Printf("Calling health check for task %s: %s\n", t.ID, t.HealthCheck)
+	logger.Info("Selected worker for task", "task_id", t.ID, "worker", w.Name)
 
-	w := m.TaskWorkerMap[t.ID]
-	hostPort := getHostPort(t.HostPorts)
-	worker := strings.Split(w, ":")
-	if hostPort == nil {
-		logging.Warning.Printf("Have not collected task %s host port yet. Skipping.\n", t.ID)
-		return nil
+	if !m.tryReserve(w, t) {
+		m.scheduleMu.Unlock()
+		logger.Warn("Worker no longer has capacity for task, requeueing", "task_id", t.ID, "worker", w.Name)
+		m.publish(eventbus.TaskDispatched, t, w.Name, "requeued")
+		m.enqueue(te)
+		return
 	}
 
-	url := fmt.Sprintf("http://%s:%s%s", worker[0], *hostPort, t.HealthCheck)
-	logging.Info.Printf("Calling health check for task %s: %s\n", t.ID, url)
-	resp, err := http.Get(url)
-	if err != nil {
-		msg := fmt.Sprintf("Error connecting to health check %s", url)
-		logging.Error.Println(msg)
-		return errors.New(msg)
-	}
+	m.assignTask(t.ID, w.Name)
+	m.Timeline.RecordPlacement(timeline.Placement{TaskID: t.ID, TaskName: t.Name, Node: w.Name, Action: timeline.Placed})
+	te.Worker = w.Name
+	m.Bus.Publish(eventbus.Event{Topic: eventbus.TaskRecorded, TaskEvent: te})
 
-	if resp.StatusCode != http.StatusOK {
-		msg := fmt.Sprintf("Error health check for task %s did not return 200\n", t.ID)
-		logging.Error.Println(msg)
-		return errors.New(msg)
+	t.State = task.Scheduled
+	t.ClearCondition(task.Unschedulable)
+	m.TaskDb.Put(t.ID.String(), &t)
+	m.scheduleMu.Unlock()
+
+	accepted, err := m.WorkerClient.SubmitTask(context.Background(), w.Name, te)
+	var rejected *rpc.RejectedError
+	if errors.As(err, &rejected) && rejected.Insufficient() {
+		logger.Warn("Worker lacks resources for task, rescheduling", "task_id", t.ID, "worker", w.Name, "message", rejected.Message)
+		m.recordEvent(t, w.Name, fmt.Sprintf("worker refused task, rescheduling: %s", rejected.Message))
+		m.refuse(t.ID, w.Name)
+		m.unassignTask(t.ID, w.Name)
+		m.release(t.ID, w.Name)
+		m.publish(eventbus.TaskDispatched, t, w.Name, "refused")
+		te.ID = uuid.New()
+		te.Worker = ""
+		m.enqueue(te)
+		return
+	}
+	if errors.As(err, &rejected) {
+		logger.Error("Worker rejected task", "task_id", t.ID, "worker", w.Name, "status", rejected.Code, "message", rejected.Message)
+		m.recordEvent(t, w.Name, fmt.Sprintf("worker rejected task: %s", rejected.Message))
+		m.release(t.ID, w.Name)
+		m.publish(eventbus.TaskDispatched, t, w.Name, "rejected")
+		return
+	}
+	if err != nil {
+		logger.Error("Error connecting to worker, requeueing", "task_id", t.ID, "worker", w.Name, "error", err)
+		m.recordEvent(t, w.Name, fmt.Sprintf("dispatch failed, requeued: %v", err))
+		m.unassignTask(t.ID, w.Name)
+		m.release(t.ID, w.Name)
+		m.publish(eventbus.TaskDispatched, t, w.Name, "requeued")
+		te.ID = uuid.New()
+		te.Worker = ""
+		m.enqueue(te)
+		return
 	}
 
-	logging.Info.Printf("Task %s health check response: %v\n", t.ID, resp.StatusCode)
-	return nil
+	m.clearRefusals(t.ID)
+	m.forgetPreempted(t.ID)
+	m.recordPlacement(t.ID, w.Name, te.Error)
+	m.countTask(w, 1)
+	m.publish(eventbus.TaskDispatched, t, w.Name, "success")
+	logger.Info("Task accepted by worker", "task_id", accepted.ID, "worker", w.Name, "state", accepted.State.String())
 }
 
-// 2. Health Check all the Tasks
-func (m *Manager) DoHealthChecks() {
+// Task HealthChecks and Restarts (Chapter 09)
+// Probes run on the workers, which fail tasks exceeding their probe failure threshold
+// once the probe's initial delay is over, or never passing their startup probe.
+// 1. Restart failed Tasks
+func (m *Manager) DoHealthChecks(ctx context.Context) {
+	m.Watchdog.Register("healthChecks", m.HealthCheckInterval)
 	for {
-		logging.Info.Println("Performing task health check")
+		m.Watchdog.Beat("healthChecks")
+		logger.Info("Restarting failed tasks")
 		m.doHealthChecks()
-		logging.Info.Println("Task health checks completed")
-		logging.Info.Println("Sleeping for 60 seconds")
-		time.Sleep(60 * time.Second)
+		logger.Info("Failed task restarts completed")
+		logger.Debug("Sleeping", "interval", m.HealthCheckInterval)
+		if !utils.SleepContext(ctx, m.HealthCheckInterval) {
+			return
+		}
 	}
 }
 
 func (m *Manager) doHealthChecks() {
 	for _, t := range m.GetTasks() {
-		if t.State == task.Running && t.RestartCount < 3 {
-			err := m.checkTaskHealth(*t)
-			if err != nil {
-				if t.RestartCount < 3 {
-					m.restartTask(t)
-				}
-			}
-		} else if t.State == task.Failed && t.RestartCount < 3 {
+		if t.State != task.Failed || !t.RestartAllowed(time.Now()) {
+			continue
+		}
+		if t.NextRestart.IsZero() {
+			m.scheduleRestart(t)
+			continue
+		}
+		if !time.Now().Before(t.NextRestart) {
 			m.restartTask(t)
 		}
 	}
 }
 
-// 3. Restart unhealthy Tasks
+// scheduleRestart sets when a failed task is restarted, backing off by its restart policy
+func (m *Manager) scheduleRestart(t *task.Task) {
+	delay := t.RestartPolicy.Backoff(t.RestartCount)
+	err := m.TaskDb.Update(t.ID.String(), func(value interface{}) (interface{}, error) {
+		current := value.(*task.Task)
+		if current.State != task.Failed {
+			return current, nil
+		}
+		current.NextRestart = time.Now().UTC().Add(delay)
+		return current, nil
+	})
+	if err != nil {
+		logger.Error("Error scheduling task restart", "task_id", t.ID, "error", err)
+		return
+	}
+	logger.Info("Restarting failed task after backoff", "task_id", t.ID, "restarts", t.RestartCount, "delay", delay)
+}
+
+// 2. Restart a single Task
 func (m *Manager) restartTask(t *task.Task) {
 	// Get the worker where the task was running
-	w := m.TaskWorkerMap[t.ID]
-	t.State = task.Scheduled
-	t.RestartCount++
-	// We need to overwrite the existing task to ensure it has
-	// the current state
-	m.TaskDb.Put(t.ID.String(), t)
+	w, _ := m.workerFor(t.ID)
+	m.recordRestart(w)
+	// Restart from the current stored copy, t may be stale
+	var move bool
+	err := m.TaskDb.Update(t.ID.String(), func(value interface{}) (interface{}, error) {
+		current := value.(*task.Task)
+		move = m.exhaustedNode(*current)
+		current.State = task.Scheduled
+		current.Health = ""
+		current.FailureReason = ""
+		current.Error = ""
+		current.ErrorCode = ""
+		current.OOMKilled = false
+		current.NextRestart = time.Time{}
+		current.RestartCount++
+		*t = *current
+		return current, nil
+	})
+	if err != nil {
+		logger.Error("Error updating task for restart", "task_id", t.ID, "error", err)
+		return
+	}
+	if move {
+		m.publish(eventbus.TaskRestarted, *t, w, "rescheduled")
+		m.moveTask(t, w)
+		return
+	}
+	m.recordEvent(*t, w, fmt.Sprintf("restart #%d", t.RestartCount))
+	m.publish(eventbus.TaskRestarted, *t, w, "")
+	if n := m.workerNode(w); n != nil {
+		m.reserve(n, *t)
+	}
 
 	te := task.TaskEvent{
 		ID:        uuid.New(),
@@ -378,50 +868,88 @@ func (m *Manager) restartTask(t *task.Task) {
 		Timestamp: time.Now(),
 		Task:      *t,
 	}
-	data, err := json.Marshal(te)
-	if err != nil {
-		logging.Error.Printf("Unable to marshal task object: %v.\n", t)
+	_, err = m.WorkerClient.SubmitTask(context.Background(), w, te)
+	var rejected *rpc.RejectedError
+	if errors.As(err, &rejected) {
+		logger.Error("Worker rejected task restart", "task_id", t.ID, "worker", w, "status", rejected.Code, "message", rejected.Message)
 		return
 	}
-
-	url := fmt.Sprintf("http://%s/tasks", w)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
 	if err != nil {
-		logging.Error.Printf("Error connecting to %v: %v\n", w, err)
-		m.Pending.Enqueue(t)
-		return
-	}
-
-	d := json.NewDecoder(resp.Body)
-	if resp.StatusCode != http.StatusCreated {
-		e := workerApi.ErrResponse{}
-		err := d.Decode(&e)
-		if err != nil {
-			logging.Error.Printf("Error decoding response: %s\n", err.Error())
-			return
-		}
-		logging.Error.Printf("Response error (%d): %s\n", e.HTTPStatusCode, e.Message)
+		logger.Error("Error connecting to worker, requeueing", "task_id", t.ID, "worker", w, "error", err)
+		m.unassignTask(t.ID, w)
+		m.release(t.ID, w)
+		m.enqueue(te)
 		return
 	}
+	logger.Info("Restarted task", "task_id", t.ID, "worker", w, "restarts", t.RestartCount)
+}
 
-	newTask := task.Task{}
-	err = d.Decode(&newTask)
-	if err != nil {
-		logging.Error.Printf("Error decoding response: %s\n", err.Error())
-		return
+// moveTask reschedules a task which kept failing on worker, excluding worker
+// unless no other node can run it
+func (m *Manager) moveTask(t *task.Task, worker string) {
+	reason := fmt.Sprintf("restart #%d, failed %d times on %s, rescheduling on another worker", t.RestartCount, t.RestartsOnWorker(), worker)
+	logger.Warn("Task keeps failing on its worker, rescheduling", "task_id", t.ID, "worker", worker, "restarts", t.RestartCount)
+	m.refuse(t.ID, worker)
+	m.unassignTask(t.ID, worker)
+	m.release(t.ID, worker)
+	m.Timeline.RecordPlacement(timeline.Placement{TaskID: t.ID, TaskName: t.Name, Node: worker, Action: timeline.Removed})
+	if n := m.workerNode(worker); n != nil {
+		m.countTask(n, -1)
 	}
-	logging.Info.Printf("%#v\n", t)
+	m.requeueTask(t, worker, reason)
 }
 
-func (m *Manager) UpdateNodeStats() {
+func (m *Manager) UpdateNodeStats(ctx context.Context) {
+	m.Watchdog.Register("nodeStats", m.StatsInterval)
 	for {
-		for _, node := range m.WorkerNodes {
-			logging.Info.Printf("Collecting stats for node %v", node.Name)
+		m.Watchdog.Beat("nodeStats")
+		for _, node := range m.workerNodes() {
+			if m.heartbeatPushed(node) {
+				continue
+			}
+			logger.Debug("Collecting stats for node", "worker", node.Name)
 			_, err := node.GetStats()
 			if err != nil {
-				logging.Error.Printf("Error updating node stats: %v", err)
+				logger.Error("Error updating node stats", "worker", node.Name, "error", err)
+				m.recordMissedHeartbeat(node)
+				continue
 			}
+			m.recordHeartbeat(node)
+			m.updateCordon(node)
+			m.checkVersionSkew(node)
+			m.recordUtilization(node)
 		}
-		time.Sleep(15 * time.Second)
+		if !utils.SleepContext(ctx, m.StatsInterval) {
+			return
+		}
+	}
+}
+
+// recordUtilization adds the node's latest stats to the timeline
+func (m *Manager) recordUtilization(n *node.Node) {
+	s := timeline.Sample{
+		MemUsedPercent: float32(n.Stats.MemStats.UsedPercent),
+		DiskUsedPct:    float32(n.Stats.DiskStats.UsedPercent),
+		TaskCount:      n.TaskCount,
+	}
+	if n.Stats.CpuStats != nil {
+		s.CpuPercent = float32(n.CpuUsage * 100)
+	}
+	m.Timeline.RecordSample(n.Name, s)
+}
+
+// checkVersionSkew flags workers whose advertised API version is outside the supported window
+func (m *Manager) checkVersionSkew(n *node.Node) {
+	n.VersionSkewed = !config.ApiVersionSupported(n.ApiVersion)
+	if n.VersionSkewed {
+		logger.Warn("Worker API version is outside the supported window",
+			"worker", n.Name, "api_version", n.ApiVersion, "manager_api_version", config.ApiVersion, "max_skew", config.MaxApiVersionSkew)
+		if m.RefuseSkewedWorkers {
+			logger.Warn("Worker will not be scheduled until it is upgraded", "worker", n.Name)
+		}
+		return
+	}
+	if n.Version != config.Version {
+		logger.Warn("Worker runs a different version", "worker", n.Name, "version", n.Version, "manager_version", config.Version)
 	}
 }
@@ -0,0 +1,110 @@
+package manager
+
+import (
+	"net/http"
+
+	"cube/eventbus"
+	"cube/metrics"
+	"cube/node"
+)
+
+// Manager metrics served on /metrics
+type managerMetrics struct {
+	registry            *metrics.Registry
+	tasks               *metrics.Gauge
+	pending             *metrics.Gauge
+	schedulingDuration  *metrics.Histogram
+	submissions         *metrics.Counter
+	throttled           *metrics.Counter
+	dispatches          *metrics.Counter
+	healthCheckFailures *metrics.Counter
+	restarts            *metrics.Counter
+	transitions         *metrics.Counter
+	preemptions         *metrics.Counter
+	busDropped          *metrics.Counter
+	nodeUp              *metrics.Gauge
+	nodeTasks           *metrics.Gauge
+	nodeCpuUsage        *metrics.Gauge
+	nodeCpuAllocated    *metrics.Gauge
+	nodeCores           *metrics.Gauge
+	nodeMemoryUsed      *metrics.Gauge
+	nodeMemoryAllocated *metrics.Gauge
+	nodeMemoryTotal     *metrics.Gauge
+}
+
+func newManagerMetrics(m *Manager) *managerMetrics {
+	r := metrics.NewRegistry()
+	mm := &managerMetrics{
+		registry:            r,
+		tasks:               r.NewGauge("cube_manager_tasks", "Tasks known to the manager by state.", "state"),
+		pending:             r.NewGauge("cube_manager_pending_task_events", "Task events waiting to be dispatched."),
+		schedulingDuration:  r.NewHistogram("cube_manager_scheduling_duration_seconds", "Time spent selecting a worker for a task.", metrics.DefaultBuckets),
+		submissions:         r.NewCounter("cube_manager_task_submissions_total", "Tasks submitted through the API."),
+		throttled:           r.NewCounter("cube_manager_task_submissions_throttled_total", "Task submissions refused by backpressure by reason.", "reason"),
+		dispatches:          r.NewCounter("cube_manager_task_dispatches_total", "Task events dispatched to workers by result.", "result"),
+		healthCheckFailures: r.NewCounter("cube_manager_health_check_failures_total", "Tasks failed by their health probes by node.", "node"),
+		restarts:            r.NewCounter("cube_manager_task_restarts_total", "Task restarts by node.", "node"),
+		transitions:         r.NewCounter("cube_manager_task_transitions_total", "Task state transitions reported by workers by previous and new state.", "from", "to"),
+		preemptions:         r.NewCounter("cube_manager_task_preemptions_total", "Tasks evicted for higher priority tasks by node.", "node"),
+		busDropped:          r.NewCounter("cube_manager_event_bus_dropped_total", "Events dropped by event bus subscribers falling behind by subscriber.", "subscriber"),
+		nodeUp:              r.NewGauge("cube_node_up", "Whether the node is receiving heartbeats.", "node"),
+		nodeTasks:           r.NewGauge("cube_node_tasks", "Running tasks on the node.", "node"),
+		nodeCpuUsage:        r.NewGauge("cube_node_cpu_usage_ratio", "Share of CPU time spent non-idle between the last two stats samples.", "node"),
+		nodeCpuAllocated:    r.NewGauge("cube_node_cpu_allocated", "CPUs reserved by tasks placed on the node.", "node"),
+		nodeCores:           r.NewGauge("cube_node_cpu_cores", "Logical CPUs on the node.", "node"),
+		nodeMemoryUsed:      r.NewGauge("cube_node_memory_used_bytes", "Memory used on the node.", "node"),
+		nodeMemoryAllocated: r.NewGauge("cube_node_memory_allocated_bytes", "Memory reserved by tasks placed on the node.", "node"),
+		nodeMemoryTotal:     r.NewGauge("cube_node_memory_total_bytes", "Total memory on the node.", "node"),
+	}
+	r.OnScrape(func() { mm.collect(m) })
+	return mm
+}
+
+// observe counts the task events published on the manager's bus
+func (mm *managerMetrics) observe(e eventbus.Event) {
+	switch e.Topic {
+	case eventbus.TaskSubmitted:
+		mm.submissions.Inc()
+	case eventbus.TaskDispatched:
+		mm.dispatches.Inc(e.Reason)
+	case eventbus.TaskTransitioned:
+		mm.transitions.Inc(e.Previous.String(), e.State.String())
+	case eventbus.TaskUnhealthy:
+		mm.healthCheckFailures.Inc(e.Worker)
+	case eventbus.TaskRestarted:
+		mm.restarts.Inc(e.Worker)
+	}
+}
+
+// collect sets the gauges derived from the manager's current state
+func (mm *managerMetrics) collect(m *Manager) {
+	mm.tasks.Reset()
+	for _, t := range m.GetTasks() {
+		mm.tasks.Add(1, t.State.String())
+	}
+	mm.pending.Set(float64(m.PendingLen()))
+
+	for _, n := range m.workerNodes() {
+		up := 0.0
+		if n.Status != node.Down {
+			up = 1
+		}
+		mm.nodeUp.Set(up, n.Name)
+		mm.nodeTasks.Set(float64(n.TaskCount), n.Name)
+		mm.nodeCores.Set(float64(n.Cores), n.Name)
+		mm.nodeCpuAllocated.Set(n.CpuAllocated, n.Name)
+		mm.nodeMemoryTotal.Set(float64(n.Memory), n.Name)
+		mm.nodeMemoryAllocated.Set(float64(n.MemoryAllocated), n.Name)
+		if n.Stats.MemStats != nil {
+			mm.nodeMemoryUsed.Set(float64(n.Stats.MemUsed()), n.Name)
+		}
+		if n.Stats.CpuStats != nil {
+			mm.nodeCpuUsage.Set(n.CpuUsage, n.Name)
+		}
+	}
+}
+
+// MetricsHandler serves the manager metrics in the Prometheus text format
+func (m *Manager) MetricsHandler() http.Handler {
+	return m.metrics.registry.Handler()
+}
@@ -0,0 +1,62 @@
+package manager
+
+import (
+	"fmt"
+	"slices"
+
+	"cube/node"
+	"cube/task"
+)
+
+// Node events listed with a node's details, the most recent ones
+const maxNodeDetailEvents = 20
+
+// NodeDetail is a node with the tasks placed on it and its recent events, as
+// served by GET /nodes/{name}
+type NodeDetail struct {
+	node.Info
+	Tasks []*task.Task
+	// Most recent first
+	Events []node.Event
+}
+
+// GetNode returns the details of the named worker
+func (m *Manager) GetNode(name string) (*NodeDetail, error) {
+	nodes := m.GetNodes()
+	i := slices.IndexFunc(nodes, func(n node.Info) bool { return n.Name == name })
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNodeNotFound, name)
+	}
+	detail := &NodeDetail{Info: nodes[i], Tasks: []*task.Task{}, Events: []node.Event{}}
+
+	m.mu.RLock()
+	ids := slices.Clone(m.WorkerTaskMap[name])
+	m.mu.RUnlock()
+	for _, id := range ids {
+		res, err := m.TaskDb.Get(id.String())
+		if err != nil {
+			logger.Error("Unable to get task from node", "task_id", id, "worker", name, "error", err)
+			continue
+		}
+		if t, ok := res.(*task.Task); ok {
+			detail.Tasks = append(detail.Tasks, t)
+		}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, e := range slices.Backward(m.NodeEvents) {
+		if len(detail.Events) == maxNodeDetailEvents {
+			break
+		}
+		if e.Node == name {
+			detail.Events = append(detail.Events, e)
+		}
+	}
+	return detail, nil
+}
+
+// UncordonNode lifts the drain of the named worker, enabling scheduling on it again
+func (m *Manager) UncordonNode(name string) (*node.Info, error) {
+	return m.DrainNode(name, node.DrainRequest{})
+}
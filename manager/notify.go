@@ -0,0 +1,47 @@
+package manager
+
+import (
+	"cube/eventbus"
+	"cube/notify"
+	"cube/task"
+)
+
+// EnableNotifications sends notifications through n when tasks fail, complete,
+// or fail for good with their restart budget used up
+func (m *Manager) EnableNotifications(n *notify.Notifier) {
+	m.Bus.Subscribe("notifier", func(e eventbus.Event) {
+		t := e.Task
+		switch e.State {
+		case task.Failed:
+			n.Notify(m.notification(notify.TaskFailed, t, e.Previous))
+			if t.RestartPolicy.Mode() != task.RestartNever && t.RestartCount >= t.RestartPolicy.Retries() {
+				n.Notify(m.notification(notify.RestartBudgetExhausted, t, e.Previous))
+			}
+		case task.Completed:
+			n.Notify(m.notification(notify.TaskCompleted, t, e.Previous))
+		}
+	}, eventbus.TaskTransitioned)
+}
+
+func (m *Manager) notification(e notify.Event, t task.Task, from task.State) notify.Notification {
+	m.mu.RLock()
+	worker := m.TaskWorkerMap[t.ID]
+	m.mu.RUnlock()
+
+	var msg string
+	if t.Health == task.Unhealthy {
+		msg = "failed health probes"
+	}
+	return notify.Notification{
+		Event:        e,
+		TaskID:       t.ID,
+		TaskName:     t.Name,
+		Image:        t.Image,
+		State:        t.State.String(),
+		Previous:     from.String(),
+		Worker:       worker,
+		ExitCode:     t.ExitCode,
+		RestartCount: t.RestartCount,
+		Message:      msg,
+	}
+}
@@ -0,0 +1,161 @@
+package manager
+
+import (
+	"container/heap"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/task"
+)
+
+/**
+* Pending queue
+* Task events wait in the pending queue until they are dispatched, ordered by task
+* priority and by submission within a priority. On a persistent store every queued
+* event is also saved in pending.db until its dispatch completes, and the manager
+* replays the saved events on startup, so a crash loses no submitted work.
+ */
+type PendingQueue struct {
+	items pendingItems
+	seq   uint64
+}
+
+type pendingItem struct {
+	te  task.TaskEvent
+	seq uint64
+	// Key of the persisted copy of the event
+	key string
+}
+
+// A task event saved in pending.db
+type pendingRecord struct {
+	Event    task.TaskEvent
+	Enqueued time.Time
+}
+
+func (q *PendingQueue) Enqueue(te task.TaskEvent) {
+	q.push(te, "")
+}
+
+// Dequeue removes the highest priority event, reporting false when the queue is empty
+func (q *PendingQueue) Dequeue() (task.TaskEvent, bool) {
+	item, ok := q.pop()
+	return item.te, ok
+}
+
+func (q *PendingQueue) push(te task.TaskEvent, key string) {
+	q.seq++
+	heap.Push(&q.items, pendingItem{te: te, seq: q.seq, key: key})
+}
+
+func (q *PendingQueue) pop() (pendingItem, bool) {
+	if len(q.items) == 0 {
+		return pendingItem{}, false
+	}
+	return heap.Pop(&q.items).(pendingItem), true
+}
+
+// popFirst removes the first event, in queue order, for which ok returns true,
+// leaving the events it passed over queued in their order
+func (q *PendingQueue) popFirst(ok func(pendingItem) bool) (pendingItem, bool) {
+	var skipped []pendingItem
+	defer func() {
+		for _, item := range skipped {
+			heap.Push(&q.items, item)
+		}
+	}()
+	for len(q.items) > 0 {
+		item := heap.Pop(&q.items).(pendingItem)
+		if ok(item) {
+			return item, true
+		}
+		skipped = append(skipped, item)
+	}
+	return pendingItem{}, false
+}
+
+// queued reports whether an event for the task is waiting in the queue
+func (q *PendingQueue) queued(id uuid.UUID) bool {
+	return slices.ContainsFunc(q.items, func(item pendingItem) bool { return item.te.Task.ID == id })
+}
+
+func (q *PendingQueue) Len() int {
+	return len(q.items)
+}
+
+type pendingItems []pendingItem
+
+func (p pendingItems) Len() int { return len(p) }
+
+func (p pendingItems) Less(i, j int) bool {
+	if p[i].te.Task.Priority != p[j].te.Task.Priority {
+		return p[i].te.Task.Priority > p[j].te.Task.Priority
+	}
+	return p[i].seq < p[j].seq
+}
+
+func (p pendingItems) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+
+func (p *pendingItems) Push(x any) { *p = append(*p, x.(pendingItem)) }
+
+func (p *pendingItems) Pop() any {
+	old := *p
+	item := old[len(old)-1]
+	*p = old[:len(old)-1]
+	return item
+}
+
+// persistEvent saves a queued event until ack is called with the returned key
+func (m *Manager) persistEvent(te task.TaskEvent) string {
+	if m.pendingDb == nil {
+		return ""
+	}
+	key := uuid.NewString()
+	if err := m.pendingDb.Put(key, &pendingRecord{Event: te, Enqueued: time.Now().UTC()}); err != nil {
+		logger.Error("Error persisting pending task event", "event_id", te.ID, "task_id", te.Task.ID, "error", err)
+		return ""
+	}
+	return key
+}
+
+// ack deletes the persisted copy of an event once it has been dispatched
+func (m *Manager) ack(key string) {
+	if m.pendingDb == nil || key == "" {
+		return
+	}
+	if err := m.pendingDb.Delete(key); err != nil {
+		logger.Error("Error deleting dispatched task event", "key", key, "error", err)
+	}
+}
+
+// replayPending queues the events persisted by a previous run, in their original order
+func (m *Manager) replayPending() {
+	if m.pendingDb == nil {
+		return
+	}
+	var items []pendingItem
+	var enqueued []time.Time
+	err := m.pendingDb.ForEach(func(key string, r *pendingRecord) error {
+		items = append(items, pendingItem{te: r.Event, key: key})
+		enqueued = append(enqueued, r.Enqueued)
+		return nil
+	})
+	if err != nil {
+		logger.Error("Error loading pending task events", "error", err)
+		return
+	}
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return enqueued[a].Compare(enqueued[b]) })
+
+	m.mu.Lock()
+	for _, i := range order {
+		m.Pending.push(items[i].te, items[i].key)
+	}
+	m.mu.Unlock()
+	logger.Info("Replayed pending task events", "events", len(items))
+}
@@ -0,0 +1,315 @@
+package manager
+
+import (
+	"database/sql"
+	"maps"
+	"path/filepath"
+	"slices"
+
+	"github.com/google/uuid"
+
+	"cube/scheduler"
+	"cube/store"
+	"cube/task"
+)
+
+/**
+* Persisted manager state
+* On a persistent store services, cron jobs, deployments, task groups, quotas and the
+* scheduler's position, e.g. of round robin, are saved next to the tasks, tasks
+* are saved as Pending when they are submitted and queued task events are saved
+* until they are dispatched. A manager restarting, or taking over as leader, loads
+* them back, replays the queued events and requeues the remaining pending tasks
+* through recoverState, so nothing lives only in the memory of a single manager.
+* With a SQL store all of the state is kept in the database, so managers sharing
+* a Postgres database need no shared data directory.
+ */
+// openSQLStores keeps tasks and events in the database at dsn, returned for the other state
+func openSQLStores(dbType string, dsn string) (*sql.DB, store.Store, store.Store, error) {
+	db, err := store.OpenSQL(dbType, dsn)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ts, err := store.NewSQLStore[task.Task](db, dbType, "tasks")
+	if err != nil {
+		db.Close()
+		return nil, nil, nil, err
+	}
+	es, err := store.NewSQLStore[task.TaskEvent](db, dbType, "events")
+	if err != nil {
+		db.Close()
+		return nil, nil, nil, err
+	}
+	return db, ts, es, nil
+}
+
+// openObjectStore keeps the values of bucket in db when the manager has a SQL store, in file of dataDir otherwise
+func openObjectStore[T any](dataDir string, db *sql.DB, dbType string, file string, bucket string) (*store.ObjectStore[T], error) {
+	if db != nil {
+		return store.NewSQLObjectStore[T](db, dbType, bucket)
+	}
+	return store.NewObjectStore[T](filepath.Join(dataDir, file), 0600, bucket)
+}
+
+func (m *Manager) openStateStores(dataDir string, db *sql.DB) {
+	var err error
+	m.ServiceDb, err = openObjectStore[task.Service](dataDir, db, m.DbType, "services.db", "services")
+	if err != nil {
+		logger.Error("Unable to create service store", "error", err)
+	}
+	m.CronJobDb, err = openObjectStore[task.CronJob](dataDir, db, m.DbType, "cronjobs.db", "cronjobs")
+	if err != nil {
+		logger.Error("Unable to create cron job store", "error", err)
+	}
+	m.DeploymentDb, err = openObjectStore[task.Deployment](dataDir, db, m.DbType, "deployments.db", "deployments")
+	if err != nil {
+		logger.Error("Unable to create deployment store", "error", err)
+	}
+	m.TaskGroupDb, err = openObjectStore[task.TaskGroup](dataDir, db, m.DbType, "groups.db", "groups")
+	if err != nil {
+		logger.Error("Unable to create task group store", "error", err)
+	}
+	m.QuotaDb, err = openObjectStore[task.Quota](dataDir, db, m.DbType, "quotas.db", "quotas")
+	if err != nil {
+		logger.Error("Unable to create quota store", "error", err)
+	}
+	m.pendingDb, err = openObjectStore[pendingRecord](dataDir, db, m.DbType, "pending.db", "pending")
+	if err != nil {
+		logger.Error("Unable to create pending queue store", "error", err)
+	}
+	m.schedulerDb, err = openObjectStore[schedulerRecord](dataDir, db, m.DbType, "scheduler.db", "scheduler")
+	if err != nil {
+		logger.Error("Unable to create scheduler state store", "error", err)
+	}
+	m.resultDb, err = openObjectStore[task.Result](dataDir, db, m.DbType, "results.db", "results")
+	if err != nil {
+		logger.Error("Unable to create job result store", "error", err)
+	}
+}
+
+// loadState restores the persisted services, cron jobs, deployments, task groups, quotas
+// and scheduler state
+func (m *Manager) loadState() {
+	if m.ServiceDb != nil {
+		services, err := m.ServiceDb.List()
+		if err != nil {
+			logger.Error("Error loading services", "error", err)
+		}
+		m.mu.Lock()
+		for _, s := range services {
+			m.Services[s.ID] = s
+		}
+		m.mu.Unlock()
+		logger.Info("Loaded services", "services", len(services))
+	}
+	if m.CronJobDb != nil {
+		jobs, err := m.CronJobDb.List()
+		if err != nil {
+			logger.Error("Error loading cron jobs", "error", err)
+		}
+		m.mu.Lock()
+		for _, c := range jobs {
+			m.CronJobs[c.ID] = c
+		}
+		m.mu.Unlock()
+		logger.Info("Loaded cron jobs", "cronjobs", len(jobs))
+	}
+	if m.DeploymentDb != nil {
+		deployments, err := m.DeploymentDb.List()
+		if err != nil {
+			logger.Error("Error loading deployments", "error", err)
+		}
+		m.mu.Lock()
+		for _, d := range deployments {
+			m.Deployments[d.ID] = d
+		}
+		m.mu.Unlock()
+		logger.Info("Loaded deployments", "deployments", len(deployments))
+	}
+	if m.TaskGroupDb != nil {
+		groups, err := m.TaskGroupDb.List()
+		if err != nil {
+			logger.Error("Error loading task groups", "error", err)
+		}
+		m.mu.Lock()
+		for _, g := range groups {
+			m.TaskGroups[g.ID] = g
+		}
+		m.mu.Unlock()
+		logger.Info("Loaded task groups", "groups", len(groups))
+	}
+	if m.QuotaDb != nil {
+		quotas, err := m.QuotaDb.List()
+		if err != nil {
+			logger.Error("Error loading quotas", "error", err)
+		}
+		m.quotaMu.Lock()
+		for _, q := range quotas {
+			m.Quotas[q.Namespace] = q
+		}
+		m.quotaMu.Unlock()
+		logger.Info("Loaded quotas", "quotas", len(quotas))
+	}
+	if m.schedulerDb != nil {
+		records, err := m.schedulerDb.List()
+		if err != nil {
+			logger.Error("Error loading scheduler state", "error", err)
+		}
+		for _, r := range records {
+			m.schedulerState = r.Plugins
+		}
+		m.SetScheduler(m.Scheduler, m.SchedulerType)
+	}
+}
+
+// saveService persists s, callers must not hold mu
+func (m *Manager) saveService(s *task.Service) {
+	if m.ServiceDb == nil {
+		return
+	}
+	m.mu.RLock()
+	snapshot := *s
+	snapshot.TaskIDs = slices.Clone(s.TaskIDs)
+	m.mu.RUnlock()
+	if err := m.ServiceDb.Put(s.ID.String(), &snapshot); err != nil {
+		logger.Error("Error saving service", "service_id", s.ID, "error", err)
+	}
+}
+
+func (m *Manager) deleteService(id uuid.UUID) {
+	if m.ServiceDb == nil {
+		return
+	}
+	if err := m.ServiceDb.Delete(id.String()); err != nil {
+		logger.Error("Error deleting service", "service_id", id, "error", err)
+	}
+}
+
+// saveCronJob persists c, callers must not hold mu
+func (m *Manager) saveCronJob(c *task.CronJob) {
+	if m.CronJobDb == nil {
+		return
+	}
+	m.mu.RLock()
+	snapshot := snapshotCronJob(c)
+	m.mu.RUnlock()
+	if err := m.CronJobDb.Put(c.ID.String(), &snapshot); err != nil {
+		logger.Error("Error saving cron job", "cronjob_id", c.ID, "error", err)
+	}
+}
+
+// saveDeployment persists d, callers must not hold mu
+func (m *Manager) saveDeployment(d *task.Deployment) {
+	if m.DeploymentDb == nil {
+		return
+	}
+	if err := m.DeploymentDb.Put(d.ID.String(), m.snapshotDeployment(d)); err != nil {
+		logger.Error("Error saving deployment", "deployment_id", d.ID, "error", err)
+	}
+}
+
+func (m *Manager) deleteDeployment(id uuid.UUID) {
+	if m.DeploymentDb == nil {
+		return
+	}
+	if err := m.DeploymentDb.Delete(id.String()); err != nil {
+		logger.Error("Error deleting deployment", "deployment_id", id, "error", err)
+	}
+}
+
+// saveTaskGroup persists g, which only changes when the group is placed on a worker
+func (m *Manager) saveTaskGroup(g *task.TaskGroup) {
+	if m.TaskGroupDb == nil {
+		return
+	}
+	if err := m.TaskGroupDb.Put(g.ID.String(), g); err != nil {
+		logger.Error("Error saving task group", "group_id", g.ID, "error", err)
+	}
+}
+
+func (m *Manager) deleteTaskGroup(id uuid.UUID) {
+	if m.TaskGroupDb == nil {
+		return
+	}
+	if err := m.TaskGroupDb.Delete(id.String()); err != nil {
+		logger.Error("Error deleting task group", "group_id", id, "error", err)
+	}
+}
+
+// persistPending saves a submitted task as Pending unless it is already stored, so
+// it is requeued by recoverState if the manager goes away before dispatching it
+func (m *Manager) persistPending(t task.Task) {
+	if _, err := m.TaskDb.Get(t.ID.String()); err == nil {
+		return
+	}
+	t.State = task.Pending
+	if err := m.TaskDb.Put(t.ID.String(), &t); err != nil {
+		logger.Error("Error storing pending task", "task_id", t.ID, "error", err)
+	}
+}
+
+// Close closes the manager's datastores
+func (m *Manager) Close() {
+	// Queued events are written to the event history before it is closed
+	m.Bus.Close()
+	m.TaskDb.Close()
+	m.EventDb.Close()
+	if m.ServiceDb != nil {
+		m.ServiceDb.Close()
+	}
+	if m.CronJobDb != nil {
+		m.CronJobDb.Close()
+	}
+	if m.DeploymentDb != nil {
+		m.DeploymentDb.Close()
+	}
+	if m.TaskGroupDb != nil {
+		m.TaskGroupDb.Close()
+	}
+	if m.QuotaDb != nil {
+		m.QuotaDb.Close()
+	}
+	if m.pendingDb != nil {
+		m.pendingDb.Close()
+	}
+	if m.schedulerDb != nil {
+		m.schedulerDb.Close()
+	}
+	if m.resultDb != nil {
+		m.resultDb.Close()
+	}
+}
+
+// schedulerRecord is the state of the scheduler's Stateful score plugins, saved in scheduler.db
+type schedulerRecord struct {
+	Plugins map[string]string
+}
+
+// SetScheduler replaces the scheduler, restoring the state last saved for its plugins
+func (m *Manager) SetScheduler(s scheduler.Scheduler, name string) {
+	if p, ok := s.(*scheduler.Profile); ok {
+		m.mu.RLock()
+		p.Restore(m.schedulerState)
+		m.mu.RUnlock()
+	}
+	m.Scheduler, m.SchedulerType = s, name
+}
+
+// saveSchedulerState persists the state of the scheduler's plugins when a placement changed it
+func (m *Manager) saveSchedulerState() {
+	p, ok := m.Scheduler.(*scheduler.Profile)
+	if !ok || m.schedulerDb == nil {
+		return
+	}
+	state := p.State()
+	m.mu.Lock()
+	if len(state) == 0 || maps.Equal(state, m.schedulerState) {
+		m.mu.Unlock()
+		return
+	}
+	m.schedulerState = state
+	m.mu.Unlock()
+	if err := m.schedulerDb.Put("state", &schedulerRecord{Plugins: state}); err != nil {
+		logger.Error("Error saving scheduler state", "error", err)
+	}
+}
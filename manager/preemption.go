@@ -0,0 +1,145 @@
+package manager
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+
+	"cube/features"
+	"cube/node"
+	"cube/task"
+)
+
+/**
+* Preemption
+* With the Preemption feature gate enabled, a task no node has room for evicts lower
+* priority tasks from the node where the fewest, least important of them make room.
+* Evicted tasks are rescheduled like the tasks of a drained node. Those that fit on no
+* node are parked instead of dropped, and retried on every ProcessInterval tick.
+ */
+
+// preempt evicts lower priority tasks to make room for t, returning the node it
+// freed up or nil when no eviction makes t fit
+func (m *Manager) preempt(t task.Task) *node.Node {
+	if !features.Enabled(features.Preemption) {
+		return nil
+	}
+	nodes := m.applyAffinity(t, m.withoutRefusals(t, m.schedulableNodes()))
+	tasks := m.GetTasks()
+
+	var target *node.Node
+	var victims []*task.Task
+	m.mu.RLock()
+	for _, n := range nodes {
+		v := m.victimsOn(n, t, tasks)
+		if len(v) == 0 {
+			continue
+		}
+		if target == nil || cheaper(v, victims) {
+			target, victims = n, v
+		}
+	}
+	m.mu.RUnlock()
+	if target == nil {
+		return nil
+	}
+
+	for _, v := range victims {
+		m.evict(v, target, t)
+	}
+	return target
+}
+
+// victimsOn returns the lower priority tasks of n whose eviction makes room for t,
+// least important and most recently started first, or nil when none suffices.
+// Callers hold mu.
+func (m *Manager) victimsOn(n *node.Node, t task.Task, tasks []*task.Task) []*task.Task {
+	var candidates []*task.Task
+	for _, other := range tasks {
+		if other.Priority < t.Priority && other.State.Active() && m.TaskWorkerMap[other.ID] == n.Name {
+			candidates = append(candidates, other)
+		}
+	}
+	slices.SortFunc(candidates, func(a, b *task.Task) int {
+		return cmp.Or(cmp.Compare(a.Priority, b.Priority), b.StartTime.Compare(a.StartTime))
+	})
+
+	// Release reservations on a copy of the node until the scheduler accepts t there
+	sim := *n
+	for i, c := range candidates {
+		r := m.reservations[c.ID]
+		sim.CpuAllocated = max(0, sim.CpuAllocated-r.cpu)
+		sim.MemoryAllocated = max(0, sim.MemoryAllocated-r.memory)
+		sim.DiskAllocated = max(0, sim.DiskAllocated-r.disk)
+		sim.GpusAllocated = max(0, sim.GpusAllocated-r.gpus)
+		if len(m.Scheduler.SelectCandidateNodes(t, []*node.Node{&sim})) > 0 {
+			return candidates[:i+1]
+		}
+	}
+	return nil
+}
+
+// cheaper reports whether evicting a is preferable to evicting b
+func cheaper(a, b []*task.Task) bool {
+	top := func(v []*task.Task) int { return v[len(v)-1].Priority }
+	if top(a) != top(b) {
+		return top(a) < top(b)
+	}
+	return len(a) < len(b)
+}
+
+// evict stops a task preempted by another and reschedules it
+func (m *Manager) evict(v *task.Task, n *node.Node, by task.Task) {
+	logger.Info("Preempting task", "task_id", v.ID, "priority", v.Priority, "worker", n.Name, "preemptor", by.ID, "preemptor_priority", by.Priority)
+	m.stopTask(n.Name, v.ID.String())
+	m.unassignTask(v.ID, n.Name)
+	m.release(v.ID, n.Name)
+	m.countTask(n, -1)
+	m.mu.Lock()
+	m.preempted[v.ID] = true
+	m.mu.Unlock()
+	m.metrics.preemptions.Inc(n.Name)
+	m.requeueTask(v, n.Name, fmt.Sprintf("preempted by task %v with priority %d", by.ID, by.Priority))
+}
+
+// park keeps the event of a preempted task that fits on no node for a later retry,
+// reporting false for other tasks
+func (m *Manager) park(te task.TaskEvent) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.preempted[te.Task.ID] {
+		return false
+	}
+	m.parked[te.Task.ID] = te
+	return true
+}
+
+// unpark requeues the parked events of preempted tasks
+func (m *Manager) unpark() {
+	m.mu.Lock()
+	parked := m.parked
+	m.parked = make(map[uuid.UUID]task.TaskEvent)
+	m.mu.Unlock()
+
+	for _, te := range parked {
+		te.ID = uuid.New()
+		m.enqueue(te)
+	}
+}
+
+// isPreempted reports whether a task was evicted and not placed again yet
+func (m *Manager) isPreempted(id uuid.UUID) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.preempted[id]
+}
+
+// forgetPreempted drops the preemption record of a task placed again or stopped
+func (m *Manager) forgetPreempted(id uuid.UUID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.preempted, id)
+	delete(m.parked, id)
+}
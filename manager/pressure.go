@@ -0,0 +1,18 @@
+package manager
+
+/**
+* Workload pressure
+* Workers report their task queue and the health of their container runtime with
+* their stats. Nodes whose runtime cannot be reached are not scheduled, they could
+* not start the task, and nodes with tasks waiting in their queue are penalised in
+* proportion to its length.
+ */
+const queuePenalty = 0.05
+
+func (m *Manager) applyQueuePenalty(scores map[string]float64) {
+	for name := range scores {
+		if n := m.workerNode(name); n != nil {
+			scores[name] += queuePenalty * float64(n.Stats.QueueLength)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"cube/features"
+	"cube/task"
+)
+
+var ErrPushUpdatesDisabled = errors.New("the PushUpdates feature gate is disabled")
+
+/**
+* Pushed task updates
+* With the PushUpdates feature gate enabled, workers POST a task event to
+* /task-updates whenever a task changes state, and UpdateTasks only polls every
+* pushReconcileInterval to catch updates that failed to arrive.
+ */
+const pushReconcileInterval = 2 * time.Minute
+
+// ApplyTaskUpdate records the task state pushed by the worker named in te
+func (m *Manager) ApplyTaskUpdate(te task.TaskEvent) error {
+	// Start failures are pushed by every worker
+	if !features.Enabled(features.PushUpdates) && !te.Task.StartFailed() {
+		return ErrPushUpdatesDisabled
+	}
+	if !slices.Contains(m.workers(), te.Worker) {
+		return fmt.Errorf("unknown worker %q", te.Worker)
+	}
+	if m.isDown(te.Worker) {
+		// The next successful heartbeat brings the node back, polling picks the update up then
+		logger.Info("Ignoring update for task from down worker", "task_id", te.Task.ID, "worker", te.Worker)
+		return nil
+	}
+
+	logger.Info("Worker pushed task update", "task_id", te.Task.ID, "worker", te.Worker, "state", te.Task.State.String())
+	m.applyTaskUpdate(te.Worker, &te.Task)
+	return nil
+}
+
+// pollInterval is how often UpdateTasks polls workers for their tasks
+func (m *Manager) pollInterval() time.Duration {
+	if features.Enabled(features.PushUpdates) {
+		return max(m.UpdateInterval, pushReconcileInterval)
+	}
+	return m.UpdateInterval
+}
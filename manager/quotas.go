@@ -0,0 +1,133 @@
+package manager
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"cube/features"
+	"cube/task"
+)
+
+/**
+* Namespace quotas
+* Tasks are admitted against the quota of their namespace when they are submitted,
+* through the API or by a service, deployment, cron job or task group. Tasks which
+* would take the live tasks of the namespace over a limit are rejected, those
+* already admitted keep running when a quota is lowered. Quotas are managed and
+* enforced only while the Namespaces feature gate is enabled.
+ */
+var (
+	ErrNamespacesDisabled = errors.New("the Namespaces feature gate is disabled")
+	ErrQuotaExceeded      = errors.New("namespace quota exceeded")
+	ErrQuotaNotFound      = errors.New("no quota for namespace")
+)
+
+// QuotaStatus is a quota with what the live tasks of its namespace use of it
+type QuotaStatus struct {
+	task.Quota
+	Used task.QuotaUsage
+}
+
+// admitQuota returns ErrQuotaExceeded when t does not fit in its namespace's quota,
+// callers hold quotaMu
+func (m *Manager) admitQuota(t task.Task) error {
+	if !features.Enabled(features.Namespaces) {
+		return nil
+	}
+	ns := task.NamespaceOf(t)
+	q, ok := m.Quotas[ns]
+	if !ok {
+		return nil
+	}
+	if over := q.Exceeded(m.quotaUsage(ns), t); len(over) > 0 {
+		logger.Warn("Task exceeds its namespace quota", "task_id", t.ID, "namespace", ns, "exceeded", over)
+		return fmt.Errorf("%w for %s: %s", ErrQuotaExceeded, ns, strings.Join(over, ", "))
+	}
+	return nil
+}
+
+// quotaUsage adds up the requests of the live tasks of a namespace
+func (m *Manager) quotaUsage(ns string) task.QuotaUsage {
+	var used task.QuotaUsage
+	for _, t := range m.GetTasks() {
+		if task.NamespaceOf(*t) == ns && isLive(*t) {
+			used.Add(*t)
+		}
+	}
+	return used
+}
+
+// SetQuota creates or replaces the quota of q.Namespace
+func (m *Manager) SetQuota(q task.Quota) (*QuotaStatus, error) {
+	if !features.Enabled(features.Namespaces) {
+		return nil, ErrNamespacesDisabled
+	}
+	q.UpdatedAt = time.Now().UTC()
+	if m.QuotaDb != nil {
+		if err := m.QuotaDb.Put(q.Namespace, &q); err != nil {
+			return nil, fmt.Errorf("unable to save quota: %v", err)
+		}
+	}
+	m.quotaMu.Lock()
+	m.Quotas[q.Namespace] = &q
+	m.quotaMu.Unlock()
+	logger.Info("Set namespace quota", "namespace", q.Namespace, "cpu", q.Cpu, "memory", q.Memory, "disk", q.Disk, "tasks", q.Tasks)
+	return &QuotaStatus{Quota: q, Used: m.quotaUsage(q.Namespace)}, nil
+}
+
+func (m *Manager) GetQuotas() ([]QuotaStatus, error) {
+	if !features.Enabled(features.Namespaces) {
+		return nil, ErrNamespacesDisabled
+	}
+	m.quotaMu.Lock()
+	quotas := make([]task.Quota, 0, len(m.Quotas))
+	for _, q := range m.Quotas {
+		quotas = append(quotas, *q)
+	}
+	m.quotaMu.Unlock()
+	slices.SortFunc(quotas, func(a, b task.Quota) int { return cmp.Compare(a.Namespace, b.Namespace) })
+
+	statuses := make([]QuotaStatus, 0, len(quotas))
+	for _, q := range quotas {
+		statuses = append(statuses, QuotaStatus{Quota: q, Used: m.quotaUsage(q.Namespace)})
+	}
+	return statuses, nil
+}
+
+func (m *Manager) GetQuota(ns string) (*QuotaStatus, error) {
+	if !features.Enabled(features.Namespaces) {
+		return nil, ErrNamespacesDisabled
+	}
+	m.quotaMu.Lock()
+	q, ok := m.Quotas[ns]
+	m.quotaMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrQuotaNotFound, ns)
+	}
+	return &QuotaStatus{Quota: *q, Used: m.quotaUsage(ns)}, nil
+}
+
+// DeleteQuota lifts the limits of a namespace
+func (m *Manager) DeleteQuota(ns string) error {
+	if !features.Enabled(features.Namespaces) {
+		return ErrNamespacesDisabled
+	}
+	m.quotaMu.Lock()
+	_, ok := m.Quotas[ns]
+	delete(m.Quotas, ns)
+	m.quotaMu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w %s", ErrQuotaNotFound, ns)
+	}
+	if m.QuotaDb != nil {
+		if err := m.QuotaDb.Delete(ns); err != nil {
+			logger.Error("Error deleting quota", "namespace", ns, "error", err)
+		}
+	}
+	logger.Info("Deleted namespace quota", "namespace", ns)
+	return nil
+}
@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/task"
+)
+
+// Timeout for each worker queried while recovering state
+const recoveryTimeout = 5 * time.Second
+
+/**
+* State recovery
+* The task assignments only live in memory. When the manager starts on a persistent
+* store it rebuilds them from the tasks workers report, and re-enqueues persisted
+* tasks that never made it onto a worker and have no replayed event in the pending
+* queue, such as tasks saved as Pending whose event was never persisted.
+ */
+func (m *Manager) recoverState() {
+	for _, n := range m.workerNodes() {
+		tasks, err := m.fetchWorkerTasks(n.Name)
+		if err != nil {
+			logger.Warn("Unable to recover tasks from worker", "worker", n.Name, "error", err)
+			continue
+		}
+		for _, t := range tasks {
+			if _, err := m.TaskDb.Get(t.ID.String()); err != nil {
+				logger.Info("Tracking task found on worker", "task_id", t.ID, "worker", n.Name)
+				m.TaskDb.Put(t.ID.String(), t)
+			}
+			m.assignTask(t.ID, n.Name)
+			if t.State == task.Running {
+				m.countTask(n, 1)
+			}
+			if t.State.Active() {
+				m.reserve(n, *t)
+			}
+		}
+	}
+
+	requeued := 0
+	for _, t := range m.GetTasks() {
+		if _, ok := m.workerFor(t.ID); ok {
+			continue
+		}
+		if t.State == task.Stopping {
+			// No worker runs it anymore
+			m.confirmStopped(t.ID, "")
+			continue
+		}
+		if t.State != task.Pending && t.State != task.Scheduled {
+			continue
+		}
+		m.mu.RLock()
+		queued := m.Pending.queued(t.ID)
+		m.mu.RUnlock()
+		if queued {
+			continue
+		}
+		m.enqueue(task.TaskEvent{
+			ID:        uuid.New(),
+			State:     task.Scheduled,
+			Timestamp: time.Now(),
+			Task:      *t,
+		})
+		requeued++
+	}
+
+	m.mu.RLock()
+	assigned := len(m.TaskWorkerMap)
+	m.mu.RUnlock()
+	logger.Info("Recovered task assignments", "assigned", assigned, "requeued", requeued)
+}
+
+func (m *Manager) fetchWorkerTasks(worker string) ([]*task.Task, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), recoveryTimeout)
+	defer cancel()
+	return m.WorkerClient.ListTasks(ctx, worker)
+}
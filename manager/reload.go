@@ -0,0 +1,136 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/google/uuid"
+
+	"cube/node"
+	"cube/rpc"
+	"cube/scheduler"
+	"cube/stats"
+)
+
+/**
+* Configuration reload
+* On SIGHUP or POST /config/reload the manager re-reads its configuration through
+* LoadConfig and applies the worker list and the scheduler without restarting, so
+* the pending queue and everything else kept in memory survive. Dispatching is
+* paused while the change is applied: dispatches in flight finish first, the next
+* ones wait for the reload. A worker still running tasks cannot be removed, drain it
+* first; a reload removing one is rejected as a whole.
+ */
+
+// ErrReloadUnsupported is returned when the manager was started without a configuration to reload
+var ErrReloadUnsupported = errors.New("configuration reload is not supported")
+
+// ErrWorkerInUse is returned for a reload removing workers that still run tasks
+var ErrWorkerInUse = errors.New("worker still runs tasks")
+
+// ReloadConfig holds the settings a reload applies
+type ReloadConfig struct {
+	Workers       []string
+	Scheduler     scheduler.Scheduler
+	SchedulerType string
+}
+
+// ReloadResult reports what a reload changed
+type ReloadResult struct {
+	AddedWorkers   []string `json:",omitempty"`
+	RemovedWorkers []string `json:",omitempty"`
+	Scheduler      string
+	// Set when the scheduler was replaced, its settings may have changed even if its name did not
+	SchedulerReloaded bool `json:",omitempty"`
+}
+
+// ReloadConfig loads the configuration again through LoadConfig and applies it
+func (m *Manager) ReloadConfig() (*ReloadResult, error) {
+	if m.LoadConfig == nil {
+		return nil, ErrReloadUnsupported
+	}
+	cfg, err := m.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return m.Reload(cfg)
+}
+
+// Reload replaces the worker list and the scheduler, a nil Scheduler keeps the current one
+func (m *Manager) Reload(cfg ReloadConfig) (*ReloadResult, error) {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	var added, removed []string
+	for _, w := range cfg.Workers {
+		if !slices.Contains(m.workers(), w) && !slices.Contains(added, w) {
+			added = append(added, w)
+		}
+	}
+	var inUse []string
+	m.mu.RLock()
+	for _, w := range m.Workers {
+		if slices.Contains(cfg.Workers, w) {
+			continue
+		}
+		removed = append(removed, w)
+		if len(m.WorkerTaskMap[w]) > 0 {
+			inUse = append(inUse, fmt.Sprintf("%s (%d tasks)", w, len(m.WorkerTaskMap[w])))
+		}
+	}
+	m.mu.RUnlock()
+	if len(inUse) > 0 {
+		return nil, fmt.Errorf("%w, drain it before removing it: %v", ErrWorkerInUse, inUse)
+	}
+
+	// Readers take copies of Workers and WorkerNodes under mu, see workers and workerNodes
+	statsClient, _ := m.WorkerClient.(rpc.StatsClient)
+	m.mu.Lock()
+	workers := slices.DeleteFunc(slices.Clone(m.Workers), func(w string) bool { return slices.Contains(removed, w) })
+	nodes := slices.DeleteFunc(slices.Clone(m.WorkerNodes), func(n *node.Node) bool { return slices.Contains(removed, n.Name) })
+	for _, w := range removed {
+		delete(m.WorkerTaskMap, w)
+		delete(m.nodeRestarts, w)
+	}
+	for _, w := range added {
+		workers = append(workers, w)
+		nodes = append(nodes, newWorkerNode(w, m.Client, statsClient))
+		m.WorkerTaskMap[w] = []uuid.UUID{}
+	}
+	m.Workers, m.WorkerNodes = workers, nodes
+	m.mu.Unlock()
+
+	res := &ReloadResult{AddedWorkers: added, RemovedWorkers: removed, Scheduler: m.SchedulerType}
+	if cfg.Scheduler != nil {
+		m.SetScheduler(cfg.Scheduler, cfg.SchedulerType)
+		res.Scheduler, res.SchedulerReloaded = cfg.SchedulerType, true
+	}
+	logger.Info("Reloaded configuration", "added_workers", added, "removed_workers", removed, "scheduler", res.Scheduler)
+	return res, nil
+}
+
+// newWorkerNode returns the node of a worker, fetching its stats through statsClient when set
+func newWorkerNode(worker string, client *http.Client, statsClient rpc.StatsClient) *node.Node {
+	n := node.NewNode(worker, fmt.Sprintf("http://%v", worker), "worker")
+	n.Client = client
+	if statsClient != nil {
+		n.FetchStats = func() (*stats.Stats, http.Header, error) { return statsClient.Stats(worker) }
+	}
+	return n
+}
+
+// workers returns a copy of Workers, which Reload replaces under mu
+func (m *Manager) workers() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.Clone(m.Workers)
+}
+
+// workerNodes returns a copy of WorkerNodes, which Reload replaces under mu
+func (m *Manager) workerNodes() []*node.Node {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.Clone(m.WorkerNodes)
+}
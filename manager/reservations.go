@@ -0,0 +1,86 @@
+package manager
+
+import (
+	"github.com/google/uuid"
+
+	"cube/node"
+	"cube/task"
+)
+
+/**
+* Resource reservations
+* Every task placed on a node reserves its CPU, memory, disk and GPU requests there, tracked
+* in the node's CpuAllocated, MemoryAllocated, DiskAllocated and GpusAllocated, and a slot
+* counted in TasksAllocated, until the task stops, fails or is moved. Schedulers filter candidates against the capacity left unreserved.
+ */
+type reservation struct {
+	node   string
+	cpu    float64
+	memory int64
+	disk   int64
+	gpus   int
+}
+
+// tryReserve reserves t's resources on n if the scheduler still considers n a
+// candidate, guarding against concurrent dispatches filling the node first
+func (m *Manager) tryReserve(n *node.Node, t task.Task) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.releaseLocked(t.ID, "")
+	if len(m.Scheduler.SelectCandidateNodes(t, []*node.Node{n})) == 0 {
+		return false
+	}
+	m.reserveLocked(n, t)
+	return true
+}
+
+// reserve records t's resources against n, replacing any earlier reservation for the task
+func (m *Manager) reserve(n *node.Node, t task.Task) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.releaseLocked(t.ID, "")
+	m.reserveLocked(n, t)
+}
+
+// countTask adjusts the number of tasks counted on n, under mu like its reservations
+func (m *Manager) countTask(n *node.Node, delta int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n.TaskCount = max(0, n.TaskCount+delta)
+}
+
+// release returns the resources reserved by a task to the named worker.
+// Reservations held on other workers are left in place.
+func (m *Manager) release(id uuid.UUID, worker string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.releaseLocked(id, worker)
+}
+
+func (m *Manager) reserveLocked(n *node.Node, t task.Task) {
+	n.CpuAllocated += t.Cpu
+	n.MemoryAllocated += t.Memory
+	n.DiskAllocated += t.Disk
+	n.GpusAllocated += t.GPUs()
+	n.TasksAllocated++
+	m.reservations[t.ID] = reservation{node: n.Name, cpu: t.Cpu, memory: t.Memory, disk: t.Disk, gpus: t.GPUs()}
+}
+
+// releaseLocked drops a task's reservation; an empty worker matches any node
+func (m *Manager) releaseLocked(id uuid.UUID, worker string) {
+	r, ok := m.reservations[id]
+	if !ok || (worker != "" && r.node != worker) {
+		return
+	}
+	delete(m.reservations, id)
+
+	n := m.workerNodeLocked(r.node)
+	if n == nil {
+		return
+	}
+	n.CpuAllocated = max(0, n.CpuAllocated-r.cpu)
+	n.MemoryAllocated = max(0, n.MemoryAllocated-r.memory)
+	n.DiskAllocated = max(0, n.DiskAllocated-r.disk)
+	n.GpusAllocated = max(0, n.GpusAllocated-r.gpus)
+	n.TasksAllocated = max(0, n.TasksAllocated-1)
+}
@@ -0,0 +1,148 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/task"
+)
+
+/**
+* Job results
+* Workers keep the output of a finished job until they collect the task. The
+* manager fetches it as soon as the job finishes, from the worker's HTTP API
+* whatever the transport, and keeps it in results.db, or in memory without
+* persistent stores, until the task is collected. A result missed while the
+* manager was down is fetched when it is first asked for.
+ */
+const resultFetchTimeout = 10 * time.Second
+
+var (
+	ErrNotAJob        = errors.New("task is not a job")
+	ErrJobNotFinished = errors.New("job has not finished")
+	ErrResultNotFound = errors.New("job result not found")
+)
+
+// fetchResultOnFinish fetches the result of a job once it Completed or Failed
+func (m *Manager) fetchResultOnFinish(t task.Task, from task.State, to task.State) {
+	if t.Kind != task.JobKind {
+		return
+	}
+	worker, ok := m.workerFor(t.ID)
+	if !ok {
+		return
+	}
+	go func() {
+		if _, err := m.fetchResult(worker, t.ID); err != nil {
+			logger.Error("Error fetching job result", "task_id", t.ID, "worker", worker, "error", err)
+		}
+	}()
+}
+
+// fetchResult gets the result of job id from worker and stores it
+func (m *Manager) fetchResult(worker string, id uuid.UUID) (*task.Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), resultFetchTimeout)
+	defer cancel()
+	u := fmt.Sprintf("http://%s/tasks/%s/result", worker, id)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("worker %s has no result for the job", worker)
+	default:
+		return nil, fmt.Errorf("worker %s returned %d", worker, resp.StatusCode)
+	}
+
+	var r task.Result
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("error decoding result from worker %s: %v", worker, err)
+	}
+	if err := m.saveResult(&r); err != nil {
+		return nil, err
+	}
+	logger.Info("Stored job result", "task_id", id, "worker", worker, "exit_code", r.ExitCode)
+	return &r, nil
+}
+
+// GetTaskResult returns the output and exit code of a finished job
+func (m *Manager) GetTaskResult(id uuid.UUID) (*task.Result, error) {
+	res, err := m.TaskDb.Get(id.String())
+	if err != nil {
+		return nil, err
+	}
+	t := res.(*task.Task)
+	if t.Kind != task.JobKind {
+		return nil, fmt.Errorf("%w: %v", ErrNotAJob, id)
+	}
+	if t.State != task.Completed && t.State != task.Failed {
+		return nil, fmt.Errorf("%w: job %v is %s", ErrJobNotFinished, id, t.State)
+	}
+	if r, ok := m.loadResult(id); ok {
+		return r, nil
+	}
+
+	worker, ok := m.workerFor(id)
+	if !ok {
+		return nil, fmt.Errorf("%w: job %v", ErrResultNotFound, id)
+	}
+	r, err := m.fetchResult(worker, id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: job %v: %v", ErrResultNotFound, id, err)
+	}
+	return r, nil
+}
+
+func (m *Manager) saveResult(r *task.Result) error {
+	if m.resultDb != nil {
+		if err := m.resultDb.Put(r.TaskID.String(), r); err != nil {
+			return fmt.Errorf("error storing result of job %v: %v", r.TaskID, err)
+		}
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.results[r.TaskID] = r
+	return nil
+}
+
+func (m *Manager) loadResult(id uuid.UUID) (*task.Result, bool) {
+	if m.resultDb != nil {
+		r, err := m.resultDb.Get(id.String())
+		return r, err == nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	r, ok := m.results[id]
+	return r, ok
+}
+
+// deleteResults drops the results of collected tasks
+func (m *Manager) deleteResults(ids map[uuid.UUID]bool) {
+	if m.resultDb == nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for id := range ids {
+			delete(m.results, id)
+		}
+		return
+	}
+	for id := range ids {
+		if err := m.resultDb.Delete(id.String()); err != nil {
+			logger.Error("Error deleting job result", "task_id", id, "error", err)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/features"
+	"cube/task"
+	"cube/utils"
+)
+
+var ErrServicesDisabled = errors.New("the Services feature gate is disabled")
+
+/**
+* Services
+* A service keeps Replicas instances of a task template running. Replicas are
+* labelled with the service ID and replaced by ReconcileServices when they die.
+* A replica joins the service's TaskIDs once it is stored, while it is submitted
+* it is counted in newReplicas instead.
+ */
+func (m *Manager) CreateService(s task.Service) (*task.Service, error) {
+	if !features.Enabled(features.Services) {
+		return nil, ErrServicesDisabled
+	}
+	if s.Replicas < 1 {
+		return nil, fmt.Errorf("replicas must be at least 1, got %d", s.Replicas)
+	}
+
+	s.ID = uuid.New()
+	s.CreatedAt = time.Now().UTC()
+	s.TaskIDs = nil
+
+	m.mu.Lock()
+	m.Services[s.ID] = &s
+	m.mu.Unlock()
+
+	for i := 0; i < s.Replicas; i++ {
+		m.addReplica(&s)
+	}
+	m.saveService(&s)
+	logger.Info("Created service", "service", s.Name, "service_id", s.ID, "replicas", s.Replicas)
+	return &s, nil
+}
+
+func (m *Manager) GetServices() []*task.Service {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	services := make([]*task.Service, 0, len(m.Services))
+	for _, s := range m.Services {
+		services = append(services, s)
+	}
+	return services
+}
+
+func (m *Manager) GetService(id uuid.UUID) (*task.Service, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.Services[id]
+	return s, ok
+}
+
+// DeleteService stops every replica of the service and forgets it
+func (m *Manager) DeleteService(id uuid.UUID) error {
+	m.mu.Lock()
+	s, ok := m.Services[id]
+	delete(m.Services, id)
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("service %s does not exist", id)
+	}
+	m.deleteService(id)
+
+	for _, tID := range s.TaskIDs {
+		res, err := m.TaskDb.Get(tID.String())
+		if err != nil {
+			continue
+		}
+		if !isLive(*res.(*task.Task)) {
+			continue
+		}
+		m.StopTask(tID)
+	}
+	logger.Info("Deleted service, stopping its replicas", "service_id", id, "replicas", len(s.TaskIDs))
+	return nil
+}
+
+// addReplica submits a new replica of s, adding it to the service once it is stored
+func (m *Manager) addReplica(s *task.Service) error {
+	t := s.NewReplica()
+	m.mu.Lock()
+	m.newReplicas[s.ID]++
+	m.mu.Unlock()
+
+	err := m.AddTask(task.TaskEvent{ID: uuid.New(), State: task.Scheduled, Timestamp: time.Now(), Task: t})
+
+	m.mu.Lock()
+	if m.newReplicas[s.ID]--; m.newReplicas[s.ID] <= 0 {
+		delete(m.newReplicas, s.ID)
+	}
+	deleted := m.Services[s.ID] != s
+	if err == nil && !deleted {
+		s.TaskIDs = append(s.TaskIDs, t.ID)
+	}
+	m.mu.Unlock()
+
+	if err != nil {
+		logger.Error("Error adding service replica", "service", s.Name, "service_id", s.ID, "task_id", t.ID, "error", err)
+		return err
+	}
+	if deleted {
+		// The service was deleted while the replica was submitted
+		m.StopTask(t.ID)
+	}
+	return nil
+}
+
+// ReconcileServices replaces dead replicas of every service
+func (m *Manager) ReconcileServices(ctx context.Context) {
+	m.Watchdog.Register("reconcileServices", m.UpdateInterval)
+	for {
+		m.Watchdog.Beat("reconcileServices")
+		if features.Enabled(features.Services) {
+			m.reconcileServices()
+		}
+		if !utils.SleepContext(ctx, m.UpdateInterval) {
+			return
+		}
+	}
+}
+
+func (m *Manager) reconcileServices() {
+	for _, s := range m.GetServices() {
+		m.mu.RLock()
+		ids := slices.Clone(s.TaskIDs)
+		// Replicas being submitted count as live
+		live := m.newReplicas[s.ID]
+		m.mu.RUnlock()
+
+		dead := make(map[uuid.UUID]bool)
+		for _, id := range ids {
+			// Replicas are stored before they join the service, missing ones were collected
+			res, err := m.TaskDb.Get(id.String())
+			if err == nil && isLive(*res.(*task.Task)) {
+				live++
+				continue
+			}
+			dead[id] = true
+		}
+
+		m.mu.Lock()
+		s.TaskIDs = slices.DeleteFunc(s.TaskIDs, func(id uuid.UUID) bool { return dead[id] })
+		m.mu.Unlock()
+		changed := len(dead) > 0
+
+		for i := live; i < s.Replicas; i++ {
+			logger.Info("Service is missing replicas, adding one", "service", s.Name, "live", live, "replicas", s.Replicas)
+			if err := m.addReplica(s); err != nil {
+				break
+			}
+			changed = true
+		}
+		if changed {
+			m.saveService(s)
+		}
+	}
+}
+
+// isLive reports whether a task is running or will be (re)started
+func isLive(t task.Task) bool {
+	switch t.State {
+	case task.Pending, task.Scheduled, task.Running, task.Restarting:
+		return true
+	case task.Failed:
+		return t.RestartAllowed(time.Now())
+	}
+	return false
+}
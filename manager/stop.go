@@ -0,0 +1,146 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/task"
+)
+
+// How long a Stopping task may keep running before the stop request is sent again
+const stopRetryInterval = time.Minute
+
+/**
+* Task deletion
+* StopTask moves a task to Stopping and queues a stop for its worker. The task only
+* becomes Stopped, and leaves the scheduling maps, once the worker reports that its
+* container is gone or no longer knows the task.
+ */
+func (m *Manager) StopTask(id uuid.UUID) (*task.Task, error) {
+	worker, assigned := m.workerFor(id)
+	var requested, unchanged bool
+	var stopped task.Task
+	err := m.TaskDb.Update(id.String(), func(value interface{}) (interface{}, error) {
+		t := value.(*task.Task)
+		switch {
+		case t.State == task.Stopping || t.State == task.Stopped:
+			unchanged = true
+		case assigned && t.State.Active():
+			t.State = task.Stopping
+			requested = true
+		default:
+			// Nothing runs: finished tasks, or tasks waiting to be rescheduled
+			t.State = task.Stopped
+			if t.FinishTime.IsZero() {
+				t.FinishTime = time.Now().UTC()
+			}
+		}
+		stopped = *t
+		return t, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if unchanged {
+		return &stopped, nil
+	}
+
+	defer m.stopTaskGroup(stopped, "member stopped")
+
+	if !requested {
+		logger.Info("Task is not running, marking it stopped", "task_id", id)
+		if assigned {
+			m.forgetStopped(id, worker)
+		}
+		m.recordEvent(stopped, worker, "stopped")
+		return &stopped, nil
+	}
+
+	m.mu.Lock()
+	m.stopRequests[id] = time.Now()
+	m.mu.Unlock()
+	m.recordEvent(stopped, worker, "stop requested")
+
+	t := stopped
+	t.State = task.Completed
+	m.enqueue(task.TaskEvent{ID: uuid.New(), State: task.Completed, Timestamp: time.Now(), Task: t})
+	logger.Info("Stopping task", "task_id", id, "worker", worker)
+	return &stopped, nil
+}
+
+// confirmStopped marks a Stopping task Stopped once its worker no longer runs it
+func (m *Manager) confirmStopped(id uuid.UUID, worker string) {
+	var confirmed bool
+	var stopped task.Task
+	err := m.TaskDb.Update(id.String(), func(value interface{}) (interface{}, error) {
+		t := value.(*task.Task)
+		if t.State == task.Stopping {
+			t.State = task.Stopped
+			t.FinishTime = time.Now().UTC()
+			confirmed = true
+		}
+		stopped = *t
+		return t, nil
+	})
+	if err != nil {
+		logger.Error("Error marking task stopped", "task_id", id, "error", err)
+		return
+	}
+	if confirmed {
+		m.forgetStopped(id, worker)
+		m.recordEvent(stopped, worker, "stopped")
+	}
+}
+
+// forgetStopped drops a stopped task from the scheduling maps
+func (m *Manager) forgetStopped(id uuid.UUID, worker string) {
+	m.unassignTask(id, worker)
+	m.release(id, worker)
+	m.mu.Lock()
+	delete(m.stopRequests, id)
+	m.mu.Unlock()
+	logger.Info("Task stopped", "task_id", id, "worker", worker, "state", task.Stopped.String())
+}
+
+// retryStop sends the stop request again when a Stopping task keeps running
+func (m *Manager) retryStop(worker string, id uuid.UUID) {
+	m.mu.Lock()
+	requested, ok := m.stopRequests[id]
+	retry := !ok || time.Since(requested) >= stopRetryInterval
+	if retry {
+		m.stopRequests[id] = time.Now()
+	}
+	m.mu.Unlock()
+	if !retry {
+		return
+	}
+
+	logger.Info("Task is still running, requesting the stop again", "task_id", id, "worker", worker)
+	if m.stopTask(worker, id.String()) {
+		m.confirmStopped(id, worker)
+	}
+}
+
+// confirmMissing stops the Stopping tasks of a worker that no longer lists them
+func (m *Manager) confirmMissing(worker string, listed []*task.Task) {
+	seen := make(map[uuid.UUID]bool, len(listed))
+	for _, t := range listed {
+		seen[t.ID] = true
+	}
+
+	m.mu.RLock()
+	var missing []uuid.UUID
+	for _, id := range m.WorkerTaskMap[worker] {
+		if !seen[id] {
+			if _, stopping := m.stopRequests[id]; stopping {
+				missing = append(missing, id)
+			}
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, id := range missing {
+		m.confirmStopped(id, worker)
+	}
+}
@@ -0,0 +1,122 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/task"
+)
+
+/**
+* Scheduling retries
+* A task no node can run is not dropped: it goes back on the pending queue after an
+* exponential backoff, and carries an Unschedulable condition saying why until it is
+* placed. Tasks still unschedulable after MaxUnschedulableAge fail with the
+* Unschedulable reason, zero retries them forever.
+ */
+const defaultMaxUnschedulableAge = time.Hour
+
+const (
+	minScheduleBackoff = 5 * time.Second
+	maxScheduleBackoff = 5 * time.Minute
+)
+
+// A task event waiting out its scheduling backoff
+type scheduleRetry struct {
+	te   task.TaskEvent
+	next time.Time
+}
+
+// scheduleBackoff doubles the delay with every failed attempt, up to maxScheduleBackoff
+func scheduleBackoff(attempts int) time.Duration {
+	delay := minScheduleBackoff
+	for i := 1; i < attempts && delay < maxScheduleBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxScheduleBackoff)
+}
+
+// retryUnschedulable records why te could not be placed and backs it off, or fails
+// the task once it has been unschedulable for longer than MaxUnschedulableAge
+func (m *Manager) retryUnschedulable(te task.TaskEvent, reason error) {
+	now := time.Now().UTC()
+	var t task.Task
+	var c task.Condition
+	var previous task.State
+	stopped, failed := false, false
+	mark := func(current *task.Task) {
+		if current.State == task.Stopped {
+			stopped = true
+			return
+		}
+		c = task.Condition{Type: task.Unschedulable, Since: now}
+		if prev := current.Condition(task.Unschedulable); prev != nil {
+			c = *prev
+		}
+		c.Attempts++
+		c.Message = reason.Error()
+		c.NextAttempt = now.Add(scheduleBackoff(c.Attempts))
+		previous = current.State
+		if m.MaxUnschedulableAge > 0 && now.Sub(c.Since) >= m.MaxUnschedulableAge {
+			failed = true
+			c.NextAttempt = time.Time{}
+			current.State = task.Failed
+			current.FailureReason = task.ReasonUnschedulable
+			current.FinishTime = now
+		}
+		current.SetCondition(c)
+		t = *current
+	}
+
+	err := m.TaskDb.Update(te.Task.ID.String(), func(value interface{}) (interface{}, error) {
+		mark(value.(*task.Task))
+		return value, nil
+	})
+	if err != nil {
+		// Not persisted yet, store the submitted copy
+		t = te.Task
+		t.State = task.Pending
+		mark(&t)
+		m.TaskDb.Put(t.ID.String(), &t)
+	}
+	if stopped {
+		logger.Info("Dropping task, it was stopped while waiting to be scheduled", "task_id", te.Task.ID)
+		return
+	}
+
+	if failed {
+		m.States.Fire(t, previous, task.Failed)
+		m.recordEvent(t, "", fmt.Sprintf("unschedulable for %v, giving up: %v", now.Sub(c.Since).Round(time.Second), reason))
+		logger.Warn("Task stayed unschedulable, failing it", "task_id", t.ID, "since", c.Since, "attempts", c.Attempts, "error", reason)
+		return
+	}
+	if c.Attempts == 1 {
+		m.recordEvent(t, "", fmt.Sprintf("unschedulable, retrying: %v", reason))
+	}
+	logger.Warn("No worker available for task, retrying", "task_id", t.ID, "attempts", c.Attempts, "next_attempt", c.NextAttempt, "error", reason)
+
+	m.mu.Lock()
+	m.backoff[te.Task.ID] = scheduleRetry{te: te, next: c.NextAttempt}
+	m.mu.Unlock()
+}
+
+// requeueUnschedulable requeues the task events whose scheduling backoff is over
+func (m *Manager) requeueUnschedulable() {
+	now := time.Now()
+	var due []task.TaskEvent
+	m.mu.Lock()
+	for id, r := range m.backoff {
+		if !now.Before(r.next) {
+			due = append(due, r.te)
+			delete(m.backoff, id)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, te := range due {
+		te.ID = uuid.New()
+		m.enqueue(te)
+	}
+}
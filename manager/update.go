@@ -0,0 +1,63 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/rpc"
+	"cube/task"
+	"cube/validation"
+)
+
+var ErrTaskNotRunning = errors.New("only running tasks can be updated")
+
+/**
+* Rolling updates
+* UpdateTask queues the next revision of a running task as a Running task event.
+* The worker starts it next to the current container and swaps them once it is
+* running and healthy; the manager picks up the new revision through UpdateTasks.
+ */
+func (m *Manager) UpdateTask(id uuid.UUID, u task.Update) (*task.Task, error) {
+	res, err := m.TaskDb.Get(id.String())
+	if err != nil {
+		return nil, err
+	}
+	current := res.(*task.Task)
+	if _, ok := m.workerFor(id); !ok || current.State != task.Running {
+		return nil, fmt.Errorf("%w: task %s is %v", ErrTaskNotRunning, id, current.State)
+	}
+
+	next := u.Apply(*current)
+	if errs := validation.ValidateTask(next, ""); errs != nil {
+		return nil, errs
+	}
+
+	m.enqueue(task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Running,
+		Timestamp: time.Now(),
+		Task:      next,
+	})
+	logger.Info("Queued task revision", "task_id", id, "revision", next.Revision)
+	return &next, nil
+}
+
+// rollout sends the next revision of a running task to the worker it runs on
+func (m *Manager) rollout(worker string, te task.TaskEvent) {
+	_, err := m.WorkerClient.SubmitTask(context.Background(), worker, te)
+	var rejected *rpc.RejectedError
+	if errors.As(err, &rejected) {
+		logger.Error("Worker rejected task revision", "task_id", te.Task.ID, "worker", worker, "status", rejected.Code, "message", rejected.Message)
+		return
+	}
+	if err != nil {
+		logger.Error("Error connecting to worker, requeueing", "task_id", te.Task.ID, "worker", worker, "error", err)
+		m.enqueue(te)
+		return
+	}
+	logger.Info("Rolling out task revision", "task_id", te.Task.ID, "worker", worker, "revision", te.Task.Revision)
+}
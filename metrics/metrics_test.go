@@ -0,0 +1,23 @@
+package metrics
+
+import "testing"
+
+func TestFormatLabels(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"worker-1:5556", `{node="worker-1:5556"}`},
+		{`C:\tasks`, `{node="C:\\tasks"}`},
+		{`say "hi"`, `{node="say \"hi\""}`},
+		{"two\nlines", `{node="two\nlines"}`},
+		// Other characters are written as they are, unlike Go quoting
+		{"tab\there", "{node=\"tab\there\"}"},
+		{"nœud-é", `{node="nœud-é"}`},
+	}
+	for _, tt := range tests {
+		if got := formatLabels([]string{"node"}, []string{tt.value}); got != tt.want {
+			t.Errorf("formatLabels(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package node
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Node Event definition
+type EventReason string
+
+const (
+	NodeFlapping   EventReason = "NodeFlapping"
+	NodeRecovered  EventReason = "NodeRecovered"
+	NodeDown       EventReason = "NodeDown"
+	NodeUp         EventReason = "NodeUp"
+	NodeCordoned   EventReason = "NodeCordoned"
+	NodeUncordoned EventReason = "NodeUncordoned"
+)
+
+type Event struct {
+	ID        uuid.UUID
+	Timestamp time.Time
+	Node      string
+	Reason    EventReason
+	Message   string
+}
+
+func NewEvent(node string, reason EventReason, message string) Event {
+	return Event{
+		ID:        uuid.New(),
+		Timestamp: time.Now().UTC(),
+		Node:      node,
+		Reason:    reason,
+		Message:   message,
+	}
+}
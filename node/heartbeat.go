@@ -0,0 +1,50 @@
+package node
+
+import (
+	"time"
+
+	"cube/stats"
+)
+
+/**
+* Heartbeats
+* Besides answering the manager's stats calls, a worker configured with a manager
+* pushes a heartbeat to its POST /heartbeat endpoint. It carries what the stats call
+* headers do, the version, API version, capabilities and labels of the worker, along
+* with its current load. The manager answers with its own version so both sides can
+* tell whether they are compatible, and with the interval it expects heartbeats at.
+ */
+type Heartbeat struct {
+	// Address the manager reaches the worker at, as listed in its workers
+	Worker       string
+	Version      string
+	ApiVersion   int
+	Capabilities []string
+	Labels       map[string]string `json:",omitempty"`
+	// Current load of the worker
+	Stats     stats.Stats
+	Timestamp time.Time
+}
+
+// Body of the manager's answer to a heartbeat
+type HeartbeatResponse struct {
+	Version    string
+	ApiVersion int
+	// Whether the worker's API version is within the manager's supported window
+	Compatible bool
+	// How often the manager expects the worker to send heartbeats
+	Interval time.Duration
+}
+
+// ApplyHeartbeat records what the worker advertised and its load, as a stats call does
+func (n *Node) ApplyHeartbeat(hb Heartbeat) error {
+	if _, err := n.setStats(hb.Stats); err != nil {
+		return err
+	}
+	n.Version = hb.Version
+	n.ApiVersion = hb.ApiVersion
+	n.Capabilities = hb.Capabilities
+	n.Labels = hb.Labels
+	n.LastPushedHeartbeat = time.Now().UTC()
+	return nil
+}
@@ -0,0 +1,88 @@
+package node
+
+import "time"
+
+// Info is the capacity and health of a node as served by the manager's GET /nodes
+type Info struct {
+	Name string
+	Role string
+	Api  string
+	// Capacity reported by the worker, memory in KiB and disk in bytes, and the
+	// requests of the tasks placed on it
+	Cores           int
+	CpuAllocated    float64
+	Memory          int64
+	MemoryAllocated int64
+	Disk            int64
+	DiskAllocated   int64
+	Gpus            int `json:",omitempty"`
+	GpusAllocated   int `json:",omitempty"`
+	TaskCount       int
+	MaxTasks        int `json:",omitempty"`
+	TasksAllocated  int
+	// Share of the node's CPU time spent non-idle between its last two stats samples
+	CpuUsage float64
+	// Usage the worker last sampled for the containers of its running tasks, in
+	// CPUs and bytes
+	TaskCpuUsage    float64
+	TaskMemoryUsage uint64
+	// Time of the last successful stats call, zero until the first one
+	LastStats time.Time
+	// Health: liveness, restart rate, version skew and cordon status
+	Status           Status
+	MissedHeartbeats int
+	Flapping         bool
+	VersionSkewed    bool
+	Cordoned         bool
+	Evicting         bool
+	Version          string
+	Labels           map[string]string `json:",omitempty"`
+	Capabilities     []string          `json:",omitempty"`
+	// Platform of the worker's host, e.g. linux/arm64
+	OS   string `json:",omitempty"`
+	Arch string `json:",omitempty"`
+	// Time of the last heartbeat the worker pushed, zero when it only answers stats calls
+	LastPushedHeartbeat time.Time `json:",omitempty"`
+	// Workload and container runtime health, as last reported by the worker
+	QueueLength       int
+	RunningContainers int
+	RuntimeError      string `json:",omitempty"`
+}
+
+func (n *Node) Info() Info {
+	return Info{
+		Name:             n.Name,
+		Role:             n.Role,
+		Api:              n.Api,
+		Cores:            n.Cores,
+		CpuAllocated:     n.CpuAllocated,
+		Memory:           n.Memory,
+		MemoryAllocated:  n.MemoryAllocated,
+		Disk:             n.Disk,
+		DiskAllocated:    n.DiskAllocated,
+		Gpus:             n.Gpus,
+		GpusAllocated:    n.GpusAllocated,
+		OS:               n.OS,
+		Arch:             n.Arch,
+		TaskCount:        n.TaskCount,
+		MaxTasks:         n.MaxTasks,
+		TasksAllocated:   n.TasksAllocated,
+		CpuUsage:         n.CpuUsage,
+		LastStats:        n.LastHeartbeat,
+		Status:           n.Status,
+		MissedHeartbeats: n.MissedHeartbeats,
+		Flapping:         n.Flapping,
+		VersionSkewed:    n.VersionSkewed,
+		Cordoned:         n.Cordoned,
+		Evicting:         n.Evicting,
+		Version:          n.Version,
+		Labels:           n.Labels,
+		Capabilities:     n.Capabilities,
+
+		LastPushedHeartbeat: n.LastPushedHeartbeat,
+		// Reported with the stats
+		QueueLength:       n.Stats.QueueLength,
+		RunningContainers: n.Stats.RunningContainers,
+		RuntimeError:      n.Stats.RuntimeError,
+	}
+}
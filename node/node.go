@@ -6,69 +6,231 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
-	"cube/logging"
+	"cube/config"
 	"cube/stats"
 	"cube/utils"
 )
 
+// Liveness of a worker node as observed by the manager
+type Status string
+
+const (
+	Up   Status = "Up"
+	Down Status = "Down"
+)
+
 type Node struct {
 	Name            string
 	Ip              string
 	Api             string
 	Cores           int
-	Memory          int64
+	CpuAllocated    float64
+	Memory          int64 // Memory and disk sizes are in bytes, as tasks request them
 	MemoryAllocated int64
 	Disk            int64
 	DiskAllocated   int64
+	Gpus            int
+	GpusAllocated   int
 	Stats           stats.Stats
 	Role            string
 	TaskCount       int
+	// OS and architecture the worker reported, empty until its first stats
+	OS   string
+	Arch string
+	// Most tasks the worker runs at once as it reported, zero when unlimited, and
+	// the tasks placed on it
+	MaxTasks       int
+	TasksAllocated int
+	// Share of CPU time spent non-idle between the last two stats samples. After
+	// the first one it is taken over the worker's stats history, or since boot when
+	// the worker serves none. Kept up to date with the stats so the schedulers
+	// score nodes without calling them.
+	CpuUsage float64
+	// Client used for the worker API, nil uses http.DefaultClient
+	Client *http.Client `json:"-"`
+	// Fetches stats and response headers in place of the HTTP stats call when set, e.g. over gRPC
+	FetchStats func() (*stats.Stats, http.Header, error) `json:"-"`
+	// Advertised by the worker on each stats call
+	Version       string
+	ApiVersion    int
+	Capabilities  []string
+	Labels        map[string]string
+	VersionSkewed bool
+	// Restarting tasks disproportionately often
+	Flapping bool
+	// Drained for maintenance: excluded from scheduling, and with Evicting set its
+	// tasks are rescheduled to other nodes
+	Cordoned bool
+	Evicting bool
+	// Liveness, updated by the manager on every stats call
+	Status           Status
+	LastHeartbeat    time.Time
+	MissedHeartbeats int
+	// Last heartbeat pushed by the worker, stats calls are skipped while it is recent
+	LastPushedHeartbeat time.Time
+}
+
+// Body of the PUT /drain worker API and PUT /nodes/{name}/drain manager API calls,
+// Drained false uncordons the node
+type DrainRequest struct {
+	Drained bool
+	Evict   bool
 }
 
 func NewNode(name string, api string, role string) *Node {
 	return &Node{
-		Name: name,
-		Api:  api,
-		Role: role,
+		Name:   name,
+		Api:    api,
+		Role:   role,
+		Status: Up,
 	}
 }
 
 func (n *Node) GetStats() (*stats.Stats, error) {
+	if n.FetchStats != nil {
+		s, h, err := n.FetchStats()
+		if err != nil {
+			msg := fmt.Sprintf("Unable to get stats from %v: %v", n.Name, err)
+			return nil, errors.New(msg)
+		}
+		n.readVersionHeaders(h)
+		return n.setStats(*s)
+	}
+
 	var resp *http.Response
 	var err error
 
 	url := fmt.Sprintf("%s/stats", n.Api)
-	resp, err = utils.HTTPWithRetry(http.Get, url)
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err = utils.HTTPWithRetry(client.Get, url)
 	if err != nil {
 		msg := fmt.Sprintf("Unable to connect to %v. Permanent failure.\n", n.Api)
-		logging.Error.Println(msg)
 		return nil, errors.New(msg)
 	}
 
 	if resp.StatusCode != 200 {
 		msg := fmt.Sprintf("Error retrieving stats from %v: %v", n.Api, err)
-		logging.Error.Println(msg)
 		return nil, errors.New(msg)
 	}
 
+	n.readVersionHeaders(resp.Header)
+
 	defer resp.Body.Close()
 	body, _ := ioutil.ReadAll(resp.Body)
 	var stats stats.Stats
 	err = json.Unmarshal(body, &stats)
 	if err != nil {
 		msg := fmt.Sprintf("Error decoding message while getting stats for node %s", n.Name)
-		logging.Error.Println(msg)
 		return nil, errors.New(msg)
 	}
+	first := n.Stats.CpuStats == nil
+	s, err := n.setStats(stats)
+	if err == nil && first {
+		n.seedCpuUsage()
+	}
+	return s, err
+}
+
+// seedCpuUsage replaces the CPU usage since boot of the node's first stats by its
+// usage over the samples the worker kept, when it serves them
+func (n *Node) seedCpuUsage() {
+	samples, err := n.GetStatsHistory(0)
+	if err != nil {
+		return
+	}
+	if usage, ok := stats.CpuUsageOver(samples); ok {
+		n.CpuUsage = usage
+	}
+}
+
+// GetStatsHistory returns the worker's last limit host stats samples oldest first,
+// all of those it keeps when limit is zero
+func (n *Node) GetStatsHistory(limit int) ([]stats.Sample, error) {
+	url := fmt.Sprintf("%s/stats/history", n.Api)
+	if limit > 0 {
+		url = fmt.Sprintf("%s?limit=%d", url, limit)
+	}
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := utils.HTTPWithRetry(client.Get, url)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to %v: %v", n.Api, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("error retrieving stats history from %v: status %d", n.Api, resp.StatusCode)
+	}
+	var samples []stats.Sample
+	if err := json.NewDecoder(resp.Body).Decode(&samples); err != nil {
+		return nil, fmt.Errorf("error decoding stats history of node %s: %v", n.Name, err)
+	}
+	return samples, nil
+}
 
-	if stats.MemStats == nil || stats.DiskStats == nil {
+func (n *Node) setStats(s stats.Stats) (*stats.Stats, error) {
+	if s.MemStats == nil || s.DiskStats == nil {
 		return nil, fmt.Errorf("error getting stats from node %s", n.Name)
 	}
 
-	n.Memory = int64(stats.MemTotalKb())
-	n.Disk = int64(stats.DiskTotal())
-	n.Stats = stats
+	n.Memory = int64(s.MemTotal())
+	n.Disk = int64(s.DiskTotal())
+	n.Cores = s.CpuCount
+	n.Gpus = s.GpuCount
+	n.MaxTasks = s.MaxTasks
+	n.OS, n.Arch = s.OS, s.Arch
+	switch {
+	case s.CpuStats == nil:
+		n.CpuUsage = 0
+	case n.Stats.CpuStats == nil:
+		n.CpuUsage, _, _, _ = s.CpuUsage()
+	default:
+		n.CpuUsage = stats.CpuUsageBetween(&n.Stats, &s)
+	}
+	n.Stats = s
 
 	return &n.Stats, nil
 }
+
+func (n *Node) readVersionHeaders(h http.Header) {
+	n.Version = h.Get(config.VersionHeader)
+	n.ApiVersion, _ = strconv.Atoi(h.Get(config.ApiVersionHeader))
+	n.Capabilities = nil
+	if caps := h.Get(config.CapabilitiesHeader); caps != "" {
+		n.Capabilities = strings.Split(caps, ",")
+	}
+	n.Labels = nil
+	if labels := h.Get(config.LabelsHeader); labels != "" {
+		n.Labels = make(map[string]string)
+		for _, pair := range strings.Split(labels, ",") {
+			if k, v, ok := strings.Cut(pair, "="); ok {
+				n.Labels[k] = v
+			}
+		}
+	}
+}
+
+// HasCapability reports whether the worker advertised the given capability
+func (n *Node) HasCapability(capability string) bool {
+	return slices.Contains(n.Capabilities, capability)
+}
+
+// MissingCapabilities returns those of required the worker did not advertise
+func (n *Node) MissingCapabilities(required []string) []string {
+	var missing []string
+	for _, c := range required {
+		if !n.HasCapability(c) {
+			missing = append(missing, c)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,64 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/shirou/gopsutil/v4/mem"
+
+	"cube/stats"
+)
+
+// workerStats reports user and idle CPU time since boot
+func workerStats(user, idle float64) stats.Stats {
+	return stats.Stats{
+		CpuCount:  4,
+		CpuStats:  &cpu.TimesStat{CPU: "cpu-total", User: user, Idle: idle},
+		MemStats:  &mem.VirtualMemoryStat{Total: 8 << 30, Available: 4 << 30, Used: 4 << 30},
+		DiskStats: &disk.UsageStat{Path: "/", Total: 100 << 30, Free: 50 << 30, Used: 50 << 30},
+	}
+}
+
+func TestFirstCpuUsageFromHistory(t *testing.T) {
+	tests := []struct {
+		name    string
+		history bool
+		want    float64
+	}{
+		// 90 of the last 100 seconds of CPU time were busy
+		{"from the stats history", true, 0.9},
+		{"since boot without a history", false, 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(workerStats(1000, 1000))
+			})
+			if tt.history {
+				mux.HandleFunc("/stats/history", func(w http.ResponseWriter, r *http.Request) {
+					now := time.Now().UTC()
+					json.NewEncoder(w).Encode([]stats.Sample{
+						{Timestamp: now.Add(-time.Minute), Stats: workerStats(910, 990)},
+						{Timestamp: now, Stats: workerStats(1000, 1000)},
+					})
+				})
+			}
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			n := NewNode("worker-1", srv.URL, "worker")
+			if _, err := n.GetStats(); err != nil {
+				t.Fatal(err)
+			}
+			if n.CpuUsage != tt.want {
+				t.Errorf("CPU usage = %v, want %v", n.CpuUsage, tt.want)
+			}
+		})
+	}
+}
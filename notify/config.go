@@ -0,0 +1,139 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"time"
+)
+
+/**
+* Notifier configuration
+* Loaded from the JSON file passed to --notify-config, e.g.
+*   {"Retries": 5,
+*    "Webhooks": [{"URL": "https://ops.example.com/cube", "Secret": "s3cr3t"}],
+*    "Slack": [{"WebhookURL": "https://hooks.slack.com/services/...", "Events": ["task.failed"]}],
+*    "Email": [{"Addr": "smtp.example.com:587", "From": "cube@example.com", "To": ["ops@example.com"]}]}
+* Each receiver gets all events unless it lists the ones it wants.
+ */
+type Config struct {
+	Retries        int
+	BackoffSeconds int
+	Webhooks       []WebhookConfig
+	Slack          []SlackConfig
+	Email          []EmailConfig
+}
+
+type WebhookConfig struct {
+	URL    string
+	Secret string
+	Events []Event
+}
+
+type SlackConfig struct {
+	WebhookURL string
+	Events     []Event
+}
+
+type EmailConfig struct {
+	Addr     string
+	From     string
+	To       []string
+	Username string
+	Password string
+	Events   []Event
+}
+
+// LoadConfig reads a notifier configuration file
+func LoadConfig(filename string) (Config, error) {
+	var cfg Config
+	f, err := os.Open(filename)
+	if err != nil {
+		return cfg, err
+	}
+	defer f.Close()
+
+	d := json.NewDecoder(f)
+	d.DisallowUnknownFields()
+	if err := d.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("error decoding %s: %v", filename, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return cfg, fmt.Errorf("%s: %v", filename, err)
+	}
+	return cfg, nil
+}
+
+func (c Config) validate() error {
+	if c.Retries < 0 || c.BackoffSeconds < 0 {
+		return fmt.Errorf("Retries and BackoffSeconds must not be negative")
+	}
+	for i, w := range c.Webhooks {
+		if err := ValidURL(w.URL); err != nil {
+			return fmt.Errorf("Webhooks[%d].URL: %v", i, err)
+		}
+		if err := validEvents(w.Events); err != nil {
+			return fmt.Errorf("Webhooks[%d].Events: %v", i, err)
+		}
+	}
+	for i, s := range c.Slack {
+		if err := ValidURL(s.WebhookURL); err != nil {
+			return fmt.Errorf("Slack[%d].WebhookURL: %v", i, err)
+		}
+		if err := validEvents(s.Events); err != nil {
+			return fmt.Errorf("Slack[%d].Events: %v", i, err)
+		}
+	}
+	for i, e := range c.Email {
+		if e.Addr == "" || e.From == "" || len(e.To) == 0 {
+			return fmt.Errorf("Email[%d]: Addr, From and To are required", i)
+		}
+		if err := validEvents(e.Events); err != nil {
+			return fmt.Errorf("Email[%d].Events: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// ValidURL checks that a receiver URL is an absolute http(s) URL
+func ValidURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%q is not an http(s) URL", raw)
+	}
+	return nil
+}
+
+func validEvents(events []Event) error {
+	for _, e := range events {
+		if !slices.Contains(Events, e) {
+			return fmt.Errorf("unknown event %q, must be one of %v", e, Events)
+		}
+	}
+	return nil
+}
+
+// Apply subscribes the configured receivers to n, sending with client
+func (c Config) Apply(n *Notifier, client *http.Client) {
+	if c.Retries > 0 {
+		n.Retries = c.Retries
+	}
+	if c.BackoffSeconds > 0 {
+		n.Backoff = time.Duration(c.BackoffSeconds) * time.Second
+	}
+	for _, w := range c.Webhooks {
+		n.Subscribe(&Webhook{URL: w.URL, Secret: w.Secret, Client: client}, w.Events...)
+	}
+	for _, s := range c.Slack {
+		n.Subscribe(&Slack{WebhookURL: s.WebhookURL, Client: client}, s.Events...)
+	}
+	for _, e := range c.Email {
+		n.Subscribe(&Email{Addr: e.Addr, From: e.From, To: e.To, Username: e.Username, Password: e.Password}, e.Events...)
+	}
+}
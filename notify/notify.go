@@ -0,0 +1,169 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/logging"
+	"cube/utils"
+)
+
+var logger = logging.For("notify")
+
+/**
+* Notifications
+* The manager notifies operators of notable task state changes: tasks failing,
+* completing, or failing for good after using up their restart budget. Notifications
+* are queued and delivered in the background by Run, so a slow or unreachable
+* receiver never holds up the manager loops. Every sender gets its own retries.
+ */
+type Event string
+
+const (
+	TaskFailed             Event = "task.failed"
+	TaskCompleted          Event = "task.completed"
+	RestartBudgetExhausted Event = "task.restart_budget_exhausted"
+)
+
+var Events = []Event{TaskFailed, TaskCompleted, RestartBudgetExhausted}
+
+// Notification is the payload delivered to the senders
+type Notification struct {
+	ID           uuid.UUID
+	Event        Event
+	Timestamp    time.Time
+	TaskID       uuid.UUID
+	TaskName     string
+	Image        string
+	State        string
+	Previous     string
+	Worker       string `json:",omitempty"`
+	ExitCode     int
+	RestartCount int
+	Message      string `json:",omitempty"`
+}
+
+// Sender delivers notifications to one receiver
+type Sender interface {
+	Name() string
+	Send(ctx context.Context, n Notification) error
+}
+
+// PermanentError wraps errors that retrying the delivery will not fix
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	DefaultRetries = 3
+	defaultBackoff = time.Second
+	queueSize      = 100
+	sendTimeout    = 10 * time.Second
+)
+
+type subscription struct {
+	sender Sender
+	// Events delivered to the sender, all of them when empty
+	events []Event
+}
+
+type Notifier struct {
+	subscriptions []subscription
+	queue         chan Notification
+	// Deliveries attempted after the first one failed
+	Retries int
+	// Delay before the first retry, doubled on every further retry
+	Backoff time.Duration
+}
+
+func New() *Notifier {
+	return &Notifier{
+		queue:   make(chan Notification, queueSize),
+		Retries: DefaultRetries,
+		Backoff: defaultBackoff,
+	}
+}
+
+// Subscribe delivers the given events to s, or all events when none are given
+func (n *Notifier) Subscribe(s Sender, events ...Event) {
+	n.subscriptions = append(n.subscriptions, subscription{sender: s, events: events})
+}
+
+// Enabled reports whether any sender is subscribed
+func (n *Notifier) Enabled() bool {
+	return n != nil && len(n.subscriptions) > 0
+}
+
+// Notify queues a notification for delivery, dropping it when the queue is full
+func (n *Notifier) Notify(note Notification) {
+	if !n.Enabled() {
+		return
+	}
+	if note.ID == uuid.Nil {
+		note.ID = uuid.New()
+	}
+	if note.Timestamp.IsZero() {
+		note.Timestamp = time.Now().UTC()
+	}
+	select {
+	case n.queue <- note:
+	default:
+		logger.Warn("Notification queue is full, dropping notification", "event", note.Event, "task_id", note.TaskID)
+	}
+}
+
+// Run delivers queued notifications until ctx is done
+func (n *Notifier) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case note := <-n.queue:
+			n.deliver(ctx, note)
+		}
+	}
+}
+
+func (n *Notifier) deliver(ctx context.Context, note Notification) {
+	for _, s := range n.subscriptions {
+		if len(s.events) > 0 && !slices.Contains(s.events, note.Event) {
+			continue
+		}
+		if err := n.send(ctx, s.sender, note); err != nil {
+			logger.Error("Error delivering notification", "sender", s.sender.Name(), "event", note.Event, "task_id", note.TaskID, "error", err)
+			continue
+		}
+		logger.Debug("Delivered notification", "sender", s.sender.Name(), "event", note.Event, "task_id", note.TaskID)
+	}
+}
+
+// send delivers a notification to s, retrying with exponential backoff
+func (n *Notifier) send(ctx context.Context, s Sender, note Notification) error {
+	delay := n.Backoff
+	for attempt := 0; ; attempt++ {
+		sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+		err := s.Send(sendCtx, note)
+		cancel()
+		var permanent *PermanentError
+		if err == nil || errors.As(err, &permanent) || attempt >= n.Retries {
+			return err
+		}
+		logger.Warn("Error sending notification, retrying", "sender", s.Name(), "event", note.Event, "attempt", attempt+1, "delay", delay, "error", err)
+		if !utils.SleepContext(ctx, delay) {
+			return err
+		}
+		delay *= 2
+	}
+}
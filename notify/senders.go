@@ -0,0 +1,187 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EventHeader     = "X-Cube-Event"
+	TimestampHeader = "X-Cube-Timestamp"
+	SignatureHeader = "X-Cube-Signature"
+)
+
+// Webhook posts notifications as JSON to a URL. With a secret, the request carries
+// a hex HMAC-SHA256 of "<timestamp>.<body>" in the X-Cube-Signature header, so
+// receivers can verify the sender and reject replayed payloads.
+type Webhook struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+func (w *Webhook) Name() string {
+	return "webhook " + w.URL
+}
+
+func (w *Webhook) Send(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return &PermanentError{err}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return &PermanentError{err}
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(n.Event))
+	req.Header.Set(TimestampHeader, timestamp)
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(w.Secret, timestamp, body))
+	}
+	return post(w.client(), req)
+}
+
+func (w *Webhook) client() *http.Client {
+	if w.Client == nil {
+		return http.DefaultClient
+	}
+	return w.Client
+}
+
+// Sign returns the signature of a webhook body sent at the given unix timestamp
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Slack posts notifications as messages to a Slack incoming webhook
+type Slack struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+func (s *Slack) Name() string {
+	return "slack"
+}
+
+func (s *Slack) Send(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(map[string]string{"text": Summary(n)})
+	if err != nil {
+		return &PermanentError{err}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return &PermanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return post(client, req)
+}
+
+// post sends a request, treating client errors other than rate limiting as permanent
+func post(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("%s responded %s", req.URL.Redacted(), resp.Status)
+	if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return &PermanentError{err}
+	}
+	return err
+}
+
+// Email sends notifications through an SMTP server, authenticating when a
+// username is set
+type Email struct {
+	// SMTP server host:port
+	Addr     string
+	From     string
+	To       []string
+	Username string
+	Password string
+}
+
+func (e *Email) Name() string {
+	return "email " + strings.Join(e.To, ",")
+}
+
+func (e *Email) Send(ctx context.Context, n Notification) error {
+	var auth smtp.Auth
+	if e.Username != "" {
+		host, _, err := net.SplitHostPort(e.Addr)
+		if err != nil {
+			return &PermanentError{err}
+		}
+		auth = smtp.PlainAuth("", e.Username, e.Password, host)
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&msg, "Subject: [cube] %s %s\r\n", n.Event, taskName(n))
+	fmt.Fprintf(&msg, "Date: %s\r\n", n.Timestamp.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n", Summary(n))
+
+	// net/smtp takes no context, give up waiting once it is done
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(e.Addr, auth, e.From, e.To, msg.Bytes()) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Summary describes a notification in a single line
+func Summary(n Notification) string {
+	var s string
+	switch n.Event {
+	case TaskFailed:
+		s = fmt.Sprintf("Task %s failed with exit code %d", taskName(n), n.ExitCode)
+	case TaskCompleted:
+		s = fmt.Sprintf("Task %s completed", taskName(n))
+	case RestartBudgetExhausted:
+		s = fmt.Sprintf("Task %s failed after %d restarts and will not be restarted again", taskName(n), n.RestartCount)
+	default:
+		s = fmt.Sprintf("Task %s moved from %s to %s", taskName(n), n.Previous, n.State)
+	}
+	if n.Worker != "" {
+		s += " on " + n.Worker
+	}
+	if n.Message != "" {
+		s += ": " + n.Message
+	}
+	return s
+}
+
+func taskName(n Notification) string {
+	if n.TaskName == "" {
+		return n.TaskID.String()
+	}
+	return fmt.Sprintf("%s (%v)", n.TaskName, n.TaskID)
+}
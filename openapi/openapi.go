@@ -0,0 +1,188 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+/**
+* OpenAPI documents
+* The manager and worker APIs are described by OpenAPI 3 documents built from their
+* chi routers, so every route is listed even before it is documented. The Spec of
+* each API adds a summary, the parameters and the Go types of the request and
+* response bodies of its operations, whose schemas are reflected from their JSON
+* encoding. Both APIs serve their document at /openapi.json and a Swagger UI at /swagger.
+ */
+const Version = "3.0.3"
+
+// Spec documents the operations of an API, keyed by "METHOD /path" as routed by chi
+type Spec struct {
+	Title      string
+	Version    string
+	Operations map[string]Operation
+	// Body of the API's error responses
+	Error any
+}
+
+type Operation struct {
+	Summary string
+	// Query parameters, path parameters are taken from the route
+	Query []string
+	// Zero values of the request and response body types, nil when there is none
+	Request  any
+	Response any
+	// Status of a successful response, 200 when zero
+	Status int
+	// Response content type, application/json when empty
+	ContentType string
+}
+
+type Document struct {
+	OpenAPI    string                    `json:"openapi"`
+	Info       Info                      `json:"info"`
+	Paths      map[string]map[string]*Op `json:"paths"`
+	Components Components                `json:"components"`
+	Security   []map[string][]string     `json:"security,omitempty"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme"`
+}
+
+// Op is an operation as encoded in the document
+type Op struct {
+	Summary     string               `json:"summary,omitempty"`
+	OperationID string               `json:"operationId"`
+	Parameters  []Parameter          `json:"parameters,omitempty"`
+	RequestBody *Body                `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type Body struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+var pathParamRe = regexp.MustCompile(`\{([^}]+)\}`)
+
+// Build describes every route of routes, documented by the spec's operations
+func (s Spec) Build(routes chi.Routes) (*Document, error) {
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: s.Title, Version: s.Version},
+		Paths:   make(map[string]map[string]*Op),
+		Components: Components{
+			SecuritySchemes: map[string]SecurityScheme{"bearer": {Type: "http", Scheme: "bearer"}},
+		},
+		Security: []map[string][]string{{"bearer": {}}},
+	}
+	schemas := newSchemas()
+
+	err := chi.Walk(routes, func(method string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		// Wildcards such as the gRPC service are not plain HTTP operations
+		if strings.Contains(route, "*") {
+			return nil
+		}
+		path := route
+		if len(path) > 1 {
+			path = strings.TrimSuffix(path, "/")
+		}
+		key := method + " " + path
+		o := s.Operations[key]
+
+		op := &Op{
+			Summary:     o.Summary,
+			OperationID: operationID(method, path),
+			Responses:   make(map[string]*Response),
+		}
+		for _, m := range pathParamRe.FindAllStringSubmatch(path, -1) {
+			op.Parameters = append(op.Parameters, Parameter{Name: m[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+		for _, q := range o.Query {
+			op.Parameters = append(op.Parameters, Parameter{Name: q, In: "query", Schema: &Schema{Type: "string"}})
+		}
+		if o.Request != nil {
+			op.RequestBody = &Body{
+				Required: true,
+				Content:  map[string]MediaType{"application/json": {Schema: schemas.of(o.Request)}},
+			}
+		}
+
+		status := o.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		ok := &Response{Description: http.StatusText(status)}
+		contentType := o.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		switch {
+		case o.Response != nil:
+			ok.Content = map[string]MediaType{contentType: {Schema: schemas.of(o.Response)}}
+		case o.ContentType != "":
+			ok.Content = map[string]MediaType{contentType: {Schema: &Schema{Type: "string"}}}
+		}
+		op.Responses[fmt.Sprint(status)] = ok
+		if s.Error != nil {
+			op.Responses["default"] = &Response{
+				Description: "Error",
+				Content:     map[string]MediaType{"application/json": {Schema: schemas.of(s.Error)}},
+			}
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*Op)
+		}
+		doc.Paths[path][strings.ToLower(method)] = op
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	doc.Components.Schemas = schemas.components
+	return doc, nil
+}
+
+// operationID derives a unique identifier from the method and path, e.g. get_tasks_taskID
+func operationID(method string, path string) string {
+	id := strings.ToLower(method)
+	for _, part := range strings.Split(path, "/") {
+		part = strings.Trim(part, "{}")
+		if part != "" {
+			id += "_" + strings.ReplaceAll(part, "-", "_")
+		}
+	}
+	return id
+}
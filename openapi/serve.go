@@ -0,0 +1,79 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Paths the document and the Swagger UI are served at
+const (
+	DocumentPath = "/openapi.json"
+	SwaggerPath  = "/swagger"
+)
+
+// Swagger UI is loaded from a CDN, the binary only serves the page
+const swaggerUIVersion = "5.17.14"
+
+var swaggerPage = template.Must(template.New("swagger").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>{{.Title}}</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@{{.Version}}/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@{{.Version}}/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: "{{.Document}}", dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`))
+
+// Middleware serves the API's document and Swagger UI ahead of the other middlewares,
+// so they are readable without the API token. The document is built from routes on
+// the first request, once every route is registered.
+func Middleware(spec Spec, routes chi.Routes) func(http.Handler) http.Handler {
+	var once sync.Once
+	var doc []byte
+	var err error
+	document := func(w http.ResponseWriter) {
+		once.Do(func() {
+			var d *Document
+			if d, err = spec.Build(routes); err == nil {
+				doc, err = json.Marshal(d)
+			}
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Error building OpenAPI document: %v\n", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				next.ServeHTTP(w, r)
+				return
+			}
+			switch r.URL.Path {
+			case DocumentPath:
+				document(w)
+			case SwaggerPath:
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				swaggerPage.Execute(w, map[string]string{"Title": spec.Title, "Version": swaggerUIVersion, "Document": DocumentPath})
+			default:
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package platform
+
+import (
+	"os"
+	"path/filepath"
+)
+
+/**
+* Platform specifics
+* Per-OS defaults live in platform_<os>.go, so the worker starts cleanly on
+* Linux hosts as well as on macOS/Windows against Docker Desktop.
+ */
+
+// DataDir returns the directory persistent stores are kept in, creating it if needed.
+// An empty dir falls back to the platform default.
+func DataDir(dir string) (string, error) {
+	if dir == "" {
+		dir = defaultDataDir()
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// DockerHost returns the Docker daemon address to use when DOCKER_HOST is not set
+func DockerHost() string {
+	return defaultDockerHost()
+}
+
+// PodmanHost returns the Podman API socket to use when CONTAINER_HOST is not set
+func PodmanHost() string {
+	return defaultPodmanHost()
+}
+
+// DiskRoot returns the path disk usage is reported for
+func DiskRoot() string {
+	return diskRoot
+}
+
+// LoadAvgSupported reports whether the OS exposes load averages
+func LoadAvgSupported() bool {
+	return loadAvgSupported
+}
+
+func homeDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "."
+	}
+	return home
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func dataDirUnder(base string) string {
+	return filepath.Join(base, "cube")
+}
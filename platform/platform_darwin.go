@@ -0,0 +1,28 @@
+package platform
+
+import (
+	"path/filepath"
+)
+
+const (
+	diskRoot         = "/"
+	loadAvgSupported = true
+)
+
+// Docker Desktop for Mac exposes its socket under the user's home directory
+func defaultDockerHost() string {
+	socket := filepath.Join(homeDir(), ".docker", "run", "docker.sock")
+	if fileExists(socket) {
+		return "unix://" + socket
+	}
+	return "unix:///var/run/docker.sock"
+}
+
+// podman machine forwards its API socket to the host
+func defaultPodmanHost() string {
+	return "unix://" + filepath.Join(homeDir(), ".local", "share", "containers", "podman", "machine", "podman.sock")
+}
+
+func defaultDataDir() string {
+	return dataDirUnder(filepath.Join(homeDir(), "Library", "Application Support"))
+}
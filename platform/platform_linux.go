@@ -0,0 +1,33 @@
+package platform
+
+import (
+	"os"
+	"path/filepath"
+)
+
+const (
+	diskRoot         = "/"
+	loadAvgSupported = true
+)
+
+func defaultDockerHost() string {
+	return "unix:///var/run/docker.sock"
+}
+
+// Rootless Podman listens under the user's runtime directory
+func defaultPodmanHost() string {
+	if xdg := os.Getenv("XDG_RUNTIME_DIR"); xdg != "" {
+		socket := filepath.Join(xdg, "podman", "podman.sock")
+		if fileExists(socket) {
+			return "unix://" + socket
+		}
+	}
+	return "unix:///run/podman/podman.sock"
+}
+
+func defaultDataDir() string {
+	if xdg := os.Getenv("XDG_DATA_HOME"); xdg != "" {
+		return dataDirUnder(xdg)
+	}
+	return dataDirUnder(filepath.Join(homeDir(), ".local", "share"))
+}
@@ -0,0 +1,24 @@
+//go:build !linux && !darwin && !windows
+
+package platform
+
+import (
+	"path/filepath"
+)
+
+const (
+	diskRoot         = "/"
+	loadAvgSupported = true
+)
+
+func defaultDockerHost() string {
+	return "unix:///var/run/docker.sock"
+}
+
+func defaultPodmanHost() string {
+	return "unix:///run/podman/podman.sock"
+}
+
+func defaultDataDir() string {
+	return dataDirUnder(filepath.Join(homeDir(), ".local", "share"))
+}
@@ -0,0 +1,25 @@
+package platform
+
+import (
+	"os"
+)
+
+const (
+	diskRoot         = `C:\`
+	loadAvgSupported = false
+)
+
+func defaultDockerHost() string {
+	return "npipe:////./pipe/docker_engine"
+}
+
+func defaultPodmanHost() string {
+	return "npipe:////./pipe/podman-machine-default"
+}
+
+func defaultDataDir() string {
+	if local := os.Getenv("LOCALAPPDATA"); local != "" {
+		return dataDirUnder(local)
+	}
+	return dataDirUnder(homeDir())
+}
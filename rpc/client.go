@@ -0,0 +1,72 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"cube/stats"
+	"cube/task"
+)
+
+/**
+* Manager to worker calls
+* The manager reaches workers through a WorkerClient: over the worker HTTP API, or
+* with --transport=grpc over the WorkerService workers serve next to it on the same
+* port. The HTTP API stays the only interface for end users either way.
+ */
+const (
+	HTTPTransport = "http"
+	GRPCTransport = "grpc"
+)
+
+var Transports = []string{HTTPTransport, GRPCTransport}
+
+// ErrTaskNotFound is returned by StopTask when the worker does not know the task
+var ErrTaskNotFound = errors.New("task not found on worker")
+
+// RejectedError is returned when a worker answers but refuses a request, as opposed
+// to transport errors when it cannot be reached
+type RejectedError struct {
+	Code    int
+	Message string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("worker rejected the request (%d): %s", e.Code, e.Message)
+}
+
+// Insufficient reports whether the worker refused a task because it lacks the
+// resources to run it, in which case another worker may accept it
+func (e *RejectedError) Insufficient() bool {
+	return e.Code == http.StatusTooManyRequests
+}
+
+type WorkerClient interface {
+	// Queue a task event on the worker, returning the task as the worker accepted it
+	SubmitTask(ctx context.Context, worker string, te task.TaskEvent) (*task.Task, error)
+	StopTask(ctx context.Context, worker string, id uuid.UUID) error
+	ListTasks(ctx context.Context, worker string) ([]*task.Task, error)
+}
+
+// StatsClient is implemented by clients that also carry worker stats, which the
+// manager then uses in place of the HTTP stats call
+type StatsClient interface {
+	Stats(worker string) (*stats.Stats, http.Header, error)
+}
+
+// NewWorkerClient returns the client for the named transport. HTTP calls go
+// through client, gRPC calls authenticate with token.
+func NewWorkerClient(transport string, token string, client *http.Client) (WorkerClient, error) {
+	switch transport {
+	case HTTPTransport, "":
+		return &HTTPClient{Client: client}, nil
+	case GRPCTransport:
+		return NewGRPCClient(token), nil
+	default:
+		return nil, fmt.Errorf("unknown transport %q, expected one of %v", transport, Transports)
+	}
+}
@@ -0,0 +1,365 @@
+package rpc
+
+import (
+	"sort"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/google/uuid"
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/shirou/gopsutil/v4/load"
+	"github.com/shirou/gopsutil/v4/mem"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"cube/rpc/workerpb"
+	"cube/stats"
+	"cube/task"
+)
+
+/**
+* Conversions between the task and stats types and their protobuf messages
+ */
+func TaskToProto(t task.Task) *workerpb.Task {
+	pt := &workerpb.Task{
+		Id:              t.ID.String(),
+		ContainerId:     t.ContainerID,
+		ContainerName:   t.ContainerName,
+		Name:            t.Name,
+		State:           int32(t.State),
+		Image:           t.Image,
+		Platform:        t.Platform,
+		ImagePullPolicy: string(t.ImagePullPolicy),
+		Env:             t.Env,
+		Cmd:             t.Cmd,
+		Labels:          t.Labels,
+		NodeSelector:    t.NodeSelector,
+		Constraints:     t.Constraints,
+		Affinity:        t.Affinity,
+		AntiAffinity:    t.AntiAffinity,
+		Capabilities:    t.Capabilities,
+		Cpu:             t.Cpu,
+		Memory:          t.Memory,
+		Disk:            t.Disk,
+		CpuLimit:        t.CpuLimit,
+		MemoryLimit:     t.MemoryLimit,
+		CpusetCpus:      t.CpusetCpus,
+		QosClass:        string(t.QoSClass),
+		Priority:        int32(t.Priority),
+		PortBindings:    t.PortBindings,
+		Networks:        t.Networks,
+		RestartPolicy: &workerpb.RestartPolicy{
+			Name:              string(t.RestartPolicy.Name),
+			MaxRetries:        int32(t.RestartPolicy.MaxRetries),
+			BackoffSeconds:    int32(t.RestartPolicy.BackoffSeconds),
+			MaxBackoffSeconds: int32(t.RestartPolicy.MaxBackoffSeconds),
+			RestartOnDeadline: t.RestartPolicy.RestartOnDeadline,
+		},
+		StopTimeout:   int32(t.StopTimeout),
+		StartTime:     timestamp(t.StartTime),
+		FinishTime:    timestamp(t.FinishTime),
+		Timeout:       int32(t.Timeout),
+		Deadline:      timestamp(t.Deadline),
+		FailureReason: string(t.FailureReason),
+		Error:         t.Error,
+		ErrorCode:     string(t.ErrorCode),
+		HealthCheck:   t.HealthCheck,
+		Health:        string(t.Health),
+		RestartCount:  int32(t.RestartCount),
+		Kind:          string(t.Kind),
+		ExitCode:      int32(t.ExitCode),
+		OomKilled:     t.OOMKilled,
+		OutputTail:    t.OutputTail,
+		Revision:      int32(t.Revision),
+		NextRestart:   timestamp(t.NextRestart),
+	}
+	for _, m := range t.Mounts {
+		pt.Mounts = append(pt.Mounts, &workerpb.Mount{Type: string(m.Type), Source: m.Source, Target: m.Target, ReadOnly: m.ReadOnly})
+	}
+	for p := range t.ExposedPorts {
+		pt.ExposedPorts = append(pt.ExposedPorts, string(p))
+	}
+	sort.Strings(pt.ExposedPorts)
+	for p, bindings := range t.HostPorts {
+		for _, b := range bindings {
+			pt.HostPorts = append(pt.HostPorts, &workerpb.PortBinding{ContainerPort: string(p), HostIp: b.HostIP, HostPort: b.HostPort})
+		}
+	}
+	sort.Slice(pt.HostPorts, func(i, j int) bool { return pt.HostPorts[i].ContainerPort < pt.HostPorts[j].ContainerPort })
+	for _, id := range t.DependsOn {
+		pt.DependsOn = append(pt.DependsOn, id.String())
+	}
+	if u := t.Usage; u != nil {
+		pt.Usage = &workerpb.ContainerStats{
+			CpuPercent:  u.CpuPercent,
+			MemoryUsage: u.MemoryUsage,
+			MemoryLimit: u.MemoryLimit,
+			NetworkRx:   u.NetworkRx,
+			NetworkTx:   u.NetworkTx,
+			Timestamp:   timestamp(u.Timestamp),
+		}
+	}
+	for _, r := range t.DeviceRequests {
+		pt.DeviceRequests = append(pt.DeviceRequests, &workerpb.DeviceRequest{Driver: r.Driver, Count: int32(r.Count), DeviceIds: r.DeviceIDs, Capabilities: r.Capabilities})
+	}
+	if a := t.RegistryAuth; a != nil {
+		pt.RegistryAuth = &workerpb.RegistryAuth{Username: a.Username, Password: a.Password, IdentityToken: a.IdentityToken}
+	}
+	pt.Probe = probeToProto(t.Probe)
+	pt.StartupProbe = probeToProto(t.StartupProbe)
+	if h := t.ContainerHealthcheck; h != nil {
+		pt.ContainerHealthcheck = &workerpb.ContainerHealthcheck{
+			Test:               h.Test,
+			IntervalSeconds:    int32(h.IntervalSeconds),
+			TimeoutSeconds:     int32(h.TimeoutSeconds),
+			StartPeriodSeconds: int32(h.StartPeriodSeconds),
+			Retries:            int32(h.Retries),
+		}
+	}
+	return pt
+}
+
+func TaskFromProto(pt *workerpb.Task) (task.Task, error) {
+	id, err := uuid.Parse(pt.GetId())
+	if err != nil {
+		return task.Task{}, err
+	}
+	t := task.Task{
+		ID:              id,
+		ContainerID:     pt.GetContainerId(),
+		ContainerName:   pt.GetContainerName(),
+		Name:            pt.GetName(),
+		State:           task.State(pt.GetState()),
+		Image:           pt.GetImage(),
+		Platform:        pt.GetPlatform(),
+		ImagePullPolicy: task.ImagePullPolicy(pt.GetImagePullPolicy()),
+		Env:             pt.GetEnv(),
+		Cmd:             pt.GetCmd(),
+		Labels:          pt.GetLabels(),
+		NodeSelector:    pt.GetNodeSelector(),
+		Constraints:     pt.GetConstraints(),
+		Affinity:        pt.GetAffinity(),
+		AntiAffinity:    pt.GetAntiAffinity(),
+		Capabilities:    pt.GetCapabilities(),
+		Cpu:             pt.GetCpu(),
+		Memory:          pt.GetMemory(),
+		Disk:            pt.GetDisk(),
+		CpuLimit:        pt.GetCpuLimit(),
+		MemoryLimit:     pt.GetMemoryLimit(),
+		CpusetCpus:      pt.GetCpusetCpus(),
+		QoSClass:        task.QoSClass(pt.GetQosClass()),
+		Priority:        int(pt.GetPriority()),
+		PortBindings:    pt.GetPortBindings(),
+		Networks:        pt.GetNetworks(),
+		RestartPolicy: task.RestartPolicy{
+			Name:              task.RestartMode(pt.GetRestartPolicy().GetName()),
+			MaxRetries:        int(pt.GetRestartPolicy().GetMaxRetries()),
+			BackoffSeconds:    int(pt.GetRestartPolicy().GetBackoffSeconds()),
+			MaxBackoffSeconds: int(pt.GetRestartPolicy().GetMaxBackoffSeconds()),
+			RestartOnDeadline: pt.GetRestartPolicy().GetRestartOnDeadline(),
+		},
+		StopTimeout:   int(pt.GetStopTimeout()),
+		StartTime:     fromTimestamp(pt.GetStartTime()),
+		FinishTime:    fromTimestamp(pt.GetFinishTime()),
+		Timeout:       int(pt.GetTimeout()),
+		Deadline:      fromTimestamp(pt.GetDeadline()),
+		FailureReason: task.FailureReason(pt.GetFailureReason()),
+		Error:         pt.GetError(),
+		ErrorCode:     task.ErrorCode(pt.GetErrorCode()),
+		HealthCheck:   pt.GetHealthCheck(),
+		Health:        task.HealthStatus(pt.GetHealth()),
+		RestartCount:  int(pt.GetRestartCount()),
+		Kind:          task.Kind(pt.GetKind()),
+		ExitCode:      int(pt.GetExitCode()),
+		OOMKilled:     pt.GetOomKilled(),
+		OutputTail:    pt.GetOutputTail(),
+		Revision:      int(pt.GetRevision()),
+		NextRestart:   fromTimestamp(pt.GetNextRestart()),
+	}
+	for _, dep := range pt.GetDependsOn() {
+		depID, err := uuid.Parse(dep)
+		if err != nil {
+			return task.Task{}, err
+		}
+		t.DependsOn = append(t.DependsOn, depID)
+	}
+	if u := pt.GetUsage(); u != nil {
+		t.Usage = &task.ContainerStats{
+			CpuPercent:  u.GetCpuPercent(),
+			MemoryUsage: u.GetMemoryUsage(),
+			MemoryLimit: u.GetMemoryLimit(),
+			NetworkRx:   u.GetNetworkRx(),
+			NetworkTx:   u.GetNetworkTx(),
+			Timestamp:   fromTimestamp(u.GetTimestamp()),
+		}
+	}
+	for _, m := range pt.GetMounts() {
+		t.Mounts = append(t.Mounts, task.Mount{Type: task.MountType(m.GetType()), Source: m.GetSource(), Target: m.GetTarget(), ReadOnly: m.GetReadOnly()})
+	}
+	if len(pt.GetExposedPorts()) > 0 {
+		t.ExposedPorts = make(nat.PortSet)
+		for _, p := range pt.GetExposedPorts() {
+			t.ExposedPorts[nat.Port(p)] = struct{}{}
+		}
+	}
+	if len(pt.GetHostPorts()) > 0 {
+		t.HostPorts = make(nat.PortMap)
+		for _, b := range pt.GetHostPorts() {
+			p := nat.Port(b.GetContainerPort())
+			t.HostPorts[p] = append(t.HostPorts[p], nat.PortBinding{HostIP: b.GetHostIp(), HostPort: b.GetHostPort()})
+		}
+	}
+	for _, r := range pt.GetDeviceRequests() {
+		t.DeviceRequests = append(t.DeviceRequests, task.DeviceRequest{Driver: r.GetDriver(), Count: int(r.GetCount()), DeviceIDs: r.GetDeviceIds(), Capabilities: r.GetCapabilities()})
+	}
+	if a := pt.GetRegistryAuth(); a != nil {
+		t.RegistryAuth = &task.RegistryAuth{Username: a.GetUsername(), Password: a.GetPassword(), IdentityToken: a.GetIdentityToken()}
+	}
+	t.Probe = probeFromProto(pt.GetProbe())
+	t.StartupProbe = probeFromProto(pt.GetStartupProbe())
+	if h := pt.GetContainerHealthcheck(); h != nil {
+		t.ContainerHealthcheck = &task.ContainerHealthcheck{
+			Test:               h.GetTest(),
+			IntervalSeconds:    int(h.GetIntervalSeconds()),
+			TimeoutSeconds:     int(h.GetTimeoutSeconds()),
+			StartPeriodSeconds: int(h.GetStartPeriodSeconds()),
+			Retries:            int(h.GetRetries()),
+		}
+	}
+	return t, nil
+}
+
+func probeToProto(p *task.Probe) *workerpb.Probe {
+	if p == nil {
+		return nil
+	}
+	return &workerpb.Probe{
+		Type:                string(p.Type),
+		Path:                p.Path,
+		Port:                p.Port,
+		Command:             p.Command,
+		IntervalSeconds:     int32(p.IntervalSeconds),
+		TimeoutSeconds:      int32(p.TimeoutSeconds),
+		FailureThreshold:    int32(p.FailureThreshold),
+		InitialDelaySeconds: int32(p.InitialDelaySeconds),
+	}
+}
+
+func probeFromProto(p *workerpb.Probe) *task.Probe {
+	if p == nil {
+		return nil
+	}
+	return &task.Probe{
+		Type:                task.ProbeType(p.GetType()),
+		Path:                p.GetPath(),
+		Port:                p.GetPort(),
+		Command:             p.GetCommand(),
+		IntervalSeconds:     int(p.GetIntervalSeconds()),
+		TimeoutSeconds:      int(p.GetTimeoutSeconds()),
+		FailureThreshold:    int(p.GetFailureThreshold()),
+		InitialDelaySeconds: int(p.GetInitialDelaySeconds()),
+	}
+}
+
+func TaskEventToProto(te task.TaskEvent) *workerpb.TaskEvent {
+	return &workerpb.TaskEvent{
+		Id:        te.ID.String(),
+		Timestamp: timestamp(te.Timestamp),
+		State:     int32(te.State),
+		Task:      TaskToProto(te.Task),
+	}
+}
+
+func TaskEventFromProto(pe *workerpb.TaskEvent) (task.TaskEvent, error) {
+	id, err := uuid.Parse(pe.GetId())
+	if err != nil {
+		return task.TaskEvent{}, err
+	}
+	t, err := TaskFromProto(pe.GetTask())
+	if err != nil {
+		return task.TaskEvent{}, err
+	}
+	return task.TaskEvent{
+		ID:        id,
+		Timestamp: fromTimestamp(pe.GetTimestamp()),
+		State:     task.State(pe.GetState()),
+		Task:      t,
+	}, nil
+}
+
+func StatsToProto(s *stats.Stats) *workerpb.Stats {
+	ps := &workerpb.Stats{
+		TaskCount: int32(s.TaskCount), CpuCount: int32(s.CpuCount), Drained: s.Drained, Evict: s.Evict,
+		QueueLength: int32(s.QueueLength), RunningContainers: int32(s.RunningContainers),
+		LastStartLatencyNanos: int64(s.LastStartLatency), RuntimeError: s.RuntimeError, GpuCount: int32(s.GpuCount),
+		MaxTasks: int32(s.MaxTasks), Os: s.OS, Arch: s.Arch,
+	}
+	if len(s.TasksByState) > 0 {
+		ps.TasksByState = make(map[string]int32, len(s.TasksByState))
+		for state, n := range s.TasksByState {
+			ps.TasksByState[state] = int32(n)
+		}
+	}
+	if m := s.MemStats; m != nil {
+		ps.Memory = &workerpb.MemoryStats{Total: m.Total, Available: m.Available, Used: m.Used, UsedPercent: m.UsedPercent}
+	}
+	if d := s.DiskStats; d != nil {
+		ps.Disk = &workerpb.DiskStats{Path: d.Path, Total: d.Total, Free: d.Free, Used: d.Used, UsedPercent: d.UsedPercent}
+	}
+	if c := s.CpuStats; c != nil {
+		ps.Cpu = &workerpb.CpuStats{
+			User: c.User, System: c.System, Idle: c.Idle, Nice: c.Nice, Iowait: c.Iowait,
+			Irq: c.Irq, Softirq: c.Softirq, Steal: c.Steal, Guest: c.Guest, GuestNice: c.GuestNice,
+		}
+	}
+	if l := s.LoadStats; l != nil {
+		ps.Load = &workerpb.LoadStats{Load1: l.Load1, Load5: l.Load5, Load15: l.Load15}
+	}
+	return ps
+}
+
+func StatsFromProto(ps *workerpb.Stats) *stats.Stats {
+	s := &stats.Stats{
+		TaskCount: int(ps.GetTaskCount()), CpuCount: int(ps.GetCpuCount()), Drained: ps.GetDrained(), Evict: ps.GetEvict(),
+		QueueLength: int(ps.GetQueueLength()), RunningContainers: int(ps.GetRunningContainers()),
+		LastStartLatency: time.Duration(ps.GetLastStartLatencyNanos()), RuntimeError: ps.GetRuntimeError(), GpuCount: int(ps.GetGpuCount()),
+		MaxTasks: int(ps.GetMaxTasks()), OS: ps.GetOs(), Arch: ps.GetArch(),
+	}
+	if len(ps.GetTasksByState()) > 0 {
+		s.TasksByState = make(map[string]int, len(ps.GetTasksByState()))
+		for state, n := range ps.GetTasksByState() {
+			s.TasksByState[state] = int(n)
+		}
+	}
+	if m := ps.GetMemory(); m != nil {
+		s.MemStats = &mem.VirtualMemoryStat{Total: m.GetTotal(), Available: m.GetAvailable(), Used: m.GetUsed(), UsedPercent: m.GetUsedPercent()}
+	}
+	if d := ps.GetDisk(); d != nil {
+		s.DiskStats = &disk.UsageStat{Path: d.GetPath(), Total: d.GetTotal(), Free: d.GetFree(), Used: d.GetUsed(), UsedPercent: d.GetUsedPercent()}
+	}
+	if c := ps.GetCpu(); c != nil {
+		s.CpuStats = &cpu.TimesStat{
+			CPU: "cpu-total", User: c.GetUser(), System: c.GetSystem(), Idle: c.GetIdle(), Nice: c.GetNice(), Iowait: c.GetIowait(),
+			Irq: c.GetIrq(), Softirq: c.GetSoftirq(), Steal: c.GetSteal(), Guest: c.GetGuest(), GuestNice: c.GetGuestNice(),
+		}
+	}
+	if l := ps.GetLoad(); l != nil {
+		s.LoadStats = &load.AvgStat{Load1: l.GetLoad1(), Load5: l.GetLoad5(), Load15: l.GetLoad15()}
+	}
+	return s
+}
+
+// Zero times are left unset rather than encoded as 0001-01-01
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func fromTimestamp(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
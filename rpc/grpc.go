@@ -0,0 +1,260 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"cube/logging"
+	"cube/rpc/workerpb"
+	"cube/stats"
+	"cube/task"
+)
+
+var logger = logging.For("manager")
+
+const (
+	// How often workers push stats on the StreamStats watch
+	statsInterval = 5 * time.Second
+	// How long Stats waits for the first message of a new watch
+	statsWait = 10 * time.Second
+	// Cached stats older than this are treated as a missed heartbeat
+	statsStale = 3 * statsInterval
+)
+
+// GRPCClient calls the WorkerService workers serve on their API port. Connections
+// are opened lazily per worker and reused.
+type GRPCClient struct {
+	// Bearer token sent with every call, empty disables authentication
+	Token string
+
+	mu       sync.Mutex
+	conns    map[string]*grpc.ClientConn
+	watchers map[string]*statsWatch
+}
+
+func NewGRPCClient(token string) *GRPCClient {
+	return &GRPCClient{
+		Token:    token,
+		conns:    make(map[string]*grpc.ClientConn),
+		watchers: make(map[string]*statsWatch),
+	}
+}
+
+func (c *GRPCClient) SubmitTask(ctx context.Context, worker string, te task.TaskEvent) (*task.Task, error) {
+	client, err := c.client(worker)
+	if err != nil {
+		return nil, err
+	}
+	pt, err := client.SubmitTask(ctx, TaskEventToProto(te))
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	t, err := TaskFromProto(pt)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding response: %v", err)
+	}
+	return &t, nil
+}
+
+func (c *GRPCClient) StopTask(ctx context.Context, worker string, id uuid.UUID) error {
+	client, err := c.client(worker)
+	if err != nil {
+		return err
+	}
+	_, err = client.StopTask(ctx, &workerpb.StopTaskRequest{TaskId: id.String()})
+	return fromStatus(err)
+}
+
+func (c *GRPCClient) ListTasks(ctx context.Context, worker string) ([]*task.Task, error) {
+	client, err := c.client(worker)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.ListTasks(ctx, &workerpb.ListTasksRequest{})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	tasks := make([]*task.Task, 0, len(resp.GetTasks()))
+	for _, pt := range resp.GetTasks() {
+		t, err := TaskFromProto(pt)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding task: %v", err)
+		}
+		tasks = append(tasks, &t)
+	}
+	return tasks, nil
+}
+
+// Stats returns the latest stats pushed by the worker, along with the response
+// headers of the stream so version and capability headers keep working. The first
+// call for a worker opens the StreamStats watch.
+func (c *GRPCClient) Stats(worker string) (*stats.Stats, http.Header, error) {
+	c.mu.Lock()
+	w, ok := c.watchers[worker]
+	if !ok {
+		w = &statsWatch{ready: make(chan struct{})}
+		c.watchers[worker] = w
+		go c.watchStats(worker, w)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-w.ready:
+	case <-time.After(statsWait):
+		return nil, nil, fmt.Errorf("no stats received from %s", worker)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if time.Since(w.received) > statsStale {
+		if w.err != nil {
+			return nil, nil, w.err
+		}
+		return nil, nil, fmt.Errorf("stats from %s are stale, last received %v", worker, w.received)
+	}
+	return w.stats, w.header, nil
+}
+
+// Latest state of a worker's StreamStats watch
+type statsWatch struct {
+	mu       sync.Mutex
+	stats    *stats.Stats
+	header   http.Header
+	received time.Time
+	err      error
+	// Closed once the first message or error arrives
+	ready chan struct{}
+	once  sync.Once
+}
+
+func (w *statsWatch) set(s *stats.Stats, h http.Header, err error) {
+	w.mu.Lock()
+	if err != nil {
+		w.err = err
+	} else {
+		w.stats, w.header, w.received, w.err = s, h, time.Now(), nil
+	}
+	w.mu.Unlock()
+	w.once.Do(func() { close(w.ready) })
+}
+
+// watchStats keeps a StreamStats watch open, reconnecting when the stream breaks
+func (c *GRPCClient) watchStats(worker string, w *statsWatch) {
+	for {
+		err := c.streamStats(worker, w)
+		logger.Warn("Stats stream ended", "worker", worker, "error", err)
+		w.set(nil, nil, err)
+		time.Sleep(statsInterval)
+	}
+}
+
+func (c *GRPCClient) streamStats(worker string, w *statsWatch) error {
+	client, err := c.client(worker)
+	if err != nil {
+		return err
+	}
+	stream, err := client.StreamStats(context.Background(), &workerpb.StreamStatsRequest{IntervalSeconds: int32(statsInterval / time.Second)})
+	if err != nil {
+		return fromStatus(err)
+	}
+	md, err := stream.Header()
+	if err != nil {
+		return fromStatus(err)
+	}
+	header := make(http.Header)
+	for k, vs := range md {
+		for _, v := range vs {
+			header.Add(k, v)
+		}
+	}
+	for {
+		ps, err := stream.Recv()
+		if err != nil {
+			return fromStatus(err)
+		}
+		w.set(StatsFromProto(ps), header, nil)
+	}
+}
+
+func (c *GRPCClient) client(worker string) (workerpb.WorkerServiceClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	conn, ok := c.conns[worker]
+	if !ok {
+		var err error
+		conn, err = grpc.NewClient(worker,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithPerRPCCredentials(tokenCredentials(c.Token)))
+		if err != nil {
+			return nil, fmt.Errorf("error connecting to %s: %v", worker, err)
+		}
+		c.conns[worker] = conn
+	}
+	return workerpb.NewWorkerServiceClient(conn), nil
+}
+
+// fromStatus maps errors returned by the worker to the errors of the HTTP client:
+// NOT_FOUND to ErrTaskNotFound and other refusals to a RejectedError
+func fromStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch s.Code() {
+	case codes.NotFound:
+		return ErrTaskNotFound
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.AlreadyExists, codes.PermissionDenied, codes.Unauthenticated, codes.ResourceExhausted, codes.Internal:
+		return &RejectedError{Code: httpStatus(s.Code()), Message: s.Message()}
+	}
+	return errors.New(s.Message())
+}
+
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.InvalidArgument, codes.FailedPrecondition:
+		return http.StatusBadRequest
+	case codes.AlreadyExists:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
+
+// tokenCredentials sends the cluster token as a bearer token. Workers serve gRPC
+// without TLS, the same as their HTTP API.
+type tokenCredentials string
+
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	if t == "" {
+		return nil, nil
+	}
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+var (
+	_ WorkerClient = (*HTTPClient)(nil)
+	_ WorkerClient = (*GRPCClient)(nil)
+	_ StatsClient  = (*GRPCClient)(nil)
+)
@@ -0,0 +1,105 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"cube/task"
+)
+
+// HTTPClient calls the worker HTTP API
+type HTTPClient struct {
+	Client *http.Client
+}
+
+// Error body of the worker API
+type errResponse struct {
+	HTTPStatusCode int
+	Message        string
+}
+
+func (c *HTTPClient) SubmitTask(ctx context.Context, worker string, te task.TaskEvent) (*task.Task, error) {
+	data, err := json.Marshal(te)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal task event: %v", err)
+	}
+	resp, err := c.do(ctx, http.MethodPost, fmt.Sprintf("http://%s/tasks", worker), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, rejected(resp)
+	}
+	t := task.Task{}
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return nil, fmt.Errorf("error decoding response: %v", err)
+	}
+	return &t, nil
+}
+
+func (c *HTTPClient) StopTask(ctx context.Context, worker string, id uuid.UUID) error {
+	resp, err := c.do(ctx, http.MethodDelete, fmt.Sprintf("http://%s/tasks/%s", worker, id), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return ErrTaskNotFound
+	}
+	return rejected(resp)
+}
+
+func (c *HTTPClient) ListTasks(ctx context.Context, worker string) ([]*task.Task, error) {
+	resp, err := c.do(ctx, http.MethodGet, fmt.Sprintf("http://%s/tasks", worker), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, rejected(resp)
+	}
+	var tasks []*task.Task
+	if err := json.NewDecoder(resp.Body).Decode(&tasks); err != nil {
+		return nil, fmt.Errorf("error unmarshalling tasks: %v", err)
+	}
+	return tasks, nil
+}
+
+func (c *HTTPClient) do(ctx context.Context, method string, url string, body *bytes.Reader) (*http.Response, error) {
+	var req *http.Request
+	var err error
+	if body != nil {
+		req, err = http.NewRequestWithContext(ctx, method, url, body)
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req, err = http.NewRequestWithContext(ctx, method, url, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+func rejected(resp *http.Response) error {
+	e := errResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Message == "" {
+		e.Message = http.StatusText(resp.StatusCode)
+	}
+	return &RejectedError{Code: resp.StatusCode, Message: e.Message}
+}
@@ -0,0 +1,106 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+/**
+* Scheduler configuration
+* Loaded from the JSON file passed to --scheduler-config, e.g.
+*   {
+*     "Epvm": {"CpuWeight": 2, "DiskWeight": 0.5, "MaxTasks": 8},
+*     "Profiles": {
+*       "spread": {"Filters": ["labels", "platform", "capabilities", "devices", "tasks", "disk", "memory"], "Scores": [{"Name": "epvm"}, {"Name": "round-robin", "Weight": 0.5}]}
+*     }
+*   }
+* Omitted fields keep their defaults, a zero weight leaves the dimension out.
+* Profiles are added to the built-in ones, or replace them when named the same.
+ */
+type Config struct {
+	Epvm     EpvmWeights
+	Profiles map[string]ProfileConfig
+	// Settings of custom plugins keyed by plugin name, see DecodeArgs
+	Args map[string]json.RawMessage
+}
+
+// ProfileConfig lists the plugins of a profile by registered name
+type ProfileConfig struct {
+	Filters []string
+	Scores  []WeightedScore
+}
+
+type WeightedScore struct {
+	Name string
+	// Multiplier of the plugin's scores, 1 when zero
+	Weight float64
+}
+
+type EpvmWeights struct {
+	CpuWeight    float64
+	MemoryWeight float64
+	DiskWeight   float64
+	TaskWeight   float64
+	// Task count at which a node counts as fully loaded in the task dimension,
+	// for nodes whose worker does not report its own MaxTasks
+	MaxTasks int
+}
+
+var DefaultEpvmWeights = EpvmWeights{
+	CpuWeight:    1,
+	MemoryWeight: 1,
+	DiskWeight:   1,
+	TaskWeight:   1,
+	MaxTasks:     4,
+}
+
+func DefaultConfig() Config {
+	return Config{Epvm: DefaultEpvmWeights}
+}
+
+// LoadConfig reads a scheduler configuration file on top of the defaults
+func LoadConfig(filename string) (Config, error) {
+	cfg := DefaultConfig()
+	f, err := os.Open(filename)
+	if err != nil {
+		return cfg, err
+	}
+	defer f.Close()
+
+	d := json.NewDecoder(f)
+	d.DisallowUnknownFields()
+	if err := d.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("error decoding %s: %v", filename, err)
+	}
+	w := cfg.Epvm
+	if w.CpuWeight < 0 || w.MemoryWeight < 0 || w.DiskWeight < 0 || w.TaskWeight < 0 {
+		return cfg, fmt.Errorf("%s: Epvm weights must not be negative", filename)
+	}
+	if w.MaxTasks < 1 {
+		return cfg, fmt.Errorf("%s: Epvm.MaxTasks must be at least 1", filename)
+	}
+	for name, p := range cfg.Profiles {
+		for _, s := range p.Scores {
+			if s.Weight < 0 {
+				return cfg, fmt.Errorf("%s: profile %s: weight of %s must not be negative", filename, name, s.Name)
+			}
+		}
+		if _, err := NewProfile(name, cfg); err != nil {
+			return cfg, fmt.Errorf("%s: %v", filename, err)
+		}
+	}
+	return cfg, nil
+}
+
+// DecodeArgs decodes the settings of the named plugin into v, leaving v unchanged when there are none
+func (c Config) DecodeArgs(name string, v any) error {
+	args, ok := c.Args[name]
+	if !ok {
+		return nil
+	}
+	d := json.NewDecoder(bytes.NewReader(args))
+	d.DisallowUnknownFields()
+	return d.Decode(v)
+}
@@ -0,0 +1,141 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+
+	"cube/node"
+	"cube/task"
+)
+
+/**
+* Built-in filters
+* Capacity filters compare the task's requests with what the node has left once the
+* requests of the tasks already placed there are reserved.
+**/
+type LabelsFilter struct{}
+
+func (LabelsFilter) Name() string { return "labels" }
+
+func (LabelsFilter) Filter(t task.Task, n *node.Node) string {
+	if !checkConstraints(t, n) {
+		return "node labels do not match the task's node selector or constraints"
+	}
+	return ""
+}
+
+// PlatformFilter keeps the nodes of the OS and architecture the task's Platform
+// names, any node when it has none
+type PlatformFilter struct{}
+
+func (PlatformFilter) Name() string { return "platform" }
+
+func (PlatformFilter) Filter(t task.Task, n *node.Node) string {
+	p, err := t.TargetPlatform()
+	if err != nil {
+		return err.Error()
+	}
+	if p == nil {
+		return ""
+	}
+	if n.OS == "" || n.Arch == "" {
+		return "node has not reported its platform"
+	}
+	if nodePlatform := (task.Platform{OS: n.OS, Architecture: n.Arch}); !p.Runs(nodePlatform) {
+		return fmt.Sprintf("node is %s, the task requires %s", nodePlatform, p)
+	}
+	return ""
+}
+
+// CapabilitiesFilter keeps the nodes advertising every capability the task requires
+type CapabilitiesFilter struct{}
+
+func (CapabilitiesFilter) Name() string { return "capabilities" }
+
+func (CapabilitiesFilter) Filter(t task.Task, n *node.Node) string {
+	if missing := n.MissingCapabilities(t.Capabilities); len(missing) > 0 {
+		return fmt.Sprintf("node lacks the required capabilities %s", strings.Join(missing, ", "))
+	}
+	return ""
+}
+
+// DevicesFilter keeps the nodes with the GPUs the task requests left unreserved and
+// the CPUs it is pinned to
+type DevicesFilter struct{}
+
+func (DevicesFilter) Name() string { return "devices" }
+
+func (DevicesFilter) Filter(t task.Task, n *node.Node) string {
+	if gpus := t.GPUs(); gpus > 0 {
+		if !n.HasCapability(task.GpuCapability) {
+			return "node has no GPUs"
+		}
+		if free := n.Gpus - n.GpusAllocated; free < gpus {
+			return fmt.Sprintf("not enough free GPUs for the task's request, %d of %d left", free, n.Gpus)
+		}
+	}
+	if t.CpusetCpus != "" {
+		cpus, err := task.ParseCpuset(t.CpusetCpus)
+		if err != nil {
+			return err.Error()
+		}
+		if last := cpus[len(cpus)-1]; last >= n.Cores {
+			return fmt.Sprintf("node has no CPU %d to pin the task to, it has %d", last, n.Cores)
+		}
+	}
+	return ""
+}
+
+// TasksFilter keeps the nodes running fewer tasks than their worker's MaxTasks
+type TasksFilter struct{}
+
+func (TasksFilter) Name() string { return "tasks" }
+
+func (TasksFilter) Filter(t task.Task, n *node.Node) string {
+	if n.MaxTasks > 0 && n.TasksAllocated >= n.MaxTasks {
+		return fmt.Sprintf("node runs its maximum of %d tasks", n.MaxTasks)
+	}
+	return ""
+}
+
+type DiskFilter struct{}
+
+func (DiskFilter) Name() string { return "disk" }
+
+func (DiskFilter) Filter(t task.Task, n *node.Node) string {
+	if !checkDisk(t, n.Disk-n.DiskAllocated) {
+		return "not enough free disk for the task's request"
+	}
+	return ""
+}
+
+type CpuFilter struct{}
+
+func (CpuFilter) Name() string { return "cpu" }
+
+func (CpuFilter) Filter(t task.Task, n *node.Node) string {
+	free := float64(n.Cores) - n.CpuAllocated
+	// Tasks without a request still need some room
+	if n.Cores > 0 && free <= 0 {
+		return "no free CPU left"
+	}
+	if !checkCpu(t, free) {
+		return "not enough free CPU for the task's request"
+	}
+	return ""
+}
+
+type MemoryFilter struct{}
+
+func (MemoryFilter) Name() string { return "memory" }
+
+func (MemoryFilter) Filter(t task.Task, n *node.Node) string {
+	free := n.Memory - n.MemoryAllocated
+	if n.Memory > 0 && free <= 0 {
+		return "no free memory left"
+	}
+	if !checkMemory(t, free) {
+		return "not enough free memory for the task's request"
+	}
+	return ""
+}
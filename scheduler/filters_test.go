@@ -0,0 +1,84 @@
+package scheduler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/shirou/gopsutil/v4/mem"
+
+	"cube/node"
+	"cube/stats"
+	"cube/task"
+)
+
+const (
+	mib = 1 << 20
+	gib = 1 << 30
+)
+
+// statsNode returns a node whose capacity is set from its stats, as the manager
+// collects them from a worker reporting 4 CPUs, 8 GiB of memory and 100 GiB of disk
+func statsNode(t *testing.T, name string) *node.Node {
+	t.Helper()
+	n := node.NewNode(name, "", "worker")
+	n.FetchStats = func() (*stats.Stats, http.Header, error) {
+		return &stats.Stats{
+			CpuCount:  4,
+			CpuStats:  &cpu.TimesStat{CPU: "cpu-total", User: 10, Idle: 90},
+			MemStats:  &mem.VirtualMemoryStat{Total: 8 * gib, Available: 6 * gib, Used: 2 * gib, UsedPercent: 25},
+			DiskStats: &disk.UsageStat{Path: "/", Total: 100 * gib, Free: 80 * gib, Used: 20 * gib, UsedPercent: 20},
+		}, http.Header{}, nil
+	}
+	if _, err := n.GetStats(); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestMemoryFilterOnReportedCapacity(t *testing.T) {
+	n := statsNode(t, "worker-1")
+	if n.Memory != 8*gib {
+		t.Fatalf("node memory = %d, want %d bytes", n.Memory, int64(8*gib))
+	}
+
+	// 16 tasks of 512 MiB fill the node, as the manager reserves them
+	web := task.Task{Name: "web", Memory: 512 * mib}
+	for i := 0; i < 16; i++ {
+		if reason := (MemoryFilter{}).Filter(web, n); reason != "" {
+			t.Fatalf("task %d rejected with %d of %d bytes allocated: %s", i+1, n.MemoryAllocated, n.Memory, reason)
+		}
+		n.MemoryAllocated += web.Memory
+	}
+	if reason := (MemoryFilter{}).Filter(web, n); reason != "no free memory left" {
+		t.Errorf("full node rejected with %q, want %q", reason, "no free memory left")
+	}
+	if reason := (MemoryFilter{}).Filter(task.Task{Memory: 16 * gib}, statsNode(t, "worker-2")); reason != "not enough free memory for the task's request" {
+		t.Errorf("oversized task rejected with %q", reason)
+	}
+}
+
+func TestBinPackOnReportedCapacity(t *testing.T) {
+	half, empty := statsNode(t, "worker-1"), statsNode(t, "worker-2")
+	half.CpuAllocated, half.MemoryAllocated = 2, 4*gib
+
+	web := task.Task{Name: "web", Cpu: 1, Memory: 1 * gib}
+	p, err := NewProfile("binpack", DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := []*node.Node{empty, half}
+	candidates := p.SelectCandidateNodes(web, nodes)
+	if len(candidates) != 2 {
+		t.Fatalf("%d candidates, want both nodes", len(candidates))
+	}
+	scores := p.Score(web, candidates)
+	// Free share left after the task: (1/4 + 3/8) / 2 and (3/4 + 7/8) / 2
+	if scores["worker-1"] != 0.3125 || scores["worker-2"] != 0.8125 {
+		t.Errorf("scores = %v, want worker-1 0.3125 and worker-2 0.8125", scores)
+	}
+	if picked := p.Pick(scores, candidates); picked != half {
+		t.Errorf("picked %s, want the half full worker-1", picked.Name)
+	}
+}
@@ -0,0 +1,267 @@
+package scheduler
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"cube/node"
+	"cube/task"
+)
+
+/**
+* Scheduling framework
+* A Profile composes filter plugins, which every candidate node must pass, with score
+* plugins, whose weighted scores are summed; the node with the lowest total is
+* picked. Plugins are registered by name, custom ones from the init function of a
+* package compiled into the binary with a blank import in main.go, e.g.
+*   func init() {
+*     scheduler.RegisterFilter("gpu", func(scheduler.Config) (scheduler.FilterPlugin, error) { return GPUFilter{}, nil })
+*   }
+* and composed into named profiles, built in or defined in the scheduler configuration.
+ */
+type FilterPlugin interface {
+	Name() string
+	// Filter returns why n cannot run t, empty when it can
+	Filter(t task.Task, n *node.Node) string
+}
+
+type ScorePlugin interface {
+	Name() string
+	// Score rates the nodes for t, lower is better; nodes left out are not candidates
+	Score(t task.Task, nodes []*node.Node) map[string]float64
+}
+
+// Score plugins keeping state between calls implement Cloner, so previews work on a copy
+type Cloner interface {
+	Clone() ScorePlugin
+}
+
+// Score plugins whose state should survive a manager restart, such as the position
+// of round robin, implement Stateful; the manager saves it after each placement
+type Stateful interface {
+	State() string
+	Restore(state string)
+}
+
+// Plugin factories are called for every profile using the plugin
+type FilterFactory func(cfg Config) (FilterPlugin, error)
+type ScoreFactory func(cfg Config) (ScorePlugin, error)
+
+var (
+	registryMu sync.RWMutex
+	filters    = make(map[string]FilterFactory)
+	scorers    = make(map[string]ScoreFactory)
+)
+
+// RegisterFilter makes a filter plugin available to profiles, it panics when the name is taken
+func RegisterFilter(name string, factory FilterFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := filters[name]; ok {
+		panic("scheduler: filter plugin " + name + " registered twice")
+	}
+	filters[name] = factory
+}
+
+// RegisterScore makes a score plugin available to profiles, it panics when the name is taken
+func RegisterScore(name string, factory ScoreFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := scorers[name]; ok {
+		panic("scheduler: score plugin " + name + " registered twice")
+	}
+	scorers[name] = factory
+}
+
+func init() {
+	RegisterFilter("labels", func(Config) (FilterPlugin, error) { return LabelsFilter{}, nil })
+	RegisterFilter("platform", func(Config) (FilterPlugin, error) { return PlatformFilter{}, nil })
+	RegisterFilter("capabilities", func(Config) (FilterPlugin, error) { return CapabilitiesFilter{}, nil })
+	RegisterFilter("devices", func(Config) (FilterPlugin, error) { return DevicesFilter{}, nil })
+	RegisterFilter("tasks", func(Config) (FilterPlugin, error) { return TasksFilter{}, nil })
+	RegisterFilter("disk", func(Config) (FilterPlugin, error) { return DiskFilter{}, nil })
+	RegisterFilter("cpu", func(Config) (FilterPlugin, error) { return CpuFilter{}, nil })
+	RegisterFilter("memory", func(Config) (FilterPlugin, error) { return MemoryFilter{}, nil })
+
+	RegisterScore("round-robin", func(Config) (ScorePlugin, error) { return &RoundRobin{}, nil })
+	RegisterScore("greedy", func(Config) (ScorePlugin, error) { return &Greedy{}, nil })
+	RegisterScore("epvm", func(cfg Config) (ScorePlugin, error) { return &Epvm{Weights: cfg.Epvm}, nil })
+	RegisterScore("binpack", func(Config) (ScorePlugin, error) { return &BinPack{}, nil })
+}
+
+// Compositions of the built-in plugins, named after the schedulers they replace
+var builtinProfiles = map[string]ProfileConfig{
+	"round-robin": {Filters: []string{"labels", "platform", "capabilities", "devices", "tasks", "disk", "cpu", "memory"}, Scores: []WeightedScore{{Name: "round-robin"}}},
+	"greedy":      {Filters: []string{"labels", "platform", "capabilities", "devices", "tasks", "disk"}, Scores: []WeightedScore{{Name: "greedy"}}},
+	"epvm":        {Filters: []string{"labels", "platform", "capabilities", "devices", "tasks", "disk"}, Scores: []WeightedScore{{Name: "epvm"}}},
+	"binpack":     {Filters: []string{"labels", "platform", "capabilities", "devices", "tasks", "disk", "cpu", "memory"}, Scores: []WeightedScore{{Name: "binpack"}}},
+}
+
+// BuiltinProfiles returns the names of the built-in profiles
+func BuiltinProfiles() []string {
+	return slices.Sorted(maps.Keys(builtinProfiles))
+}
+
+type weightedPlugin struct {
+	plugin ScorePlugin
+	weight float64
+}
+
+// Profile is a named composition of filter and score plugins
+type Profile struct {
+	Name    string
+	filters []FilterPlugin
+	scores  []weightedPlugin
+}
+
+// NewProfile builds the named profile, profiles in cfg take precedence over the built-in ones
+func NewProfile(name string, cfg Config) (*Profile, error) {
+	pc, ok := cfg.Profiles[name]
+	if !ok {
+		pc, ok = builtinProfiles[name]
+	}
+	if !ok {
+		known := slices.Sorted(maps.Keys(builtinProfiles))
+		for n := range cfg.Profiles {
+			if !slices.Contains(known, n) {
+				known = append(known, n)
+			}
+		}
+		return nil, fmt.Errorf("unknown scheduler profile %q, expected one of %v", name, known)
+	}
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	p := &Profile{Name: name}
+	for _, f := range pc.Filters {
+		factory, ok := filters[f]
+		if !ok {
+			return nil, fmt.Errorf("profile %s: unknown filter plugin %q", name, f)
+		}
+		plugin, err := factory(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: filter plugin %s: %v", name, f, err)
+		}
+		p.filters = append(p.filters, plugin)
+	}
+	for _, s := range pc.Scores {
+		factory, ok := scorers[s.Name]
+		if !ok {
+			return nil, fmt.Errorf("profile %s: unknown score plugin %q", name, s.Name)
+		}
+		plugin, err := factory(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: score plugin %s: %v", name, s.Name, err)
+		}
+		weight := s.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		p.scores = append(p.scores, weightedPlugin{plugin: plugin, weight: weight})
+	}
+	return p, nil
+}
+
+// Filter returns the first filter plugin rejecting n for t and its reason, empty when n passes
+func (p *Profile) Filter(t task.Task, n *node.Node) (string, string) {
+	for _, f := range p.filters {
+		if reason := f.Filter(t, n); reason != "" {
+			return f.Name(), reason
+		}
+	}
+	return "", ""
+}
+
+func (p *Profile) SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node {
+	var candidates []*node.Node
+	for _, n := range nodes {
+		if plugin, _ := p.Filter(t, n); plugin == "" {
+			candidates = append(candidates, n)
+		}
+	}
+	return candidates
+}
+
+// Score sums the weighted scores of the plugins, nodes a plugin did not score are left out
+func (p *Profile) Score(t task.Task, nodes []*node.Node) map[string]float64 {
+	total, _ := p.ExplainScore(t, nodes)
+	return total
+}
+
+// ExplainScore is Score with the weighted score of every plugin per node, e.g. "epvm: 0.12 x 2",
+// and the plugin that left a node out
+func (p *Profile) ExplainScore(t task.Task, nodes []*node.Node) (map[string]float64, map[string][]string) {
+	total := make(map[string]float64, len(nodes))
+	reasons := make(map[string][]string, len(nodes))
+	for _, n := range nodes {
+		total[n.Name] = 0
+	}
+	for _, s := range p.scores {
+		scores := s.plugin.Score(t, nodes)
+		for name := range total {
+			score, ok := scores[name]
+			if !ok {
+				delete(total, name)
+				reasons[name] = append(reasons[name], fmt.Sprintf("%s: not scored", s.plugin.Name()))
+				continue
+			}
+			total[name] += s.weight * score
+			reasons[name] = append(reasons[name], fmt.Sprintf("%s: %.4g x %g", s.plugin.Name(), score, s.weight))
+		}
+	}
+	return total, reasons
+}
+
+// Pick returns the scored candidate with the lowest score, the first one on ties
+func (p *Profile) Pick(scores map[string]float64, candidates []*node.Node) *node.Node {
+	var bestNode *node.Node
+	var lowestScore float64
+	for _, n := range candidates {
+		score, ok := scores[n.Name]
+		if !ok {
+			continue
+		}
+		if bestNode == nil || score < lowestScore {
+			bestNode = n
+			lowestScore = score
+		}
+	}
+	return bestNode
+}
+
+// State returns the state of the profile's Stateful score plugins by plugin name
+func (p *Profile) State() map[string]string {
+	state := make(map[string]string)
+	for _, s := range p.scores {
+		if sp, ok := s.plugin.(Stateful); ok {
+			state[s.plugin.Name()] = sp.State()
+		}
+	}
+	return state
+}
+
+// Restore sets the state of the profile's Stateful score plugins, as returned by State
+func (p *Profile) Restore(state map[string]string) {
+	for _, s := range p.scores {
+		if sp, ok := s.plugin.(Stateful); ok {
+			if v, ok := state[s.plugin.Name()]; ok {
+				sp.Restore(v)
+			}
+		}
+	}
+}
+
+// Preview returns a copy of the profile for placements that are not carried out
+func (p *Profile) Preview() *Profile {
+	c := *p
+	c.scores = make([]weightedPlugin, len(p.scores))
+	for i, s := range p.scores {
+		if cloner, ok := s.plugin.(Cloner); ok {
+			s.plugin = cloner.Clone()
+		}
+		c.scores[i] = s
+	}
+	return &c
+}
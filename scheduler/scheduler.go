@@ -1,45 +1,67 @@
 package scheduler
 
 import (
+	"cube/logging"
 	"cube/node"
 	"cube/task"
-	"log"
+	"fmt"
 	"math"
-	"time"
+	"slices"
 )
 
+var logger = logging.For("scheduler")
+
+// Scheduler places tasks on nodes, implemented by Profile
 type Scheduler interface {
 	SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node
 	Score(t task.Task, nodes []*node.Node) map[string]float64
 	Pick(scores map[string]float64, candidates []*node.Node) *node.Node
 }
 
+// Explainer is optionally implemented by a Scheduler to give the reasons behind its
+// decisions, as served by GET /tasks/{id}/scheduling
+type Explainer interface {
+	// Filter returns the check rejecting n for t and why, empty when n passes
+	Filter(t task.Task, n *node.Node) (string, string)
+	// ExplainScore scores like Score and returns the terms of each node's score
+	ExplainScore(t task.Task, nodes []*node.Node) (map[string]float64, map[string][]string)
+}
+
 /**
-* Round Robin scheduler
+* Round Robin score
+* Favours the node after the one favoured last, by name, among the nodes that passed
+* the filters, the other nodes score 1. Full nodes are left out by the filters of
+* the round-robin profile, the rotation carries on over the others.
 **/
 type RoundRobin struct {
-	Name       string
-	LastWorker int
+	// Name of the node favoured last
+	LastWorker string
 }
 
-func (r *RoundRobin) SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node {
-	return nodes
-}
+func (r *RoundRobin) Name() string { return "round-robin" }
 
 func (r *RoundRobin) Score(t task.Task, nodes []*node.Node) map[string]float64 {
 	nodeScores := make(map[string]float64)
+	if len(nodes) == 0 {
+		return nodeScores
+	}
 
-	var newWorker int
-	if r.LastWorker+1 < len(nodes) {
-		newWorker = r.LastWorker + 1
-		r.LastWorker++
-	} else {
-		newWorker = 0
-		r.LastWorker = 0
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.Name)
+	}
+	slices.Sort(names)
+	newWorker := names[0]
+	for _, name := range names {
+		if name > r.LastWorker {
+			newWorker = name
+			break
+		}
 	}
+	r.LastWorker = newWorker
 
-	for idx, node := range nodes {
-		if idx == newWorker {
+	for _, node := range nodes {
+		if node.Name == newWorker {
 			nodeScores[node.Name] = 0.1
 		} else {
 			nodeScores[node.Name] = 1.0
@@ -48,34 +70,24 @@ func (r *RoundRobin) Score(t task.Task, nodes []*node.Node) map[string]float64 {
 	return nodeScores
 }
 
-func (r *RoundRobin) Pick(scores map[string]float64, candidates []*node.Node) *node.Node {
-	var bestNode *node.Node
-	var lowestScore float64
-	for idx, node := range candidates {
-		if idx == 0 {
-			bestNode = node
-			lowestScore = scores[node.Name]
-			continue
-		}
+// State is the node favoured last, saved by the manager so a restart resumes the rotation
+func (r *RoundRobin) State() string { return r.LastWorker }
 
-		if scores[node.Name] < lowestScore {
-			bestNode = node
-			lowestScore = scores[node.Name]
-		}
-	}
-	return bestNode
+func (r *RoundRobin) Restore(state string) { r.LastWorker = state }
+
+// Clone copies the position, so previews do not advance the rotation
+func (r *RoundRobin) Clone() ScorePlugin {
+	c := *r
+	return &c
 }
 
 /**
-* Greedy scheduler
+* Greedy score
+* The node's CPU load between its last two stats samples.
 **/
-type Greedy struct {
-	Name string
-}
+type Greedy struct{}
 
-func (g *Greedy) SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node {
-	return selectCandidateNodes(t, nodes)
-}
+func (g *Greedy) Name() string { return "greedy" }
 
 func (g *Greedy) Score(t task.Task, nodes []*node.Node) map[string]float64 {
 	nodeScores := make(map[string]float64)
@@ -83,7 +95,7 @@ func (g *Greedy) Score(t task.Task, nodes []*node.Node) map[string]float64 {
 	for _, node := range nodes {
 		cpuUsage, err := calculateCpuUsage(node)
 		if err != nil {
-			log.Printf("error calculating CPU usage for node %s, skipping: %v\n", node.Name, err)
+			logger.Warn("Error calculating CPU usage for node, skipping", "worker", node.Name, "error", err)
 			continue
 		}
 		cpuLoad := calculateLoad(float64(*cpuUsage), math.Pow(2, 0.8))
@@ -92,26 +104,8 @@ func (g *Greedy) Score(t task.Task, nodes []*node.Node) map[string]float64 {
 	return nodeScores
 }
 
-func (g *Greedy) Pick(candidates map[string]float64, nodes []*node.Node) *node.Node {
-	minCpu := 0.00
-	var bestNode *node.Node
-	for idx, node := range nodes {
-		if idx == 0 {
-			minCpu = candidates[node.Name]
-			bestNode = node
-			continue
-		}
-
-		if candidates[node.Name] < minCpu {
-			minCpu = candidates[node.Name]
-			bestNode = node
-		}
-	}
-	return bestNode
-}
-
 /**
-* E-PVM scheduler
+* E-PVM score
 **/
 const (
 	// LIEB square ice constant
@@ -119,109 +113,135 @@ const (
 	LIEB = 1.53960071783900203869
 )
 
+// Tasks without a CPU request are costed as if they requested this many cores
+const defaultCpuRequest = 0.1
+
+/**
+* The cost of placing a task on a node is the sum, over CPU, memory, disk and task
+* count, of LIEB^(load after) - LIEB^(load before), each scaled by its weight. The
+* exponential makes the same increment cost more on a busier node. Loads are the
+* larger of the measured usage and the requests already placed on the node.
+**/
 type Epvm struct {
-	Name string
+	// Zero value uses DefaultEpvmWeights
+	Weights EpvmWeights
 }
 
-func (e *Epvm) SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node {
-	return selectCandidateNodes(t, nodes)
-}
+func (e *Epvm) Name() string { return "epvm" }
 
 func (e *Epvm) Score(t task.Task, nodes []*node.Node) map[string]float64 {
 	nodeScores := make(map[string]float64)
-	maxJobs := 4.0
-
+	w := e.Weights
+	if w == (EpvmWeights{}) {
+		w = DefaultEpvmWeights
+	}
 	for _, node := range nodes {
 		cpuUsage, err := calculateCpuUsage(node)
 		if err != nil {
-			log.Printf("error calculating CPU usage for node %s, skipping: %v\n", node.Name, err)
+			logger.Warn("Error calculating CPU usage for node, skipping", "worker", node.Name, "error", err)
 			continue
 		}
-		cpuLoad := calculateLoad(*cpuUsage, math.Pow(2, 0.8))
-
-		memoryAllocated := float64(node.Stats.MemUsedKb()) + float64(node.MemoryAllocated)
-		memoryPercentAllocated := memoryAllocated / float64(node.Memory)
-
-		newMemPercent := (calculateLoad(memoryAllocated+float64(t.Memory/1000), float64(node.Memory)))
-		memCost := math.Pow(LIEB, newMemPercent) +
-			math.Pow(LIEB, (float64(node.TaskCount+1))/maxJobs) -
-			math.Pow(LIEB, memoryPercentAllocated) -
-			math.Pow(LIEB, float64(node.TaskCount)/float64(maxJobs))
-		cpuCost := math.Pow(LIEB, cpuLoad) +
-			math.Pow(LIEB, (float64(node.TaskCount+1))/maxJobs) -
-			math.Pow(LIEB, cpuLoad) -
-			math.Pow(LIEB, float64(node.TaskCount)/float64(maxJobs))
-
-		nodeScores[node.Name] = memCost + cpuCost
-	}
-	return nodeScores
-}
 
-func (e *Epvm) Pick(scores map[string]float64, candidates []*node.Node) *node.Node {
-	minCost := 0.00
-	var bestNode *node.Node
-	for idx, node := range candidates {
-		if idx == 0 {
-			minCost = scores[node.Name]
-			bestNode = node
-			continue
+		var cost float64
+		if node.Cores > 0 {
+			cores := float64(node.Cores)
+			request := t.Cpu
+			if request <= 0 {
+				request = defaultCpuRequest
+			}
+			cpuLoad := max(*cpuUsage, calculateLoad(node.CpuAllocated, cores))
+			cost += w.CpuWeight * marginalCost(cpuLoad, calculateLoad(request, cores))
 		}
-
-		if scores[node.Name] < minCost {
-			minCost = scores[node.Name]
-			bestNode = node
+		if node.Memory > 0 {
+			// Usage, reservations and the request are all in bytes
+			memory := float64(node.Memory)
+			memoryLoad := calculateLoad(max(float64(node.Stats.MemUsed()), float64(node.MemoryAllocated)), memory)
+			cost += w.MemoryWeight * marginalCost(memoryLoad, calculateLoad(float64(t.Memory), memory))
+		}
+		if node.Disk > 0 {
+			disk := float64(node.Disk)
+			diskLoad := calculateLoad(max(float64(node.Stats.DiskUsed()), float64(node.DiskAllocated)), disk)
+			cost += w.DiskWeight * marginalCost(diskLoad, calculateLoad(float64(t.Disk), disk))
 		}
+		maxTasks := float64(max(w.MaxTasks, 1))
+		if node.MaxTasks > 0 {
+			maxTasks = float64(node.MaxTasks)
+		}
+		cost += w.TaskWeight * marginalCost(float64(node.TaskCount)/maxTasks, 1/maxTasks)
+
+		nodeScores[node.Name] = cost
 	}
-	return bestNode
+	return nodeScores
+}
+
+// marginalCost is the E-PVM cost of raising a dimension's load by increment
+func marginalCost(load float64, increment float64) float64 {
+	return math.Pow(LIEB, load+increment) - math.Pow(LIEB, load)
 }
 
 /**
-* Auxiliary functions
+* Bin packing score
+* Packs tasks onto the node left with the least free capacity so the remaining
+* nodes stay free for large tasks. Meant to follow the cpu and memory filters.
 **/
-func selectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node {
-	var candidates []*node.Node
-	for node := range nodes {
+type BinPack struct{}
 
-		if checkDisk(t, nodes[node].Disk-nodes[node].DiskAllocated) {
-			candidates = append(candidates, nodes[node])
-		}
+func (b *BinPack) Name() string { return "binpack" }
+
+// Score is the fraction of CPU and memory a node has left free once the task is placed
+func (b *BinPack) Score(t task.Task, nodes []*node.Node) map[string]float64 {
+	nodeScores := make(map[string]float64)
 
+	for _, node := range nodes {
+		var free float64
+		var dims int
+		if node.Cores > 0 {
+			free += calculateLoad(float64(node.Cores)-node.CpuAllocated-t.Cpu, float64(node.Cores))
+			dims++
+		}
+		if node.Memory > 0 {
+			free += calculateLoad(float64(node.Memory-node.MemoryAllocated-t.Memory), float64(node.Memory))
+			dims++
+		}
+		if dims == 0 {
+			nodeScores[node.Name] = 1.0
+			continue
+		}
+		nodeScores[node.Name] = free / float64(dims)
 	}
+	return nodeScores
+}
 
-	return candidates
+/**
+* Auxiliary functions
+**/
+// checkConstraints reports whether the node's labels satisfy the task's NodeSelector and Constraints
+func checkConstraints(t task.Task, node *node.Node) bool {
+	return t.NodeRequirements().Matches(node.Labels)
 }
 
 func checkDisk(t task.Task, diskAvailable int64) bool {
 	return t.Disk <= diskAvailable
 }
 
+func checkCpu(t task.Task, cpuAvailable float64) bool {
+	return t.Cpu <= cpuAvailable
+}
+
+func checkMemory(t task.Task, memoryAvailable int64) bool {
+	return t.Memory <= memoryAvailable
+}
+
 func calculateLoad(usage float64, capacity float64) float64 {
 	return usage / capacity
 }
 
+// calculateCpuUsage returns the node's CPU usage between its last two stats samples,
+// as cached by the manager's stats updates
 func calculateCpuUsage(node *node.Node) (*float64, error) {
-	stat1, err := node.GetStats()
-	if err != nil {
-		return nil, err
-	}
-	time.Sleep(3 * time.Second)
-
-	stat2, err := node.GetStats()
-	if err != nil {
-		return nil, err
-	}
-
-	_, stat1Idle, _, stat1Total := stat1.CpuUsage()
-	_, stat2Idle, _, stat2Total := stat2.CpuUsage()
-
-	total := stat2Total - stat1Total
-	idle := stat2Idle - stat1Idle
-
-	var cpuPercentUsage float64
-	if total == 0 && idle == 0 {
-		cpuPercentUsage = 0.00
-	} else {
-		cpuPercentUsage = (float64(total) - float64(idle)) / float64(total)
+	if node.Stats.CpuStats == nil {
+		return nil, fmt.Errorf("no CPU stats collected for node %s yet", node.Name)
 	}
-	return &cpuPercentUsage, nil
+	usage := node.CpuUsage
+	return &usage, nil
 }
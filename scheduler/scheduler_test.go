@@ -0,0 +1,47 @@
+package scheduler
+
+import (
+	"math"
+	"testing"
+
+	"cube/node"
+	"cube/task"
+)
+
+func TestEpvmScoresEveryDimensionInItsUnit(t *testing.T) {
+	n := statsNode(t, "worker-1")
+	web := task.Task{Name: "web", Cpu: 1, Memory: 512 * mib, Disk: 1 * gib}
+
+	// 10% CPU used plus a quarter of the cores, 2 of 8 GiB plus 512 MiB, 20 of
+	// 100 GiB plus 1 GiB, and the first of 4 tasks
+	want := marginalCost(0.1, 0.25) + marginalCost(0.25, 1.0/16) + marginalCost(0.2, 0.01) + marginalCost(0, 0.25)
+	got := (&Epvm{}).Score(web, []*node.Node{n})["worker-1"]
+	if math.Abs(got-want) > 1e-9 {
+		t.Errorf("score = %v, want %v", got, want)
+	}
+}
+
+func TestEpvmWeighsCpuAgainstMemory(t *testing.T) {
+	cpuBound, memoryBound := statsNode(t, "worker-1"), statsNode(t, "worker-2")
+	cpuBound.CpuAllocated = 3
+	memoryBound.MemoryAllocated = 5 * gib
+
+	// A task requesting a core and 512 MiB costs more on the node short of CPU
+	web := task.Task{Name: "web", Cpu: 1, Memory: 512 * mib}
+	nodes := []*node.Node{cpuBound, memoryBound}
+	p, err := NewProfile("epvm", DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	scores := p.Score(web, nodes)
+	if picked := p.Pick(scores, nodes); picked != memoryBound {
+		t.Errorf("picked %s with scores %v, want worker-2", picked.Name, scores)
+	}
+
+	// And more on the node short of memory when it mostly asks for memory
+	cache := task.Task{Name: "cache", Cpu: 0.25, Memory: 2 * gib}
+	scores = p.Score(cache, nodes)
+	if picked := p.Pick(scores, nodes); picked != cpuBound {
+		t.Errorf("picked %s with scores %v, want worker-1", picked.Name, scores)
+	}
+}
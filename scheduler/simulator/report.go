@@ -0,0 +1,121 @@
+package simulator
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"cube/node"
+)
+
+// Report is the outcome of a simulation
+type Report struct {
+	Scheduler string
+	Submitted int
+	Placed    int
+	Failed    int
+	// Placements per node, in the order of the simulated nodes
+	Nodes []NodeReport
+	// Coefficient of variation of the placements per node: zero when every node
+	// got as many tasks, higher as they pile up on fewer nodes
+	Imbalance float64
+	Failures  []Failure `json:",omitempty"`
+	// Nodes rejected by each filter plugin over the failed placements
+	Rejections map[string]int `json:",omitempty"`
+	Duration   time.Duration
+
+	nodes map[string]*NodeReport
+}
+
+type NodeReport struct {
+	Name   string
+	Placed int
+	// Highest share of the node's CPU and memory reserved at once
+	PeakCpu    float64
+	PeakMemory float64
+}
+
+// Failure is a task no node was found for
+type Failure struct {
+	Task   string
+	Step   int
+	Reason string
+	// Why each node was rejected, by node name
+	Rejected map[string]string `json:",omitempty"`
+}
+
+func newReport(scheduler string, nodes []*node.Node) Report {
+	r := Report{Scheduler: scheduler, Rejections: make(map[string]int), nodes: make(map[string]*NodeReport)}
+	for _, n := range nodes {
+		r.Nodes = append(r.Nodes, NodeReport{Name: n.Name})
+	}
+	for i := range r.Nodes {
+		r.nodes[r.Nodes[i].Name] = &r.Nodes[i]
+	}
+	return r
+}
+
+func (r *Report) place(n *node.Node) {
+	r.Placed++
+	nr := r.nodes[n.Name]
+	nr.Placed++
+	nr.PeakCpu = max(nr.PeakCpu, ratio(n.CpuAllocated, float64(n.Cores)))
+	nr.PeakMemory = max(nr.PeakMemory, ratio(float64(n.MemoryAllocated), float64(n.Memory)))
+}
+
+func (r *Report) fail(f Failure) {
+	r.Failed++
+	r.Failures = append(r.Failures, f)
+}
+
+func (r *Report) finish() {
+	if len(r.Nodes) == 0 || r.Placed == 0 {
+		return
+	}
+	mean := float64(r.Placed) / float64(len(r.Nodes))
+	var variance float64
+	for _, n := range r.Nodes {
+		d := float64(n.Placed) - mean
+		variance += d * d
+	}
+	variance /= float64(len(r.Nodes))
+	r.Imbalance = math.Sqrt(variance) / mean
+}
+
+// Write prints the report as tables, listing at most maxFailures failed tasks
+func (r Report) Write(w io.Writer, maxFailures int) {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(tw, "Scheduler:\t%s\n", r.Scheduler)
+	fmt.Fprintf(tw, "Tasks:\t%d submitted, %d placed, %d failed\n", r.Submitted, r.Placed, r.Failed)
+	fmt.Fprintf(tw, "Imbalance:\t%.3f\n", r.Imbalance)
+	fmt.Fprintf(tw, "Duration:\t%v\n", r.Duration.Round(time.Microsecond))
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tPLACED\tPEAK CPU\tPEAK MEMORY\t")
+	for _, n := range r.Nodes {
+		fmt.Fprintf(tw, "%s\t%d\t%.0f%%\t%.0f%%\t\n", n.Name, n.Placed, n.PeakCpu*100, n.PeakMemory*100)
+	}
+	tw.Flush()
+
+	if len(r.Rejections) > 0 {
+		var counts []string
+		for _, check := range slices.Sorted(maps.Keys(r.Rejections)) {
+			counts = append(counts, fmt.Sprintf("%s %d", check, r.Rejections[check]))
+		}
+		fmt.Fprintf(w, "\nRejections by filter: %s\n", strings.Join(counts, ", "))
+	}
+	for i, f := range r.Failures {
+		if i == maxFailures {
+			fmt.Fprintf(w, "... and %d more failed tasks\n", len(r.Failures)-maxFailures)
+			break
+		}
+		fmt.Fprintf(w, "Failed %s at step %d: %s\n", f.Task, f.Step, f.Reason)
+	}
+}
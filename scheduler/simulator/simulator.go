@@ -0,0 +1,284 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/shirou/gopsutil/v4/mem"
+
+	"cube/node"
+	"cube/scheduler"
+	"cube/stats"
+	"cube/task"
+)
+
+/**
+* Scheduler simulator
+* Replays a workload against a Scheduler on a synthetic cluster, placing tasks the
+* way the manager does: the scheduler filters, scores and picks a node, and the
+* task's requests are reserved on it. No worker is called, the nodes' stats come
+* from a StatsSource before each placement. Only the scheduler is simulated, the
+* manager's affinity, QoS and restart adjustments are left out. The Report tells
+* where tasks landed and why the others could not be placed, to compare the
+* built-in schedulers or validate a new one on the same scenario.
+ */
+
+// NodeSpec describes Count identical nodes, named Name-1, Name-2...
+type NodeSpec struct {
+	Name  string
+	Count int
+	Cores int
+	// Bytes of memory and disk, as workers report them
+	Memory       int64
+	Disk         int64
+	Gpus         int               `json:",omitempty"`
+	MaxTasks     int               `json:",omitempty"`
+	Labels       map[string]string `json:",omitempty"`
+	Capabilities []string          `json:",omitempty"`
+	// os/arch of the nodes, linux/amd64 when empty
+	Platform string `json:",omitempty"`
+}
+
+// TaskSpec describes Count tasks made from Task, named Task.Name-1, Task.Name-2...
+type TaskSpec struct {
+	Count int
+	// Placements after which each task finishes and frees its resources, zero
+	// keeps it running until the end
+	Lifetime int `json:",omitempty"`
+	Task     task.Task
+}
+
+// Scenario is a cluster and the workload submitted to it, in order
+type Scenario struct {
+	Nodes []NodeSpec
+	Tasks []TaskSpec
+}
+
+// Submission is a task submitted to the simulated cluster
+type Submission struct {
+	Task     task.Task
+	Lifetime int
+}
+
+// LoadScenario reads a scenario from a JSON file
+func LoadScenario(file string) (Scenario, error) {
+	var s Scenario
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("error parsing scenario %s: %v", file, err)
+	}
+	return s, s.Validate()
+}
+
+// DefaultScenario is a small mixed cluster, with a few nodes of each size, and a
+// workload of small services, memory heavy caches and short-lived batch jobs
+func DefaultScenario() Scenario {
+	const gib = 1 << 30
+	return Scenario{
+		Nodes: []NodeSpec{
+			{Name: "small", Count: 3, Cores: 2, Memory: 4 * gib, Disk: 50 * gib},
+			{Name: "medium", Count: 2, Cores: 4, Memory: 8 * gib, Disk: 100 * gib},
+			{Name: "large", Count: 1, Cores: 8, Memory: 32 * gib, Disk: 200 * gib},
+		},
+		Tasks: []TaskSpec{
+			{Count: 20, Task: task.Task{Name: "web", Image: "nginx", Cpu: 0.25, Memory: 256 << 20}},
+			{Count: 6, Task: task.Task{Name: "cache", Image: "redis", Cpu: 0.5, Memory: 2 * gib}},
+			{Count: 30, Lifetime: 10, Task: task.Task{Name: "batch", Image: "alpine", Kind: task.JobKind, Cpu: 1, Memory: 512 << 20}},
+		},
+	}
+}
+
+func (s Scenario) Validate() error {
+	if len(s.Nodes) == 0 {
+		return fmt.Errorf("scenario has no nodes")
+	}
+	for i, n := range s.Nodes {
+		if n.Name == "" || n.Count < 1 {
+			return fmt.Errorf("node spec %d: expected a name and a count of at least one", i)
+		}
+		if n.Cores < 0 || n.Memory < 0 || n.Disk < 0 || n.Gpus < 0 || n.MaxTasks < 0 {
+			return fmt.Errorf("node spec %s: capacities must be zero or more", n.Name)
+		}
+		if _, err := n.platform(); err != nil {
+			return fmt.Errorf("node spec %s: %v", n.Name, err)
+		}
+	}
+	for i, t := range s.Tasks {
+		if t.Task.Name == "" || t.Count < 1 {
+			return fmt.Errorf("task spec %d: expected a task name and a count of at least one", i)
+		}
+		if t.Lifetime < 0 {
+			return fmt.Errorf("task spec %s: lifetime must be zero or more", t.Task.Name)
+		}
+	}
+	return nil
+}
+
+func (n NodeSpec) platform() (task.Platform, error) {
+	if n.Platform == "" {
+		return task.Platform{OS: "linux", Architecture: "amd64"}, nil
+	}
+	return task.ParsePlatform(n.Platform)
+}
+
+// GenerateNodes returns new nodes for the scenario's node specs, with no task placed.
+// Their capacities are set from the stats an idle worker of the spec reports, as
+// the manager sets them.
+func (s Scenario) GenerateNodes() []*node.Node {
+	var nodes []*node.Node
+	for _, spec := range s.Nodes {
+		reported := spec.stats()
+		for i := 1; i <= spec.Count; i++ {
+			n := node.NewNode(fmt.Sprintf("%s-%d", spec.Name, i), "", "worker")
+			n.FetchStats = func() (*stats.Stats, http.Header, error) {
+				st := reported
+				return &st, http.Header{}, nil
+			}
+			if _, err := n.GetStats(); err != nil {
+				panic(fmt.Sprintf("simulator: stats of node %s: %v", n.Name, err))
+			}
+			n.FetchStats = nil
+			n.Labels = spec.Labels
+			n.Capabilities = spec.Capabilities
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// stats returns the stats of an idle node of the spec
+func (n NodeSpec) stats() stats.Stats {
+	platform, _ := n.platform()
+	return stats.Stats{
+		CpuCount:  n.Cores,
+		GpuCount:  n.Gpus,
+		MaxTasks:  n.MaxTasks,
+		OS:        platform.OS,
+		Arch:      platform.Architecture,
+		MemStats:  &mem.VirtualMemoryStat{Total: uint64(n.Memory), Available: uint64(n.Memory)},
+		DiskStats: &disk.UsageStat{Path: "/", Total: uint64(n.Disk), Free: uint64(n.Disk)},
+	}
+}
+
+// Workload returns the scenario's tasks in submission order, spec after spec
+func (s Scenario) Workload() []Submission {
+	var subs []Submission
+	for _, spec := range s.Tasks {
+		for i := 1; i <= spec.Count; i++ {
+			t := spec.Task
+			t.ID = uuid.New()
+			t.Name = fmt.Sprintf("%s-%d", spec.Task.Name, i)
+			t.State = task.Scheduled
+			subs = append(subs, Submission{Task: t, Lifetime: spec.Lifetime})
+		}
+	}
+	return subs
+}
+
+// Simulation places a workload on Nodes with Scheduler
+type Simulation struct {
+	// Name of the scheduler in the report
+	Name      string
+	Scheduler scheduler.Scheduler
+	Nodes     []*node.Node
+	// Fakes the stats of the nodes, AllocatedStats when nil
+	Stats StatsSource
+}
+
+type running struct {
+	task  task.Task
+	node  *node.Node
+	until int
+}
+
+// Run submits the workload in order, one placement per step, and reports where
+// the tasks were placed. The nodes keep the reservations of the tasks still
+// running at the end.
+func (s *Simulation) Run(workload []Submission) Report {
+	src := s.Stats
+	if src == nil {
+		src = AllocatedStats{}
+	}
+	r := newReport(s.Name, s.Nodes)
+	explainer, _ := s.Scheduler.(scheduler.Explainer)
+	var live []running
+	start := time.Now()
+
+	for step, sub := range workload {
+		// Tasks which ran their lifetime finish before the next placement
+		kept := live[:0]
+		for _, l := range live {
+			if l.until > 0 && l.until <= step {
+				release(l.node, l.task)
+				continue
+			}
+			kept = append(kept, l)
+		}
+		live = kept
+		for _, n := range s.Nodes {
+			n.Stats, n.CpuUsage = src.Sample(n, step)
+		}
+
+		t := sub.Task
+		r.Submitted++
+		candidates := s.Scheduler.SelectCandidateNodes(t, s.Nodes)
+		if len(candidates) == 0 {
+			f := Failure{Task: t.Name, Step: step, Reason: "no node passed the filters", Rejected: make(map[string]string)}
+			for _, n := range s.Nodes {
+				check, reason := "unknown", "rejected by the scheduler"
+				if explainer != nil {
+					if c, why := explainer.Filter(t, n); c != "" {
+						check, reason = c, why
+					}
+				}
+				f.Rejected[n.Name] = fmt.Sprintf("%s (%s filter)", reason, check)
+				r.Rejections[check]++
+			}
+			r.fail(f)
+			continue
+		}
+		picked := s.Scheduler.Pick(s.Scheduler.Score(t, candidates), candidates)
+		if picked == nil {
+			r.fail(Failure{Task: t.Name, Step: step, Reason: "no candidate could be scored"})
+			continue
+		}
+
+		reserve(picked, t)
+		until := 0
+		if sub.Lifetime > 0 {
+			until = step + sub.Lifetime
+		}
+		live = append(live, running{task: t, node: picked, until: until})
+		r.place(picked)
+	}
+	r.Duration = time.Since(start)
+	r.finish()
+	return r
+}
+
+// reserve and release account for a task's requests on a node, as the manager does
+func reserve(n *node.Node, t task.Task) {
+	n.CpuAllocated += t.Cpu
+	n.MemoryAllocated += t.Memory
+	n.DiskAllocated += t.Disk
+	n.GpusAllocated += t.GPUs()
+	n.TasksAllocated++
+	n.TaskCount++
+}
+
+func release(n *node.Node, t task.Task) {
+	n.CpuAllocated -= t.Cpu
+	n.MemoryAllocated -= t.Memory
+	n.DiskAllocated -= t.Disk
+	n.GpusAllocated -= t.GPUs()
+	n.TasksAllocated--
+	n.TaskCount--
+}
@@ -0,0 +1,129 @@
+package simulator
+
+import (
+	"testing"
+
+	"cube/scheduler"
+	"cube/task"
+)
+
+const gib = 1 << 30
+
+// testScenario fits the 8 small tasks on two of the four nodes, the big task on none
+func testScenario() Scenario {
+	return Scenario{
+		Nodes: []NodeSpec{
+			{Name: "node", Count: 4, Cores: 4, Memory: 8 * gib, Disk: 100 * gib},
+		},
+		Tasks: []TaskSpec{
+			{Count: 8, Task: task.Task{Name: "small", Image: "nginx", Cpu: 1, Memory: 1 * gib}},
+			{Count: 1, Task: task.Task{Name: "big", Image: "nginx", Cpu: 16, Memory: 1 * gib}},
+		},
+	}
+}
+
+// run simulates the scenario with the named built-in profile and a fixed seed
+func run(t *testing.T, profile string) Report {
+	t.Helper()
+	s := testScenario()
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	p, err := scheduler.NewProfile(profile, scheduler.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := Simulation{Name: profile, Scheduler: p, Nodes: s.GenerateNodes(), Stats: NewRandomStats(42, 0.1, 0.1)}
+	return sim.Run(s.Workload())
+}
+
+func TestGenerateNodesFromStats(t *testing.T) {
+	nodes := testScenario().GenerateNodes()
+	if len(nodes) != 4 {
+		t.Fatalf("generated %d nodes, want 4", len(nodes))
+	}
+	for _, n := range nodes {
+		if n.Memory != int64(n.Stats.MemTotal()) || n.Memory != 8*gib || n.Disk != 100*gib || n.Cores != 4 {
+			t.Errorf("%s has %d cores, %d bytes of memory and %d of disk, reported %d bytes of memory",
+				n.Name, n.Cores, n.Memory, n.Disk, n.Stats.MemTotal())
+		}
+		if n.OS != "linux" || n.Arch != "amd64" {
+			t.Errorf("%s runs %s/%s, want linux/amd64", n.Name, n.OS, n.Arch)
+		}
+	}
+}
+
+func placements(r Report) map[string]int {
+	placed := make(map[string]int)
+	for _, n := range r.Nodes {
+		placed[n.Name] = n.Placed
+	}
+	return placed
+}
+
+func TestBuiltinProfiles(t *testing.T) {
+	for _, profile := range scheduler.BuiltinProfiles() {
+		t.Run(profile, func(t *testing.T) {
+			r := run(t, profile)
+			if r.Scheduler != profile || r.Submitted != 9 {
+				t.Errorf("report of %s submitted %d tasks, want 9", r.Scheduler, r.Submitted)
+			}
+			if r.Placed+r.Failed != r.Submitted || len(r.Failures) != r.Failed {
+				t.Errorf("placed %d and failed %d (%d failures listed) of %d tasks", r.Placed, r.Failed, len(r.Failures), r.Submitted)
+			}
+		})
+	}
+}
+
+func TestRoundRobinSpreads(t *testing.T) {
+	r := run(t, "round-robin")
+	want := map[string]int{"node-1": 2, "node-2": 2, "node-3": 2, "node-4": 2}
+	for name, placed := range placements(r) {
+		if placed != want[name] {
+			t.Errorf("round-robin placed %d tasks on %s, want %d", placed, name, want[name])
+		}
+	}
+	if r.Imbalance != 0 {
+		t.Errorf("imbalance = %v, want 0", r.Imbalance)
+	}
+}
+
+func TestBinPackPacks(t *testing.T) {
+	r := run(t, "binpack")
+	want := map[string]int{"node-1": 4, "node-2": 4, "node-3": 0, "node-4": 0}
+	for name, placed := range placements(r) {
+		if placed != want[name] {
+			t.Errorf("binpack placed %d tasks on %s, want %d", placed, name, want[name])
+		}
+	}
+	for _, n := range r.Nodes[:2] {
+		if n.PeakCpu != 1 {
+			t.Errorf("peak CPU of %s = %v, want 1", n.Name, n.PeakCpu)
+		}
+	}
+	if rr := run(t, "round-robin"); r.Imbalance <= rr.Imbalance {
+		t.Errorf("binpack imbalance %v is not above round-robin's %v", r.Imbalance, rr.Imbalance)
+	}
+}
+
+func TestFailureReasons(t *testing.T) {
+	r := run(t, "round-robin")
+	if r.Placed != 8 || r.Failed != 1 {
+		t.Fatalf("placed %d and failed %d tasks, want 8 and 1", r.Placed, r.Failed)
+	}
+	f := r.Failures[0]
+	if f.Task != "big-1" || f.Step != 8 || f.Reason != "no node passed the filters" {
+		t.Errorf("failure = %s at step %d: %s", f.Task, f.Step, f.Reason)
+	}
+	if len(f.Rejected) != 4 {
+		t.Errorf("%d nodes rejected, want 4", len(f.Rejected))
+	}
+	for name, reason := range f.Rejected {
+		if want := "not enough free CPU for the task's request (cpu filter)"; reason != want {
+			t.Errorf("%s rejected with %q, want %q", name, reason, want)
+		}
+	}
+	if r.Rejections["cpu"] != 4 || len(r.Rejections) != 1 {
+		t.Errorf("rejections = %v, want cpu 4", r.Rejections)
+	}
+}
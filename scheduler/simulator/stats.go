@@ -0,0 +1,83 @@
+package simulator
+
+import (
+	"math/rand/v2"
+
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/shirou/gopsutil/v4/mem"
+
+	"cube/node"
+	"cube/stats"
+)
+
+// StatsSource fakes the stats simulated nodes report, sampled before every placement
+type StatsSource interface {
+	// Sample returns the stats of n at the given step and its CPU usage ratio
+	Sample(n *node.Node, step int) (stats.Stats, float64)
+}
+
+// AllocatedStats reports the resources reserved by the tasks placed on a node as
+// its usage, as if they used all they requested
+type AllocatedStats struct{}
+
+func (AllocatedStats) Sample(n *node.Node, step int) (stats.Stats, float64) {
+	return usage(n, ratio(n.CpuAllocated, float64(n.Cores)), n.MemoryAllocated, n.DiskAllocated)
+}
+
+// RandomStats adds a background usage to AllocatedStats, drawn on every sample up
+// to CpuUsage and MemoryUsage of the node's capacity, as left by processes other
+// than the tasks
+type RandomStats struct {
+	Rand        *rand.Rand
+	CpuUsage    float64
+	MemoryUsage float64
+}
+
+// NewRandomStats returns RandomStats drawing from seed, so runs can be repeated
+func NewRandomStats(seed uint64, cpuUsage float64, memoryUsage float64) *RandomStats {
+	return &RandomStats{Rand: rand.New(rand.NewPCG(seed, seed)), CpuUsage: cpuUsage, MemoryUsage: memoryUsage}
+}
+
+func (r *RandomStats) Sample(n *node.Node, step int) (stats.Stats, float64) {
+	cpuUsage := ratio(n.CpuAllocated, float64(n.Cores)) + r.Rand.Float64()*r.CpuUsage
+	memory := n.MemoryAllocated + int64(r.Rand.Float64()*r.MemoryUsage*float64(n.Memory))
+	return usage(n, cpuUsage, memory, n.DiskAllocated)
+}
+
+// usage builds the stats of n using the given CPU ratio, memory and disk bytes,
+// capped to its capacity
+func usage(n *node.Node, cpuUsage float64, memory int64, diskUsed int64) (stats.Stats, float64) {
+	cpuUsage = min(cpuUsage, 1)
+	memory = min(memory, n.Memory)
+	diskUsed = min(diskUsed, n.Disk)
+	s := stats.Stats{
+		CpuCount:  n.Cores,
+		GpuCount:  n.Gpus,
+		MaxTasks:  n.MaxTasks,
+		TaskCount: n.TaskCount,
+		CpuStats:  &cpu.TimesStat{CPU: "cpu-total", User: cpuUsage * 100, Idle: (1 - cpuUsage) * 100},
+		MemStats: &mem.VirtualMemoryStat{
+			Total:       uint64(n.Memory),
+			Used:        uint64(memory),
+			Available:   uint64(n.Memory - memory),
+			UsedPercent: ratio(float64(memory), float64(n.Memory)) * 100,
+		},
+		DiskStats: &disk.UsageStat{
+			Path:        "/",
+			Total:       uint64(n.Disk),
+			Used:        uint64(diskUsed),
+			Free:        uint64(n.Disk - diskUsed),
+			UsedPercent: ratio(float64(diskUsed), float64(n.Disk)) * 100,
+		},
+	}
+	return s, cpuUsage
+}
+
+// ratio returns used over capacity, zero for an unknown capacity
+func ratio(used float64, capacity float64) float64 {
+	if capacity <= 0 {
+		return 0
+	}
+	return used / capacity
+}
@@ -0,0 +1,49 @@
+package stats
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+/**
+* GPU detection
+* GPUs are counted once, with nvidia-smi when it is installed, otherwise from the
+* /dev/nvidia<N> device files the driver creates. Workers with GPUs advertise the
+* gpu capability.
+ */
+const nvidiaSmiTimeout = 5 * time.Second
+
+var gpuCount = sync.OnceValue(detectGpus)
+
+// GetGpuCount returns the number of GPUs on the host
+func GetGpuCount() int {
+	return gpuCount()
+}
+
+func detectGpus() int {
+	if path, err := exec.LookPath("nvidia-smi"); err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), nvidiaSmiTimeout)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, path, "-L").Output()
+		if err == nil {
+			n := 0
+			for _, line := range bytes.Split(out, []byte("\n")) {
+				if bytes.HasPrefix(line, []byte("GPU ")) {
+					n++
+				}
+			}
+			logger.Info("Detected GPUs with nvidia-smi", "count", n)
+			return n
+		}
+		logger.Warn("Error listing GPUs with nvidia-smi, counting device files", "error", err)
+	}
+	devices, _ := filepath.Glob("/dev/nvidia[0-9]*")
+	if len(devices) > 0 {
+		logger.Info("Detected GPU device files", "count", len(devices))
+	}
+	return len(devices)
+}
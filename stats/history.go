@@ -0,0 +1,91 @@
+package stats
+
+import (
+	"sync"
+	"time"
+)
+
+/**
+* Stats history
+* Workers keep their last host stats samples in a fixed size ring buffer, served
+* on /stats/history, so trends such as the CPU usage sustained over the last
+* minutes can be computed from two samples already taken instead of sampling the
+* node twice, seconds apart, when a task is scheduled.
+ */
+const DefaultHistorySize = 20
+
+type Sample struct {
+	Timestamp time.Time
+	Stats
+}
+
+type History struct {
+	mu      sync.RWMutex
+	samples []Sample
+	// Index the next sample is written at, the oldest sample once the buffer is full
+	next int
+	full bool
+}
+
+// NewHistory keeps the last size samples, at least one
+func NewHistory(size int) *History {
+	return &History{samples: make([]Sample, max(size, 1))}
+}
+
+// Add records s as the latest sample, overwriting the oldest one when the buffer is full
+func (h *History) Add(s Stats) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.samples[h.next] = Sample{Timestamp: time.Now().UTC(), Stats: s}
+	h.next = (h.next + 1) % len(h.samples)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Samples returns the last n samples oldest first, all of them when n is not positive
+func (h *History) Samples(n int) []Sample {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var samples []Sample
+	if h.full {
+		samples = append(samples, h.samples[h.next:]...)
+	}
+	samples = append(samples, h.samples[:h.next]...)
+	if n > 0 && n < len(samples) {
+		samples = samples[len(samples)-n:]
+	}
+	return samples
+}
+
+// CpuUsageOver returns the share of CPU time spent non-idle between the oldest and
+// the newest of samples, false when there are not two samples with CPU stats
+func CpuUsageOver(samples []Sample) (float64, bool) {
+	var first, last *Stats
+	for i := range samples {
+		if samples[i].CpuStats == nil {
+			continue
+		}
+		if first == nil {
+			first = &samples[i].Stats
+		}
+		last = &samples[i].Stats
+	}
+	if first == nil || first == last {
+		return 0, false
+	}
+	return CpuUsageBetween(first, last), true
+}
+
+// CpuUsageBetween returns the share of CPU time spent non-idle from the prev sample
+// to the cur one, which must both have CPU stats
+func CpuUsageBetween(prev *Stats, cur *Stats) float64 {
+	_, idle1, _, total1 := prev.CpuUsage()
+	_, idle2, _, total2 := cur.CpuUsage()
+	total := total2 - total1
+	idle := idle2 - idle1
+	if total <= 0 {
+		return 0
+	}
+	return (total - idle) / total
+}
@@ -1,7 +1,11 @@
 package stats
 
 import (
-	"log"
+	"runtime"
+	"time"
+
+	"cube/logging"
+	"cube/platform"
 
 	"github.com/shirou/gopsutil/v4/cpu"
 	"github.com/shirou/gopsutil/v4/disk"
@@ -9,16 +13,38 @@ import (
 	"github.com/shirou/gopsutil/v4/mem"
 )
 
+var logger = logging.For("stats")
+
 type Stats struct {
 	MemStats  *mem.VirtualMemoryStat
 	DiskStats *disk.UsageStat
 	CpuStats  *cpu.TimesStat
 	LoadStats *load.AvgStat
 	TaskCount int
+	// Logical CPUs and GPUs on the host
+	CpuCount int
+	GpuCount int `json:",omitempty"`
+	// OS and architecture of the host, in Go's GOOS and GOARCH terms as image platforms are
+	OS   string `json:",omitempty"`
+	Arch string `json:",omitempty"`
+	// Most tasks the worker runs at once, zero when it is unlimited
+	MaxTasks int `json:",omitempty"`
+	// Drain status of the worker, see node.DrainRequest
+	Drained bool `json:",omitempty"`
+	Evict   bool `json:",omitempty"`
+	// Workload of the worker: queued tasks, tasks by state and running containers
+	QueueLength       int
+	TasksByState      map[string]int `json:",omitempty"`
+	RunningContainers int
+	// How long the container of the last started task took to start
+	LastStartLatency time.Duration
+	// Why the container runtime could not be reached, empty when it answered
+	RuntimeError string `json:",omitempty"`
 }
 
 // Stats Helper
-func (s *Stats) MemUsedKb() uint64 {
+// Memory and disk sizes are in bytes, as gopsutil reports them and as tasks request them
+func (s *Stats) MemUsed() uint64 {
 	return s.MemStats.Used
 }
 
@@ -26,11 +52,11 @@ func (s *Stats) MemUsedPercent() uint64 {
 	return uint64(s.MemStats.UsedPercent)
 }
 
-func (s *Stats) MemAvailableKb() uint64 {
+func (s *Stats) MemAvailable() uint64 {
 	return s.MemStats.Available
 }
 
-func (s *Stats) MemTotalKb() uint64 {
+func (s *Stats) MemTotal() uint64 {
 	return s.MemStats.Total
 }
 
@@ -67,6 +93,10 @@ func GetStats() *Stats {
 		DiskStats: GetDiskInfo(),
 		CpuStats:  GetCpuStats(),
 		LoadStats: GetLoadAvg(),
+		CpuCount:  GetCpuCount(),
+		GpuCount:  GetGpuCount(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
 	}
 }
 
@@ -82,7 +112,7 @@ func GetStats() *Stats {
 func GetMemoryInfo() *mem.VirtualMemoryStat {
 	mem_stats, err := mem.VirtualMemory()
 	if err != nil {
-		log.Printf("Error reading from /proc/meminfo")
+		logger.Error("Error reading from /proc/meminfo", "error", err)
 		return &mem.VirtualMemoryStat{}
 	}
 
@@ -90,9 +120,9 @@ func GetMemoryInfo() *mem.VirtualMemoryStat {
 }
 
 func GetDiskInfo() *disk.UsageStat {
-	disk_stats, err := disk.Usage("/")
+	disk_stats, err := disk.Usage(platform.DiskRoot())
 	if err != nil {
-		log.Printf("Error reading from /")
+		logger.Error("Error reading disk usage", "path", platform.DiskRoot(), "error", err)
 		return &disk.UsageStat{}
 	}
 
@@ -102,17 +132,29 @@ func GetDiskInfo() *disk.UsageStat {
 func GetCpuStats() *cpu.TimesStat {
 	stats, err := cpu.Times(false)
 	if err != nil {
-		log.Printf("Error reading from /proc/stat")
+		logger.Error("Error reading from /proc/stat", "error", err)
 		return &cpu.TimesStat{}
 	}
 
 	return &stats[0]
 }
 
+func GetCpuCount() int {
+	count, err := cpu.Counts(true)
+	if err != nil {
+		logger.Error("Error counting CPUs", "error", err)
+		return 0
+	}
+	return count
+}
+
 func GetLoadAvg() *load.AvgStat {
+	if !platform.LoadAvgSupported() {
+		return &load.AvgStat{}
+	}
 	load_avg, err := load.Avg()
 	if err != nil {
-		log.Printf("Error reading from /proc/loadavg")
+		logger.Error("Error reading from /proc/loadavg", "error", err)
 		return &load.AvgStat{}
 	}
 
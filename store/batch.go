@@ -0,0 +1,280 @@
+package store
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/boltdb/bolt"
+
+	"cube/task"
+)
+
+/**
+* Batches, updates and iteration
+* Batch applies a set of puts and deletes atomically, Update performs an atomic
+* read-modify-write of a single key, and ForEach iterates over a consistent snapshot
+* of the store in key order. The persistent stores run each in one BoltDB transaction.
+ */
+
+// Op is a single put or delete applied by Batch
+type Op struct {
+	Key    string
+	Value  interface{}
+	Delete bool
+}
+
+func PutOp(key string, value interface{}) Op {
+	return Op{Key: key, Value: value}
+}
+
+func DeleteOp(key string) Op {
+	return Op{Key: key, Delete: true}
+}
+
+// UpdateFunc receives a copy of the current value and returns the value to store
+type UpdateFunc func(value interface{}) (interface{}, error)
+
+// In memory stores
+
+func (i *InMemoryTaskStore) Delete(key string) error {
+	return memDelete(&i.mu, i.Db, key, i.index)
+}
+
+func (i *InMemoryTaskStore) Batch(ops []Op) error {
+	return memBatch(&i.mu, i.Db, ops, i.index)
+}
+
+func (i *InMemoryTaskStore) Update(key string, fn UpdateFunc) error {
+	return memUpdate(&i.mu, i.Db, key, fn, i.index)
+}
+
+func (i *InMemoryTaskStore) ForEach(fn func(key string, value interface{}) error) error {
+	return memForEach(&i.mu, i.Db, fn)
+}
+
+func (i *InMemoryTaskEventStore) Delete(key string) error {
+	return memDelete(&i.mu, i.Db, key, nil)
+}
+
+func (i *InMemoryTaskEventStore) Batch(ops []Op) error {
+	return memBatch(&i.mu, i.Db, ops, nil)
+}
+
+func (i *InMemoryTaskEventStore) Update(key string, fn UpdateFunc) error {
+	return memUpdate(&i.mu, i.Db, key, fn, nil)
+}
+
+func (i *InMemoryTaskEventStore) ForEach(fn func(key string, value interface{}) error) error {
+	return memForEach(&i.mu, i.Db, fn)
+}
+
+// memIndex is told of every write to a key with the store locked, value nil when it is deleted
+type memIndex[T any] func(key string, value *T)
+
+func memDelete[T any](mu *sync.RWMutex, db map[string]*T, key string, index memIndex[T]) error {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(db, key)
+	if index != nil {
+		index(key, nil)
+	}
+	return nil
+}
+
+func memBatch[T any](mu *sync.RWMutex, db map[string]*T, ops []Op, index memIndex[T]) error {
+	// Check every value first, so a bad op leaves the store untouched
+	for _, op := range ops {
+		if _, ok := op.Value.(*T); !ok && !op.Delete {
+			return fmt.Errorf("value %v for key %s is not a %T", op.Value, op.Key, *new(T))
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, op := range ops {
+		var value *T
+		if op.Delete {
+			delete(db, op.Key)
+		} else {
+			value = op.Value.(*T)
+			db[op.Key] = value
+		}
+		if index != nil {
+			index(op.Key, value)
+		}
+	}
+	return nil
+}
+
+func memUpdate[T any](mu *sync.RWMutex, db map[string]*T, key string, fn UpdateFunc, index memIndex[T]) error {
+	mu.Lock()
+	defer mu.Unlock()
+	current, ok := db[key]
+	if !ok {
+		return fmt.Errorf("key %s does not exist", key)
+	}
+	c := *current
+	next, err := fn(&c)
+	if err != nil {
+		return err
+	}
+	v, ok := next.(*T)
+	if !ok {
+		return fmt.Errorf("value %v for key %s is not a %T", next, key, c)
+	}
+	db[key] = v
+	if index != nil {
+		index(key, v)
+	}
+	return nil
+}
+
+func memForEach[T any](mu *sync.RWMutex, db map[string]*T, fn func(key string, value interface{}) error) error {
+	mu.RLock()
+	snapshot := maps.Clone(db)
+	mu.RUnlock()
+	for _, k := range slices.Sorted(maps.Keys(snapshot)) {
+		if err := fn(k, snapshot[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Persistent stores
+
+func (t *TaskStore) Delete(key string) error {
+	return boltDelete(t.Db, t.Bucket, key, t.index)
+}
+
+func (t *TaskStore) Batch(ops []Op) error {
+	return boltBatch(t.Db, t.Bucket, ops, t.index)
+}
+
+func (t *TaskStore) Update(key string, fn UpdateFunc) error {
+	return boltUpdate[task.Task](t.Db, t.Bucket, key, fn, t.index)
+}
+
+func (t *TaskStore) ForEach(fn func(key string, value interface{}) error) error {
+	return boltForEach[task.Task](t.Db, t.Bucket, fn)
+}
+
+func (e *TaskEventStore) Delete(key string) error {
+	return boltDelete(e.Db, e.Bucket, key, nil)
+}
+
+func (e *TaskEventStore) Batch(ops []Op) error {
+	return boltBatch(e.Db, e.Bucket, ops, nil)
+}
+
+func (e *TaskEventStore) Update(key string, fn UpdateFunc) error {
+	return boltUpdate[task.TaskEvent](e.Db, e.Bucket, key, fn, nil)
+}
+
+func (e *TaskEventStore) ForEach(fn func(key string, value interface{}) error) error {
+	return boltForEach[task.TaskEvent](e.Db, e.Bucket, fn)
+}
+
+// boltIndex is told of every write to a key within its transaction, value nil when it is deleted
+type boltIndex func(tx *bolt.Tx, key string, value interface{}) error
+
+func boltDelete(db *bolt.DB, bucket string, key string, index boltIndex) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket([]byte(bucket)).Delete([]byte(key)); err != nil {
+			return err
+		}
+		if index != nil {
+			return index(tx, key, nil)
+		}
+		return nil
+	})
+}
+
+func boltBatch(db *bolt.DB, bucket string, ops []Op, index boltIndex) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		for _, op := range ops {
+			if op.Delete {
+				if err := b.Delete([]byte(op.Key)); err != nil {
+					return err
+				}
+				if index != nil {
+					if err := index(tx, op.Key, nil); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			buf, err := encode(bucket, op.Key, op.Value)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(op.Key), buf); err != nil {
+				return err
+			}
+			if index != nil {
+				if err := index(tx, op.Key, op.Value); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func boltUpdate[T any](db *bolt.DB, bucket string, key string, fn UpdateFunc, index boltIndex) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		v := b.Get([]byte(key))
+		if v == nil {
+			return fmt.Errorf("key %s does not exist", key)
+		}
+		var current T
+		if err := decode(bucket, key, v, &current); err != nil {
+			return err
+		}
+		next, err := fn(&current)
+		if err != nil {
+			return err
+		}
+		buf, err := encode(bucket, key, next)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(key), buf); err != nil {
+			return err
+		}
+		if index != nil {
+			return index(tx, key, next)
+		}
+		return nil
+	})
+}
+
+// boltForEach decodes a snapshot inside a read transaction and calls fn outside it,
+// so fn may write to the store
+func boltForEach[T any](db *bolt.DB, bucket string, fn func(key string, value interface{}) error) error {
+	var keys []string
+	var values []*T
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).ForEach(func(k, v []byte) error {
+			var value T
+			if err := decode(bucket, string(k), v, &value); err != nil {
+				return err
+			}
+			keys = append(keys, string(k))
+			values = append(values, &value)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	for i, k := range keys {
+		if err := fn(k, values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
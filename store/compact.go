@@ -0,0 +1,89 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+/**
+* Compaction
+* BoltDB never shrinks its file, pages freed by deleted tasks and events are only
+* reused. Compact copies every bucket into a fresh file and replaces the store with
+* it. The store must not be open, Compact fails when another process holds it.
+ */
+const compactLockTimeout = time.Second
+
+// CompactResult reports the size of a store before and after compaction
+type CompactResult struct {
+	File   string
+	Before int64
+	After  int64
+}
+
+// Compact rewrites the store at path to reclaim unused space
+func Compact(path string) (CompactResult, error) {
+	result := CompactResult{File: path}
+	info, err := os.Stat(path)
+	if err != nil {
+		return result, err
+	}
+	result.Before = info.Size()
+
+	src, err := bolt.Open(path, info.Mode(), &bolt.Options{Timeout: compactLockTimeout, ReadOnly: true})
+	if err != nil {
+		return result, fmt.Errorf("unable to open %v, is it in use? %v", path, err)
+	}
+	defer src.Close()
+
+	tmp := path + ".compact"
+	os.Remove(tmp)
+	dst, err := bolt.Open(tmp, info.Mode(), nil)
+	if err != nil {
+		return result, fmt.Errorf("unable to create %v: %v", tmp, err)
+	}
+	if err := copyBuckets(src, dst); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return result, err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return result, err
+	}
+	src.Close()
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return result, err
+	}
+	if info, err := os.Stat(path); err == nil {
+		result.After = info.Size()
+	}
+	return result, nil
+}
+
+// copyBuckets copies the top level buckets of src to dst. Values are copied as
+// stored, encrypted or not.
+func copyBuckets(src *bolt.DB, dst *bolt.DB) error {
+	return src.View(func(stx *bolt.Tx) error {
+		return dst.Update(func(dtx *bolt.Tx) error {
+			return stx.ForEach(func(name []byte, sb *bolt.Bucket) error {
+				db, err := dtx.CreateBucketIfNotExists(name)
+				if err != nil {
+					return err
+				}
+				// Keys are inserted in order, so pages can be filled completely
+				db.FillPercent = 1.0
+				return sb.ForEach(func(k, v []byte) error {
+					if v == nil {
+						return fmt.Errorf("nested bucket %s/%s is not supported", name, k)
+					}
+					return db.Put(k, v)
+				})
+			})
+		})
+	})
+}
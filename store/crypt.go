@@ -0,0 +1,111 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+/**
+* At-rest encryption
+* With a key configured, the persistent stores seal every value with AES-256-GCM,
+* bound to its bucket and key so values cannot be swapped between records. Values
+* written without a key stay readable, so existing stores are encrypted as their
+* records are rewritten. The key is 32 bytes, base64 encoded, e.g.
+*   head -c 32 /dev/urandom | base64
+ */
+const KeyEnv = "CUBE_STORE_KEY"
+
+// Encrypted values start with this byte, plain values are JSON objects
+const sealedVersion = 0x01
+
+var aead atomic.Pointer[cipher.AEAD]
+
+var errNoKey = errors.New("value is encrypted, but no store encryption key is configured")
+
+// ConfigureEncryption loads the store encryption key from keyFile or, when it is
+// empty, from the CUBE_STORE_KEY environment variable. Without either, values are
+// stored unencrypted. Stores opened afterwards use the key.
+func ConfigureEncryption(keyFile string) (bool, error) {
+	encoded := os.Getenv(KeyEnv)
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return false, fmt.Errorf("unable to read store key: %v", err)
+		}
+		encoded = string(data)
+	}
+	encoded = strings.TrimSpace(encoded)
+	if encoded == "" {
+		aead.Store(nil)
+		return false, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return false, fmt.Errorf("store key is not valid base64: %v", err)
+	}
+	if len(key) != 32 {
+		return false, fmt.Errorf("store key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return false, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return false, err
+	}
+	aead.Store(&gcm)
+	return true, nil
+}
+
+// encode marshals a value for bucket and key, sealing it when a key is configured
+func encode(bucket string, key string, value interface{}) ([]byte, error) {
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	gcm := aead.Load()
+	if gcm == nil {
+		return buf, nil
+	}
+
+	nonce := make([]byte, (*gcm).NonceSize(), 1+(*gcm).NonceSize()+len(buf)+(*gcm).Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := append([]byte{sealedVersion}, nonce...)
+	return (*gcm).Seal(sealed, nonce, buf, additionalData(bucket, key)), nil
+}
+
+// decode unmarshals a value read from bucket and key, opening it when it is sealed
+func decode(bucket string, key string, data []byte, value interface{}) error {
+	if len(data) > 0 && data[0] == sealedVersion {
+		gcm := aead.Load()
+		if gcm == nil {
+			return errNoKey
+		}
+		size := (*gcm).NonceSize()
+		if len(data) < 1+size {
+			return fmt.Errorf("value of %s is truncated", key)
+		}
+		plain, err := (*gcm).Open(nil, data[1:1+size], data[1+size:], additionalData(bucket, key))
+		if err != nil {
+			return fmt.Errorf("unable to decrypt value of %s: %v", key, err)
+		}
+		data = plain
+	}
+	return json.Unmarshal(data, value)
+}
+
+func additionalData(bucket string, key string) []byte {
+	return []byte(bucket + "/" + key)
+}
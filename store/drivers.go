@@ -0,0 +1,8 @@
+package store
+
+import (
+	// Registers the "pgx" driver for Postgres
+	_ "github.com/jackc/pgx/v5/stdlib"
+	// Registers the "sqlite3" driver, which requires a build with cgo enabled
+	_ "github.com/mattn/go-sqlite3"
+)
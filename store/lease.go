@@ -0,0 +1,217 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+/**
+* Leader lease
+* Managers sharing a data directory elect a leader through a lease kept in a small
+* BoltDB file next to the stores. The file is only opened for the duration of each
+* call, so every manager can take its turn; BoltDB's file lock serializes them.
+* Managers sharing a Postgres database keep the lease in a row of it instead.
+* The lease is held until it expires unless its holder renews it.
+ */
+const (
+	leaseBucket      = "lease"
+	leaseKey         = "leader"
+	leaseLockTimeout = time.Second
+)
+
+// ErrLeaseHeld is returned when another holder owns an unexpired lease
+var ErrLeaseHeld = errors.New("lease is held by another manager")
+
+// errNotHolder leaves the SQL lease untouched when it is released by another holder
+var errNotHolder = errors.New("lease is not held by this manager")
+
+// LeaseRecord is the current holder of a lease
+type LeaseRecord struct {
+	Holder  string
+	Address string
+	Expires time.Time
+}
+
+// Expired reports whether the lease can be taken over at now
+func (r LeaseRecord) Expired(now time.Time) bool {
+	return r.Holder == "" || !now.Before(r.Expires)
+}
+
+// LeaseStore is implemented by the BoltDB and the SQL lease
+type LeaseStore interface {
+	// Acquire takes or renews the lease for holder until now+ttl, failing with
+	// ErrLeaseHeld while another holder's lease has not expired. It returns the
+	// lease as it is after the call.
+	Acquire(holder string, address string, ttl time.Duration) (LeaseRecord, error)
+	// Release gives the lease up if holder owns it
+	Release(holder string) error
+	// Get returns the current holder of the lease, a zero record when nobody holds it
+	Get() (LeaseRecord, error)
+}
+
+type Lease struct {
+	DbFile   string
+	FileMode os.FileMode
+}
+
+func NewLease(file string, mode os.FileMode) *Lease {
+	return &Lease{DbFile: file, FileMode: mode}
+}
+
+func (l *Lease) open() (*bolt.DB, error) {
+	db, err := bolt.Open(l.DbFile, l.FileMode, &bolt.Options{Timeout: leaseLockTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %v: %v", l.DbFile, err)
+	}
+	return db, nil
+}
+
+// Acquire takes or renews the lease for holder until now+ttl, failing with
+// ErrLeaseHeld while another holder's lease has not expired. It returns the
+// lease as it is after the call.
+func (l *Lease) Acquire(holder string, address string, ttl time.Duration) (LeaseRecord, error) {
+	db, err := l.open()
+	if err != nil {
+		return LeaseRecord{}, err
+	}
+	defer db.Close()
+
+	var current LeaseRecord
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(leaseBucket))
+		if err != nil {
+			return err
+		}
+		if v := b.Get([]byte(leaseKey)); v != nil {
+			if err := decode(leaseBucket, leaseKey, v, &current); err != nil {
+				return err
+			}
+		}
+		now := time.Now().UTC()
+		if current.Holder != holder && !current.Expired(now) {
+			return ErrLeaseHeld
+		}
+		current = LeaseRecord{Holder: holder, Address: address, Expires: now.Add(ttl)}
+		buf, err := encode(leaseBucket, leaseKey, &current)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(leaseKey), buf)
+	})
+	return current, err
+}
+
+// Release gives the lease up if holder owns it, so another manager can take over
+// without waiting for it to expire
+func (l *Lease) Release(holder string) error {
+	db, err := l.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(leaseBucket))
+		if b == nil {
+			return nil
+		}
+		v := b.Get([]byte(leaseKey))
+		if v == nil {
+			return nil
+		}
+		var current LeaseRecord
+		if err := decode(leaseBucket, leaseKey, v, &current); err != nil {
+			return err
+		}
+		if current.Holder != holder {
+			return nil
+		}
+		return b.Delete([]byte(leaseKey))
+	})
+}
+
+// Get returns the current holder of the lease, a zero record when nobody holds it
+func (l *Lease) Get() (LeaseRecord, error) {
+	db, err := l.open()
+	if err != nil {
+		return LeaseRecord{}, err
+	}
+	defer db.Close()
+
+	var current LeaseRecord
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(leaseBucket))
+		if b == nil {
+			return nil
+		}
+		v := b.Get([]byte(leaseKey))
+		if v == nil {
+			return nil
+		}
+		return decode(leaseBucket, leaseKey, v, &current)
+	})
+	return current, err
+}
+
+// SQLLease keeps the lease in the cube_lease table, its row locked while it is acquired
+type SQLLease struct {
+	Db *SQLStore[LeaseRecord]
+}
+
+// NewSQLLease creates the lease's row, unheld, unless another manager already did
+func NewSQLLease(db *sql.DB, dbType string) (*SQLLease, error) {
+	s, err := NewSQLStore[LeaseRecord](db, dbType, leaseBucket)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := encode(leaseBucket, leaseKey, &LeaseRecord{})
+	if err != nil {
+		return nil, err
+	}
+	// Acquire only ever updates the row, so two managers cannot both insert it
+	_, err = db.Exec(s.query("INSERT INTO {table} (id, data) VALUES (?, ?) ON CONFLICT (id) DO NOTHING"), leaseKey, buf)
+	if err != nil {
+		return nil, fmt.Errorf("create lease: %v", err)
+	}
+	return &SQLLease{Db: s}, nil
+}
+
+func (l *SQLLease) Acquire(holder string, address string, ttl time.Duration) (LeaseRecord, error) {
+	var current LeaseRecord
+	err := l.Db.Update(leaseKey, func(value interface{}) (interface{}, error) {
+		current = *value.(*LeaseRecord)
+		now := time.Now().UTC()
+		if current.Holder != holder && !current.Expired(now) {
+			return nil, ErrLeaseHeld
+		}
+		current = LeaseRecord{Holder: holder, Address: address, Expires: now.Add(ttl)}
+		return &current, nil
+	})
+	return current, err
+}
+
+func (l *SQLLease) Release(holder string) error {
+	err := l.Db.Update(leaseKey, func(value interface{}) (interface{}, error) {
+		if value.(*LeaseRecord).Holder != holder {
+			return nil, errNotHolder
+		}
+		return &LeaseRecord{}, nil
+	})
+	if errors.Is(err, errNotHolder) {
+		return nil
+	}
+	return err
+}
+
+func (l *SQLLease) Get() (LeaseRecord, error) {
+	v, err := l.Db.Get(leaseKey)
+	if err != nil {
+		return LeaseRecord{}, err
+	}
+	return *v.(*LeaseRecord), nil
+}
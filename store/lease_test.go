@@ -0,0 +1,72 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLease(t *testing.T) {
+	leases := map[string]func(t *testing.T) LeaseStore{
+		"bolt": func(t *testing.T) LeaseStore {
+			return NewLease(filepath.Join(t.TempDir(), "leader.lease"), 0600)
+		},
+		"sql": func(t *testing.T) LeaseStore {
+			s := openSQLite(t)
+			lease, err := NewSQLLease(s.Db, SQLite)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// A second manager opening the lease finds it as it is
+			if _, err := NewSQLLease(s.Db, SQLite); err != nil {
+				t.Fatal(err)
+			}
+			return lease
+		},
+	}
+	for name, open := range leases {
+		t.Run(name, func(t *testing.T) {
+			lease := open(t)
+			if rec, err := lease.Get(); err != nil || rec.Holder != "" {
+				t.Fatalf("Get() = %+v, %v, want the lease unheld", rec, err)
+			}
+
+			rec, err := lease.Acquire("manager-1", "manager-1:5555", time.Minute)
+			if err != nil || rec.Holder != "manager-1" || rec.Address != "manager-1:5555" {
+				t.Fatalf("Acquire() = %+v, %v, want it held by manager-1", rec, err)
+			}
+			rec, err = lease.Acquire("manager-2", "manager-2:5555", time.Minute)
+			if !errors.Is(err, ErrLeaseHeld) || rec.Holder != "manager-1" {
+				t.Errorf("Acquire() by manager-2 = %+v, %v, want ErrLeaseHeld by manager-1", rec, err)
+			}
+			// The holder renews its lease
+			renewed, err := lease.Acquire("manager-1", "manager-1:5555", 2*time.Minute)
+			if err != nil || !renewed.Expires.After(rec.Expires) {
+				t.Errorf("renewed lease expires at %v, %v, want after %v", renewed.Expires, err, rec.Expires)
+			}
+
+			// Only the holder releases the lease
+			if err := lease.Release("manager-2"); err != nil {
+				t.Fatal(err)
+			}
+			if rec, _ := lease.Get(); rec.Holder != "manager-1" {
+				t.Errorf("lease held by %q after manager-2 released it, want manager-1", rec.Holder)
+			}
+			if err := lease.Release("manager-1"); err != nil {
+				t.Fatal(err)
+			}
+			if rec, err := lease.Acquire("manager-2", "manager-2:5555", time.Minute); err != nil || rec.Holder != "manager-2" {
+				t.Errorf("Acquire() after release = %+v, %v, want it held by manager-2", rec, err)
+			}
+
+			// An expired lease is taken over
+			if _, err := lease.Acquire("manager-2", "manager-2:5555", -time.Second); err != nil {
+				t.Fatal(err)
+			}
+			if rec, err := lease.Acquire("manager-3", "manager-3:5555", time.Minute); err != nil || rec.Holder != "manager-3" {
+				t.Errorf("Acquire() of an expired lease = %+v, %v, want it held by manager-3", rec, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	"github.com/boltdb/bolt"
+)
+
+/**
+* Object stores
+* The manager keeps its services and cron jobs next to its tasks, so a manager
+* taking over from another one, or restarting, finds them again. Unlike the task
+* and event stores they only need to be saved and loaded as a whole. They are
+* kept in a BoltDB file, or in the SQL database of the task store.
+ */
+type ObjectStore[T any] struct {
+	Db       *bolt.DB
+	DbFile   string
+	FileMode os.FileMode
+	Bucket   string
+	// Set instead of Db when the values are kept in a SQL database
+	SQL *SQLStore[T]
+}
+
+func NewObjectStore[T any](file string, mode os.FileMode, bucket string) (*ObjectStore[T], error) {
+	db, err := bolt.Open(file, mode, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %v", file)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create bucket %s: %s", bucket, err)
+	}
+	return &ObjectStore[T]{Db: db, DbFile: file, FileMode: mode, Bucket: bucket}, nil
+}
+
+// NewSQLObjectStore keeps the values in the cube_<bucket> table of db, which may be shared with other stores
+func NewSQLObjectStore[T any](db *sql.DB, dbType string, bucket string) (*ObjectStore[T], error) {
+	s, err := NewSQLStore[T](db, dbType, bucket)
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectStore[T]{Bucket: bucket, SQL: s}, nil
+}
+
+func (s *ObjectStore[T]) Close() {
+	if s.SQL != nil {
+		s.SQL.Close()
+		return
+	}
+	s.Db.Close()
+}
+
+func (s *ObjectStore[T]) Put(key string, value *T) error {
+	if s.SQL != nil {
+		return s.SQL.Put(key, value)
+	}
+	return s.Db.Update(func(tx *bolt.Tx) error {
+		buf, err := encode(s.Bucket, key, value)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(s.Bucket)).Put([]byte(key), buf)
+	})
+}
+
+// Get returns the value stored at key, for stores too large to be loaded whole
+func (s *ObjectStore[T]) Get(key string) (*T, error) {
+	if s.SQL != nil {
+		v, err := s.SQL.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		return v.(*T), nil
+	}
+	var value T
+	err := s.Db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(s.Bucket)).Get([]byte(key))
+		if v == nil {
+			return fmt.Errorf("%s %v not found", s.Bucket, key)
+		}
+		return decode(s.Bucket, key, v, &value)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+func (s *ObjectStore[T]) Delete(key string) error {
+	if s.SQL != nil {
+		return s.SQL.Delete(key)
+	}
+	return s.Db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(s.Bucket)).Delete([]byte(key))
+	})
+}
+
+func (s *ObjectStore[T]) List() ([]*T, error) {
+	if s.SQL != nil {
+		_, values, err := s.SQL.rows()
+		return values, err
+	}
+	var values []*T
+	err := s.Db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(s.Bucket)).ForEach(func(k, v []byte) error {
+			var value T
+			if err := decode(s.Bucket, string(k), v, &value); err != nil {
+				return err
+			}
+			values = append(values, &value)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// ForEach calls fn with every stored value and its key
+func (s *ObjectStore[T]) ForEach(fn func(key string, value *T) error) error {
+	if s.SQL != nil {
+		return s.SQL.ForEach(func(key string, value interface{}) error {
+			return fn(key, value.(*T))
+		})
+	}
+	return s.Db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(s.Bucket)).ForEach(func(k, v []byte) error {
+			var value T
+			if err := decode(s.Bucket, string(k), v, &value); err != nil {
+				return err
+			}
+			return fn(string(k), &value)
+		})
+	})
+}
@@ -0,0 +1,308 @@
+package store
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/boltdb/bolt"
+
+	"cube/task"
+)
+
+/**
+* Task queries
+* The task list endpoints filter tasks by state, image, labels and namespace, sort them and
+* return a page of them, e.g. ?state=running&image=nginx&label=app%3Dweb&sort=-startTime&limit=50.
+* Both task stores index the keys of their tasks by state, so a state filter only
+* reads the matching tasks: the in memory store next to its tasks, the persistent
+* store in a "<bucket>_index" bucket, built on open for stores written without it.
+ */
+const MaxTaskQueryLimit = 1000
+
+// Keys tasks can be sorted by, prefixed with "-" for descending order
+var TaskSortKeys = []string{"name", "state", "image", "priority", "startTime", "finishTime"}
+
+type TaskQuery struct {
+	// Tasks in any of the states, all of them when empty
+	States []task.State
+	// Tasks of the image, with any tag or digest when it has neither
+	Image string
+	// Tasks whose labels match the selector, see task.ParseSelector
+	Selector task.Selector
+	// Tasks of the namespace, see task.NamespaceOf
+	Namespace string
+	// One of TaskSortKeys, tasks are in ID order when empty
+	Sort string
+	// Page of the matching tasks, all of them when Limit is zero
+	Limit  int
+	Offset int
+}
+
+// TaskQuerier is implemented by the task stores
+type TaskQuerier interface {
+	// QueryTasks returns the page of tasks matching q and the number of matching tasks
+	QueryTasks(q TaskQuery) ([]*task.Task, int, error)
+}
+
+// ParseTaskQuery reads a query from the state, image, label, namespace, sort, limit and
+// offset parameters. States are comma separated and case insensitive, label parameters
+// are selectors such as app=web,tier!=db that must all match.
+func ParseTaskQuery(v url.Values) (TaskQuery, error) {
+	q := TaskQuery{Image: v.Get("image"), Namespace: v.Get("namespace"), Sort: v.Get("sort")}
+	for _, param := range v["state"] {
+		for _, name := range strings.Split(param, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			s, err := task.ParseState(name)
+			if err != nil {
+				return q, err
+			}
+			if !slices.Contains(q.States, s) {
+				q.States = append(q.States, s)
+			}
+		}
+	}
+	for _, param := range v["label"] {
+		sel, err := task.ParseSelector(param)
+		if err != nil {
+			return q, err
+		}
+		q.Selector = append(q.Selector, sel...)
+	}
+	if q.Sort != "" && !slices.Contains(TaskSortKeys, strings.TrimPrefix(q.Sort, "-")) {
+		return q, fmt.Errorf("unknown sort key %q, expected one of %v", q.Sort, TaskSortKeys)
+	}
+	var err error
+	if q.Limit, err = queryInt(v, "limit"); err != nil {
+		return q, err
+	}
+	if q.Limit > MaxTaskQueryLimit {
+		return q, fmt.Errorf("limit must be at most %d, got %d", MaxTaskQueryLimit, q.Limit)
+	}
+	if q.Offset, err = queryInt(v, "offset"); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+func queryInt(v url.Values, name string) (int, error) {
+	s := v.Get(name)
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer, got %q", name, s)
+	}
+	return n, nil
+}
+
+// QueryTasks answers q from s, filtering every task of stores without an index
+func QueryTasks(s Store, q TaskQuery) ([]*task.Task, int, error) {
+	if tq, ok := s.(TaskQuerier); ok {
+		return tq.QueryTasks(q)
+	}
+	res, err := s.List()
+	if err != nil {
+		return nil, 0, err
+	}
+	tasks, _ := res.([]*task.Task)
+	tasks, total := q.Apply(tasks)
+	return tasks, total, nil
+}
+
+// Matches reports whether t passes the query's filters
+func (q TaskQuery) Matches(t *task.Task) bool {
+	if len(q.States) > 0 && !slices.Contains(q.States, t.State) {
+		return false
+	}
+	if q.Image != "" && t.Image != q.Image &&
+		!strings.HasPrefix(t.Image, q.Image+":") && !strings.HasPrefix(t.Image, q.Image+"@") {
+		return false
+	}
+	if q.Namespace != "" && task.NamespaceOf(*t) != q.Namespace {
+		return false
+	}
+	return q.Selector.Matches(t.Labels)
+}
+
+// Apply filters, sorts and pages tasks, returning the page and the number of matching tasks
+func (q TaskQuery) Apply(tasks []*task.Task) ([]*task.Task, int) {
+	matching := make([]*task.Task, 0, len(tasks))
+	for _, t := range tasks {
+		if q.Matches(t) {
+			matching = append(matching, t)
+		}
+	}
+
+	key, desc := strings.CutPrefix(q.Sort, "-")
+	slices.SortFunc(matching, func(a, b *task.Task) int {
+		c := 0
+		switch key {
+		case "name":
+			c = cmp.Compare(a.Name, b.Name)
+		case "state":
+			c = cmp.Compare(a.State, b.State)
+		case "image":
+			c = cmp.Compare(a.Image, b.Image)
+		case "priority":
+			c = cmp.Compare(a.Priority, b.Priority)
+		case "startTime":
+			c = a.StartTime.Compare(b.StartTime)
+		case "finishTime":
+			c = a.FinishTime.Compare(b.FinishTime)
+		}
+		if desc {
+			c = -c
+		}
+		if c == 0 {
+			c = cmp.Compare(a.ID.String(), b.ID.String())
+		}
+		return c
+	})
+
+	total := len(matching)
+	start := min(q.Offset, total)
+	end := total
+	if q.Limit > 0 {
+		end = min(start+q.Limit, total)
+	}
+	return matching[start:end], total
+}
+
+// In memory task store
+
+func (i *InMemoryTaskStore) QueryTasks(q TaskQuery) ([]*task.Task, int, error) {
+	i.mu.RLock()
+	var tasks []*task.Task
+	if len(q.States) == 0 {
+		for _, t := range i.Db {
+			tasks = append(tasks, t)
+		}
+	}
+	for _, s := range q.States {
+		for key := range i.byState[s] {
+			tasks = append(tasks, i.Db[key])
+		}
+	}
+	i.mu.RUnlock()
+	// Stored tasks may have changed since they were indexed, the filters are applied again
+	tasks, total := q.Apply(tasks)
+	return tasks, total, nil
+}
+
+// index moves key to the state of t in the index, t nil removes it. The store must be locked.
+func (i *InMemoryTaskStore) index(key string, t *task.Task) {
+	if i.byState == nil {
+		i.byState = make(map[task.State]map[string]bool)
+		i.states = make(map[string]task.State)
+	}
+	if s, ok := i.states[key]; ok {
+		delete(i.byState[s], key)
+		delete(i.states, key)
+	}
+	if t == nil {
+		return
+	}
+	if i.byState[t.State] == nil {
+		i.byState[t.State] = make(map[string]bool)
+	}
+	i.byState[t.State][key] = true
+	i.states[key] = t.State
+}
+
+// Persistent task store
+// The index bucket holds "s/<state>/<key>" entries, whose values are the task keys,
+// and "k/<key>" entries with the state each task is indexed under.
+
+func (t *TaskStore) indexBucket() []byte {
+	return []byte(t.Bucket + "_index")
+}
+
+func stateIndexPrefix(s task.State) []byte {
+	return []byte(fmt.Sprintf("s/%d/", s))
+}
+
+// createIndex creates the index bucket, indexing the stored tasks when it is missing
+func (t *TaskStore) createIndex() error {
+	return t.Db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(t.indexBucket()) != nil {
+			return nil
+		}
+		if _, err := tx.CreateBucket(t.indexBucket()); err != nil {
+			return fmt.Errorf("create bucket %s: %s", t.indexBucket(), err)
+		}
+		return tx.Bucket([]byte(t.Bucket)).ForEach(func(k, v []byte) error {
+			var tk task.Task
+			if err := decode(t.Bucket, string(k), v, &tk); err != nil {
+				return fmt.Errorf("unable to index task %s: %v", k, err)
+			}
+			return t.index(tx, string(k), &tk)
+		})
+	})
+}
+
+// index moves key to the state of value in the index, a nil value removes it
+func (t *TaskStore) index(tx *bolt.Tx, key string, value interface{}) error {
+	b := tx.Bucket(t.indexBucket())
+	if b == nil {
+		return fmt.Errorf("bucket %s does not exist", t.indexBucket())
+	}
+	stateKey := []byte("k/" + key)
+	if prev := b.Get(stateKey); prev != nil {
+		if err := b.Delete(append([]byte("s/"+string(prev)+"/"), key...)); err != nil {
+			return err
+		}
+	}
+	tk, ok := value.(*task.Task)
+	if !ok || tk == nil {
+		return b.Delete(stateKey)
+	}
+	if err := b.Put(append(stateIndexPrefix(tk.State), key...), []byte(key)); err != nil {
+		return err
+	}
+	return b.Put(stateKey, []byte(strconv.Itoa(int(tk.State))))
+}
+
+func (t *TaskStore) QueryTasks(q TaskQuery) ([]*task.Task, int, error) {
+	if len(q.States) == 0 {
+		res, err := t.List()
+		if err != nil {
+			return nil, 0, err
+		}
+		tasks, total := q.Apply(res.([]*task.Task))
+		return tasks, total, nil
+	}
+
+	var tasks []*task.Task
+	err := t.Db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(t.Bucket))
+		c := tx.Bucket(t.indexBucket()).Cursor()
+		for _, s := range q.States {
+			prefix := stateIndexPrefix(s)
+			for k, key := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, key = c.Next() {
+				v := b.Get(key)
+				if v == nil {
+					continue
+				}
+				var tk task.Task
+				if err := decode(t.Bucket, string(key), v, &tk); err != nil {
+					return err
+				}
+				tasks = append(tasks, &tk)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	page, total := q.Apply(tasks)
+	return page, total, nil
+}
@@ -0,0 +1,263 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+/**
+* SQL storage
+* SQLStore keeps a store's values in a table of a SQL database, one row per key
+* holding the value encoded like in the BoltDB stores, so managers are not tied to
+* a local disk and their state can be inspected with SQL. SQLite suits a single
+* node, Postgres a database shared by several managers. Stores are written
+* against database/sql with the drivers linked in drivers.go; SQLite needs a
+* binary built with cgo.
+ */
+const (
+	SQLite   = "sqlite"
+	Postgres = "postgres"
+)
+
+var SQLTypes = []string{SQLite, Postgres}
+
+// Driver names each database type is known by, in order of preference
+var sqlDrivers = map[string][]string{
+	SQLite:   {"sqlite", "sqlite3"},
+	Postgres: {"pgx", "postgres"},
+}
+
+// IsSQL reports whether dbType is one of SQLTypes
+func IsSQL(dbType string) bool {
+	return slices.Contains(SQLTypes, dbType)
+}
+
+// OpenSQL connects to the database of dbType at dsn with the first driver registered for it
+func OpenSQL(dbType string, dsn string) (*sql.DB, error) {
+	candidates, ok := sqlDrivers[dbType]
+	if !ok {
+		return nil, fmt.Errorf("unknown SQL database type %q, expected one of %v", dbType, SQLTypes)
+	}
+	if dsn == "" {
+		return nil, fmt.Errorf("a DSN is required for %s", dbType)
+	}
+	registered := sql.Drivers()
+	for _, driver := range candidates {
+		if !slices.Contains(registered, driver) {
+			continue
+		}
+		db, err := sql.Open(driver, dsn)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open %s database: %v", dbType, err)
+		}
+		if err := db.Ping(); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("unable to connect to %s database: %v", dbType, err)
+		}
+		if dbType == SQLite {
+			// Writers would otherwise fail with SQLITE_BUSY instead of waiting for each other
+			db.SetMaxOpenConns(1)
+		}
+		return db, nil
+	}
+	return nil, fmt.Errorf("no %s driver is linked into this build, expected one registered as %v", dbType, candidates)
+}
+
+type SQLStore[T any] struct {
+	Db     *sql.DB
+	DbType string
+	// Values are encoded with the bucket name, as in the BoltDB stores
+	Bucket string
+	Table  string
+}
+
+// NewSQLStore stores values in the cube_<bucket> table of db, creating it when missing
+func NewSQLStore[T any](db *sql.DB, dbType string, bucket string) (*SQLStore[T], error) {
+	s := &SQLStore[T]{Db: db, DbType: dbType, Bucket: bucket, Table: "cube_" + bucket}
+	blob := "BLOB"
+	if dbType == Postgres {
+		blob = "BYTEA"
+	}
+	_, err := db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id TEXT PRIMARY KEY, data %s NOT NULL)", s.Table, blob))
+	if err != nil {
+		return nil, fmt.Errorf("create table %s: %v", s.Table, err)
+	}
+	return s, nil
+}
+
+// query fills in the table of q and rewrites its ? placeholders for the database
+func (s *SQLStore[T]) query(q string) string {
+	if s.DbType != Postgres {
+		return strings.ReplaceAll(q, "{table}", s.Table)
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range strings.ReplaceAll(q, "{table}", s.Table) {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Close closes the database, which may be shared with other stores
+func (s *SQLStore[T]) Close() {
+	s.Db.Close()
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func (s *SQLStore[T]) put(e execer, key string, value interface{}) error {
+	v, ok := value.(*T)
+	if !ok {
+		return fmt.Errorf("value %v for key %s is not a %T", value, key, *new(T))
+	}
+	buf, err := encode(s.Bucket, key, v)
+	if err != nil {
+		return err
+	}
+	_, err = e.Exec(s.query("INSERT INTO {table} (id, data) VALUES (?, ?) ON CONFLICT (id) DO UPDATE SET data = excluded.data"), key, buf)
+	return err
+}
+
+func (s *SQLStore[T]) Put(key string, value interface{}) error {
+	return s.put(s.Db, key, value)
+}
+
+func (s *SQLStore[T]) Get(key string) (interface{}, error) {
+	var buf []byte
+	err := s.Db.QueryRow(s.query("SELECT data FROM {table} WHERE id = ?"), key).Scan(&buf)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("key %s does not exist", key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var value T
+	if err := decode(s.Bucket, key, buf, &value); err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+// rows decodes every row in key order
+func (s *SQLStore[T]) rows() ([]string, []*T, error) {
+	rows, err := s.Db.Query(s.query("SELECT id, data FROM {table} ORDER BY id"))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var keys []string
+	var values []*T
+	for rows.Next() {
+		var key string
+		var buf []byte
+		if err := rows.Scan(&key, &buf); err != nil {
+			return nil, nil, err
+		}
+		var value T
+		if err := decode(s.Bucket, key, buf, &value); err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+		values = append(values, &value)
+	}
+	return keys, values, rows.Err()
+}
+
+func (s *SQLStore[T]) List() (interface{}, error) {
+	_, values, err := s.rows()
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func (s *SQLStore[T]) Count() (int, error) {
+	var n int
+	if err := s.Db.QueryRow(s.query("SELECT COUNT(*) FROM {table}")).Scan(&n); err != nil {
+		return -1, err
+	}
+	return n, nil
+}
+
+func (s *SQLStore[T]) Delete(key string) error {
+	_, err := s.Db.Exec(s.query("DELETE FROM {table} WHERE id = ?"), key)
+	return err
+}
+
+func (s *SQLStore[T]) Batch(ops []Op) error {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, op := range ops {
+		if op.Delete {
+			if _, err := tx.Exec(s.query("DELETE FROM {table} WHERE id = ?"), op.Key); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.put(tx, op.Key, op.Value); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Update locks the row on Postgres, SQLite runs one writer at a time
+func (s *SQLStore[T]) Update(key string, fn UpdateFunc) error {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	q := "SELECT data FROM {table} WHERE id = ?"
+	if s.DbType == Postgres {
+		q += " FOR UPDATE"
+	}
+	var buf []byte
+	err = tx.QueryRow(s.query(q), key).Scan(&buf)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("key %s does not exist", key)
+	}
+	if err != nil {
+		return err
+	}
+	var current T
+	if err := decode(s.Bucket, key, buf, &current); err != nil {
+		return err
+	}
+	next, err := fn(&current)
+	if err != nil {
+		return err
+	}
+	if err := s.put(tx, key, next); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ForEach reads every row before calling fn, so fn may write to the store
+func (s *SQLStore[T]) ForEach(fn func(key string, value interface{}) error) error {
+	keys, values, err := s.rows()
+	if err != nil {
+		return err
+	}
+	for i, k := range keys {
+		if err := fn(k, values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
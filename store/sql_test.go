@@ -0,0 +1,195 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"cube/task"
+)
+
+// openSQLite opens a SQLite database in a temporary directory
+func openSQLite(t *testing.T) *SQLStore[task.Task] {
+	t.Helper()
+	db, err := OpenSQL(SQLite, filepath.Join(t.TempDir(), "cube.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s, err := NewSQLStore[task.Task](db, SQLite, "tasks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func newTask(name string) *task.Task {
+	return &task.Task{ID: uuid.New(), Name: name, State: task.Pending, Image: "nginx"}
+}
+
+func TestOpenSQL(t *testing.T) {
+	if _, err := OpenSQL("mysql", "cube"); err == nil {
+		t.Error("opened a database of an unknown type")
+	}
+	if _, err := OpenSQL(Postgres, ""); err == nil {
+		t.Error("opened a postgres database without a DSN")
+	}
+	if s := openSQLite(t); s.Table != "cube_tasks" {
+		t.Errorf("table = %s, want cube_tasks", s.Table)
+	}
+}
+
+func TestSQLStore(t *testing.T) {
+	s := openSQLite(t)
+	web, db := newTask("web"), newTask("db")
+	for _, tk := range []*task.Task{web, db} {
+		if err := s.Put(tk.ID.String(), tk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Put("bad", "not a task"); err == nil {
+		t.Error("stored a value which is not a task")
+	}
+
+	v, err := s.Get(web.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := v.(*task.Task); got.Name != "web" || got.ID != web.ID {
+		t.Errorf("Get() = %s %s, want web %s", got.Name, got.ID, web.ID)
+	}
+	if _, err := s.Get(uuid.NewString()); err == nil {
+		t.Error("got a task which was never stored")
+	}
+
+	// Put replaces the stored value
+	web.State = task.Running
+	if err := s.Put(web.ID.String(), web); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.Count(); err != nil || n != 2 {
+		t.Errorf("Count() = %d, %v, want 2", n, err)
+	}
+	list, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := make(map[string]task.State)
+	for _, tk := range list.([]*task.Task) {
+		states[tk.Name] = tk.State
+	}
+	if len(states) != 2 || states["web"] != task.Running || states["db"] != task.Pending {
+		t.Errorf("listed %v, want web running and db pending", states)
+	}
+
+	if err := s.Delete(db.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.Count(); n != 1 {
+		t.Errorf("%d tasks left after Delete, want 1", n)
+	}
+}
+
+func TestSQLStoreBatch(t *testing.T) {
+	s := openSQLite(t)
+	web, db, cache := newTask("web"), newTask("db"), newTask("cache")
+	if err := s.Put(web.ID.String(), web); err != nil {
+		t.Fatal(err)
+	}
+	err := s.Batch([]Op{PutOp(db.ID.String(), db), PutOp(cache.ID.String(), cache), DeleteOp(web.ID.String())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.Count(); n != 2 {
+		t.Errorf("%d tasks after the batch, want 2", n)
+	}
+	if _, err := s.Get(web.ID.String()); err == nil {
+		t.Error("web is still stored after the batch deleted it")
+	}
+
+	// A failing op rolls back the whole batch
+	err = s.Batch([]Op{DeleteOp(db.ID.String()), PutOp("bad", "not a task")})
+	if err == nil {
+		t.Fatal("applied a batch storing a value which is not a task")
+	}
+	if _, err := s.Get(db.ID.String()); err != nil {
+		t.Errorf("db was deleted by a failed batch: %v", err)
+	}
+}
+
+func TestSQLStoreUpdateAndForEach(t *testing.T) {
+	s := openSQLite(t)
+	web, db := newTask("web"), newTask("db")
+	for _, tk := range []*task.Task{web, db} {
+		if err := s.Put(tk.ID.String(), tk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := s.Update(web.ID.String(), func(value interface{}) (interface{}, error) {
+		tk := value.(*task.Task)
+		tk.State = task.Scheduled
+		return tk, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(uuid.NewString(), func(value interface{}) (interface{}, error) { return value, nil }); err == nil {
+		t.Error("updated a task which was never stored")
+	}
+
+	// ForEach visits keys in order and lets fn write to the store
+	var keys []string
+	err = s.ForEach(func(key string, value interface{}) error {
+		keys = append(keys, key)
+		tk := value.(*task.Task)
+		if tk.Name == "web" && tk.State != task.Scheduled {
+			t.Errorf("web is %s after Update, want scheduled", tk.State)
+		}
+		return s.Delete(key)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] > keys[1] {
+		t.Errorf("visited %v, want both keys in order", keys)
+	}
+	if n, _ := s.Count(); n != 0 {
+		t.Errorf("%d tasks left, want the ones ForEach deleted gone", n)
+	}
+}
+
+func TestSQLObjectStore(t *testing.T) {
+	s := openSQLite(t)
+	services, err := NewSQLObjectStore[task.Service](s.Db, SQLite, "services")
+	if err != nil {
+		t.Fatal(err)
+	}
+	web := &task.Service{ID: uuid.New(), Name: "web", Replicas: 3}
+	if err := services.Put(web.ID.String(), web); err != nil {
+		t.Fatal(err)
+	}
+	got, err := services.Get(web.ID.String())
+	if err != nil || got.Name != "web" || got.Replicas != 3 {
+		t.Errorf("Get() = %+v, %v, want web with 3 replicas", got, err)
+	}
+	all, err := services.List()
+	if err != nil || len(all) != 1 {
+		t.Errorf("List() = %d services, %v, want 1", len(all), err)
+	}
+	// Services share the database with the tasks, in their own table
+	if n, _ := s.Count(); n != 0 {
+		t.Errorf("%d tasks stored, want the service kept apart", n)
+	}
+	if err := services.Delete(web.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	services.ForEach(func(key string, value *task.Service) error {
+		n++
+		return nil
+	})
+	if n != 0 {
+		t.Errorf("%d services left after Delete, want 0", n)
+	}
+}
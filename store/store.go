@@ -1,33 +1,49 @@
 package store
 
 import (
-	"encoding/json"
 	"fmt"
-	"log"
 	"os"
+	"sync"
 
 	"github.com/boltdb/bolt"
 
+	"cube/logging"
 	"cube/task"
 )
 
+var logger = logging.For("store")
+
 type Store interface {
 	Put(key string, value interface{}) error
 	Get(key string) (interface{}, error)
 	List() (interface{}, error)
 	Count() (int, error)
+	Delete(key string) error
+	// Batch applies all puts and deletes atomically
+	Batch(ops []Op) error
+	// Update atomically replaces the value at key with the one fn returns
+	Update(key string, fn UpdateFunc) error
+	// ForEach calls fn for every key and value in key order, stopping at the first error
+	ForEach(fn func(key string, value interface{}) error) error
+	Close()
 }
 
 /**
 * In Memory Storage
  */
 type InMemoryTaskStore struct {
+	mu sync.RWMutex
 	Db map[string]*task.Task
+	// Keys of the tasks in each state, see QueryTasks
+	byState map[task.State]map[string]bool
+	states  map[string]task.State
 }
 
 func NewInMemoryTaskStore() *InMemoryTaskStore {
 	return &InMemoryTaskStore{
-		Db: make(map[string]*task.Task),
+		Db:      make(map[string]*task.Task),
+		byState: make(map[task.State]map[string]bool),
+		states:  make(map[string]task.State),
 	}
 }
 
@@ -36,11 +52,16 @@ func (i *InMemoryTaskStore) Put(key string, value interface{}) error {
 	if !ok {
 		return fmt.Errorf("value %v is not a task.Task type", value)
 	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
 	i.Db[key] = t
+	i.index(key, t)
 	return nil
 }
 
 func (i *InMemoryTaskStore) Get(key string) (interface{}, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
 	t, ok := i.Db[key]
 	if !ok {
 		return nil, fmt.Errorf("task with ID '%s' does not exist", key)
@@ -49,6 +70,8 @@ func (i *InMemoryTaskStore) Get(key string) (interface{}, error) {
 }
 
 func (i *InMemoryTaskStore) List() (interface{}, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
 	var tasks []*task.Task
 	for _, t := range i.Db {
 		tasks = append(tasks, t)
@@ -57,11 +80,16 @@ func (i *InMemoryTaskStore) List() (interface{}, error) {
 }
 
 func (i *InMemoryTaskStore) Count() (int, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
 	return len(i.Db), nil
 }
 
+func (i *InMemoryTaskStore) Close() {}
+
 // In Memory Task Event Store
 type InMemoryTaskEventStore struct {
+	mu sync.RWMutex
 	Db map[string]*task.TaskEvent
 }
 
@@ -76,11 +104,15 @@ func (i *InMemoryTaskEventStore) Put(key string, value interface{}) error {
 	if !ok {
 		return fmt.Errorf("value %v is not a task.TaskEvent type", value)
 	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
 	i.Db[key] = e
 	return nil
 }
 
 func (i *InMemoryTaskEventStore) Get(key string) (interface{}, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
 	e, ok := i.Db[key]
 	if !ok {
 		return nil, fmt.Errorf("task event with key %s does not exist", key)
@@ -90,6 +122,8 @@ func (i *InMemoryTaskEventStore) Get(key string) (interface{}, error) {
 }
 
 func (i *InMemoryTaskEventStore) List() (interface{}, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
 	var events []*task.TaskEvent
 	for _, e := range i.Db {
 		events = append(events, e)
@@ -98,9 +132,13 @@ func (i *InMemoryTaskEventStore) List() (interface{}, error) {
 }
 
 func (i *InMemoryTaskEventStore) Count() (int, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
 	return len(i.Db), nil
 }
 
+func (i *InMemoryTaskEventStore) Close() {}
+
 /**
 * Persistent Storage
  */
@@ -126,7 +164,11 @@ func NewTaskStore(file string, mode os.FileMode, bucket string) (*TaskStore, err
 
 	err = t.CreateBucket()
 	if err != nil {
-		log.Printf("bucket already exists, will use existing")
+		logger.Debug("Bucket already exists, will use existing")
+	}
+	if err := t.createIndex(); err != nil {
+		db.Close()
+		return nil, err
 	}
 
 	return &t, nil
@@ -152,7 +194,7 @@ func (t *TaskStore) Put(key string, value interface{}) error {
 	return t.Db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(t.Bucket))
 
-		buf, err := json.Marshal(value.(*task.Task))
+		buf, err := encode(t.Bucket, key, value.(*task.Task))
 		if err != nil {
 			return err
 		}
@@ -161,7 +203,7 @@ func (t *TaskStore) Put(key string, value interface{}) error {
 		if err != nil {
 			return err
 		}
-		return nil
+		return t.index(tx, key, value)
 	})
 }
 
@@ -169,11 +211,11 @@ func (t *TaskStore) Get(key string) (interface{}, error) {
 	var task task.Task
 	err := t.Db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(t.Bucket))
-		t := b.Get([]byte(key))
-		if t == nil {
+		v := b.Get([]byte(key))
+		if v == nil {
 			return fmt.Errorf("task %v not found", key)
 		}
-		err := json.Unmarshal(t, &task)
+		err := decode(t.Bucket, key, v, &task)
 		if err != nil {
 			return err
 		}
@@ -192,7 +234,7 @@ func (t *TaskStore) List() (interface{}, error) {
 		b := tx.Bucket([]byte(t.Bucket))
 		b.ForEach(func(k, v []byte) error {
 			var task task.Task
-			err := json.Unmarshal(v, &task)
+			err := decode(t.Bucket, string(k), v, &task)
 			if err != nil {
 				return err
 			}
@@ -224,3 +266,98 @@ func (t *TaskStore) Count() (int, error) {
 
 	return taskCount, nil
 }
+
+// Persistent Task Event Store
+type TaskEventStore struct {
+	Db       *bolt.DB
+	DbFile   string
+	FileMode os.FileMode
+	Bucket   string
+}
+
+func NewTaskEventStore(file string, mode os.FileMode, bucket string) (*TaskEventStore, error) {
+	db, err := bolt.Open(file, mode, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %v", file)
+	}
+
+	e := TaskEventStore{
+		DbFile:   file,
+		FileMode: mode,
+		Db:       db,
+		Bucket:   bucket,
+	}
+
+	err = e.Db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create bucket %s: %s", bucket, err)
+	}
+
+	return &e, nil
+}
+
+func (e *TaskEventStore) Close() {
+	e.Db.Close()
+}
+
+func (e *TaskEventStore) Put(key string, value interface{}) error {
+	event, ok := value.(*task.TaskEvent)
+	if !ok {
+		return fmt.Errorf("value %v is not a task.TaskEvent type", value)
+	}
+	buf, err := encode(e.Bucket, key, event)
+	if err != nil {
+		return err
+	}
+	return e.Db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(e.Bucket)).Put([]byte(key), buf)
+	})
+}
+
+func (e *TaskEventStore) Get(key string) (interface{}, error) {
+	var event task.TaskEvent
+	err := e.Db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(e.Bucket)).Get([]byte(key))
+		if v == nil {
+			return fmt.Errorf("task event with key %s does not exist", key)
+		}
+		return decode(e.Bucket, key, v, &event)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (e *TaskEventStore) List() (interface{}, error) {
+	var events []*task.TaskEvent
+	err := e.Db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(e.Bucket)).ForEach(func(k, v []byte) error {
+			var event task.TaskEvent
+			if err := decode(e.Bucket, string(k), v, &event); err != nil {
+				return err
+			}
+			events = append(events, &event)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (e *TaskEventStore) Count() (int, error) {
+	count := 0
+	err := e.Db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket([]byte(e.Bucket)).Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return count, nil
+}
@@ -0,0 +1,83 @@
+package supervisor
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"cube/logging"
+)
+
+var logger = logging.For("supervisor")
+
+/**
+* Supervisor
+* Runs long-lived component loops, restarting any loop that panics with
+* an increasing backoff, so one failing loop does not take the process down.
+ */
+const (
+	initialBackoff = 1 * time.Second
+	maxBackoff     = 1 * time.Minute
+)
+
+type Supervisor struct {
+	mu       sync.Mutex
+	restarts map[string]int
+	wg       sync.WaitGroup
+}
+
+func New() *Supervisor {
+	return &Supervisor{restarts: make(map[string]int)}
+}
+
+// Go starts fn under supervision. fn is restarted after a panic; a normal return ends supervision.
+func (s *Supervisor) Go(name string, fn func()) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		backoff := initialBackoff
+		for {
+			err := run(fn)
+			if err == nil {
+				logger.Info("Supervised loop exited", "loop", name)
+				return
+			}
+
+			s.mu.Lock()
+			s.restarts[name]++
+			count := s.restarts[name]
+			s.mu.Unlock()
+
+			logger.Error("Supervised loop crashed", "loop", name, "restart", count, "backoff", backoff, "error", err)
+			time.Sleep(backoff)
+			backoff = min(backoff*2, maxBackoff)
+		}
+	}()
+}
+
+// Wait blocks until every supervised loop has returned
+func (s *Supervisor) Wait() {
+	s.wg.Wait()
+}
+
+// Restarts returns how many times each loop has been restarted
+func (s *Supervisor) Restarts() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]int, len(s.restarts))
+	for k, v := range s.restarts {
+		out[k] = v
+	}
+	return out
+}
+
+func run(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v\n%s", r, debug.Stack())
+		}
+	}()
+	fn()
+	return nil
+}
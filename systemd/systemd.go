@@ -0,0 +1,130 @@
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"cube/logging"
+)
+
+var logger = logging.For("systemd")
+
+/**
+* sd_notify protocol
+* See https://www.freedesktop.org/software/systemd/man/sd_notify.html
+ */
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Alive    = "WATCHDOG=1"
+)
+
+// Notify sends a state string to the systemd notification socket.
+// It is a no-op when the process is not running under systemd.
+func Notify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// Abstract namespace sockets are announced with a leading '@'
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("unable to connect to notify socket: %v", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// WatchdogInterval returns the watchdog timeout systemd expects pings within, if enabled for this process
+func WatchdogInterval() (time.Duration, bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+	return time.Duration(usec) * time.Microsecond, true
+}
+
+/**
+* Watchdog
+* Background loops register themselves and beat once per iteration; WATCHDOG=1 is only
+* sent while every loop has beaten recently, so a hung loop lets systemd restart the process.
+ */
+type loop struct {
+	interval time.Duration
+	last     time.Time
+}
+
+type Watchdog struct {
+	mu    sync.Mutex
+	loops map[string]*loop
+}
+
+func NewWatchdog() *Watchdog {
+	return &Watchdog{loops: make(map[string]*loop)}
+}
+
+// Register a background loop expected to beat at least once per interval
+func (w *Watchdog) Register(name string, interval time.Duration) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.loops[name] = &loop{interval: interval, last: time.Now()}
+}
+
+// Beat records an iteration of the named loop
+func (w *Watchdog) Beat(name string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if l, ok := w.loops[name]; ok {
+		l.last = time.Now()
+	}
+}
+
+// Healthy reports whether every registered loop has beaten within three of its intervals
+func (w *Watchdog) Healthy() (bool, string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for name, l := range w.loops {
+		if time.Since(l.last) > 3*l.interval {
+			return false, name
+		}
+	}
+	return true, ""
+}
+
+// Run pings the systemd watchdog at half its timeout while all loops are healthy
+func (w *Watchdog) Run() {
+	timeout, ok := WatchdogInterval()
+	if !ok {
+		return
+	}
+	logger.Info("systemd watchdog enabled", "timeout", timeout)
+	for {
+		if healthy, stale := w.Healthy(); healthy {
+			if err := Notify(Alive); err != nil {
+				logger.Error("Error notifying systemd watchdog", "error", err)
+			}
+		} else {
+			logger.Warn("Background loop is stale, withholding watchdog ping", "loop", stale)
+		}
+		time.Sleep(timeout / 2)
+	}
+}
@@ -0,0 +1,54 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+/**
+* Container labels
+* Every container a worker starts is labeled with the ID and the spec of its task,
+* and the name of the worker, so a worker restarting without its task store can
+* rebuild the tasks of its containers and resume monitoring them, and containers
+* no task knows about can be told apart from those run outside of Cube.
+ */
+const (
+	TaskIDLabel   = "cube.task.id"
+	TaskSpecLabel = "cube.task.spec"
+	WorkerLabel   = "cube.worker.name"
+)
+
+// ContainerLabels returns the labels of the container t runs in on the named worker.
+// Registry credentials are left out, labels are readable by anyone with runtime access.
+func ContainerLabels(t Task, worker string) map[string]string {
+	labels := map[string]string{TaskIDLabel: t.ID.String(), WorkerLabel: worker}
+	t.RegistryAuth = nil
+	t.ContainerID = ""
+	t.OutputTail = ""
+	if spec, err := json.Marshal(t); err == nil {
+		labels[TaskSpecLabel] = string(spec)
+	} else {
+		logger.Warn("Unable to encode task spec label", "task_id", t.ID, "error", err)
+	}
+	return labels
+}
+
+// TaskFromLabels rebuilds the task a container was started for from its labels
+func TaskFromLabels(labels map[string]string) (*Task, error) {
+	id, err := uuid.Parse(labels[TaskIDLabel])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s label: %v", TaskIDLabel, err)
+	}
+	t := Task{ID: id}
+	if spec, ok := labels[TaskSpecLabel]; ok {
+		if err := json.Unmarshal([]byte(spec), &t); err != nil {
+			return nil, fmt.Errorf("invalid %s label: %v", TaskSpecLabel, err)
+		}
+		if t.ID != id {
+			return nil, fmt.Errorf("%s label is for task %v, not %v", TaskSpecLabel, t.ID, id)
+		}
+	}
+	return &t, nil
+}
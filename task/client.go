@@ -0,0 +1,239 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/google/uuid"
+
+	"cube/platform"
+)
+
+/**
+* Runtime client
+* A worker drives Docker and Podman through a single Docker SDK client, created
+* once and shared by every container operation: the SDK client is safe for
+* concurrent use and pools its connections, creating one per operation leaks
+* them under load. The API version is negotiated with the daemon instead of
+* being pinned. CheckHealth pings the daemon and replaces the client when the
+* connection is lost, so a restarted daemon is picked up without restarting the
+* worker. Events streams the lifecycle events of the worker's containers.
+* containerd is driven through nerdctl and needs no client.
+ */
+
+// How long a health check waits for the daemon to answer a ping
+const pingTimeout = 5 * time.Second
+
+type RuntimeClient struct {
+	// Container runtime, one of Runtimes
+	Name string
+
+	mu     sync.Mutex
+	client *client.Client
+}
+
+// NewRuntimeClient returns the client of the named runtime. No connection is made
+// until the first operation.
+func NewRuntimeClient(name string) (*RuntimeClient, error) {
+	if name == "" {
+		name = DockerRuntime
+	}
+	rc := &RuntimeClient{Name: name}
+	switch name {
+	case DockerRuntime, PodmanRuntime:
+		if _, err := rc.Client(); err != nil {
+			return nil, err
+		}
+	case ContainerdRuntime:
+		if _, err := NewContainerd(&Config{}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown container runtime %q, expected one of %v", name, Runtimes)
+	}
+	return rc, nil
+}
+
+// Client returns the shared Docker SDK client, creating it after a lost connection
+func (rc *RuntimeClient) Client() (*client.Client, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.client != nil {
+		return rc.client, nil
+	}
+	c, err := rc.newClient()
+	if err != nil {
+		return nil, err
+	}
+	rc.client = c
+	return c, nil
+}
+
+func (rc *RuntimeClient) newClient() (*client.Client, error) {
+	if rc.Name == PodmanRuntime {
+		host := os.Getenv("CONTAINER_HOST")
+		if host == "" {
+			host = platform.PodmanHost()
+		}
+		c, err := client.NewClientWithOpts(client.WithHost(host), client.WithAPIVersionNegotiation())
+		if err != nil {
+			return nil, fmt.Errorf("error creating podman client for %s: %v", host, err)
+		}
+		return c, nil
+	}
+	opts := []client.Opt{client.FromEnv}
+	if os.Getenv("DOCKER_HOST") == "" {
+		opts = append(opts, client.WithHost(platform.DockerHost()))
+	}
+	opts = append(opts, client.WithAPIVersionNegotiation())
+	c, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating docker client: %v", err)
+	}
+	return c, nil
+}
+
+// Runtime returns the container runtime configured to run c, sharing the client
+func (rc *RuntimeClient) Runtime(c *Config) (ContainerRuntime, error) {
+	if rc.Name == ContainerdRuntime {
+		return NewContainerd(c)
+	}
+	dc, err := rc.Client()
+	if err != nil {
+		return nil, err
+	}
+	return NewDocker(dc, c), nil
+}
+
+// CheckHealth pings the daemon. A client that cannot reach it is closed and
+// replaced, and the new one is pinged once before giving up, returning whether
+// the worker reconnected.
+func (rc *RuntimeClient) CheckHealth(ctx context.Context) (bool, error) {
+	if rc.Name == ContainerdRuntime {
+		return false, nil
+	}
+	c, err := rc.Client()
+	if err != nil {
+		return false, err
+	}
+	if err = ping(ctx, c); err == nil {
+		return false, nil
+	}
+
+	rc.reset(c)
+	if c, err = rc.Client(); err != nil {
+		return false, err
+	}
+	if err := ping(ctx, c); err != nil {
+		return false, fmt.Errorf("%s daemon is unreachable: %v", rc.Name, err)
+	}
+	return true, nil
+}
+
+func ping(ctx context.Context, c *client.Client) error {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	_, err := c.Ping(ctx)
+	return err
+}
+
+// reset drops c unless another health check already replaced it
+func (rc *RuntimeClient) reset(c *client.Client) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.client == c {
+		rc.client = nil
+		c.Close()
+	}
+}
+
+// Close releases the client's connections
+func (rc *RuntimeClient) Close() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.client == nil {
+		return nil
+	}
+	err := rc.client.Close()
+	rc.client = nil
+	return err
+}
+
+// ErrEventsUnsupported is returned by Events for runtimes without an event stream
+var ErrEventsUnsupported = errors.New("container runtime does not stream events")
+
+// ContainerEvent is a lifecycle event of a container started by a worker
+type ContainerEvent struct {
+	ContainerID string
+	Name        string `json:",omitempty"`
+	Image       string `json:",omitempty"`
+	TaskID      uuid.UUID
+	// Runtime action, e.g. create, start, die, oom, kill or "health_status: unhealthy"
+	Action string
+	// Set for die events
+	ExitCode *int `json:",omitempty"`
+	Time     time.Time
+}
+
+// Events streams the lifecycle events of the containers worker started, until
+// ctx is done or the stream fails with an error sent on the second channel
+func (rc *RuntimeClient) Events(ctx context.Context, worker string) (<-chan ContainerEvent, <-chan error) {
+	out := make(chan ContainerEvent)
+	errs := make(chan error, 1)
+	if rc.Name == ContainerdRuntime {
+		errs <- ErrEventsUnsupported
+		return out, errs
+	}
+	c, err := rc.Client()
+	if err != nil {
+		errs <- err
+		return out, errs
+	}
+
+	messages, streamErrs := c.Events(ctx, events.ListOptions{Filters: filters.NewArgs(
+		filters.Arg("type", string(events.ContainerEventType)),
+		filters.Arg("label", WorkerLabel+"="+worker),
+	)})
+	go func() {
+		for {
+			select {
+			case m := <-messages:
+				select {
+				case out <- containerEvent(m):
+				case <-ctx.Done():
+					return
+				}
+			case err := <-streamErrs:
+				errs <- err
+				return
+			}
+		}
+	}()
+	return out, errs
+}
+
+// containerEvent keeps the fields of m worth reporting, leaving out the container's
+// labels and the task spec they carry
+func containerEvent(m events.Message) ContainerEvent {
+	attrs := m.Actor.Attributes
+	e := ContainerEvent{
+		ContainerID: m.Actor.ID,
+		Name:        attrs["name"],
+		Image:       attrs["image"],
+		Action:      string(m.Action),
+		Time:        time.Unix(0, m.TimeNano).UTC(),
+	}
+	e.TaskID, _ = uuid.Parse(attrs[TaskIDLabel])
+	if code, err := strconv.Atoi(attrs["exitCode"]); err == nil {
+		e.ExitCode = &code
+	}
+	return e
+}
@@ -0,0 +1,50 @@
+package task
+
+import (
+	"slices"
+	"time"
+)
+
+type ConditionType string
+
+const (
+	// No node can run the task, the manager retries placing it with backoff
+	Unschedulable ConditionType = "Unschedulable"
+)
+
+// Condition is an observation about a task that its State does not capture
+type Condition struct {
+	Type    ConditionType
+	Message string
+	// When the condition was first observed, and how often since
+	Since    time.Time
+	Attempts int
+	// When the manager acts on the task next, if it does
+	NextAttempt time.Time `json:",omitempty"`
+}
+
+// Condition returns the task's condition of the given type, or nil
+func (t *Task) Condition(ct ConditionType) *Condition {
+	for i := range t.Conditions {
+		if t.Conditions[i].Type == ct {
+			return &t.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds c to the task's conditions, replacing one of the same type
+func (t *Task) SetCondition(c Condition) {
+	if current := t.Condition(c.Type); current != nil {
+		*current = c
+		return
+	}
+	t.Conditions = append(t.Conditions, c)
+}
+
+func (t *Task) ClearCondition(ct ConditionType) {
+	t.Conditions = slices.DeleteFunc(t.Conditions, func(c Condition) bool { return c.Type == ct })
+	if len(t.Conditions) == 0 {
+		t.Conditions = nil
+	}
+}
@@ -0,0 +1,350 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
+	"github.com/moby/moby/pkg/stdcopy"
+)
+
+/**
+* containerd runtime
+* Drives containerd through nerdctl, whose Docker compatible output is mapped onto
+* the Docker API types the worker already understands. The containerd socket and
+* namespace follow nerdctl's own CONTAINERD_ADDRESS / CONTAINERD_NAMESPACE settings.
+ */
+const nerdctlBinary = "nerdctl"
+
+type Containerd struct {
+	// Path to the nerdctl binary
+	Binary string
+	Config Config
+}
+
+func NewContainerd(c *Config) (*Containerd, error) {
+	bin, err := exec.LookPath(nerdctlBinary)
+	if err != nil {
+		return nil, fmt.Errorf("containerd runtime requires %s in PATH: %v", nerdctlBinary, err)
+	}
+	return &Containerd{Binary: bin, Config: *c}, nil
+}
+
+func (c *Containerd) nerdctl(ctx context.Context, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Binary, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %v: %s", nerdctlBinary, args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// Create and Start container
+func (c *Containerd) Run() DockerResult {
+	ctx := context.Background()
+	pull := map[ImagePullPolicy]string{PullAlways: "always", PullIfNotPresent: "missing", PullNever: "never"}
+	args := []string{"run", "--detach", "--pull", pull[PullPolicyFor(c.Config.ImagePullPolicy, c.Config.Image)]}
+	if c.Config.RegistryAuth != nil {
+		// nerdctl only takes credentials from its own login
+		logger.Warn("Registry credentials are not supported by the containerd runtime, pulling with the nerdctl login", "image", c.Config.Image)
+	}
+	if c.Config.Name != "" {
+		args = append(args, "--name", c.Config.Name)
+	}
+	if c.Config.Platform != "" {
+		args = append(args, "--platform", c.Config.Platform)
+	}
+
+	// Limits cap the container, requests are kept as soft reservations
+	memory, cpu := c.Config.Memory, c.Config.Cpu
+	if c.Config.MemoryLimit > 0 {
+		memory = c.Config.MemoryLimit
+	}
+	if c.Config.CpuLimit > 0 {
+		cpu = c.Config.CpuLimit
+	}
+	if memory > 0 {
+		args = append(args, "--memory", strconv.FormatInt(memory, 10))
+	}
+	if c.Config.Memory > 0 {
+		args = append(args, "--memory-reservation", strconv.FormatInt(c.Config.Memory, 10))
+	}
+	if cpu > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(cpu, 'f', -1, 64))
+	}
+	if c.Config.CpusetCpus != "" {
+		args = append(args, "--cpuset-cpus", c.Config.CpusetCpus)
+	}
+	for _, r := range c.Config.DeviceRequests {
+		args = append(args, "--gpus", r.gpusFlag())
+	}
+	for _, m := range c.Config.Mounts {
+		args = append(args, "--mount", m.String())
+	}
+	for _, e := range c.Config.Env {
+		args = append(args, "--env", e)
+	}
+	for k, v := range c.Config.Labels {
+		args = append(args, "--label", k+"="+v)
+	}
+	if h := c.Config.Healthcheck; h != nil {
+		args = append(args, h.nerdctlFlags()...)
+	}
+	if err := c.ensureNetworks(ctx); err != nil {
+		logger.Error("Error creating networks", "networks", c.Config.Networks, "error", err)
+		return DockerResult{Error: err}
+	}
+	for _, n := range c.Config.Networks {
+		args = append(args, "--network", n)
+	}
+	// Publish bound ports on their host port and every other exposed port on a
+	// random host port, like PublishAllPorts
+	bindings := c.Config.portBindings()
+	for p := range c.Config.exposedPorts() {
+		if b, ok := bindings[p]; ok {
+			args = append(args, "--publish", b[0].HostPort+":"+string(p))
+		} else {
+			args = append(args, "--publish", string(p))
+		}
+	}
+	args = append(args, c.Config.Image)
+	args = append(args, c.Config.Cmd...)
+
+	out, err := c.nerdctl(ctx, args...)
+	if err != nil {
+		logger.Error("Error running container", "image", c.Config.Image, "error", err)
+		if pullFailed(err) {
+			return DockerResult{Error: &ImagePullError{Image: c.Config.Image, Err: err}}
+		}
+		return DockerResult{Error: &StartError{Code: CodeStartFailed, Err: err}}
+	}
+	id := strings.TrimSpace(string(out))
+	return DockerResult{ContainerID: id, Action: "start", Result: "success"}
+}
+
+// pullFailed reports whether nerdctl run failed pulling the image rather than running it
+func pullFailed(err error) bool {
+	msg := err.Error()
+	for _, s := range []string{"failed to resolve reference", "pull access denied", "failed to pull", "failed to fetch"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureNetworks creates the configured networks missing on the host
+func (c *Containerd) ensureNetworks(ctx context.Context) error {
+	for _, name := range c.Config.Networks {
+		if _, err := c.nerdctl(ctx, "network", "inspect", name); err == nil {
+			continue
+		}
+		logger.Info("Creating network", "network", name)
+		if _, err := c.nerdctl(ctx, "network", "create", "--label", NetworkLabel+"=true", name); err != nil && !strings.Contains(err.Error(), "already exists") {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop and Remove container
+func (c *Containerd) Stop(id string) DockerResult {
+	logger.Info("Attempting to stop container", "container_id", id)
+	timeout := c.Config.stopTimeout()
+	stopCtx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second+stopGracePeriod)
+	defer cancel()
+	_, err := c.nerdctl(stopCtx, "stop", "--time", strconv.Itoa(timeout), id)
+	if err == nil {
+		if _, err = c.nerdctl(context.Background(), "rm", "--volumes", id); err == nil {
+			return DockerResult{Action: "stop", Result: "success", Error: nil}
+		}
+	}
+
+	logger.Warn("Error stopping container gracefully, killing it", "container_id", id, "error", err)
+	ctx := context.Background()
+	if _, err := c.nerdctl(ctx, "kill", id); err != nil {
+		logger.Error("Error killing container", "container_id", id, "error", err)
+	}
+	if _, err := c.nerdctl(ctx, "rm", "--force", "--volumes", id); err != nil {
+		logger.Error("Error removing container", "container_id", id, "error", err)
+		return DockerResult{Error: err, Killed: true}
+	}
+	return DockerResult{Action: "stop", Result: "killed", Killed: true}
+}
+
+func (c *Containerd) Inspect(containerID string) DockerInspectResponse {
+	out, err := c.nerdctl(context.Background(), "inspect", "--mode", "dockercompat", containerID)
+	if err != nil {
+		logger.Error("Error inspecting container", "container_id", containerID, "error", err)
+		return DockerInspectResponse{Error: err}
+	}
+
+	var resp []container.InspectResponse
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return DockerInspectResponse{Error: err}
+	}
+	if len(resp) == 0 {
+		return DockerInspectResponse{Error: fmt.Errorf("no such container: %s", containerID)}
+	}
+	return DockerInspectResponse{Container: &resp[0]}
+}
+
+func (c *Containerd) Exec(ctx context.Context, containerID string, cmd []string) (int, error) {
+	args := append([]string{"exec", containerID}, cmd...)
+	err := exec.CommandContext(ctx, c.Binary, args...).Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
+
+// Logs streams nerdctl's output framed with stdcopy, so callers can split it like Docker's
+func (c *Containerd) Logs(ctx context.Context, containerID string, follow bool, tail string) (io.ReadCloser, error) {
+	args := []string{"logs"}
+	if follow {
+		args = append(args, "--follow")
+	}
+	if tail != "" && tail != "all" {
+		args = append(args, "--tail", tail)
+	}
+	args = append(args, containerID)
+
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	cmd := exec.CommandContext(ctx, c.Binary, args...)
+	cmd.Stdout = stdcopy.NewStdWriter(pw, stdcopy.Stdout)
+	cmd.Stderr = stdcopy.NewStdWriter(pw, stdcopy.Stderr)
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, err
+	}
+	go func() {
+		pw.CloseWithError(cmd.Wait())
+	}()
+	return &cmdReadCloser{PipeReader: pr, cancel: cancel}, nil
+}
+
+type cmdReadCloser struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+}
+
+func (r *cmdReadCloser) Close() error {
+	r.cancel()
+	return r.PipeReader.Close()
+}
+
+// nerdctl stats --format '{{json .}}' output
+type nerdctlStats struct {
+	CPUPerc  string
+	MemUsage string
+	NetIO    string
+}
+
+func (c *Containerd) Stats(ctx context.Context, containerID string) (*ContainerStats, error) {
+	out, err := c.nerdctl(ctx, "stats", "--no-stream", "--format", "{{json .}}", containerID)
+	if err != nil {
+		return nil, err
+	}
+	var ns nerdctlStats
+	if err := json.Unmarshal(out, &ns); err != nil {
+		return nil, err
+	}
+
+	cs := ContainerStats{Timestamp: time.Now().UTC()}
+	cs.CpuPercent, _ = strconv.ParseFloat(strings.TrimSuffix(ns.CPUPerc, "%"), 64)
+	// MemUsage is "<usage> / <limit>", e.g. "1.5MiB / 7.6GiB"
+	if usage, limit, ok := strings.Cut(ns.MemUsage, "/"); ok {
+		u, _ := units.RAMInBytes(strings.TrimSpace(usage))
+		l, _ := units.RAMInBytes(strings.TrimSpace(limit))
+		cs.MemoryUsage, cs.MemoryLimit = uint64(u), uint64(l)
+	}
+	// NetIO is "<received> / <sent>" in decimal units, e.g. "1.2kB / 648B"
+	if rx, tx, ok := strings.Cut(ns.NetIO, "/"); ok {
+		r, _ := units.FromHumanSize(strings.TrimSpace(rx))
+		t, _ := units.FromHumanSize(strings.TrimSpace(tx))
+		cs.NetworkRx, cs.NetworkTx = uint64(r), uint64(t)
+	}
+	return &cs, nil
+}
+
+// nerdctl ps --format '{{json .}}' output
+type nerdctlContainer struct {
+	ID        string
+	Names     string
+	Image     string
+	Status    string
+	CreatedAt string
+	// Comma separated key=value pairs
+	Labels string
+}
+
+func (c *Containerd) List() ([]container.Summary, error) {
+	out, err := c.nerdctl(context.Background(), "ps", "--all", "--no-trunc", "--format", "{{json .}}")
+	if err != nil {
+		logger.Error("Error listing containers", "error", err)
+		return nil, err
+	}
+
+	var containers []container.Summary
+	for _, line := range bytes.Split(bytes.TrimSpace(out), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var nc nerdctlContainer
+		if err := json.Unmarshal(line, &nc); err != nil {
+			return nil, err
+		}
+		created, _ := time.Parse("2006-01-02 15:04:05 -0700 MST", nc.CreatedAt)
+		containers = append(containers, container.Summary{
+			ID:      nc.ID,
+			Names:   []string{"/" + nc.Names},
+			Image:   nc.Image,
+			State:   stateFromStatus(nc.Status),
+			Status:  nc.Status,
+			Created: created.Unix(),
+			Labels:  parseLabels(nc.Labels),
+		})
+	}
+	return containers, nil
+}
+
+// parseLabels splits nerdctl's label list. Values containing commas are cut
+// short, callers needing full values inspect the container instead.
+func parseLabels(list string) map[string]string {
+	labels := make(map[string]string)
+	for _, l := range strings.Split(list, ",") {
+		if k, v, ok := strings.Cut(l, "="); ok {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// stateFromStatus derives the Docker container state from a human readable status
+func stateFromStatus(status string) string {
+	switch {
+	case strings.HasPrefix(status, "Up"):
+		return "running"
+	case strings.HasPrefix(status, "Exited"):
+		return "exited"
+	case strings.HasPrefix(status, "Created"):
+		return "created"
+	case strings.HasPrefix(status, "Paused"):
+		return "paused"
+	default:
+		return strings.ToLower(status)
+	}
+}
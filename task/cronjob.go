@@ -0,0 +1,65 @@
+package task
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Label set on every task started by a cron job
+const CronJobLabel = "cube.cronjob"
+
+// What a cron job does when a trigger fires while a previous run is still active
+type ConcurrencyPolicy string
+
+const (
+	// Start the new run next to the active ones
+	AllowConcurrent ConcurrencyPolicy = "Allow"
+	// Skip the new run
+	ForbidConcurrent ConcurrencyPolicy = "Forbid"
+	// Stop the active runs and start the new one
+	ReplaceConcurrent ConcurrencyPolicy = "Replace"
+)
+
+var ConcurrencyPolicies = []ConcurrencyPolicy{AllowConcurrent, ForbidConcurrent, ReplaceConcurrent}
+
+// CronJob starts a new instance of a task template on every trigger of its schedule
+type CronJob struct {
+	ID                uuid.UUID
+	Name              string
+	Schedule          string
+	ConcurrencyPolicy ConcurrencyPolicy
+	Template          Task
+	// Most recent runs, oldest first
+	History   []CronRun
+	NextRun   time.Time
+	CreatedAt time.Time
+}
+
+// A single trigger of a cron job
+type CronRun struct {
+	ScheduledAt time.Time
+	TaskID      uuid.UUID `json:",omitempty"`
+	// Last known state of the run's task
+	State State
+	// Set when the run was skipped because of the concurrency policy
+	Skipped bool `json:",omitempty"`
+}
+
+// NewRun returns a new task instance of the cron job template. Runs are named
+// after their trigger time so their containers don't clash on a node.
+func (c *CronJob) NewRun(at time.Time) Task {
+	t := c.Template
+	t.ID = uuid.New()
+	t.State = Pending
+	if t.Name != "" {
+		t.Name = fmt.Sprintf("%s-%d", t.Name, at.Unix())
+	}
+	t.Labels = make(map[string]string, len(c.Template.Labels)+1)
+	for k, v := range c.Template.Labels {
+		t.Labels[k] = v
+	}
+	t.Labels[CronJobLabel] = c.ID.String()
+	return t
+}
@@ -0,0 +1,43 @@
+package task
+
+import "time"
+
+/**
+* Timeouts and deadlines
+* Batch jobs can hang. The worker kills the container of a task running longer than
+* its Timeout, or still running at its Deadline, and marks the task Failed with the
+* DeadlineExceeded reason. The manager fails tasks whose Deadline passes before they
+* are dispatched. Such tasks are only restarted when their restart policy sets
+* RestartOnDeadline, and never once their Deadline has passed.
+ */
+// DeadlineAt returns when the running task must be done, zero when it may run forever
+func (t Task) DeadlineAt() time.Time {
+	var at time.Time
+	if t.Timeout > 0 && !t.StartTime.IsZero() {
+		at = t.StartTime.Add(time.Duration(t.Timeout) * time.Second)
+	}
+	if !t.Deadline.IsZero() && (at.IsZero() || t.Deadline.Before(at)) {
+		at = t.Deadline
+	}
+	return at
+}
+
+// DeadlineExceeded reports whether the running task is past its timeout or deadline
+func (t Task) DeadlineExceeded(now time.Time) bool {
+	at := t.DeadlineAt()
+	return !at.IsZero() && !now.Before(at)
+}
+
+// RestartAllowed reports whether the failed task is restarted by its restart policy,
+// never when its image does not exist
+func (t Task) RestartAllowed(now time.Time) bool {
+	if t.ErrorCode.Permanent() {
+		return false
+	}
+	if t.FailureReason == ReasonDeadlineExceeded {
+		if !t.RestartPolicy.RestartOnDeadline || !t.Deadline.IsZero() && !now.Before(t.Deadline) {
+			return false
+		}
+	}
+	return t.RestartPolicy.ShouldRestart(true, t.RestartCount)
+}
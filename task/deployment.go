@@ -0,0 +1,85 @@
+package task
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Labels set on every replica of a deployment
+const (
+	DeploymentLabel         = "cube.deployment"
+	DeploymentRevisionLabel = "cube.deployment.revision"
+)
+
+type DeploymentStatus string
+
+const (
+	// Replicas of an older revision are still being replaced
+	DeploymentProgressing DeploymentStatus = "Progressing"
+	// Every replica runs the current revision and is ready
+	DeploymentComplete DeploymentStatus = "Complete"
+)
+
+// Deployment runs Replicas copies of a task template and rolls out a new template
+// by replacing the replicas a few at a time: at most MaxSurge replicas above
+// Replicas are started, and at most MaxUnavailable replicas below Replicas are
+// not ready, at any point of the rollout. A zero MaxSurge and MaxUnavailable
+// default to a surge of one replica.
+type Deployment struct {
+	ID             uuid.UUID
+	Name           string
+	Replicas       int
+	Template       Task
+	MaxUnavailable int
+	MaxSurge       int
+	// Bumped every time a new template is deployed
+	Revision int
+	Status   DeploymentStatus
+	// Replicas running the current revision, and those of them that are ready
+	UpdatedReplicas int
+	ReadyReplicas   int
+	TaskIDs         []uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// ApplyDefaults sets a surge of one replica when the rollout has no room at all
+func (d *Deployment) ApplyDefaults() {
+	if d.MaxSurge == 0 && d.MaxUnavailable == 0 {
+		d.MaxSurge = 1
+	}
+}
+
+// NewReplica returns a new task instance of the deployment's current revision. Its
+// name gets a suffix from its ID, so replicas of two revisions can share a node.
+func (d *Deployment) NewReplica() Task {
+	t := d.Template
+	t.ID = uuid.New()
+	t.State = Pending
+	if t.Name != "" {
+		t.Name = fmt.Sprintf("%s-%s", t.Name, t.ID.String()[:8])
+	}
+	t.Labels = make(map[string]string, len(d.Template.Labels)+2)
+	for k, v := range d.Template.Labels {
+		t.Labels[k] = v
+	}
+	t.Labels[DeploymentLabel] = d.ID.String()
+	t.Labels[DeploymentRevisionLabel] = strconv.Itoa(d.Revision)
+	return t
+}
+
+// Current reports whether t runs the deployment's current revision
+func (d *Deployment) Current(t Task) bool {
+	return t.Labels[DeploymentRevisionLabel] == strconv.Itoa(d.Revision)
+}
+
+// Ready reports whether t runs and passes its health checks, if it has any
+func Ready(t Task) bool {
+	if t.State != Running {
+		return false
+	}
+	return !t.HasHealthCheck() || t.Health == Healthy
+}
@@ -0,0 +1,103 @@
+package task
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+/**
+* CPU pinning and devices
+* CpusetCpus pins a task's container to host CPUs, in the cpuset list format of
+* docker run --cpuset-cpus, e.g. "0-3,6". DeviceRequests give it GPUs like
+* docker run --gpus: a number of them or specific ones, through a driver such as
+* nvidia. Tasks requesting GPUs are only placed on nodes advertising the gpu
+* capability with enough GPUs left unreserved.
+ */
+const GpuCapability = "gpu"
+
+// DeviceRequest asks the runtime for Count devices, or for the ones in DeviceIDs
+type DeviceRequest struct {
+	// Device driver, e.g. nvidia, the runtime picks one when empty
+	Driver string `json:",omitempty"`
+	// Number of devices, -1 for all of them
+	Count     int      `json:",omitempty"`
+	DeviceIDs []string `json:",omitempty"`
+	// Capabilities the devices must have, gpu when empty
+	Capabilities []string `json:",omitempty"`
+}
+
+// GPUs returns the number of GPUs the task requests. Requests for all of a node's
+// GPUs count as one, the least the node must have.
+func (t Task) GPUs() int {
+	n := 0
+	for _, r := range t.DeviceRequests {
+		switch {
+		case len(r.DeviceIDs) > 0:
+			n += len(r.DeviceIDs)
+		case r.Count < 0:
+			n++
+		default:
+			n += r.Count
+		}
+	}
+	return n
+}
+
+// ParseCpuset returns the CPUs of a cpuset list such as "0-3,6", in ascending order
+func ParseCpuset(s string) ([]int, error) {
+	var cpus []int
+	for _, part := range strings.Split(s, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		lo, err := strconv.Atoi(first)
+		if err != nil || lo < 0 {
+			return nil, fmt.Errorf("invalid cpuset %q, expected CPU numbers and ranges such as 0-3,6", s)
+		}
+		hi := lo
+		if isRange {
+			if hi, err = strconv.Atoi(last); err != nil || hi < lo {
+				return nil, fmt.Errorf("invalid cpuset %q, expected CPU numbers and ranges such as 0-3,6", s)
+			}
+		}
+		for cpu := lo; cpu <= hi; cpu++ {
+			if !slices.Contains(cpus, cpu) {
+				cpus = append(cpus, cpu)
+			}
+		}
+	}
+	slices.Sort(cpus)
+	return cpus, nil
+}
+
+// dockerDeviceRequests translates device requests to the Docker API type
+func dockerDeviceRequests(requests []DeviceRequest) []container.DeviceRequest {
+	var drs []container.DeviceRequest
+	for _, r := range requests {
+		capabilities := r.Capabilities
+		if len(capabilities) == 0 {
+			capabilities = []string{GpuCapability}
+		}
+		drs = append(drs, container.DeviceRequest{
+			Driver:       r.Driver,
+			Count:        r.Count,
+			DeviceIDs:    r.DeviceIDs,
+			Capabilities: [][]string{capabilities},
+		})
+	}
+	return drs
+}
+
+// gpusFlag formats a device request as the value of nerdctl's --gpus flag
+func (r DeviceRequest) gpusFlag() string {
+	switch {
+	case len(r.DeviceIDs) > 0:
+		return fmt.Sprintf(`"device=%s"`, strings.Join(r.DeviceIDs, ","))
+	case r.Count < 0:
+		return "all"
+	default:
+		return fmt.Sprintf("count=%d", r.Count)
+	}
+}
@@ -0,0 +1,159 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+// FailureReason tells why a task failed, so users can tell a crash from an OOM
+// kill or an image that could not be pulled
+type FailureReason string
+
+const (
+	// The container exited on its own, with ExitCode
+	ReasonError FailureReason = "Error"
+	// The container of a task that is not a job exited with code 0
+	ReasonCompleted FailureReason = "Completed"
+	// The container was killed for exceeding its memory limit
+	ReasonOOMKilled FailureReason = "OOMKilled"
+	// The image could not be pulled, or is missing with the Never pull policy
+	ReasonImagePullFailed FailureReason = "ImagePullFailed"
+	// The container could not be created or started
+	ReasonStartFailed FailureReason = "StartFailed"
+	// The container disappeared while the task was running
+	ReasonContainerMissing FailureReason = "ContainerMissing"
+	// The task failed its health probes
+	ReasonUnhealthy FailureReason = "Unhealthy"
+	// The task never passed its startup probe
+	ReasonStartupProbeFailed FailureReason = "StartupProbeFailed"
+	// The task ran past its Timeout or Deadline
+	ReasonDeadlineExceeded FailureReason = "DeadlineExceeded"
+	// No node could run the task within the manager's maximum unschedulable age
+	ReasonUnschedulable FailureReason = "Unschedulable"
+)
+
+// ImagePullError is returned by runtimes unable to make the task's image available
+type ImagePullError struct {
+	Image string
+	Err   error
+}
+
+func (e *ImagePullError) Error() string {
+	return fmt.Sprintf("pulling image %s: %v", e.Image, e.Err)
+}
+
+func (e *ImagePullError) Unwrap() error {
+	return e.Err
+}
+
+// StartFailureReason returns why starting a task's container failed with err
+func StartFailureReason(err error) FailureReason {
+	var pullErr *ImagePullError
+	if errors.As(err, &pullErr) {
+		return ReasonImagePullFailed
+	}
+	return ReasonStartFailed
+}
+
+// ErrorCode tells which step of starting a container failed and how, so a typo in
+// an image name is not retried like a registry that is briefly unreachable
+type ErrorCode string
+
+const (
+	// The registry refused the credentials, or the image requires some
+	CodePullAuth ErrorCode = "PullAuth"
+	// The image or its tag does not exist, restarting the task cannot help
+	CodePullNotFound ErrorCode = "PullNotFound"
+	// The registry could not be reached, pulls are retried by the worker
+	CodePullNetwork ErrorCode = "PullNetwork"
+	// Any other pull error, e.g. a missing image with the Never pull policy
+	CodePullFailed ErrorCode = "PullFailed"
+	// The runtime could not create the container, e.g. a name conflict
+	CodeCreateFailed ErrorCode = "CreateFailed"
+	// The container was created but did not start, e.g. a missing entrypoint
+	CodeStartFailed ErrorCode = "StartFailed"
+)
+
+// StartError is returned by runtimes failing to create or start a container
+type StartError struct {
+	Code ErrorCode
+	Err  error
+}
+
+func (e *StartError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StartError) Unwrap() error {
+	return e.Err
+}
+
+// ClassifyStartError returns the code of an error starting a container, empty for
+// errors raised before the runtime was called
+func ClassifyStartError(err error) ErrorCode {
+	var pullErr *ImagePullError
+	if errors.As(err, &pullErr) {
+		return classifyPullError(pullErr.Err)
+	}
+	var startErr *StartError
+	if errors.As(err, &startErr) {
+		return startErr.Code
+	}
+	return ""
+}
+
+func classifyPullError(err error) ErrorCode {
+	var netErr net.Error
+	switch {
+	case errdefs.IsNotFound(err):
+		return CodePullNotFound
+	case errdefs.IsUnauthorized(err), errdefs.IsForbidden(err):
+		return CodePullAuth
+	case errdefs.IsUnavailable(err), errdefs.IsDeadline(err), client.IsErrConnectionFailed(err), errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr):
+		return CodePullNetwork
+	}
+	// Runtimes driven through a CLI, such as nerdctl, only report messages
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "not found"), strings.Contains(msg, "does not exist"), strings.Contains(msg, "manifest unknown"):
+		return CodePullNotFound
+	case strings.Contains(msg, "unauthorized"), strings.Contains(msg, "denied"), strings.Contains(msg, "authentication required"):
+		return CodePullAuth
+	case strings.Contains(msg, "timeout"), strings.Contains(msg, "connection refused"), strings.Contains(msg, "no such host"),
+		strings.Contains(msg, "connection reset"), strings.Contains(msg, "tls handshake"), strings.Contains(msg, "service unavailable"):
+		return CodePullNetwork
+	}
+	return CodePullFailed
+}
+
+// Transient reports whether starting the container again may succeed without any change
+func (c ErrorCode) Transient() bool {
+	return c == CodePullNetwork
+}
+
+// Permanent reports whether restarting the task cannot succeed until its spec changes
+func (c ErrorCode) Permanent() bool {
+	return c == CodePullNotFound
+}
+
+// StartFailed reports whether the task failed before its container ran
+func (t Task) StartFailed() bool {
+	return t.State == Failed && (t.FailureReason == ReasonStartFailed || t.FailureReason == ReasonImagePullFailed)
+}
+
+// ExitReason returns why the container of a task exited
+func ExitReason(exitCode int, oomKilled bool) FailureReason {
+	switch {
+	case oomKilled:
+		return ReasonOOMKilled
+	case exitCode != 0:
+		return ReasonError
+	}
+	return ReasonCompleted
+}
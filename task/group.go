@@ -0,0 +1,84 @@
+package task
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Label set on every member of a task group
+const GroupLabel = "cube.group"
+
+// TaskGroup runs several containers side by side on one worker, like a pod. The
+// members are placed together, the node is selected for their summed requests,
+// they reach each other by name on the group's network and are stopped as a unit.
+type TaskGroup struct {
+	ID   uuid.UUID
+	Name string
+	// Member specs, each needs a Name unique within the group
+	Tasks   []Task
+	TaskIDs []uuid.UUID
+	// Worker the members run on, set by the manager when the first member is placed
+	Worker    string `json:",omitempty"`
+	CreatedAt time.Time
+}
+
+// Network returns the name of the network the members of the group share
+func (g *TaskGroup) Network() string {
+	return "cube-group-" + g.ID.String()[:8]
+}
+
+// NewMembers returns the task instances of the group's members. Their names are
+// prefixed with the group name, which keeps container names unique on the worker,
+// and are their DNS names on the group's network.
+func (g *TaskGroup) NewMembers() []Task {
+	members := make([]Task, 0, len(g.Tasks))
+	for _, spec := range g.Tasks {
+		t := spec
+		t.ID = uuid.New()
+		t.State = Pending
+		t.Name = fmt.Sprintf("%s-%s", g.Name, spec.Name)
+		t.Labels = make(map[string]string, len(spec.Labels)+1)
+		for k, v := range spec.Labels {
+			t.Labels[k] = v
+		}
+		t.Labels[GroupLabel] = g.ID.String()
+		t.Networks = append([]string{g.Network()}, spec.Networks...)
+		members = append(members, t)
+	}
+	return members
+}
+
+// Placement returns a task standing for the whole group when selecting its node:
+// the summed requests of the members under the placement rules of all of them
+func (g *TaskGroup) Placement() Task {
+	p := Task{Name: g.Name, State: Pending, NodeSelector: make(map[string]string)}
+	for i, t := range g.Tasks {
+		p.Cpu += t.Cpu
+		p.Memory += t.Memory
+		p.Disk += t.Disk
+		if i == 0 || t.Priority > p.Priority {
+			p.Priority = t.Priority
+		}
+		for k, v := range t.NodeSelector {
+			p.NodeSelector[k] = v
+		}
+		p.Constraints = append(p.Constraints, t.Constraints...)
+		p.DeviceRequests = append(p.DeviceRequests, t.DeviceRequests...)
+		for _, c := range t.Capabilities {
+			if !slices.Contains(p.Capabilities, c) {
+				p.Capabilities = append(p.Capabilities, c)
+			}
+		}
+		if p.Affinity == "" {
+			p.Affinity = t.Affinity
+		}
+		if p.AntiAffinity == "" {
+			p.AntiAffinity = t.AntiAffinity
+		}
+	}
+	p.QoSClass = QoSClassFor(p)
+	return p
+}
@@ -0,0 +1,36 @@
+package task
+
+import "time"
+
+/**
+* Placement history
+* The manager records every worker that accepted a task, with the task's restart
+* count at the time, so restarts can be attributed to the node the task is on and a
+* task failing over and over on the same node can be moved to another one.
+ */
+const MaxPlacements = 10
+
+type Placement struct {
+	Worker string
+	Time   time.Time
+	// RestartCount of the task when it was placed
+	RestartCount int
+	// Why the task left the previous worker, empty for its first placement
+	Reason string `json:",omitempty"`
+}
+
+// AddPlacement records that worker accepted the task, keeping the last MaxPlacements
+func (t *Task) AddPlacement(worker string, reason string) {
+	t.Placements = append(t.Placements, Placement{Worker: worker, Time: time.Now().UTC(), RestartCount: t.RestartCount, Reason: reason})
+	if len(t.Placements) > MaxPlacements {
+		t.Placements = t.Placements[len(t.Placements)-MaxPlacements:]
+	}
+}
+
+// RestartsOnWorker returns the restarts of the task since it was placed on its current worker
+func (t Task) RestartsOnWorker() int {
+	if len(t.Placements) == 0 {
+		return t.RestartCount
+	}
+	return t.RestartCount - t.Placements[len(t.Placements)-1].RestartCount
+}
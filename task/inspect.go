@@ -0,0 +1,76 @@
+package task
+
+import (
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+)
+
+// Inspection is a task together with the state of its container, as served by
+// GET /tasks/{taskID} on the worker and manager APIs
+type Inspection struct {
+	Task      Task
+	Container *ContainerState `json:",omitempty"`
+	// Why the container could not be inspected, if it could not
+	ContainerError string `json:",omitempty"`
+}
+
+// ContainerState is the part of a container inspection relevant to a task
+type ContainerState struct {
+	ID         string
+	Name       string
+	Image      string
+	Status     string
+	Running    bool
+	ExitCode   int
+	OOMKilled  bool
+	Error      string `json:",omitempty"`
+	StartedAt  string
+	FinishedAt string `json:",omitempty"`
+	// Health reported by the container's healthcheck, if it has one
+	Health HealthStatus `json:",omitempty"`
+	// Host port mappings of the container's ports
+	Ports nat.PortMap `json:",omitempty"`
+	// Address of the container on each of its networks
+	Networks map[string]string `json:",omitempty"`
+}
+
+// NewContainerState summarizes a container inspection
+func NewContainerState(c *container.InspectResponse) *ContainerState {
+	cs := &ContainerState{}
+	if c.ContainerJSONBase != nil {
+		cs.ID = c.ID
+		cs.Name = strings.TrimPrefix(c.Name, "/")
+		cs.Image = c.Image
+		if s := c.State; s != nil {
+			cs.Status = s.Status
+			cs.Running = s.Running
+			cs.ExitCode = s.ExitCode
+			cs.OOMKilled = s.OOMKilled
+			cs.Error = s.Error
+			cs.StartedAt = s.StartedAt
+			if !s.Running {
+				cs.FinishedAt = s.FinishedAt
+			}
+			cs.Health = ContainerHealth(c)
+		}
+	}
+	if c.Config != nil && c.Config.Image != "" {
+		// The base image field is the image ID
+		cs.Image = c.Config.Image
+	}
+	if ns := c.NetworkSettings; ns != nil {
+		cs.Ports = ns.Ports
+		for name, ep := range ns.Networks {
+			if ep == nil {
+				continue
+			}
+			if cs.Networks == nil {
+				cs.Networks = make(map[string]string)
+			}
+			cs.Networks[name] = ep.IPAddress
+		}
+	}
+	return cs
+}
@@ -0,0 +1,65 @@
+package task
+
+import (
+	"fmt"
+	"strings"
+)
+
+/**
+* Label selectors
+* A comma separated list of requirements, e.g. "app=web,tier!=db". All must match.
+ */
+type Requirement struct {
+	Key      string
+	Value    string
+	NotEqual bool
+}
+
+type Selector []Requirement
+
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		r := Requirement{}
+		k, v, ok := strings.Cut(part, "!=")
+		if ok {
+			r.NotEqual = true
+		} else if k, v, ok = strings.Cut(part, "="); !ok {
+			return nil, fmt.Errorf("invalid selector requirement %q, expected key=value or key!=value", part)
+		}
+		r.Key = strings.TrimSpace(k)
+		r.Value = strings.TrimSpace(strings.TrimPrefix(v, "="))
+		if r.Key == "" {
+			return nil, fmt.Errorf("invalid selector requirement %q, missing key", part)
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		v, ok := labels[r.Key]
+		if r.NotEqual == (ok && v == r.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s Selector) String() string {
+	parts := make([]string, len(s))
+	for i, r := range s {
+		op := "="
+		if r.NotEqual {
+			op = "!="
+		}
+		parts[i] = r.Key + op + r.Value
+	}
+	return strings.Join(parts, ",")
+}
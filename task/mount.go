@@ -0,0 +1,57 @@
+package task
+
+import (
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+)
+
+/**
+* Task mounts
+* - bind:   Source is a path on the worker host
+* - volume: Source names a volume, created by the runtime when missing
+* - tmpfs:  in-memory filesystem, Source is unused
+ */
+type MountType string
+
+const (
+	BindMount   MountType = "bind"
+	VolumeMount MountType = "volume"
+	TmpfsMount  MountType = "tmpfs"
+)
+
+var MountTypes = []MountType{BindMount, VolumeMount, TmpfsMount}
+
+type Mount struct {
+	Type     MountType
+	Source   string `json:",omitempty"`
+	Target   string
+	ReadOnly bool `json:",omitempty"`
+}
+
+// dockerMounts translates task mounts to the Docker API type
+func dockerMounts(mounts []Mount) []mount.Mount {
+	var dm []mount.Mount
+	for _, m := range mounts {
+		dm = append(dm, mount.Mount{
+			Type:     mount.Type(m.Type),
+			Source:   m.Source,
+			Target:   m.Target,
+			ReadOnly: m.ReadOnly,
+		})
+	}
+	return dm
+}
+
+// String formats the mount as a --mount flag value
+func (m Mount) String() string {
+	fields := []string{"type=" + string(m.Type)}
+	if m.Source != "" {
+		fields = append(fields, "source="+m.Source)
+	}
+	fields = append(fields, "target="+m.Target)
+	if m.ReadOnly {
+		fields = append(fields, "readonly")
+	}
+	return strings.Join(fields, ",")
+}
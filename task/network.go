@@ -0,0 +1,88 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+)
+
+/**
+* Task networks
+* Tasks listing Networks are attached to those user-defined bridge networks, which
+* the worker creates on first use. On them a task is reachable by other tasks under
+* its Name, kept across rolling updates, instead of through published host ports.
+* Tasks without Networks stay on the runtime's default network. nerdctl has no
+* network aliases, on containerd tasks resolve each other by container name.
+ */
+
+// Label set on the networks created by workers
+const NetworkLabel = "cube.managed"
+
+var networkNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Networks a task may not join: they have no name resolution or bypass port mapping
+var ReservedNetworks = []string{"bridge", "host", "none", "default"}
+
+// ValidNetworkName reports why name cannot be used as a task network, if it cannot
+func ValidNetworkName(name string) error {
+	if !networkNamePattern.MatchString(name) {
+		return fmt.Errorf("%q is not a valid network name", name)
+	}
+	for _, r := range ReservedNetworks {
+		if strings.EqualFold(name, r) {
+			return fmt.Errorf("%q is reserved by the container runtime", name)
+		}
+	}
+	return nil
+}
+
+// ensureNetworks creates the configured networks missing on the host
+func (d *Docker) ensureNetworks(ctx context.Context) error {
+	for _, name := range d.Config.Networks {
+		networks, err := d.Client.NetworkList(ctx, network.ListOptions{
+			Filters: filters.NewArgs(filters.Arg("name", name)),
+		})
+		if err != nil {
+			return err
+		}
+		// The name filter also matches on substrings
+		found := false
+		for _, n := range networks {
+			found = found || n.Name == name
+		}
+		if found {
+			continue
+		}
+		logger.Info("Creating network", "network", name)
+		_, err = d.Client.NetworkCreate(ctx, name, network.CreateOptions{
+			Driver: "bridge",
+			Labels: map[string]string{NetworkLabel: "true"},
+		})
+		// Another task may have created it in the meantime
+		if err != nil && !strings.Contains(err.Error(), "already exists") {
+			return fmt.Errorf("error creating network %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// networkingConfig attaches the container to the configured networks, under its
+// DNS alias when set
+func (c Config) networkingConfig() *network.NetworkingConfig {
+	if len(c.Networks) == 0 {
+		return nil
+	}
+	nc := &network.NetworkingConfig{EndpointsConfig: make(map[string]*network.EndpointSettings)}
+	for _, name := range c.Networks {
+		es := &network.EndpointSettings{}
+		if c.Alias != "" {
+			es.Aliases = []string{c.Alias}
+		}
+		nc.EndpointsConfig[name] = es
+	}
+	return nc
+}
@@ -0,0 +1,35 @@
+package task
+
+import (
+	"maps"
+	"slices"
+)
+
+/**
+* Placement constraints
+* - NodeSelector: node labels the task requires, matched exactly
+* - Constraints:  node label requirements such as "zone=eu-west" or "gpu!=true"
+* - Affinity:     selector over task labels, the task is placed next to a live match
+* - AntiAffinity: selector over task labels, the task avoids nodes running a live match
+ */
+
+// NodeRequirements combines NodeSelector and Constraints into a single selector.
+// Constraints are validated on submission, invalid ones are ignored here.
+func (t Task) NodeRequirements() Selector {
+	var sel Selector
+	for _, k := range sortedKeys(t.NodeSelector) {
+		sel = append(sel, Requirement{Key: k, Value: t.NodeSelector[k]})
+	}
+	for _, c := range t.Constraints {
+		if s, err := ParseSelector(c); err == nil {
+			sel = append(sel, s...)
+		}
+	}
+	return sel
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := slices.Collect(maps.Keys(m))
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,88 @@
+package task
+
+import (
+	"fmt"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+/**
+* Platforms
+* A task's Platform pins the OS and architecture its image is pulled and run for,
+* written os/arch or os/arch/variant as in docker --platform, e.g. linux/arm64 or
+* linux/arm/v7. Workers report the platform they run on with their stats and the
+* scheduler only places the task on nodes of the same OS and architecture, so
+* amd64 and arm64 nodes can share a cluster. Tasks without a Platform run on any
+* node, with the image variant the node's runtime picks.
+ */
+type Platform struct {
+	OS           string
+	Architecture string
+	Variant      string `json:",omitempty"`
+}
+
+// Common aliases of the architectures, as reported by uname
+var archAliases = map[string]string{
+	"x86_64":  "amd64",
+	"x86-64":  "amd64",
+	"aarch64": "arm64",
+	"armhf":   "arm",
+	"i386":    "386",
+}
+
+// ParsePlatform parses os/arch[/variant], normalizing the architecture's aliases
+func ParsePlatform(s string) (Platform, error) {
+	parts := strings.Split(strings.ToLower(s), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return Platform{}, fmt.Errorf("platform %q must be os/arch or os/arch/variant, e.g. linux/arm64", s)
+	}
+	p := Platform{OS: parts[0], Architecture: parts[1]}
+	if alias, ok := archAliases[p.Architecture]; ok {
+		p.Architecture = alias
+	}
+	if len(parts) == 3 {
+		if parts[2] == "" {
+			return Platform{}, fmt.Errorf("platform %q has an empty variant", s)
+		}
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+func (p Platform) String() string {
+	if p.Variant != "" {
+		return p.OS + "/" + p.Architecture + "/" + p.Variant
+	}
+	return p.OS + "/" + p.Architecture
+}
+
+// Runs reports whether a node of platform node can run images of p. Variants are
+// not reported by nodes and left to the runtime.
+func (p Platform) Runs(node Platform) bool {
+	return p.OS == node.OS && p.Architecture == node.Architecture
+}
+
+// TargetPlatform returns the task's parsed Platform, nil when it runs anywhere
+func (t Task) TargetPlatform() (*Platform, error) {
+	if t.Platform == "" {
+		return nil, nil
+	}
+	p, err := ParsePlatform(t.Platform)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ociPlatform returns the platform containers are created for, nil for the daemon's default
+func (c *Config) ociPlatform() *ocispec.Platform {
+	if c.Platform == "" {
+		return nil
+	}
+	p, err := ParsePlatform(c.Platform)
+	if err != nil {
+		return nil
+	}
+	return &ocispec.Platform{OS: p.OS, Architecture: p.Architecture, Variant: p.Variant}
+}
@@ -0,0 +1,59 @@
+package task
+
+import (
+	"maps"
+	"strings"
+
+	"github.com/docker/go-connections/nat"
+)
+
+/**
+* Host port bindings
+* PortBindings maps a container port, e.g. "80" or "53/udp", to a fixed host port.
+* Exposed ports without a binding are published on a random host port. The protocol
+* of a container port defaults to tcp, and a binding uses the same protocol on the host.
+ */
+
+// containerPort returns the port spec of a PortBindings key with its protocol
+func containerPort(spec string) nat.Port {
+	if !strings.Contains(spec, "/") {
+		spec += "/tcp"
+	}
+	return nat.Port(spec)
+}
+
+// BoundHostPorts returns the host ports the task binds explicitly, as "port/proto"
+func (t *Task) BoundHostPorts() []string {
+	var ports []string
+	for spec, hostPort := range t.PortBindings {
+		ports = append(ports, hostPort+"/"+containerPort(spec).Proto())
+	}
+	return ports
+}
+
+// exposedPorts returns the exposed ports of c, including the bound ones
+func (c Config) exposedPorts() nat.PortSet {
+	if len(c.PortBindings) == 0 {
+		return c.ExposedPorts
+	}
+	ports := maps.Clone(c.ExposedPorts)
+	if ports == nil {
+		ports = make(nat.PortSet)
+	}
+	for spec := range c.PortBindings {
+		ports[containerPort(spec)] = struct{}{}
+	}
+	return ports
+}
+
+// portBindings translates the PortBindings of c to the Docker API type
+func (c Config) portBindings() nat.PortMap {
+	if len(c.PortBindings) == 0 {
+		return nil
+	}
+	bindings := make(nat.PortMap)
+	for spec, hostPort := range c.PortBindings {
+		bindings[containerPort(spec)] = []nat.PortBinding{{HostPort: hostPort}}
+	}
+	return bindings
+}
@@ -0,0 +1,16 @@
+package task
+
+/**
+* Task priority
+* Pending tasks are dispatched by Priority, highest first, and in submission order
+* within a priority. With the Preemption feature gate enabled, a task no node has
+* room for evicts lower priority tasks, which are rescheduled once room frees up.
+ */
+const (
+	LowPriority    = -100
+	NormalPriority = 0
+	HighPriority   = 100
+
+	MinPriority = -1000
+	MaxPriority = 1000
+)
@@ -0,0 +1,175 @@
+package task
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+/**
+* Health probes
+* Probes run on the worker against the task's container. HTTP probes GET a path on
+* a published port, TCP probes connect to a published port, and exec probes run a
+* command inside the container. A task failing FailureThreshold consecutive probes
+* is marked Failed and Unhealthy, and restarted by the manager.
+* Failures are only counted once the container has run for InitialDelaySeconds,
+* so slow-starting apps are not restarted while booting. A StartupProbe goes
+* further: the Probe only runs once the startup probe succeeded, and a task
+* failing its startup probe FailureThreshold times in a row is failed.
+ */
+type ProbeType string
+
+const (
+	HTTPProbe ProbeType = "http"
+	TCPProbe  ProbeType = "tcp"
+	ExecProbe ProbeType = "exec"
+)
+
+var ProbeTypes = []ProbeType{HTTPProbe, TCPProbe, ExecProbe}
+
+const (
+	defaultProbeInterval         = 10 * time.Second
+	defaultProbeTimeout          = 2 * time.Second
+	defaultProbeFailureThreshold = 3
+)
+
+type Probe struct {
+	Type ProbeType
+	// Path requested by HTTP probes
+	Path string `json:",omitempty"`
+	// Exposed port probed by HTTP and TCP probes, e.g. 80/tcp; defaults to the first published port
+	Port string `json:",omitempty"`
+	// Command exec probes run in the container, healthy when it exits with 0
+	Command []string `json:",omitempty"`
+	// Zero values use the defaults: every 10 seconds, 2 second timeout, 3 failures
+	IntervalSeconds  int `json:",omitempty"`
+	TimeoutSeconds   int `json:",omitempty"`
+	FailureThreshold int `json:",omitempty"`
+	// Grace period after the container started during which failures are not counted
+	InitialDelaySeconds int `json:",omitempty"`
+}
+
+func (p Probe) Interval() time.Duration {
+	if p.IntervalSeconds <= 0 {
+		return defaultProbeInterval
+	}
+	return time.Duration(p.IntervalSeconds) * time.Second
+}
+
+func (p Probe) Timeout() time.Duration {
+	if p.TimeoutSeconds <= 0 {
+		return defaultProbeTimeout
+	}
+	return time.Duration(p.TimeoutSeconds) * time.Second
+}
+
+func (p Probe) Threshold() int {
+	if p.FailureThreshold <= 0 {
+		return defaultProbeFailureThreshold
+	}
+	return p.FailureThreshold
+}
+
+func (p Probe) InitialDelay() time.Duration {
+	return time.Duration(max(p.InitialDelaySeconds, 0)) * time.Second
+}
+
+// Result of the latest probes of a running task
+type HealthStatus string
+
+const (
+	Healthy   HealthStatus = "Healthy"
+	Unhealthy HealthStatus = "Unhealthy"
+)
+
+// HasHealthCheck reports whether the task's health is checked, by a probe or by its container's healthcheck
+func (t Task) HasHealthCheck() bool {
+	return t.HealthProbe() != nil || t.StartupProbe != nil || (t.ContainerHealthcheck != nil && !t.ContainerHealthcheck.Disabled())
+}
+
+// HealthProbe returns the task's probe; a plain HealthCheck path is an HTTP probe
+func (t Task) HealthProbe() *Probe {
+	if t.Probe != nil {
+		return t.Probe
+	}
+	if t.HealthCheck != "" {
+		return &Probe{Type: HTTPProbe, Path: t.HealthCheck}
+	}
+	return nil
+}
+
+/**
+* Container healthchecks
+* A ContainerHealthcheck is run by the container runtime itself, like a HEALTHCHECK
+* in a Dockerfile, instead of by the worker's probes. The worker reads the health
+* the runtime reports when it inspects the container: a container reported
+* unhealthy is stopped and the task marked Failed and Unhealthy, like a task failing
+* its probes.
+ */
+type ContainerHealthcheck struct {
+	// Command run in the container: ["CMD", args...] runs it directly, ["CMD-SHELL",
+	// command] with the container's shell, ["NONE"] disables the image's healthcheck
+	Test []string
+	// Zero values use the runtime's defaults
+	IntervalSeconds    int `json:",omitempty"`
+	TimeoutSeconds     int `json:",omitempty"`
+	StartPeriodSeconds int `json:",omitempty"`
+	// Consecutive failures before the container is unhealthy
+	Retries int `json:",omitempty"`
+}
+
+// Disabled reports whether the healthcheck turns off the one defined by the image
+func (h ContainerHealthcheck) Disabled() bool {
+	return len(h.Test) > 0 && h.Test[0] == "NONE"
+}
+
+func (h ContainerHealthcheck) dockerConfig() *container.HealthConfig {
+	return &container.HealthConfig{
+		Test:        h.Test,
+		Interval:    time.Duration(h.IntervalSeconds) * time.Second,
+		Timeout:     time.Duration(h.TimeoutSeconds) * time.Second,
+		StartPeriod: time.Duration(h.StartPeriodSeconds) * time.Second,
+		Retries:     h.Retries,
+	}
+}
+
+// nerdctlFlags returns the healthcheck as nerdctl run flags, which take the command as a shell command
+func (h ContainerHealthcheck) nerdctlFlags() []string {
+	if h.Disabled() {
+		return []string{"--no-healthcheck"}
+	}
+	var args []string
+	if len(h.Test) > 1 {
+		args = append(args, "--health-cmd", strings.Join(h.Test[1:], " "))
+	}
+	durations := []struct {
+		flag    string
+		seconds int
+	}{{"--health-interval", h.IntervalSeconds}, {"--health-timeout", h.TimeoutSeconds}, {"--health-start-period", h.StartPeriodSeconds}}
+	for _, d := range durations {
+		if d.seconds > 0 {
+			args = append(args, d.flag, (time.Duration(d.seconds) * time.Second).String())
+		}
+	}
+	if h.Retries > 0 {
+		args = append(args, "--health-retries", strconv.Itoa(h.Retries))
+	}
+	return args
+}
+
+// ContainerHealth maps the health a runtime reports for a container, empty while
+// its healthcheck is starting or when it has none
+func ContainerHealth(c *container.InspectResponse) HealthStatus {
+	if c == nil || c.ContainerJSONBase == nil || c.State == nil || c.State.Health == nil {
+		return ""
+	}
+	switch c.State.Health.Status {
+	case container.Healthy:
+		return Healthy
+	case container.Unhealthy:
+		return Unhealthy
+	}
+	return ""
+}
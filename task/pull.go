@@ -0,0 +1,104 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+)
+
+/**
+* Image pull policies
+* - Always:       pull the image on every start
+* - IfNotPresent: only pull when the image is missing on the host
+* - Never:        never pull, starting fails when the image is missing
+* When unset, images tagged latest (or untagged) are always pulled and any other
+* tag or digest is only pulled if not present. For a task with a Platform, an image
+* present for another platform counts as missing.
+ */
+type ImagePullPolicy string
+
+const (
+	PullAlways       ImagePullPolicy = "Always"
+	PullIfNotPresent ImagePullPolicy = "IfNotPresent"
+	PullNever        ImagePullPolicy = "Never"
+)
+
+var ImagePullPolicies = []ImagePullPolicy{PullAlways, PullIfNotPresent, PullNever}
+
+// PullPolicyFor returns the policy used to start image when none is set
+func PullPolicyFor(policy ImagePullPolicy, img string) ImagePullPolicy {
+	if policy != "" {
+		return policy
+	}
+	named, err := reference.ParseNormalizedNamed(img)
+	if err != nil {
+		return PullAlways
+	}
+	if _, ok := named.(reference.Digested); ok {
+		return PullIfNotPresent
+	}
+	if tagged, ok := reference.TagNameOnly(named).(reference.Tagged); ok && tagged.Tag() != "latest" {
+		return PullIfNotPresent
+	}
+	return PullAlways
+}
+
+// ensureImage makes the configured image available locally according to its pull policy
+func (d *Docker) ensureImage(ctx context.Context) error {
+	policy := PullPolicyFor(d.Config.ImagePullPolicy, d.Config.Image)
+	if policy != PullAlways {
+		present, err := d.imagePresent(ctx)
+		if err != nil {
+			return err
+		}
+		if present {
+			return nil
+		}
+		if policy == PullNever {
+			return fmt.Errorf("image %s not present and pull policy is %s", d.Config.Image, PullNever)
+		}
+	}
+
+	opts := image.PullOptions{Platform: d.Config.Platform}
+	if d.Config.RegistryAuth != nil {
+		auth, err := d.Config.RegistryAuth.Encode(RegistryDomain(d.Config.Image))
+		if err != nil {
+			return err
+		}
+		opts.RegistryAuth = auth
+	}
+	reader, err := d.Client.ImagePull(ctx, d.Config.Image, opts)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	io.Copy(os.Stdout, reader)
+	return nil
+}
+
+func (d *Docker) imagePresent(ctx context.Context) (bool, error) {
+	images, err := d.Client.ImageList(ctx, image.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("reference", d.Config.Image)),
+	})
+	if err != nil {
+		return false, err
+	}
+	if len(images) == 0 || d.Config.Platform == "" {
+		return len(images) > 0, nil
+	}
+	// An image pulled for another platform is pulled again
+	want, err := ParsePlatform(d.Config.Platform)
+	if err != nil {
+		return false, err
+	}
+	info, err := d.Client.ImageInspect(ctx, d.Config.Image)
+	if err != nil {
+		return false, err
+	}
+	return want.Runs(Platform{OS: info.Os, Architecture: info.Architecture}), nil
+}
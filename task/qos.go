@@ -0,0 +1,41 @@
+package task
+
+/**
+* Quality of Service classes
+* Derived from a task's resource requests (Cpu, Memory) and limits (CpuLimit, MemoryLimit):
+* - Guaranteed: CPU and memory requested, with limits equal to the requests (or unset)
+* - BestEffort: no requests and no limits
+* - Burstable:  anything in between
+ */
+type QoSClass string
+
+const (
+	Guaranteed QoSClass = "Guaranteed"
+	Burstable  QoSClass = "Burstable"
+	BestEffort QoSClass = "BestEffort"
+)
+
+// Rank orders classes by eviction preference, lowest is evicted first
+func (q QoSClass) Rank() int {
+	switch q {
+	case Guaranteed:
+		return 2
+	case Burstable:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func QoSClassFor(t Task) QoSClass {
+	if t.Cpu == 0 && t.Memory == 0 && t.CpuLimit == 0 && t.MemoryLimit == 0 {
+		return BestEffort
+	}
+
+	cpuGuaranteed := t.Cpu > 0 && (t.CpuLimit == 0 || t.CpuLimit == t.Cpu)
+	memGuaranteed := t.Memory > 0 && (t.MemoryLimit == 0 || t.MemoryLimit == t.Memory)
+	if cpuGuaranteed && memGuaranteed {
+		return Guaranteed
+	}
+	return Burstable
+}
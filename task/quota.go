@@ -0,0 +1,66 @@
+package task
+
+import (
+	"fmt"
+	"time"
+)
+
+/**
+* Namespaces and quotas
+* Every task belongs to a namespace, DefaultNamespace when it names none, so teams
+* sharing a cluster can be told apart. A Quota caps what the live tasks of a
+* namespace may request in total: CPU, memory, disk and the number of tasks. Zero
+* limits are unlimited, and namespaces without a quota are not limited at all.
+ */
+const DefaultNamespace = "default"
+
+type Quota struct {
+	Namespace string
+	Cpu       float64 `json:",omitempty"`
+	Memory    int64   `json:",omitempty"`
+	Disk      int64   `json:",omitempty"`
+	Tasks     int     `json:",omitempty"`
+	UpdatedAt time.Time
+}
+
+// QuotaUsage adds up the requests of the live tasks of a namespace
+type QuotaUsage struct {
+	Cpu    float64
+	Memory int64
+	Disk   int64
+	Tasks  int
+}
+
+// NamespaceOf returns the namespace of t, DefaultNamespace when it names none
+func NamespaceOf(t Task) string {
+	if t.Namespace == "" {
+		return DefaultNamespace
+	}
+	return t.Namespace
+}
+
+// Add counts the requests of t
+func (u *QuotaUsage) Add(t Task) {
+	u.Cpu += t.Cpu
+	u.Memory += t.Memory
+	u.Disk += t.Disk
+	u.Tasks++
+}
+
+// Exceeded returns the limits of q that adding t to used would go over
+func (q Quota) Exceeded(used QuotaUsage, t Task) []string {
+	var over []string
+	if q.Cpu > 0 && used.Cpu+t.Cpu > q.Cpu {
+		over = append(over, fmt.Sprintf("cpu: %.2f used + %.2f requested > %.2f", used.Cpu, t.Cpu, q.Cpu))
+	}
+	if q.Memory > 0 && used.Memory+t.Memory > q.Memory {
+		over = append(over, fmt.Sprintf("memory: %d used + %d requested > %d", used.Memory, t.Memory, q.Memory))
+	}
+	if q.Disk > 0 && used.Disk+t.Disk > q.Disk {
+		over = append(over, fmt.Sprintf("disk: %d used + %d requested > %d", used.Disk, t.Disk, q.Disk))
+	}
+	if q.Tasks > 0 && used.Tasks+1 > q.Tasks {
+		over = append(over, fmt.Sprintf("tasks: %d used, limit %d", used.Tasks, q.Tasks))
+	}
+	return over
+}
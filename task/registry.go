@@ -0,0 +1,192 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/registry"
+)
+
+/**
+* Registry credentials
+* Private images are pulled with the credentials of their registry. Workers load
+* credentials per registry domain from --registry-config, and a task can bring its
+* own through RegistryAuth, which take precedence. The manager and worker APIs
+* redact the secrets of task credentials in every response, see Redact.
+ */
+type RegistryAuth struct {
+	Username string `json:",omitempty"`
+	Password string `json:",omitempty"`
+	// Token used instead of a username and password
+	IdentityToken string `json:",omitempty"`
+}
+
+// Masks secrets like config.Settings.Redacted does
+const redactedSecret = "********"
+
+// Encode returns the credentials in the base64 form the Docker API expects
+func (a RegistryAuth) Encode(server string) (string, error) {
+	return registry.EncodeAuthConfig(registry.AuthConfig{
+		Username:      a.Username,
+		Password:      a.Password,
+		IdentityToken: a.IdentityToken,
+		ServerAddress: server,
+	})
+}
+
+// RegistryDomain returns the registry an image is pulled from, e.g. docker.io
+func RegistryDomain(img string) string {
+	named, err := reference.ParseNormalizedNamed(img)
+	if err != nil {
+		return ""
+	}
+	return reference.Domain(named)
+}
+
+// Registries maps registry domains to the credentials images are pulled from them with
+type Registries map[string]RegistryAuth
+
+// LoadRegistries reads registry credentials from a JSON file, e.g.
+// {"registry.example.com": {"Username": "ci", "Password": "s3cr3t"}}
+func LoadRegistries(filename string) (Registries, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var r Registries
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("error decoding %s: %v", filename, err)
+	}
+	return r, nil
+}
+
+// For returns the credentials the image of t is pulled with, nil for anonymous pulls
+func (r Registries) For(t Task) *RegistryAuth {
+	if t.RegistryAuth != nil {
+		return t.RegistryAuth
+	}
+	if auth, ok := r[RegistryDomain(t.Image)]; ok {
+		return &auth
+	}
+	return nil
+}
+
+// Redacted returns a copy of t with the secrets of its registry credentials masked
+func (t Task) Redacted() Task {
+	if t.RegistryAuth == nil {
+		return t
+	}
+	auth := *t.RegistryAuth
+	if auth.Password != "" {
+		auth.Password = redactedSecret
+	}
+	if auth.IdentityToken != "" {
+		auth.IdentityToken = redactedSecret
+	}
+	t.RegistryAuth = &auth
+	return t
+}
+
+// Redact returns v with the registry credentials of the tasks it holds masked, for
+// tasks, task events, inspections and the templates of services, deployments, cron
+// jobs and task groups. Other values are returned as they are.
+func Redact(v any) any {
+	switch v := v.(type) {
+	case Task:
+		return v.Redacted()
+	case *Task:
+		if v == nil {
+			return v
+		}
+		r := v.Redacted()
+		return &r
+	case []*Task:
+		return redactAll(v, Task.Redacted)
+	case TaskEvent:
+		return v.Redacted()
+	case []*TaskEvent:
+		return redactAll(v, TaskEvent.Redacted)
+	case *Inspection:
+		if v == nil {
+			return v
+		}
+		r := *v
+		r.Task = v.Task.Redacted()
+		return &r
+	case *Service:
+		return redactOne(v, Service.Redacted)
+	case []*Service:
+		return redactAll(v, Service.Redacted)
+	case *Deployment:
+		return redactOne(v, Deployment.Redacted)
+	case []*Deployment:
+		return redactAll(v, Deployment.Redacted)
+	case CronJob:
+		return v.Redacted()
+	case *CronJob:
+		return redactOne(v, CronJob.Redacted)
+	case []CronJob:
+		r := make([]CronJob, len(v))
+		for i, c := range v {
+			r[i] = c.Redacted()
+		}
+		return r
+	case *TaskGroup:
+		return redactOne(v, TaskGroup.Redacted)
+	case []*TaskGroup:
+		return redactAll(v, TaskGroup.Redacted)
+	}
+	return v
+}
+
+func redactOne[T any](v *T, redacted func(T) T) *T {
+	if v == nil {
+		return nil
+	}
+	r := redacted(*v)
+	return &r
+}
+
+func redactAll[T any](v []*T, redacted func(T) T) []*T {
+	r := make([]*T, len(v))
+	for i, item := range v {
+		r[i] = redactOne(item, redacted)
+	}
+	return r
+}
+
+// Redacted returns a copy of te with the secrets of its task's registry credentials masked
+func (te TaskEvent) Redacted() TaskEvent {
+	te.Task = te.Task.Redacted()
+	return te
+}
+
+// Redacted returns a copy of s with the secrets of its template's registry credentials masked
+func (s Service) Redacted() Service {
+	s.Template = s.Template.Redacted()
+	return s
+}
+
+// Redacted returns a copy of d with the secrets of its template's registry credentials masked
+func (d Deployment) Redacted() Deployment {
+	d.Template = d.Template.Redacted()
+	return d
+}
+
+// Redacted returns a copy of c with the secrets of its template's registry credentials masked
+func (c CronJob) Redacted() CronJob {
+	c.Template = c.Template.Redacted()
+	return c
+}
+
+// Redacted returns a copy of g with the secrets of its members' registry credentials masked
+func (g TaskGroup) Redacted() TaskGroup {
+	tasks := make([]Task, len(g.Tasks))
+	for i, t := range g.Tasks {
+		tasks[i] = t.Redacted()
+	}
+	g.Tasks = tasks
+	return g
+}
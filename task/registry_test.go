@@ -0,0 +1,53 @@
+package task
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tmpl := Task{Name: "web", Image: "registry.example.com/web:1", RegistryAuth: &RegistryAuth{Username: "deploy", Password: "hunter2", IdentityToken: "tok3n"}}
+	cron := CronJob{Template: tmpl}
+	tests := []struct {
+		name string
+		v    any
+	}{
+		{"task", tmpl},
+		{"task pointer", &tmpl},
+		{"tasks", []*Task{&tmpl}},
+		{"task event", TaskEvent{Task: tmpl}},
+		{"task events", []*TaskEvent{{Task: tmpl}}},
+		{"inspection", &Inspection{Task: tmpl}},
+		{"service", &Service{Template: tmpl}},
+		{"services", []*Service{{Template: tmpl}}},
+		{"deployment", &Deployment{Template: tmpl}},
+		{"deployments", []*Deployment{{Template: tmpl}}},
+		{"cron job", cron},
+		{"cron job pointer", &cron},
+		{"cron jobs", []CronJob{cron}},
+		{"task group", &TaskGroup{Tasks: []Task{tmpl}}},
+		{"task groups", []*TaskGroup{{Tasks: []Task{tmpl}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := json.Marshal(Redact(tt.v))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, secret := range []string{"hunter2", "tok3n"} {
+				if strings.Contains(string(out), secret) {
+					t.Errorf("response leaks %q: %s", secret, out)
+				}
+			}
+			if !strings.Contains(string(out), `"Username":"deploy"`) {
+				t.Errorf("response lost the username: %s", out)
+			}
+		})
+	}
+
+	// The original keeps its credentials, they are still sent to workers
+	if tmpl.RegistryAuth.Password != "hunter2" || cron.Template.RegistryAuth.IdentityToken != "tok3n" {
+		t.Error("Redact changed the credentials of the value it was given")
+	}
+}
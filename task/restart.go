@@ -0,0 +1,93 @@
+package task
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+/**
+* Restart policies
+* Containers exiting on their own are restarted in place by the worker, tasks failing
+* otherwise (start errors, failed probes) are restarted by the manager. Both honor the
+* task's RestartPolicy and wait an exponential backoff with jitter between restarts,
+* so crash looping containers do not hammer the worker.
+ */
+type RestartMode string
+
+const (
+	RestartNever     RestartMode = "never"
+	RestartOnFailure RestartMode = "on-failure"
+	// Also restarts jobs that completed successfully
+	RestartAlways RestartMode = "always"
+)
+
+var RestartModes = []RestartMode{RestartNever, RestartOnFailure, RestartAlways}
+
+const (
+	DefaultMaxRetries      = 3
+	defaultRestartBackoff  = 10 * time.Second
+	defaultMaxRestartDelay = 5 * time.Minute
+)
+
+type RestartPolicy struct {
+	// Defaults to RestartOnFailure
+	Name RestartMode `json:",omitempty"`
+	// Restarts over the lifetime of the task, zero uses DefaultMaxRetries
+	MaxRetries int `json:",omitempty"`
+	// Delay before the first restart, doubled on every further restart up to
+	// MaxBackoffSeconds. Zero values use 10 seconds and 5 minutes.
+	BackoffSeconds    int `json:",omitempty"`
+	MaxBackoffSeconds int `json:",omitempty"`
+	// Also restart tasks killed for exceeding their Timeout
+	RestartOnDeadline bool `json:",omitempty"`
+}
+
+func (p RestartPolicy) Mode() RestartMode {
+	if p.Name == "" {
+		return RestartOnFailure
+	}
+	return p.Name
+}
+
+func (p RestartPolicy) Retries() int {
+	if p.MaxRetries <= 0 {
+		return DefaultMaxRetries
+	}
+	return p.MaxRetries
+}
+
+// ShouldRestart reports whether a task that failed, or completed when failed is
+// false, is restarted after the given number of earlier restarts
+func (p RestartPolicy) ShouldRestart(failed bool, restarts int) bool {
+	if restarts >= p.Retries() {
+		return false
+	}
+	switch p.Mode() {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return failed
+	}
+	return false
+}
+
+// Backoff returns the delay before the next restart of a task restarted the given
+// number of times. Half of the delay is random, so tasks failing together spread out.
+func (p RestartPolicy) Backoff(restarts int) time.Duration {
+	base := defaultRestartBackoff
+	if p.BackoffSeconds > 0 {
+		base = time.Duration(p.BackoffSeconds) * time.Second
+	}
+	limit := defaultMaxRestartDelay
+	if p.MaxBackoffSeconds > 0 {
+		limit = time.Duration(p.MaxBackoffSeconds) * time.Second
+	}
+	limit = max(limit, base)
+
+	d := base
+	for i := 0; i < restarts && d < limit; i++ {
+		d *= 2
+	}
+	d = min(d, limit)
+	return d/2 + rand.N(d/2+1)
+}
@@ -0,0 +1,52 @@
+package task
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+/**
+* Job results
+* The output of a finished job is kept with its exit code, so it can be read
+* back after the container and its logs are gone. Workers capture stdout and
+* stderr apart, each up to a size limit, when the job exits. The manager fetches
+* the result once the job finishes and stores it with the task, it is deleted
+* when the task is collected.
+ */
+
+// Bytes of stdout and of stderr kept by default, the rest is dropped
+const DefaultMaxResultOutput = 1 << 20
+
+type Result struct {
+	TaskID     uuid.UUID
+	State      State
+	ExitCode   int
+	FinishTime time.Time
+	Stdout     string
+	Stderr     string
+	// Set when the stream was longer than the limit and only its start was kept
+	StdoutTruncated bool `json:",omitempty"`
+	StderrTruncated bool `json:",omitempty"`
+}
+
+// LimitedBuffer keeps the first Limit bytes written to it and drops the rest
+type LimitedBuffer struct {
+	Limit     int
+	Truncated bool
+	buf       []byte
+}
+
+func (b *LimitedBuffer) Write(p []byte) (int, error) {
+	if room := b.Limit - len(b.buf); len(p) > room {
+		b.buf = append(b.buf, p[:max(room, 0)]...)
+		b.Truncated = true
+		return len(p), nil
+	}
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+func (b *LimitedBuffer) String() string {
+	return string(b.buf)
+}
@@ -0,0 +1,56 @@
+package task
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+/**
+* Container runtimes
+* The worker drives containers through ContainerRuntime, selected with --runtime.
+* Docker and Podman share the Docker SDK implementation (Podman serves a Docker
+* compatible API) through the shared client of RuntimeClient, containerd is
+* driven through nerdctl.
+ */
+type ContainerRuntime interface {
+	// Create and start the container described by the runtime's Config
+	Run() DockerResult
+	// Stop and remove a container
+	Stop(id string) DockerResult
+	Inspect(containerID string) DockerInspectResponse
+	// Run a command in a running container, returning its exit code
+	Exec(ctx context.Context, containerID string, cmd []string) (int, error)
+	// Stream container logs, multiplexed the same way as the Docker API
+	Logs(ctx context.Context, containerID string, follow bool, tail string) (io.ReadCloser, error)
+	Stats(ctx context.Context, containerID string) (*ContainerStats, error)
+	// List all containers on the host, including stopped ones
+	List() ([]container.Summary, error)
+}
+
+const (
+	DockerRuntime     = "docker"
+	PodmanRuntime     = "podman"
+	ContainerdRuntime = "containerd"
+)
+
+var Runtimes = []string{DockerRuntime, PodmanRuntime, ContainerdRuntime}
+
+// Resource usage of a single container
+type ContainerStats struct {
+	CpuPercent  float64
+	MemoryUsage uint64
+	MemoryLimit uint64
+	// Bytes received and sent over the container's network interfaces
+	NetworkRx uint64
+	NetworkTx uint64
+	// When the usage was sampled
+	Timestamp time.Time
+}
+
+var (
+	_ ContainerRuntime = (*Docker)(nil)
+	_ ContainerRuntime = (*Containerd)(nil)
+)
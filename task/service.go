@@ -0,0 +1,38 @@
+package task
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Label set on every replica of a service
+const ServiceLabel = "cube.service"
+
+// Service runs Replicas copies of a task template, reconciled by the manager
+type Service struct {
+	ID       uuid.UUID
+	Name     string
+	Replicas int
+	Template Task
+	// Place replicas on distinct nodes through an anti-affinity on the service label
+	SpreadReplicas bool `json:",omitempty"`
+	TaskIDs        []uuid.UUID
+	CreatedAt      time.Time
+}
+
+// NewReplica returns a new task instance of the service template
+func (s *Service) NewReplica() Task {
+	t := s.Template
+	t.ID = uuid.New()
+	t.State = Pending
+	t.Labels = make(map[string]string, len(s.Template.Labels)+1)
+	for k, v := range s.Template.Labels {
+		t.Labels[k] = v
+	}
+	t.Labels[ServiceLabel] = s.ID.String()
+	if s.SpreadReplicas && t.AntiAffinity == "" {
+		t.AntiAffinity = ServiceLabel + "=" + s.ID.String()
+	}
+	return t
+}
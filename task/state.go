@@ -0,0 +1,171 @@
+package task
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+/**
+* Task State and State Machine
+* States move along the transitions of a StateMachine. The manager and the worker
+* each keep one and register hooks on it, which run when a task is seen moving from
+* one state to another. ValidStateTransition checks against the default transitions.
+ */
+// State Definition
+type State int
+
+const (
+	Pending State = iota
+	Scheduled
+	Running
+	Completed
+	Stopped
+	Failed
+	// Stop requested by the manager, waiting for the worker to confirm
+	Stopping
+	// Exited and waiting for the backoff of its restart policy on the worker
+	Restarting
+)
+
+var States = []State{Pending, Scheduled, Running, Completed, Stopped, Failed, Stopping, Restarting}
+
+// AnyState matches every state when registering transition hooks
+const AnyState State = -1
+
+func (s State) String() string {
+	switch s {
+	case Pending:
+		return "Pending"
+	case Scheduled:
+		return "Scheduled"
+	case Running:
+		return "Running"
+	case Completed:
+		return "Completed"
+	case Stopped:
+		return "Stopped"
+	case Failed:
+		return "Failed"
+	case Stopping:
+		return "Stopping"
+	case Restarting:
+		return "Restarting"
+	case AnyState:
+		return "Any"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// ParseState returns the state with the given name, case insensitively
+func ParseState(name string) (State, error) {
+	for _, s := range States {
+		if strings.EqualFold(s.String(), name) {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown state %q, expected one of %v", name, States)
+}
+
+// Active reports whether a task in this state is placed on a worker and holds its
+// resources there
+func (s State) Active() bool {
+	return s == Scheduled || s == Running || s == Restarting
+}
+
+// State Machine
+var stateTransitionMap = map[State][]State{
+	Pending:    {Scheduled},
+	Scheduled:  {Scheduled, Running, Failed, Stopping},
+	Running:    {Running, Completed, Failed, Stopping},
+	Stopping:   {Stopping, Completed, Failed, Stopped},
+	Failed:     {Restarting, Scheduled},
+	Restarting: {Restarting, Scheduled, Stopping, Stopped},
+	Completed:  {},
+	Stopped:    {},
+}
+
+func ValidStateTransition(src State, dst State) bool {
+	return slices.Contains(stateTransitionMap[src], dst)
+}
+
+// TransitionHook is called when a task is seen moving from one state to another
+type TransitionHook interface {
+	OnTransition(t Task, from State, to State)
+}
+
+// TransitionHookFunc adapts a function to a TransitionHook
+type TransitionHookFunc func(t Task, from State, to State)
+
+func (f TransitionHookFunc) OnTransition(t Task, from State, to State) {
+	f(t, from, to)
+}
+
+type transition struct {
+	from, to State
+}
+
+// StateMachine holds the allowed transitions between states and the hooks
+// registered on them
+type StateMachine struct {
+	mu          sync.RWMutex
+	transitions map[State][]State
+	hooks       map[transition][]TransitionHook
+}
+
+// NewStateMachine returns a state machine with the default transitions
+func NewStateMachine() *StateMachine {
+	transitions := make(map[State][]State, len(stateTransitionMap))
+	for src, dsts := range stateTransitionMap {
+		transitions[src] = slices.Clone(dsts)
+	}
+	return &StateMachine{
+		transitions: transitions,
+		hooks:       make(map[transition][]TransitionHook),
+	}
+}
+
+// Allow adds transitions from src to each of dsts
+func (sm *StateMachine) Allow(src State, dsts ...State) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	for _, dst := range dsts {
+		if !slices.Contains(sm.transitions[src], dst) {
+			sm.transitions[src] = append(sm.transitions[src], dst)
+		}
+	}
+}
+
+// Valid reports whether a task may move from src to dst
+func (sm *StateMachine) Valid(src State, dst State) bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return slices.Contains(sm.transitions[src], dst)
+}
+
+// OnTransition registers h to run when a task moves from one state to another.
+// Either state can be AnyState.
+func (sm *StateMachine) OnTransition(from State, to State, h TransitionHook) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	k := transition{from, to}
+	sm.hooks[k] = append(sm.hooks[k], h)
+}
+
+// Fire runs the hooks registered on the transition of t from a state to another.
+// Hooks run whether or not the transition is valid, it already happened.
+func (sm *StateMachine) Fire(t Task, from State, to State) {
+	if from == to {
+		return
+	}
+	sm.mu.RLock()
+	var hooks []TransitionHook
+	for _, k := range []transition{{from, to}, {from, AnyState}, {AnyState, to}, {AnyState, AnyState}} {
+		hooks = append(hooks, sm.hooks[k]...)
+	}
+	sm.mu.RUnlock()
+	for _, h := range hooks {
+		h.OnTransition(t, from, to)
+	}
+}
@@ -1,55 +1,23 @@
 package task
 
 import (
+	"encoding/json"
+	"fmt"
 	"io"
-	"log"
 	"math"
-	"os"
 	"time"
 
 	"context"
 
-	"slices"
-
 	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
 	"github.com/google/uuid"
-	"github.com/moby/moby/pkg/stdcopy"
-)
-
-/**
-* Task State and State Machine
- */
-// State Definition
-type State int
 
-const (
-	Pending State = iota
-	Scheduled
-	Running
-	Completed
-	Stopped
-	Failed
+	"cube/logging"
 )
 
-func (s State) String() []string {
-	return []string{"Pending", "Scheduled", "Running", "Completed", "Failed"}
-}
-
-// State Machine
-var stateTransitionMap = map[State][]State{
-	Pending:   {Scheduled},
-	Scheduled: {Scheduled, Running, Failed},
-	Running:   {Running, Completed, Failed},
-	Completed: {},
-	Failed:    {},
-}
-
-func ValidStateTransition(src State, dst State) bool {
-	return slices.Contains(stateTransitionMap[src], dst)
-}
+var logger = logging.For("task")
 
 /**
 * Task
@@ -61,30 +29,126 @@ type Task struct {
 	Name        string
 	State       State
 	Image       string
-	// Resources
-	Cpu    float64
-	Memory int64
-	Disk   int64
+	// OS and architecture the image is run for, os/arch[/variant], see Platform
+	Platform string `json:",omitempty"`
+	// Name of the task's container, recorded by the worker when creating it
+	ContainerName string `json:",omitempty"`
+	// Defaults to PullPolicyFor(Image)
+	ImagePullPolicy ImagePullPolicy   `json:",omitempty"`
+	Env             []string          `json:",omitempty"`
+	Cmd             []string          `json:",omitempty"` // overrides the image's default command
+	Labels          map[string]string `json:",omitempty"`
+	Mounts          []Mount           `json:",omitempty"`
+	// Tenant the task belongs to, limited by the namespace's Quota, see NamespaceOf
+	Namespace string `json:",omitempty"`
+	// Credentials of a private registry, instead of those configured on the worker
+	RegistryAuth *RegistryAuth `json:",omitempty"`
+	// Placement constraints, see NodeRequirements
+	NodeSelector map[string]string `json:",omitempty"`
+	Constraints  []string          `json:",omitempty"`
+	Affinity     string            `json:",omitempty"`
+	AntiAffinity string            `json:",omitempty"`
+	// Worker capabilities the task needs, e.g. gpu or volumes
+	Capabilities []string `json:",omitempty"`
+	// Resources: requests and optional limits
+	Cpu         float64
+	Memory      int64
+	Disk        int64
+	CpuLimit    float64
+	MemoryLimit int64
+	QoSClass    QoSClass
+	// CPUs the container is pinned to and the GPUs it is given, see DeviceRequest
+	CpusetCpus     string          `json:",omitempty"`
+	DeviceRequests []DeviceRequest `json:",omitempty"`
+	// Dispatch order and preemption rank, see NormalPriority
+	Priority int `json:",omitempty"`
 	// Networking for Docker images
 	ExposedPorts nat.PortSet
 	PortBindings map[string]string
 	HostPorts    nat.PortMap
+	// User-defined networks the task joins, reachable there under its Name
+	Networks []string `json:",omitempty"`
 	// Define retry policy on failure
-	RestartPolicy container.RestartPolicy
+	RestartPolicy RestartPolicy
+	// Seconds to wait for a graceful stop before the container is killed, zero uses DefaultStopTimeout
+	StopTimeout int `json:",omitempty"`
 	// Running time monitoring
 	StartTime  time.Time
 	FinishTime time.Time
+	// Seconds the task may run, and when it must be done by, see DeadlineAt
+	Timeout  int       `json:",omitempty"`
+	Deadline time.Time `json:",omitempty"`
+	// Why the task last failed, see FailureReason
+	FailureReason FailureReason `json:",omitempty"`
+	// Error the worker got starting the task, e.g. a missing image or a port in use
+	Error string `json:",omitempty"`
+	// Step of the container start that failed with Error, see ErrorCode
+	ErrorCode ErrorCode `json:",omitempty"`
+	// Observations about the task, such as Unschedulable, set by the manager
+	Conditions []Condition `json:",omitempty"`
 	// Health checks and restarts
-	HealthCheck  string
-	RestartCount int
+	HealthCheck string
+	Probe       *Probe `json:",omitempty"`
+	// Probe that must succeed before Probe runs, for slow-starting apps
+	StartupProbe *Probe `json:",omitempty"`
+	// Healthcheck run by the container runtime, see ContainerHealthcheck
+	ContainerHealthcheck *ContainerHealthcheck `json:",omitempty"`
+	Health               HealthStatus          `json:",omitempty"`
+	RestartCount         int
+	// When the task waiting for a restart is started again
+	NextRestart time.Time `json:",omitempty"`
+	// Workers the task was placed on, oldest first, see AddPlacement
+	Placements []Placement `json:",omitempty"`
+	// Job tasks run to completion; their exit code and output tail are recorded
+	Kind       Kind `json:",omitempty"`
+	ExitCode   int
+	OOMKilled  bool   `json:",omitempty"`
+	OutputTail string `json:",omitempty"`
+	// Tasks that must be Completed before this one is dispatched
+	DependsOn []uuid.UUID `json:",omitempty"`
+	// Resource usage of the container, last sampled by the worker
+	Usage *ContainerStats `json:",omitempty"`
+	// Incremented by every rolling update of the task
+	Revision int
 }
 
+// NewContainerName returns the container name for the task's current revision. The
+// short task ID keeps tasks sharing a name from colliding, and the revision lets a new
+// revision run next to the previous one during a rolling update.
+func (t Task) NewContainerName() string {
+	if t.Name == "" {
+		return ""
+	}
+	name := fmt.Sprintf("%s-%s", t.Name, t.ID.String()[:8])
+	if t.Revision > 0 {
+		name += fmt.Sprintf("-r%d", t.Revision)
+	}
+	return name
+}
+
+// Task kinds
+type Kind string
+
+const (
+	ServiceKind Kind = "Service"
+	JobKind     Kind = "Job"
+)
+
+// Maximum bytes of job output kept on the task record
+const MaxOutputTail = 4096
+
 // Task Event definition
 type TaskEvent struct {
 	ID        uuid.UUID
 	Timestamp time.Time
 	State     State
 	Task      Task
+	// Audit details recorded by the manager
+	Worker string `json:",omitempty"`
+	Error  string `json:",omitempty"`
+	// Cron expression and concurrency policy of cron jobs created from the event
+	CronSpec          string            `json:",omitempty"`
+	ConcurrencyPolicy ConcurrencyPolicy `json:",omitempty"`
 }
 
 /**
@@ -93,35 +157,69 @@ type TaskEvent struct {
  */
 // Docker config
 type Config struct {
-	Name  string
-	Image string
+	Name            string
+	Image           string
+	ImagePullPolicy ImagePullPolicy
+	// os/arch[/variant] the image is pulled and run for, the runtime's default when empty
+	Platform string
+	// Credentials the image is pulled with, set by the worker
+	RegistryAuth *RegistryAuth
 	// Attach std in/out/error
 	AttachStdin  bool
 	AttachStdout bool
 	AttachStderr bool
-	// Set of exposed ports
+	// Set of exposed ports, and the fixed host ports of some of them
 	ExposedPorts nat.PortSet
+	PortBindings map[string]string
+	// Networks to attach to, and the DNS name of the container on them
+	Networks []string
+	Alias    string
 	// Custom command
 	Cmd []string
 	// Resources
-	Cpu    float64
-	Memory int64
-	Disk   int64
+	Cpu         float64
+	Memory      int64
+	Disk        int64
+	CpuLimit    float64
+	MemoryLimit int64
+	// CPU pinning and devices such as GPUs
+	CpusetCpus     string
+	DeviceRequests []DeviceRequest
 	// Env vars
 	Env []string
-	// Restart container policy
-	RestartPolicy container.RestartPolicy
+	// Bind mounts, volumes and tmpfs mounts
+	Mounts []Mount
+	// Seconds to wait for a graceful stop
+	StopTimeout int
+	// Healthcheck run by the runtime, the image's one when nil
+	Healthcheck *ContainerHealthcheck
+	// Container labels, set by the worker
+	Labels map[string]string
 }
 
 func NewConfig(t *Task) *Config {
 	return &Config{
-		Name:          t.Name,
-		ExposedPorts:  t.ExposedPorts,
-		Image:         t.Image,
-		Cpu:           t.Cpu,
-		Memory:        t.Memory,
-		Disk:          t.Disk,
-		RestartPolicy: t.RestartPolicy,
+		Name:            t.NewContainerName(),
+		ExposedPorts:    t.ExposedPorts,
+		PortBindings:    t.PortBindings,
+		Networks:        t.Networks,
+		Alias:           t.Name,
+		Env:             t.Env,
+		Cmd:             t.Cmd,
+		Mounts:          t.Mounts,
+		Image:           t.Image,
+		ImagePullPolicy: t.ImagePullPolicy,
+		Platform:        t.Platform,
+		RegistryAuth:    t.RegistryAuth,
+		Cpu:             t.Cpu,
+		Memory:          t.Memory,
+		Disk:            t.Disk,
+		CpuLimit:        t.CpuLimit,
+		MemoryLimit:     t.MemoryLimit,
+		CpusetCpus:      t.CpusetCpus,
+		DeviceRequests:  t.DeviceRequests,
+		StopTimeout:     t.StopTimeout,
+		Healthcheck:     t.ContainerHealthcheck,
 	}
 }
 
@@ -133,9 +231,8 @@ type Docker struct {
 	Config Config
 }
 
-func NewDocker(c *Config) *Docker {
-	// Fix "Error response from daemon: client version 1.48 is too new. Maximum supported API version is 1.47"
-	dc, _ := client.NewClientWithOpts(client.WithVersion("1.47"))
+// NewDocker returns a runtime running c through dc, the worker's shared client, see RuntimeClient
+func NewDocker(dc *client.Client, c *Config) *Docker {
 	return &Docker{
 		Client: dc,
 		Config: *c,
@@ -148,6 +245,21 @@ type DockerResult struct {
 	Action      string
 	ContainerID string
 	Result      string
+	// Set when a stop timed out and the container was killed and force removed
+	Killed bool
+}
+
+// Seconds a container gets to stop gracefully when the task sets no StopTimeout
+const DefaultStopTimeout = 10
+
+// Extra time allowed for the runtime to act on a stop before escalating to a kill
+const stopGracePeriod = 5 * time.Second
+
+func (c Config) stopTimeout() int {
+	if c.StopTimeout <= 0 {
+		return DefaultStopTimeout
+	}
+	return c.StopTimeout
 }
 
 // --------------------------------
@@ -157,73 +269,143 @@ type DockerResult struct {
 // Create and Start container
 func (d *Docker) Run() DockerResult {
 	ctx := context.Background()
-	reader, err := d.Client.ImagePull(ctx, d.Config.Image, image.PullOptions{})
-	if err != nil {
-		log.Printf("Error pulling image %s: %v\n", d.Config.Image, err)
+	if err := d.ensureImage(ctx); err != nil {
+		logger.Error("Error pulling image", "image", d.Config.Image, "error", err)
+		return DockerResult{Error: &ImagePullError{Image: d.Config.Image, Err: err}}
+	}
+	if err := d.ensureNetworks(ctx); err != nil {
+		logger.Error("Error creating networks", "networks", d.Config.Networks, "error", err)
 		return DockerResult{Error: err}
 	}
-	io.Copy(os.Stdout, reader)
 
+	// Limits cap the container, requests are kept as soft reservations
+	memory, cpu := d.Config.Memory, d.Config.Cpu
+	if d.Config.MemoryLimit > 0 {
+		memory = d.Config.MemoryLimit
+	}
+	if d.Config.CpuLimit > 0 {
+		cpu = d.Config.CpuLimit
+	}
 	r := container.Resources{
-		Memory:   d.Config.Memory,
-		NanoCPUs: int64(d.Config.Cpu * math.Pow(10, 9)),
+		Memory:            memory,
+		MemoryReservation: d.Config.Memory,
+		NanoCPUs:          int64(cpu * math.Pow(10, 9)),
+		CpusetCpus:        d.Config.CpusetCpus,
+		DeviceRequests:    dockerDeviceRequests(d.Config.DeviceRequests),
 	}
 	cc := container.Config{
 		Image:        d.Config.Image,
 		Tty:          false,
 		Env:          d.Config.Env,
-		ExposedPorts: d.Config.ExposedPorts,
+		Cmd:          d.Config.Cmd,
+		ExposedPorts: d.Config.exposedPorts(),
+		Labels:       d.Config.Labels,
+	}
+	if d.Config.Healthcheck != nil {
+		cc.Healthcheck = d.Config.Healthcheck.dockerConfig()
 	}
+	// Ports without a binding are published on random host ports
 	hc := container.HostConfig{
-		RestartPolicy:   d.Config.RestartPolicy,
 		Resources:       r,
+		Mounts:          dockerMounts(d.Config.Mounts),
+		PortBindings:    d.Config.portBindings(),
 		PublishAllPorts: true,
 	}
+	if len(d.Config.Networks) > 0 {
+		hc.NetworkMode = container.NetworkMode(d.Config.Networks[0])
+	}
 
 	// Attempt to create the container
-	resp, err := d.Client.ContainerCreate(ctx, &cc, &hc, nil, nil, d.Config.Name)
+	resp, err := d.Client.ContainerCreate(ctx, &cc, &hc, d.Config.networkingConfig(), d.Config.ociPlatform(), d.Config.Name)
 	if err != nil {
-		log.Printf("Error creating container using image %s: %v\n", d.Config.Image, err)
-		return DockerResult{Error: err}
+		logger.Error("Error creating container", "image", d.Config.Image, "error", err)
+		return DockerResult{Error: &StartError{Code: CodeCreateFailed, Err: err}}
 	}
 	// Attempt to start the container
 	err = d.Client.ContainerStart(ctx, resp.ID, container.StartOptions{})
 	if err != nil {
-		log.Printf("Error starting container %s: %v\n", resp.ID, err)
-		return DockerResult{Error: err}
+		logger.Error("Error starting container", "container_id", resp.ID, "error", err)
+		return DockerResult{Error: &StartError{Code: CodeStartFailed, Err: err}}
 	}
-	// Attempt to fetch the Container logs
-	out, err := d.Client.ContainerLogs(ctx, resp.ID, container.LogsOptions{ShowStdout: true, ShowStderr: true})
-	if err != nil {
-		log.Printf("Error getting logs for container %s: %v\n", resp.ID, err)
-		return DockerResult{Error: err}
-	}
-
-	stdcopy.StdCopy(os.Stdout, os.Stderr, out)
-
+	// Container output is retrieved on demand through Logs
 	return DockerResult{ContainerID: resp.ID, Action: "start", Result: "success"}
 }
 
-// Stop and Remove container
+// Stop and Remove container. Containers not stopping within the stop timeout,
+// e.g. because they ignore SIGTERM, are killed and force removed.
 func (d *Docker) Stop(id string) DockerResult {
-	log.Printf("Attempting to stop container %v", id)
+	logger.Info("Attempting to stop container", "container_id", id)
+	timeout := d.Config.stopTimeout()
+	stopCtx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second+stopGracePeriod)
+	defer cancel()
+	err := d.Client.ContainerStop(stopCtx, id, container.StopOptions{Timeout: &timeout})
+	if err == nil {
+		// Attempt to Remove the container
+		err = d.Client.ContainerRemove(context.Background(), id, container.RemoveOptions{
+			RemoveVolumes: true,
+			RemoveLinks:   false,
+			Force:         false,
+		})
+		if err == nil {
+			return DockerResult{Action: "stop", Result: "success", Error: nil}
+		}
+	}
+
+	logger.Warn("Error stopping container gracefully, killing it", "container_id", id, "error", err)
 	ctx := context.Background()
-	err := d.Client.ContainerStop(ctx, id, container.StopOptions{})
+	if err := d.Client.ContainerKill(ctx, id, "SIGKILL"); err != nil {
+		logger.Error("Error killing container", "container_id", id, "error", err)
+	}
+	err = d.Client.ContainerRemove(ctx, id, container.RemoveOptions{RemoveVolumes: true, Force: true})
 	if err != nil {
-		log.Printf("Error stopping container %s: %v\n", id, err)
-		return DockerResult{Error: err}
+		logger.Error("Error removing container", "container_id", id, "error", err)
+		return DockerResult{Error: err, Killed: true}
+	}
+	return DockerResult{Action: "stop", Result: "killed", Killed: true}
+}
+
+// Stream container logs. Unless the container has a TTY the stream is
+// multiplexed and must be split with stdcopy.StdCopy.
+func (d *Docker) Logs(ctx context.Context, containerID string, follow bool, tail string) (io.ReadCloser, error) {
+	if tail == "" {
+		tail = "all"
 	}
-	// Attempt to Remove the container
-	err = d.Client.ContainerRemove(ctx, id, container.RemoveOptions{
-		RemoveVolumes: true,
-		RemoveLinks:   false,
-		Force:         false,
+	return d.Client.ContainerLogs(ctx, containerID, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     follow,
+		Tail:       tail,
+	})
+}
+
+// Exec runs cmd in a running container and returns its exit code
+func (d *Docker) Exec(ctx context.Context, containerID string, cmd []string) (int, error) {
+	created, err := d.Client.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
 	})
 	if err != nil {
-		log.Printf("Error removing container %s: %v\n", id, err)
-		return DockerResult{Error: err}
+		return 0, err
+	}
+	resp, err := d.Client.ContainerExecAttach(ctx, created.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Close()
+	// The attached stream ends when the command exits, closing it unblocks the copy on timeout
+	stop := context.AfterFunc(ctx, resp.Close)
+	defer stop()
+	io.Copy(io.Discard, resp.Reader)
+	if err := ctx.Err(); err != nil {
+		return 0, err
 	}
-	return DockerResult{Action: "stop", Result: "success", Error: nil}
+
+	inspect, err := d.Client.ContainerExecInspect(ctx, created.ID)
+	if err != nil {
+		return 0, err
+	}
+	return inspect.ExitCode, nil
 }
 
 // Inspect a container
@@ -233,13 +415,49 @@ type DockerInspectResponse struct {
 }
 
 func (d *Docker) Inspect(containerID string) DockerInspectResponse {
-	dc, _ := client.NewClientWithOpts(client.WithVersion("1.47"))
 	ctx := context.Background()
-	resp, err := dc.ContainerInspect(ctx, containerID)
+	resp, err := d.Client.ContainerInspect(ctx, containerID)
 	if err != nil {
-		log.Printf("Error inspecting container: %s\n", err)
+		logger.Error("Error inspecting container", "container_id", containerID, "error", err)
 		return DockerInspectResponse{Error: err}
 	}
 
 	return DockerInspectResponse{Container: &resp}
 }
+
+// List all containers on the host, including stopped ones
+func (d *Docker) List() ([]container.Summary, error) {
+	ctx := context.Background()
+	containers, err := d.Client.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		logger.Error("Error listing containers", "error", err)
+		return nil, err
+	}
+	return containers, nil
+}
+
+// Stats samples a container's CPU and memory usage
+func (d *Docker) Stats(ctx context.Context, containerID string) (*ContainerStats, error) {
+	resp, err := d.Client.ContainerStats(ctx, containerID, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var s container.StatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return nil, err
+	}
+
+	cs := ContainerStats{MemoryUsage: s.MemoryStats.Usage, MemoryLimit: s.MemoryStats.Limit, Timestamp: s.Read.UTC()}
+	for _, n := range s.Networks {
+		cs.NetworkRx += n.RxBytes
+		cs.NetworkTx += n.TxBytes
+	}
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(s.CPUStats.SystemUsage) - float64(s.PreCPUStats.SystemUsage)
+	if cpuDelta > 0 && systemDelta > 0 {
+		cs.CpuPercent = cpuDelta / systemDelta * float64(s.CPUStats.OnlineCPUs) * 100
+	}
+	return &cs, nil
+}
@@ -0,0 +1,41 @@
+package task
+
+// Update describes the changes of a rolling task update. Unset fields keep
+// their current value; Env, when set, replaces the whole environment.
+type Update struct {
+	Image       string    `json:",omitempty"`
+	Env         *[]string `json:",omitempty"`
+	Cpu         *float64  `json:",omitempty"`
+	Memory      *int64    `json:",omitempty"`
+	Disk        *int64    `json:",omitempty"`
+	CpuLimit    *float64  `json:",omitempty"`
+	MemoryLimit *int64    `json:",omitempty"`
+}
+
+// Apply returns the next revision of t with the update applied
+func (u Update) Apply(t Task) Task {
+	if u.Image != "" {
+		t.Image = u.Image
+	}
+	if u.Env != nil {
+		t.Env = *u.Env
+	}
+	if u.Cpu != nil {
+		t.Cpu = *u.Cpu
+	}
+	if u.Memory != nil {
+		t.Memory = *u.Memory
+	}
+	if u.Disk != nil {
+		t.Disk = *u.Disk
+	}
+	if u.CpuLimit != nil {
+		t.CpuLimit = *u.CpuLimit
+	}
+	if u.MemoryLimit != nil {
+		t.MemoryLimit = *u.MemoryLimit
+	}
+	t.QoSClass = QoSClassFor(t)
+	t.Revision++
+	return t
+}
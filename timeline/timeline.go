@@ -0,0 +1,155 @@
+package timeline
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+/**
+* Timeline
+* Keeps placement changes and periodic node utilization samples for a retention
+* window, so incidents can be analysed after the fact:
+* "what ran on node X between 2 and 3 AM and how loaded was it?"
+ */
+type Action string
+
+const (
+	Placed  Action = "placed"
+	Removed Action = "removed"
+)
+
+type Placement struct {
+	Timestamp time.Time
+	TaskID    uuid.UUID
+	TaskName  string
+	Node      string
+	Action    Action
+}
+
+// Sample is a compact utilization data point of a node
+type Sample struct {
+	Timestamp      time.Time
+	CpuPercent     float32
+	MemUsedPercent float32
+	DiskUsedPct    float32
+	TaskCount      int
+}
+
+// TaskInterval is the period a task was placed on a node; a zero To means it still is
+type TaskInterval struct {
+	TaskID   uuid.UUID
+	TaskName string
+	From     time.Time
+	To       time.Time `json:",omitempty"`
+}
+
+type NodeTimeline struct {
+	Node    string
+	From    time.Time
+	To      time.Time
+	Tasks   []TaskInterval
+	Samples []Sample
+}
+
+type Timeline struct {
+	mu         sync.RWMutex
+	retention  time.Duration
+	placements []Placement
+	samples    map[string][]Sample
+}
+
+func New(retention time.Duration) *Timeline {
+	return &Timeline{
+		retention: retention,
+		samples:   make(map[string][]Sample),
+	}
+}
+
+func (t *Timeline) RecordPlacement(p Placement) {
+	if p.Timestamp.IsZero() {
+		p.Timestamp = time.Now().UTC()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.placements = append(t.placements, p)
+	t.prune(p.Timestamp)
+}
+
+func (t *Timeline) RecordSample(node string, s Sample) {
+	if s.Timestamp.IsZero() {
+		s.Timestamp = time.Now().UTC()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.samples[node] = append(t.samples[node], s)
+	t.prune(s.Timestamp)
+}
+
+// prune drops everything older than the retention window; callers hold the lock
+func (t *Timeline) prune(now time.Time) {
+	cutoff := now.Add(-t.retention)
+	i := sort.Search(len(t.placements), func(i int) bool { return !t.placements[i].Timestamp.Before(cutoff) })
+	t.placements = t.placements[i:]
+	for node, samples := range t.samples {
+		j := sort.Search(len(samples), func(i int) bool { return !samples[i].Timestamp.Before(cutoff) })
+		t.samples[node] = samples[j:]
+	}
+}
+
+// TaskPlacements returns the placement history of a task
+func (t *Timeline) TaskPlacements(id uuid.UUID) []Placement {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var out []Placement
+	for _, p := range t.placements {
+		if p.TaskID == id {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Node returns the tasks placed on a node and its utilization samples between from and to
+func (t *Timeline) Node(node string, from time.Time, to time.Time) NodeTimeline {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	nt := NodeTimeline{Node: node, From: from, To: to}
+
+	open := make(map[uuid.UUID]*TaskInterval)
+	var closed []TaskInterval
+	for _, p := range t.placements {
+		if p.Timestamp.After(to) {
+			break
+		}
+		if iv, ok := open[p.TaskID]; ok && (p.Action == Removed || p.Node != node) {
+			iv.To = p.Timestamp
+			closed = append(closed, *iv)
+			delete(open, p.TaskID)
+		}
+		if p.Action == Placed && p.Node == node {
+			if _, ok := open[p.TaskID]; !ok {
+				open[p.TaskID] = &TaskInterval{TaskID: p.TaskID, TaskName: p.TaskName, From: p.Timestamp}
+			}
+		}
+	}
+	for _, iv := range closed {
+		if !iv.To.Before(from) {
+			nt.Tasks = append(nt.Tasks, iv)
+		}
+	}
+	for _, iv := range open {
+		nt.Tasks = append(nt.Tasks, *iv)
+	}
+	sort.Slice(nt.Tasks, func(i, j int) bool { return nt.Tasks[i].From.Before(nt.Tasks[j].From) })
+
+	for _, s := range t.samples[node] {
+		if !s.Timestamp.Before(from) && !s.Timestamp.After(to) {
+			nt.Samples = append(nt.Samples, s)
+		}
+	}
+	return nt
+}
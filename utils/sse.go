@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+* Server-sent events
+* Long lived streams such as followed logs are sent as text/event-stream: every
+* event is flushed as soon as it is written, and a comment is sent when the stream
+* is idle so proxies and load balancers keep the connection open.
+ */
+const SSEContentType = "text/event-stream"
+
+// How often idle streams send a keep-alive comment
+const sseKeepAlive = 15 * time.Second
+
+type SSEWriter struct {
+	mu sync.Mutex
+	fw *FlushWriter
+}
+
+// NewSSEWriter sets the event stream headers on w, the status is written with the first event
+func NewSSEWriter(w http.ResponseWriter) *SSEWriter {
+	SetSSEHeaders(w)
+	return &SSEWriter{fw: NewFlushWriter(w)}
+}
+
+// SetSSEHeaders sets the headers of an event stream, also used when relaying one
+func SetSSEHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", SSEContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	// Disables response buffering in nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+}
+
+// Event sends an event, data spanning several lines is sent as several data fields
+func (s *SSEWriter) Event(event string, data string) error {
+	var b strings.Builder
+	if event != "" {
+		fmt.Fprintf(&b, "event: %s\n", event)
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// KeepAlive sends a comment every sseKeepAlive until ctx is done
+func (s *SSEWriter) KeepAlive(ctx context.Context) {
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if s.write(": keep-alive\n\n") != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *SSEWriter) write(p string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.fw.Write([]byte(p))
+	return err
+}
+
+// Lines returns a writer sending every line written to it as an event
+func (s *SSEWriter) Lines(event string) *SSELineWriter {
+	return &SSELineWriter{s: s, event: event}
+}
+
+type SSELineWriter struct {
+	s       *SSEWriter
+	event   string
+	partial []byte
+}
+
+func (l *SSELineWriter) Write(p []byte) (int, error) {
+	l.partial = append(l.partial, p...)
+	for {
+		i := bytes.IndexByte(l.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := strings.TrimSuffix(string(l.partial[:i]), "\r")
+		l.partial = l.partial[i+1:]
+		if err := l.s.Event(l.event, line); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Flush sends the last line when it did not end with a newline
+func (l *SSELineWriter) Flush() error {
+	if len(l.partial) == 0 {
+		return nil
+	}
+	line := string(l.partial)
+	l.partial = nil
+	return l.s.Event(l.event, line)
+}
+
+// ReadSSE calls handle with every event read from r until r ends or handle fails.
+// Comments are skipped, events without an event field are "message" events.
+func ReadSSE(r io.Reader, handle func(event string, data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	event := ""
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				if err := handle(cmp.Or(event, "message"), strings.Join(data, "\n")); err != nil {
+					return err
+				}
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, ":"):
+		default:
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				event = value
+			case "data":
+				data = append(data, value)
+			}
+		}
+	}
+	return scanner.Err()
+}
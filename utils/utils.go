@@ -1,8 +1,13 @@
 package utils
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -21,3 +26,59 @@ func HTTPWithRetry(f func(string) (*http.Response, error), url string) (*http.Re
 	}
 	return resp, err
 }
+
+// FlushWriter flushes the response after every write so streamed output reaches the client immediately
+type FlushWriter struct {
+	w io.Writer
+	f http.Flusher
+}
+
+func NewFlushWriter(w http.ResponseWriter) *FlushWriter {
+	f, _ := w.(http.Flusher)
+	return &FlushWriter{w: w, f: f}
+}
+
+func (fw *FlushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if fw.f != nil {
+		fw.f.Flush()
+	}
+	return n, err
+}
+
+// ValidLogTail reports whether tail is a number of log lines, "all" or empty
+func ValidLogTail(tail string) bool {
+	if tail == "" || tail == "all" {
+		return true
+	}
+	n, err := strconv.Atoi(tail)
+	return err == nil && n >= 0
+}
+
+// SleepContext waits for d, returning false early if ctx is cancelled first
+func SleepContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Listen binds srv's address and serves it in the background. The returned channel
+// receives the error serving stopped with, unless the server was shut down.
+func Listen(srv *http.Server) (<-chan error, error) {
+	l, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return nil, err
+	}
+	failed := make(chan error, 1)
+	go func() {
+		if err := srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+			failed <- err
+		}
+	}()
+	return failed, nil
+}
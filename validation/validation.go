@@ -0,0 +1,547 @@
+package validation
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/docker/go-connections/nat"
+	"github.com/google/uuid"
+
+	"cube/cron"
+	"cube/task"
+)
+
+/**
+* Task spec validation
+* Shared by the CLI (fast client-side feedback) and the manager API (authoritative).
+ */
+const (
+	MaxCpu          = 1024.0
+	MaxLabelKeyLen  = 63
+	MaxLabelPrefix  = 253
+	MaxLabelValue   = 63
+	maxPortNumber   = 65535
+	healthCheckRoot = "/"
+	// Docker refuses smaller memory limits
+	MinMemoryLimit = 6 * 1024 * 1024
+)
+
+var (
+	containerNameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	labelNameRe     = regexp.MustCompile(`^([A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?)?$`)
+	dnsSubdomainRe  = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+	namespaceRe     = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+)
+
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *Errors) add(field string, format string, args ...interface{}) {
+	*e = append(*e, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// ValidateTaskEvent validates a task submission, returning nil when it is valid
+func ValidateTaskEvent(te task.TaskEvent) Errors {
+	var errs Errors
+	if te.ID == uuid.Nil {
+		errs.add("ID", "is required")
+	}
+	if !slices.Contains(task.States, te.State) {
+		errs.add("State", "unknown state %d", te.State)
+	}
+	if te.Task.ID == uuid.Nil {
+		errs.add("Task.ID", "is required")
+	}
+	// Submissions create tasks, they cannot start in any later state
+	if te.Task.State != task.Pending && te.Task.State != task.Scheduled {
+		errs.add("Task.State", "%v must be %v or %v for a new task", te.Task.State, task.Pending, task.Scheduled)
+	}
+	return append(errs, ValidateTask(te.Task, "Task.")...)
+}
+
+// ValidateCronJob validates a cron job submission: a task event with a CronSpec
+func ValidateCronJob(te task.TaskEvent) Errors {
+	errs := ValidateTask(te.Task, "Task.")
+	if te.CronSpec == "" {
+		errs.add("CronSpec", "is required")
+	} else if _, err := cron.Parse(te.CronSpec); err != nil {
+		errs.add("CronSpec", "%v", err)
+	}
+	if te.ConcurrencyPolicy != "" && !slices.Contains(task.ConcurrencyPolicies, te.ConcurrencyPolicy) {
+		errs.add("ConcurrencyPolicy", "%q must be one of %v", te.ConcurrencyPolicy, task.ConcurrencyPolicies)
+	}
+	return errs
+}
+
+// ValidateDeployment validates a deployment submission
+func ValidateDeployment(d task.Deployment) Errors {
+	var errs Errors
+	if d.Name == "" {
+		errs.add("Name", "is required")
+	}
+	if d.Replicas < 1 {
+		errs.add("Replicas", "must be at least 1, got %d", d.Replicas)
+	}
+	if d.MaxUnavailable < 0 {
+		errs.add("MaxUnavailable", "must not be negative, got %d", d.MaxUnavailable)
+	}
+	if d.MaxSurge < 0 {
+		errs.add("MaxSurge", "must not be negative, got %d", d.MaxSurge)
+	}
+	return append(errs, ValidateTask(d.Template, "Template.")...)
+}
+
+// ValidateQuota validates the limits of a namespace quota
+func ValidateQuota(q task.Quota) Errors {
+	var errs Errors
+	validateNamespace(&errs, "Namespace", q.Namespace)
+	if q.Cpu < 0 {
+		errs.add("Cpu", "must not be negative, got %v", q.Cpu)
+	}
+	if q.Memory < 0 {
+		errs.add("Memory", "must not be negative, got %d", q.Memory)
+	}
+	if q.Disk < 0 {
+		errs.add("Disk", "must not be negative, got %d", q.Disk)
+	}
+	if q.Tasks < 0 {
+		errs.add("Tasks", "must not be negative, got %d", q.Tasks)
+	}
+	return errs
+}
+
+func validateNamespace(errs *Errors, field string, ns string) {
+	if len(ns) > MaxLabelValue || !namespaceRe.MatchString(ns) {
+		errs.add(field, "%q must be at most %d lowercase letters, digits and dashes, starting and ending with a letter or digit", ns, MaxLabelValue)
+	}
+}
+
+// ValidateTaskGroup validates a task group submission
+func ValidateTaskGroup(g task.TaskGroup) Errors {
+	var errs Errors
+	if g.Name == "" {
+		errs.add("Name", "is required")
+	} else if !containerNameRe.MatchString(g.Name) {
+		errs.add("Name", "%q must match %s", g.Name, containerNameRe)
+	}
+	if len(g.Tasks) == 0 {
+		errs.add("Tasks", "must list at least one task")
+	}
+	selector := make(map[string]string)
+	var affinity, antiAffinity string
+	for i, t := range g.Tasks {
+		prefix := fmt.Sprintf("Tasks[%d].", i)
+		if t.Name == "" {
+			errs.add(prefix+"Name", "is required, it is the member's DNS name on the group's network")
+		}
+		for _, other := range g.Tasks[:i] {
+			if t.Name != "" && other.Name == t.Name {
+				errs.add(prefix+"Name", "%q is used by another member", t.Name)
+				break
+			}
+		}
+		// Members share a node, their placement rules must agree
+		for k, v := range t.NodeSelector {
+			if prev, ok := selector[k]; ok && prev != v {
+				errs.add(prefix+"NodeSelector", "%s=%s conflicts with %s=%s of another member", k, v, k, prev)
+			}
+			selector[k] = v
+		}
+		if t.Affinity != "" && affinity != "" && t.Affinity != affinity {
+			errs.add(prefix+"Affinity", "must match the Affinity of the other members")
+		}
+		if t.AntiAffinity != "" && antiAffinity != "" && t.AntiAffinity != antiAffinity {
+			errs.add(prefix+"AntiAffinity", "must match the AntiAffinity of the other members")
+		}
+		affinity = cmp.Or(affinity, t.Affinity)
+		antiAffinity = cmp.Or(antiAffinity, t.AntiAffinity)
+		errs = append(errs, ValidateTask(t, prefix)...)
+	}
+	return errs
+}
+
+// ValidateTask validates a task spec; field names in errors are prefixed with prefix
+func ValidateTask(t task.Task, prefix string) Errors {
+	var errs Errors
+
+	if t.Name != "" && !containerNameRe.MatchString(t.Name) {
+		errs.add(prefix+"Name", "%q must match %s", t.Name, containerNameRe)
+	}
+	if t.Namespace != "" {
+		validateNamespace(&errs, prefix+"Namespace", t.Namespace)
+	}
+	validateImage(&errs, prefix+"Image", t.Image)
+	if t.ImagePullPolicy != "" && !slices.Contains(task.ImagePullPolicies, t.ImagePullPolicy) {
+		errs.add(prefix+"ImagePullPolicy", "%q must be one of %v", t.ImagePullPolicy, task.ImagePullPolicies)
+	}
+	if _, err := t.TargetPlatform(); err != nil {
+		errs.add(prefix+"Platform", "%v", err)
+	}
+	for i, e := range t.Env {
+		if k, _, ok := strings.Cut(e, "="); !ok || k == "" {
+			errs.add(fmt.Sprintf("%sEnv[%d]", prefix, i), "%q must be in KEY=VALUE form", e)
+		}
+	}
+	if len(t.Cmd) > 0 && t.Cmd[0] == "" {
+		errs.add(prefix+"Cmd[0]", "command must not be empty")
+	}
+	for i, dep := range t.DependsOn {
+		field := fmt.Sprintf("%sDependsOn[%d]", prefix, i)
+		switch {
+		case dep == uuid.Nil:
+			errs.add(field, "must be a task ID")
+		case dep == t.ID:
+			errs.add(field, "a task cannot depend on itself")
+		case slices.Contains(t.DependsOn[:i], dep):
+			errs.add(field, "%v is listed more than once", dep)
+		}
+	}
+	if t.StopTimeout < 0 {
+		errs.add(prefix+"StopTimeout", "must not be negative")
+	}
+	if t.Timeout < 0 {
+		errs.add(prefix+"Timeout", "must not be negative")
+	}
+	validateMounts(&errs, prefix, t)
+	validateRegistryAuth(&errs, prefix+"RegistryAuth", t.RegistryAuth)
+	validatePlacement(&errs, prefix, t)
+	validateResources(&errs, prefix, t)
+	validateDevices(&errs, prefix, t)
+	validatePorts(&errs, prefix, t)
+	validateNetworks(&errs, prefix, t)
+	validateHealthCheck(&errs, prefix+"HealthCheck", t)
+	if t.Probe != nil && t.HealthCheck != "" {
+		errs.add(prefix+"Probe", "cannot be combined with HealthCheck")
+	}
+	validateProbe(&errs, prefix+"Probe", t.Probe, t)
+	validateProbe(&errs, prefix+"StartupProbe", t.StartupProbe, t)
+	validateContainerHealthcheck(&errs, prefix+"ContainerHealthcheck", t.ContainerHealthcheck)
+	validateRestartPolicy(&errs, prefix+"RestartPolicy", t.RestartPolicy)
+	errs = append(errs, ValidateLabels(prefix+"Labels", t.Labels)...)
+
+	return errs
+}
+
+func validateImage(errs *Errors, field string, image string) {
+	if image == "" {
+		errs.add(field, "is required")
+		return
+	}
+	if _, err := reference.ParseNormalizedNamed(image); err != nil {
+		errs.add(field, "%q is not a valid image reference: %v", image, err)
+	}
+}
+
+func validateMounts(errs *Errors, prefix string, t task.Task) {
+	targets := make(map[string]bool)
+	for i, m := range t.Mounts {
+		field := fmt.Sprintf("%sMounts[%d]", prefix, i)
+		if !slices.Contains(task.MountTypes, m.Type) {
+			errs.add(field+".Type", "%q must be one of %v", m.Type, task.MountTypes)
+		}
+		if (m.Type == task.BindMount || m.Type == task.VolumeMount) && m.Source == "" {
+			errs.add(field+".Source", "is required for %s mounts", m.Type)
+		}
+		if m.Type == task.TmpfsMount && m.Source != "" {
+			errs.add(field+".Source", "must be empty for tmpfs mounts")
+		}
+		// Containers are Linux, whatever the platform submitting the task
+		if !path.IsAbs(m.Target) {
+			errs.add(field+".Target", "%q must be an absolute path", m.Target)
+		} else if targets[path.Clean(m.Target)] {
+			errs.add(field+".Target", "%q is mounted more than once", m.Target)
+		}
+		targets[path.Clean(m.Target)] = true
+	}
+}
+
+func validateRegistryAuth(errs *Errors, field string, a *task.RegistryAuth) {
+	if a == nil || a.IdentityToken != "" {
+		return
+	}
+	if a.Username == "" || a.Password == "" {
+		errs.add(field, "requires a Username and Password, or an IdentityToken")
+	}
+}
+
+func validatePlacement(errs *Errors, prefix string, t task.Task) {
+	*errs = append(*errs, ValidateLabels(prefix+"NodeSelector", t.NodeSelector)...)
+	for i, c := range t.Constraints {
+		if _, err := task.ParseSelector(c); err != nil || strings.TrimSpace(c) == "" {
+			errs.add(fmt.Sprintf("%sConstraints[%d]", prefix, i), "%q must be a key=value or key!=value requirement", c)
+		}
+	}
+	*errs = append(*errs, ValidateCapabilities(prefix+"Capabilities", t.Capabilities)...)
+	if _, err := task.ParseSelector(t.Affinity); err != nil {
+		errs.add(prefix+"Affinity", "%v", err)
+	}
+	if _, err := task.ParseSelector(t.AntiAffinity); err != nil {
+		errs.add(prefix+"AntiAffinity", "%v", err)
+	}
+}
+
+func validateResources(errs *Errors, prefix string, t task.Task) {
+	if t.Cpu < 0 || t.Cpu > MaxCpu {
+		errs.add(prefix+"Cpu", "must be between 0 and %v, got %v", MaxCpu, t.Cpu)
+	}
+	if t.Memory < 0 {
+		errs.add(prefix+"Memory", "must not be negative, got %d", t.Memory)
+	}
+	if t.Disk < 0 {
+		errs.add(prefix+"Disk", "must not be negative, got %d", t.Disk)
+	}
+	if t.CpuLimit < 0 || t.CpuLimit > MaxCpu {
+		errs.add(prefix+"CpuLimit", "must be between 0 and %v, got %v", MaxCpu, t.CpuLimit)
+	}
+	if t.CpuLimit > 0 && t.CpuLimit < t.Cpu {
+		errs.add(prefix+"CpuLimit", "must not be lower than the Cpu request (%v < %v)", t.CpuLimit, t.Cpu)
+	}
+	if t.MemoryLimit < 0 {
+		errs.add(prefix+"MemoryLimit", "must not be negative, got %d", t.MemoryLimit)
+	} else if t.MemoryLimit > 0 && t.MemoryLimit < MinMemoryLimit {
+		errs.add(prefix+"MemoryLimit", "must be at least %d bytes, got %d", MinMemoryLimit, t.MemoryLimit)
+	}
+	if t.MemoryLimit > 0 && t.MemoryLimit < t.Memory {
+		errs.add(prefix+"MemoryLimit", "must not be lower than the Memory request (%d < %d)", t.MemoryLimit, t.Memory)
+	}
+	if t.Priority < task.MinPriority || t.Priority > task.MaxPriority {
+		errs.add(prefix+"Priority", "must be between %d and %d, got %d", task.MinPriority, task.MaxPriority, t.Priority)
+	}
+}
+
+func validateDevices(errs *Errors, prefix string, t task.Task) {
+	if t.CpusetCpus != "" {
+		if _, err := task.ParseCpuset(t.CpusetCpus); err != nil {
+			errs.add(prefix+"CpusetCpus", "%v", err)
+		}
+	}
+	for i, r := range t.DeviceRequests {
+		field := fmt.Sprintf("%sDeviceRequests[%d]", prefix, i)
+		switch {
+		case r.Count < -1:
+			errs.add(field+".Count", "must be -1 for all devices or a positive number, got %d", r.Count)
+		case r.Count != 0 && len(r.DeviceIDs) > 0:
+			errs.add(field, "requires either a Count or DeviceIDs, not both")
+		case r.Count == 0 && len(r.DeviceIDs) == 0:
+			errs.add(field, "requires a Count or DeviceIDs")
+		}
+		for j, id := range r.DeviceIDs {
+			if strings.TrimSpace(id) == "" || strings.Contains(id, ",") {
+				errs.add(fmt.Sprintf("%s.DeviceIDs[%d]", field, j), "%q must be a device index or UUID", id)
+			}
+		}
+	}
+}
+
+func validateNetworks(errs *Errors, prefix string, t task.Task) {
+	for i, n := range t.Networks {
+		field := fmt.Sprintf("%sNetworks[%d]", prefix, i)
+		if err := task.ValidNetworkName(n); err != nil {
+			errs.add(field, "%v", err)
+		} else if slices.Contains(t.Networks[:i], n) {
+			errs.add(field, "%q is listed more than once", n)
+		}
+	}
+	if len(t.Networks) > 0 && t.Name == "" {
+		errs.add(prefix+"Name", "is required for tasks joining Networks, it is their DNS name")
+	}
+}
+
+func validatePorts(errs *Errors, prefix string, t task.Task) {
+	for p := range t.ExposedPorts {
+		validatePortSpec(errs, fmt.Sprintf("%sExposedPorts[%s]", prefix, p), string(p))
+	}
+	for containerPort, hostPort := range t.PortBindings {
+		field := fmt.Sprintf("%sPortBindings[%s]", prefix, containerPort)
+		validatePortSpec(errs, field, containerPort)
+		n, err := strconv.Atoi(hostPort)
+		if err != nil || n < 1 || n > maxPortNumber {
+			errs.add(field, "host port %q must be a number between 1 and %d", hostPort, maxPortNumber)
+		}
+	}
+	hostPorts := t.BoundHostPorts()
+	slices.Sort(hostPorts)
+	for i := 1; i < len(hostPorts); i++ {
+		if hostPorts[i] == hostPorts[i-1] && (i == 1 || hostPorts[i] != hostPorts[i-2]) {
+			errs.add(prefix+"PortBindings", "host port %s is bound more than once", hostPorts[i])
+		}
+	}
+}
+
+func validatePortSpec(errs *Errors, field string, spec string) {
+	proto, port := nat.SplitProtoPort(spec)
+	if proto != "tcp" && proto != "udp" && proto != "sctp" {
+		errs.add(field, "unsupported protocol %q, expected tcp, udp or sctp", proto)
+	}
+	n, err := nat.ParsePort(port)
+	if err != nil || n < 1 || n > maxPortNumber {
+		errs.add(field, "port %q must be a number between 1 and %d", port, maxPortNumber)
+	}
+}
+
+func validateHealthCheck(errs *Errors, field string, t task.Task) {
+	if t.HealthCheck == "" {
+		return
+	}
+	if !strings.HasPrefix(t.HealthCheck, healthCheckRoot) {
+		errs.add(field, "%q must be an absolute path starting with %q", t.HealthCheck, healthCheckRoot)
+	}
+	if len(t.ExposedPorts) == 0 {
+		errs.add(field, "requires at least one exposed port")
+	}
+}
+
+func validateRestartPolicy(errs *Errors, field string, p task.RestartPolicy) {
+	if p.Name != "" && !slices.Contains(task.RestartModes, p.Name) {
+		errs.add(field+".Name", "%q must be one of %v", p.Name, task.RestartModes)
+	}
+	if p.MaxRetries < 0 {
+		errs.add(field+".MaxRetries", "must not be negative")
+	}
+	if p.BackoffSeconds < 0 {
+		errs.add(field+".BackoffSeconds", "must not be negative")
+	}
+	if p.MaxBackoffSeconds < 0 {
+		errs.add(field+".MaxBackoffSeconds", "must not be negative")
+	}
+}
+
+// validateProbe checks p, the task's Probe or StartupProbe
+func validateProbe(errs *Errors, field string, p *task.Probe, t task.Task) {
+	if p == nil {
+		return
+	}
+	switch p.Type {
+	case task.HTTPProbe, task.TCPProbe:
+		if p.Type == task.HTTPProbe && !strings.HasPrefix(p.Path, healthCheckRoot) {
+			errs.add(field+".Path", "%q must be an absolute path starting with %q", p.Path, healthCheckRoot)
+		}
+		if len(t.ExposedPorts) == 0 {
+			errs.add(field, "%s probes require at least one exposed port", p.Type)
+		}
+		if p.Port != "" {
+			port := p.Port
+			if !strings.Contains(port, "/") {
+				port += "/tcp"
+			}
+			if _, ok := t.ExposedPorts[nat.Port(port)]; !ok {
+				errs.add(field+".Port", "%q is not an exposed port", p.Port)
+			}
+		}
+	case task.ExecProbe:
+		if len(p.Command) == 0 || p.Command[0] == "" {
+			errs.add(field+".Command", "is required for exec probes")
+		}
+	default:
+		errs.add(field+".Type", "%q must be one of %v", p.Type, task.ProbeTypes)
+	}
+	if p.IntervalSeconds < 0 {
+		errs.add(field+".IntervalSeconds", "must not be negative")
+	}
+	if p.TimeoutSeconds < 0 {
+		errs.add(field+".TimeoutSeconds", "must not be negative")
+	}
+	if p.FailureThreshold < 0 {
+		errs.add(field+".FailureThreshold", "must not be negative")
+	}
+	if p.InitialDelaySeconds < 0 {
+		errs.add(field+".InitialDelaySeconds", "must not be negative")
+	}
+}
+
+func validateContainerHealthcheck(errs *Errors, field string, h *task.ContainerHealthcheck) {
+	if h == nil {
+		return
+	}
+	switch {
+	case len(h.Test) == 0:
+		errs.add(field+".Test", "is required")
+	case h.Test[0] == "NONE":
+		if len(h.Test) > 1 {
+			errs.add(field+".Test", "NONE takes no command")
+		}
+	case h.Test[0] == "CMD" || h.Test[0] == "CMD-SHELL":
+		if len(h.Test) < 2 || h.Test[1] == "" {
+			errs.add(field+".Test", "%s requires a command", h.Test[0])
+		}
+		if h.Test[0] == "CMD-SHELL" && len(h.Test) > 2 {
+			errs.add(field+".Test", "CMD-SHELL takes the command as a single string")
+		}
+	default:
+		errs.add(field+".Test", "%q must start with NONE, CMD or CMD-SHELL", h.Test[0])
+	}
+	if h.IntervalSeconds < 0 {
+		errs.add(field+".IntervalSeconds", "must not be negative")
+	}
+	if h.TimeoutSeconds < 0 {
+		errs.add(field+".TimeoutSeconds", "must not be negative")
+	}
+	if h.StartPeriodSeconds < 0 {
+		errs.add(field+".StartPeriodSeconds", "must not be negative")
+	}
+	if h.Retries < 0 {
+		errs.add(field+".Retries", "must not be negative")
+	}
+}
+
+// ValidateLabels checks label keys (optional DNS subdomain prefix and a name) and values
+func ValidateLabels(field string, labels map[string]string) Errors {
+	var errs Errors
+	for k, v := range labels {
+		f := fmt.Sprintf("%s[%s]", field, k)
+		if msg := labelKeyError(k); msg != "" {
+			errs.add(f, "%s", msg)
+		}
+		if len(v) > MaxLabelValue || !labelNameRe.MatchString(v) {
+			errs.add(f, "value %q must be at most %d alphanumeric characters, '-', '_' or '.'", v, MaxLabelValue)
+		}
+	}
+	return errs
+}
+
+// ValidateCapabilities checks capability names, which follow the rules of label values
+func ValidateCapabilities(field string, capabilities []string) Errors {
+	var errs Errors
+	for i, c := range capabilities {
+		if c == "" || len(c) > MaxLabelValue || !labelNameRe.MatchString(c) {
+			errs.add(fmt.Sprintf("%s[%d]", field, i), "%q must be 1-%d alphanumeric characters, '-', '_' or '.'", c, MaxLabelValue)
+		}
+	}
+	return errs
+}
+
+func labelKeyError(key string) string {
+	name := key
+	if prefix, n, ok := strings.Cut(key, "/"); ok {
+		if prefix == "" || len(prefix) > MaxLabelPrefix || !dnsSubdomainRe.MatchString(prefix) {
+			return fmt.Sprintf("key prefix %q must be a DNS subdomain", prefix)
+		}
+		name = n
+	}
+	if name == "" || len(name) > MaxLabelKeyLen || !labelNameRe.MatchString(name) {
+		return fmt.Sprintf("key name %q must be 1-%d alphanumeric characters, '-', '_' or '.'", name, MaxLabelKeyLen)
+	}
+	return ""
+}
@@ -0,0 +1,140 @@
+package validation
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+
+	"cube/task"
+)
+
+// validTask passes ValidateTask, each case breaks one field of it
+func validTask() task.Task {
+	return task.Task{
+		Name:         "web",
+		Image:        "nginx:1.27",
+		ExposedPorts: nat.PortSet{"80/tcp": {}},
+		PortBindings: map[string]string{"80/tcp": "8080"},
+		Labels:       map[string]string{"app": "web"},
+	}
+}
+
+func TestValidateTask(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(t *task.Task)
+		want   Errors
+	}{
+		{"valid", func(t *task.Task) {}, nil},
+
+		// Image references
+		{"missing image", func(t *task.Task) { t.Image = "" },
+			Errors{{"Task.Image", "is required"}}},
+		{"uppercase image", func(t *task.Task) { t.Image = "Nginx" },
+			Errors{{"Task.Image", `"Nginx" is not a valid image reference: invalid reference format: repository name (library/Nginx) must be lowercase`}}},
+		{"malformed image", func(t *task.Task) { t.Image = "nginx:" },
+			Errors{{"Task.Image", `"nginx:" is not a valid image reference: invalid reference format`}}},
+		{"registry image with digest", func(t *task.Task) {
+			t.Image = "registry.example.com:5000/team/web@sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+		}, nil},
+
+		// Ports
+		{"unsupported protocol", func(t *task.Task) { t.ExposedPorts = nat.PortSet{"80/icmp": {}}; t.PortBindings = nil },
+			Errors{{"Task.ExposedPorts[80/icmp]", `unsupported protocol "icmp", expected tcp, udp or sctp`}}},
+		{"port out of range", func(t *task.Task) { t.ExposedPorts = nat.PortSet{"70000/udp": {}}; t.PortBindings = nil },
+			Errors{{"Task.ExposedPorts[70000/udp]", `port "70000" must be a number between 1 and 65535`}}},
+		{"host port not a number", func(t *task.Task) { t.PortBindings = map[string]string{"80/tcp": "http"} },
+			Errors{{"Task.PortBindings[80/tcp]", `host port "http" must be a number between 1 and 65535`}}},
+		{"host port bound twice", func(t *task.Task) {
+			t.ExposedPorts = nat.PortSet{"80/tcp": {}, "81/tcp": {}}
+			t.PortBindings = map[string]string{"80/tcp": "8080", "81/tcp": "8080"}
+		}, Errors{{"Task.PortBindings", "host port 8080/tcp is bound more than once"}}},
+
+		// Resource bounds
+		{"negative cpu", func(t *task.Task) { t.Cpu = -1 },
+			Errors{{"Task.Cpu", "must be between 0 and 1024, got -1"}}},
+		{"too many cpus", func(t *task.Task) { t.Cpu = 2048 },
+			Errors{{"Task.Cpu", "must be between 0 and 1024, got 2048"}}},
+		{"cpu limit below request", func(t *task.Task) { t.Cpu = 2; t.CpuLimit = 1 },
+			Errors{{"Task.CpuLimit", "must not be lower than the Cpu request (1 < 2)"}}},
+		{"negative memory", func(t *task.Task) { t.Memory = -1 },
+			Errors{{"Task.Memory", "must not be negative, got -1"}}},
+		{"memory limit below docker minimum", func(t *task.Task) { t.MemoryLimit = 1024 },
+			Errors{{"Task.MemoryLimit", "must be at least 6291456 bytes, got 1024"}}},
+		{"memory limit below request", func(t *task.Task) { t.Memory = 64 << 20; t.MemoryLimit = 32 << 20 },
+			Errors{{"Task.MemoryLimit", "must not be lower than the Memory request (33554432 < 67108864)"}}},
+		{"negative disk", func(t *task.Task) { t.Disk = -5 },
+			Errors{{"Task.Disk", "must not be negative, got -5"}}},
+
+		// Label keys
+		{"prefixed label key", func(t *task.Task) { t.Labels = map[string]string{"cube.example.com/tier": "front"} }, nil},
+		{"empty label prefix", func(t *task.Task) { t.Labels = map[string]string{"/tier": "front"} },
+			Errors{{"Task.Labels[/tier]", `key prefix "" must be a DNS subdomain`}}},
+		{"uppercase label prefix", func(t *task.Task) { t.Labels = map[string]string{"Example.com/tier": "front"} },
+			Errors{{"Task.Labels[Example.com/tier]", `key prefix "Example.com" must be a DNS subdomain`}}},
+		{"label key with spaces", func(t *task.Task) { t.Labels = map[string]string{"my tier": "front"} },
+			Errors{{"Task.Labels[my tier]", `key name "my tier" must be 1-63 alphanumeric characters, '-', '_' or '.'`}}},
+		{"label key ending in a dash", func(t *task.Task) { t.Labels = map[string]string{"tier-": "front"} },
+			Errors{{"Task.Labels[tier-]", `key name "tier-" must be 1-63 alphanumeric characters, '-', '_' or '.'`}}},
+		{"invalid label value", func(t *task.Task) { t.Labels = map[string]string{"tier": "front end"} },
+			Errors{{"Task.Labels[tier]", `value "front end" must be at most 63 alphanumeric characters, '-', '_' or '.'`}}},
+
+		// Health check shapes
+		{"relative health check", func(t *task.Task) { t.HealthCheck = "health" },
+			Errors{{"Task.HealthCheck", `"health" must be an absolute path starting with "/"`}}},
+		{"health check without ports", func(t *task.Task) { t.HealthCheck = "/health"; t.ExposedPorts = nil; t.PortBindings = nil },
+			Errors{{"Task.HealthCheck", "requires at least one exposed port"}}},
+		{"probe with health check", func(t *task.Task) {
+			t.HealthCheck = "/health"
+			t.Probe = &task.Probe{Type: task.TCPProbe}
+		}, Errors{{"Task.Probe", "cannot be combined with HealthCheck"}}},
+		{"unknown probe type", func(t *task.Task) { t.Probe = &task.Probe{Type: "grpc"} },
+			Errors{{"Task.Probe.Type", `"grpc" must be one of [http tcp exec]`}}},
+		{"http probe with relative path", func(t *task.Task) { t.Probe = &task.Probe{Type: task.HTTPProbe, Path: "ready"} },
+			Errors{{"Task.Probe.Path", `"ready" must be an absolute path starting with "/"`}}},
+		{"probe of an unexposed port", func(t *task.Task) { t.Probe = &task.Probe{Type: task.TCPProbe, Port: "81"} },
+			Errors{{"Task.Probe.Port", `"81" is not an exposed port`}}},
+		{"exec probe without command", func(t *task.Task) { t.StartupProbe = &task.Probe{Type: task.ExecProbe} },
+			Errors{{"Task.StartupProbe.Command", "is required for exec probes"}}},
+		{"negative probe delay", func(t *task.Task) {
+			t.StartupProbe = &task.Probe{Type: task.ExecProbe, Command: []string{"true"}, InitialDelaySeconds: -1}
+		}, Errors{{"Task.StartupProbe.InitialDelaySeconds", "must not be negative"}}},
+		{"container healthcheck without test", func(t *task.Task) { t.ContainerHealthcheck = &task.ContainerHealthcheck{} },
+			Errors{{"Task.ContainerHealthcheck.Test", "is required"}}},
+		{"container healthcheck with unknown test", func(t *task.Task) {
+			t.ContainerHealthcheck = &task.ContainerHealthcheck{Test: []string{"curl", "localhost"}}
+		}, Errors{{"Task.ContainerHealthcheck.Test", `"curl" must start with NONE, CMD or CMD-SHELL`}}},
+		{"CMD-SHELL with arguments", func(t *task.Task) {
+			t.ContainerHealthcheck = &task.ContainerHealthcheck{Test: []string{"CMD-SHELL", "curl", "localhost"}}
+		}, Errors{{"Task.ContainerHealthcheck.Test", "CMD-SHELL takes the command as a single string"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := validTask()
+			tt.modify(&task)
+			if got := ValidateTask(task, "Task."); !slices.Equal(got, tt.want) {
+				t.Errorf("ValidateTask() = %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTaskEventFieldPaths(t *testing.T) {
+	te := task.TaskEvent{Task: validTask()}
+	te.Task.Cpu = -1
+
+	got := ValidateTaskEvent(te)
+	want := Errors{
+		{"ID", "is required"},
+		{"Task.ID", "is required"},
+		{"Task.Cpu", "must be between 0 and 1024, got -1"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ValidateTaskEvent() = %q\nwant %q", got, want)
+	}
+	if msg := got.Error(); msg != "ID: is required; Task.ID: is required; Task.Cpu: must be between 0 and 1024, got -1" {
+		t.Errorf("Error() = %q", msg)
+	}
+}
@@ -0,0 +1,119 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/google/uuid"
+
+	"cube/task"
+)
+
+/**
+* Admission control
+* The manager places tasks from the stats it last received, which can be stale or
+* miss tasks placed by another scheduling pass. Before accepting a new task the
+* worker checks the requested cpu, memory and disk against its own capacity, minus
+* what its scheduled and running tasks already requested, and refuses tasks that do
+* not fit so the manager places them elsewhere instead of overcommitting the host.
+* Workers with MaxTasks set also refuse tasks beyond that many active ones.
+ */
+
+// ErrInsufficientResources is returned when a task does not fit on the worker
+var ErrInsufficientResources = errors.New("insufficient resources")
+
+// Admit reports whether the worker has the resources to run t. Tasks without
+// requests, and workers which have not collected stats yet, are always admitted.
+func (w *Worker) Admit(t task.Task) error {
+	if err := w.admitCount(t); err != nil {
+		return err
+	}
+	if t.Cpu <= 0 && t.Memory <= 0 && t.Disk <= 0 {
+		return nil
+	}
+	s := w.Stats
+	if s == nil {
+		return nil
+	}
+
+	// Tasks with a stop queued, e.g. preempted by t, are about to free their resources
+	stopping := w.stopsQueued()
+	var cpu float64
+	var memory, disk int64
+	for _, other := range w.GetTasks() {
+		if other.ID == t.ID || !other.State.Active() || stopping[other.ID] {
+			continue
+		}
+		cpu += other.Cpu
+		memory += other.Memory
+		disk += other.Disk
+	}
+
+	if t.Cpu > 0 && s.CpuCount > 0 && cpu+t.Cpu > float64(s.CpuCount) {
+		return fmt.Errorf("%w: requested %.2f cpus, %.2f of %d allocated", ErrInsufficientResources, t.Cpu, cpu, s.CpuCount)
+	}
+	if t.Memory > 0 && s.MemStats != nil {
+		if memory+t.Memory > int64(s.MemTotal()) {
+			return fmt.Errorf("%w: requested %d bytes of memory, %d of %d allocated", ErrInsufficientResources, t.Memory, memory, s.MemTotal())
+		}
+		if t.Memory > int64(s.MemAvailable()) {
+			return fmt.Errorf("%w: requested %d bytes of memory, %d available", ErrInsufficientResources, t.Memory, s.MemAvailable())
+		}
+	}
+	if t.Disk > 0 && s.DiskStats != nil {
+		if disk+t.Disk > int64(s.DiskTotal()) {
+			return fmt.Errorf("%w: requested %d bytes of disk, %d of %d allocated", ErrInsufficientResources, t.Disk, disk, s.DiskTotal())
+		}
+		if t.Disk > int64(s.DiskFree()) {
+			return fmt.Errorf("%w: requested %d bytes of disk, %d free", ErrInsufficientResources, t.Disk, s.DiskFree())
+		}
+	}
+	return nil
+}
+
+// admitCount refuses t when the worker already runs MaxTasks other active tasks
+func (w *Worker) admitCount(t task.Task) error {
+	if w.MaxTasks <= 0 {
+		return nil
+	}
+	stopping := w.stopsQueued()
+	active := 0
+	for _, other := range w.GetTasks() {
+		if other.ID != t.ID && other.State.Active() && !stopping[other.ID] {
+			active++
+		}
+	}
+	if active >= w.MaxTasks {
+		return fmt.Errorf("%w: worker runs its maximum of %d tasks", ErrInsufficientResources, w.MaxTasks)
+	}
+	return nil
+}
+
+// stopsQueued returns the tasks being stopped or with a stop queued
+func (w *Worker) stopsQueued() map[uuid.UUID]bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stopping := maps.Clone(w.stopping)
+	for n := w.Queue.Len(); n > 0; n-- {
+		t := w.Queue.Dequeue().(task.Task)
+		if t.State == task.Completed {
+			stopping[t.ID] = true
+		}
+		w.Queue.Enqueue(t)
+	}
+	return stopping
+}
+
+// AdmitEvent checks the task of a submitted event, see Admit. Only tasks the worker
+// does not know yet go through admission, stops and rollouts of running tasks do
+// not ask for new resources.
+func (w *Worker) AdmitEvent(te task.TaskEvent) error {
+	if te.Task.State != task.Scheduled {
+		return nil
+	}
+	if _, err := w.Db.Get(te.Task.ID.String()); err == nil {
+		return nil
+	}
+	return w.Admit(te.Task)
+}
@@ -0,0 +1,56 @@
+package worker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/shirou/gopsutil/v4/mem"
+
+	"cube/stats"
+	"cube/task"
+)
+
+const (
+	mib = 1 << 20
+	gib = 1 << 30
+)
+
+func TestAdmitMemory(t *testing.T) {
+	w := New("worker-1", "memory", "")
+	// A 16 GiB host as gopsutil reports it, running a task which requested 8 GiB
+	w.Stats = &stats.Stats{
+		CpuCount:  8,
+		MemStats:  &mem.VirtualMemoryStat{Total: 16 * gib, Available: 6 * gib, Used: 10 * gib, UsedPercent: 62.5},
+		DiskStats: &disk.UsageStat{Path: "/", Total: 100 * gib, Free: 60 * gib, Used: 40 * gib, UsedPercent: 40},
+	}
+	running := task.Task{ID: uuid.New(), Name: "db", State: task.Running, Memory: 8 * gib}
+	if err := w.Db.Put(running.ID.String(), &running); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		memory int64
+		want   string
+	}{
+		{"fits", 512 * mib, ""},
+		{"fills the host", 6 * gib, ""},
+		{"over the host's memory", 9 * gib, "insufficient resources: requested 9663676416 bytes of memory, 8589934592 of 17179869184 allocated"},
+		{"over the available memory", 7 * gib, "insufficient resources: requested 7516192768 bytes of memory, 6442450944 available"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := w.Admit(task.Task{ID: uuid.New(), Name: "web", State: task.Scheduled, Memory: tt.memory})
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("Admit() = %v, want the task admitted", err)
+			case tt.want != "" && (err == nil || err.Error() != tt.want):
+				t.Errorf("Admit() = %v, want %s", err, tt.want)
+			case tt.want != "" && !errors.Is(err, ErrInsufficientResources):
+				t.Errorf("Admit() = %v, want an ErrInsufficientResources", err)
+			}
+		})
+	}
+}
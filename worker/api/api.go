@@ -1,11 +1,24 @@
 package workerApi
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 
+	"cube/auth"
+	"cube/config"
+	"cube/openapi"
+	"cube/rpc"
+	"cube/rpc/workerpb"
+	"cube/task"
+	"cube/utils"
 	"cube/worker"
 )
 
@@ -13,8 +26,13 @@ type Api struct {
 	Address string
 	Port    int
 	Worker  *worker.Worker
+	// Bearer token required on every request, empty disables authentication
+	AuthToken string
+	// Manager to worker transport, rpc.GRPCTransport also serves the gRPC API
+	Transport string
 	// Mux > multiplexer == request router
 	Router *chi.Mux
+	Server *http.Server
 }
 
 type ErrResponse struct {
@@ -22,22 +40,92 @@ type ErrResponse struct {
 	Message        string
 }
 
+// encode writes v as the JSON response body, with the registry credentials of the
+// tasks in it redacted. Workers only receive credentials, they never hand them out.
+func encode(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(task.Redact(v))
+}
+
 // Server
 func (a *Api) initRouter() {
 	a.Router = chi.NewRouter()
+	a.Router.Use(openapi.Middleware(spec, a.Router))
+	a.Router.Use(auth.Middleware(a.AuthToken))
+	a.Router.Use(a.versionHeaders)
 	a.Router.Route("/tasks", func(r chi.Router) {
 		r.Post("/", a.StartTaskHandler)
 		r.Get("/", a.GetTasksHandler)
 		r.Route("/{taskID}", func(r chi.Router) {
+			r.Get("/", a.GetTaskHandler)
 			r.Delete("/", a.StopTaskHandler)
+			r.Get("/logs", a.GetTaskLogsHandler)
+			r.Get("/logs/stream", a.GetTaskLogStreamHandler)
+			r.Get("/stats", a.GetTaskStatsHandler)
+			r.Get("/result", a.GetTaskResultHandler)
 		})
 	})
+	a.Router.Get("/events/stream", a.GetEventStreamHandler)
 	a.Router.Route("/stats", func(r chi.Router) {
 		r.Get("/", a.GetStatsHandler)
+		r.Get("/history", a.GetStatsHistoryHandler)
+	})
+	a.Router.Route("/containers", func(r chi.Router) {
+		r.Get("/", a.GetContainersHandler)
+		r.Post("/cleanup", a.CleanupContainersHandler)
+		r.Post("/{containerID}/adopt", a.AdoptContainerHandler)
+	})
+	a.Router.Route("/drain", func(r chi.Router) {
+		r.Get("/", a.GetDrainHandler)
+		r.Put("/", a.DrainHandler)
+	})
+	a.Router.Route("/config", func(r chi.Router) {
+		r.Get("/", a.GetConfigHandler)
 	})
+	a.Router.Method(http.MethodGet, "/metrics", a.Worker.MetricsHandler())
+	if a.Transport == rpc.GRPCTransport {
+		a.Router.Handle("/"+workerpb.WorkerService_ServiceDesc.ServiceName+"/*", a.grpcHandler())
+	}
 }
 
-func (a *Api) Start() {
+// Advertise the worker version, capabilities and labels on every response
+func (a *Api) versionHeaders(next http.Handler) http.Handler {
+	labels := make([]string, 0, len(a.Worker.Labels))
+	for k, v := range a.Worker.Labels {
+		labels = append(labels, k+"="+v)
+	}
+	slices.Sort(labels)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(config.VersionHeader, config.Version)
+		w.Header().Set(config.ApiVersionHeader, strconv.Itoa(config.ApiVersion))
+		w.Header().Set(config.CapabilitiesHeader, strings.Join(a.Worker.AdvertisedCapabilities(), ","))
+		if len(labels) > 0 {
+			w.Header().Set(config.LabelsHeader, strings.Join(labels, ","))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Start binds the API address, returning the error when it cannot, and serves in the
+// background; the returned channel receives the error serving fails with
+func (a *Api) Start() (<-chan error, error) {
 	a.initRouter()
-	http.ListenAndServe(fmt.Sprintf("%s:%d", a.Address, a.Port), a.Router)
+	a.Server = &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", a.Address, a.Port),
+		Handler: a.Router,
+	}
+	if a.Transport == rpc.GRPCTransport {
+		// gRPC clients speak HTTP/2 without TLS
+		a.Server.Protocols = new(http.Protocols)
+		a.Server.Protocols.SetHTTP1(true)
+		a.Server.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return utils.Listen(a.Server)
+}
+
+// Stop gracefully shuts the server down, waiting for in-flight requests until ctx expires
+func (a *Api) Stop(ctx context.Context) error {
+	if a.Server == nil {
+		return nil
+	}
+	return a.Server.Shutdown(ctx)
 }
@@ -0,0 +1,99 @@
+package workerApi
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"cube/rpc"
+	"cube/rpc/workerpb"
+	"cube/task"
+)
+
+/**
+* gRPC API
+* With --transport=grpc the WorkerService is served next to the HTTP API on the same
+* port, over unencrypted HTTP/2. It goes through the same router, so the bearer token
+* and version headers apply to it as well.
+ */
+const defaultStatsInterval = 15 * time.Second
+
+type grpcServer struct {
+	workerpb.UnimplementedWorkerServiceServer
+	api *Api
+}
+
+func (a *Api) grpcHandler() *grpc.Server {
+	s := grpc.NewServer()
+	workerpb.RegisterWorkerServiceServer(s, &grpcServer{api: a})
+	return s
+}
+
+func (s *grpcServer) SubmitTask(ctx context.Context, pe *workerpb.TaskEvent) (*workerpb.Task, error) {
+	te, err := rpc.TaskEventFromProto(pe)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid task event: %v", err)
+	}
+	if err := s.api.Worker.AdmitEvent(te); err != nil {
+		logger.Warn("Task not admitted", "task_id", te.Task.ID, "error", err)
+		return nil, status.Errorf(codes.ResourceExhausted, "task %v not admitted: %v", te.Task.ID, err)
+	}
+	s.api.Worker.AddTask(te.Task)
+	logger.Info("Added task", "task_id", te.Task.ID, "state", te.Task.State.String())
+	return rpc.TaskToProto(te.Task), nil
+}
+
+func (s *grpcServer) StopTask(ctx context.Context, req *workerpb.StopTaskRequest) (*workerpb.StopTaskResponse, error) {
+	tID, err := uuid.Parse(req.GetTaskId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid task ID %q", req.GetTaskId())
+	}
+	taskToStop, err := s.api.Worker.Db.Get(tID.String())
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "no task with ID %v found", tID)
+	}
+
+	// we need to make a copy so we are not modifying the task in the datastore
+	taskCopy := *taskToStop.(*task.Task)
+	taskCopy.State = task.Completed
+	s.api.Worker.AddTask(taskCopy)
+
+	logger.Info("Added task to stop container", "task_id", taskCopy.ID, "container_id", taskCopy.ContainerID)
+	return &workerpb.StopTaskResponse{}, nil
+}
+
+func (s *grpcServer) ListTasks(ctx context.Context, req *workerpb.ListTasksRequest) (*workerpb.ListTasksResponse, error) {
+	tasks := s.api.Worker.GetTasks()
+	resp := &workerpb.ListTasksResponse{Tasks: make([]*workerpb.Task, 0, len(tasks))}
+	for _, t := range tasks {
+		resp.Tasks = append(resp.Tasks, rpc.TaskToProto(*t))
+	}
+	return resp, nil
+}
+
+// StreamStats sends the worker stats every interval until the client goes away
+func (s *grpcServer) StreamStats(req *workerpb.StreamStatsRequest, stream grpc.ServerStreamingServer[workerpb.Stats]) error {
+	interval := time.Duration(req.GetIntervalSeconds()) * time.Second
+	if interval <= 0 {
+		interval = defaultStatsInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// Stats are nil until the worker collected them once
+		if st := s.api.Worker.Stats; st != nil {
+			if err := stream.Send(rpc.StatsToProto(st)); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,17 +1,28 @@
 package workerApi
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
+	"strconv"
 
+	"cube/config"
+	"cube/logging"
+	"cube/node"
+	"cube/store"
 	"cube/task"
+	"cube/utils"
+	"cube/worker"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/moby/moby/pkg/stdcopy"
 )
 
+var logger = logging.For("worker")
+
 // Tasks
 func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 	d := json.NewDecoder(r.Body)
@@ -21,40 +32,64 @@ func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 	err := d.Decode(&te)
 	if err != nil {
 		msg := fmt.Sprintf("Error unmarshalling body: %v\n", err)
-		log.Printf("%s\n", msg)
+		logger.Warn(msg)
 		w.WriteHeader(400)
 		e := ErrResponse{
 			HTTPStatusCode: 400,
 			Message:        msg,
 		}
-		json.NewEncoder(w).Encode(e)
+		encode(w, e)
+		return
+	}
+
+	if err := a.Worker.AdmitEvent(te); err != nil {
+		msg := fmt.Sprintf("Task %v not admitted: %v", te.Task.ID, err)
+		logger.Warn(msg)
+		w.WriteHeader(429)
+		encode(w, ErrResponse{HTTPStatusCode: 429, Message: msg})
 		return
 	}
 
 	a.Worker.AddTask(te.Task)
-	log.Printf("Added task: %v\n", te.Task.ID)
+	logger.Info("Added task", "task_id", te.Task.ID, "state", te.Task.State.String())
 	w.WriteHeader(201)
-	json.NewEncoder(w).Encode(te.Task)
+	encode(w, te.Task)
 }
 
 func (a *Api) GetTasksHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := store.ParseTaskQuery(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: err.Error()})
+		return
+	}
+	tasks, total, err := a.Worker.QueryTasks(q)
+	if err != nil {
+		logger.Error("Error querying tasks", "error", err)
+		w.WriteHeader(500)
+		encode(w, ErrResponse{HTTPStatusCode: 500, Message: err.Error()})
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(config.TotalCountHeader, strconv.Itoa(total))
 	w.WriteHeader(200)
-	json.NewEncoder(w).Encode(a.Worker.GetTasks())
+	encode(w, tasks)
 }
 
 func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 	taskID := chi.URLParam(r, "taskID")
 	if taskID == "" {
-		log.Printf("No taskID passed in request.\n")
+		logger.Warn("No taskID passed in request")
 		w.WriteHeader(400)
+		return
 	}
 
 	tID, _ := uuid.Parse(taskID)
 	taskToStop, err := a.Worker.Db.Get(tID.String())
 	if err != nil {
-		log.Printf("No task with ID %v found", tID)
+		logger.Warn("No task with ID found", "task_id", tID)
 		w.WriteHeader(404)
+		return
 	}
 
 	// we need to make a copy so we are not modifying the task in the datastore
@@ -62,13 +97,319 @@ func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 	taskCopy.State = task.Completed
 	a.Worker.AddTask(taskCopy)
 
-	log.Printf("Added task %v to stop container %v\n", taskCopy.ID, taskCopy.ContainerID)
+	logger.Info("Added task to stop container", "task_id", taskCopy.ID, "container_id", taskCopy.ContainerID)
 	w.WriteHeader(204)
 }
 
+func (a *Api) GetTaskLogsHandler(w http.ResponseWriter, r *http.Request) {
+	follow := r.URL.Query().Get("follow") == "true"
+	logs, ok := a.openTaskLogs(w, r, follow)
+	if !ok {
+		return
+	}
+	defer logs.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(200)
+	fw := utils.NewFlushWriter(w)
+	stdcopy.StdCopy(fw, fw, logs)
+}
+
+// GetTaskLogStreamHandler follows the output of a task's container as server-sent
+// events: a stdout or stderr event per line, then an end event once the container
+// exits, or an error event if reading its output fails
+func (a *Api) GetTaskLogStreamHandler(w http.ResponseWriter, r *http.Request) {
+	logs, ok := a.openTaskLogs(w, r, true)
+	if !ok {
+		return
+	}
+	defer logs.Close()
+
+	sse := utils.NewSSEWriter(w)
+	w.WriteHeader(200)
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go sse.KeepAlive(ctx)
+
+	stdout, stderr := sse.Lines("stdout"), sse.Lines("stderr")
+	_, err := stdcopy.StdCopy(stdout, stderr, logs)
+	if r.Context().Err() != nil {
+		// The client went away
+		return
+	}
+	stdout.Flush()
+	stderr.Flush()
+	if err != nil {
+		sse.Event("error", err.Error())
+		return
+	}
+	sse.Event("end", chi.URLParam(r, "taskID"))
+}
+
+// openTaskLogs opens the output of the task's container with the request's tail,
+// writing the error response when it cannot
+func (a *Api) openTaskLogs(w http.ResponseWriter, r *http.Request, follow bool) (io.ReadCloser, bool) {
+	taskID := chi.URLParam(r, "taskID")
+	res, err := a.Worker.Db.Get(taskID)
+	if err != nil {
+		msg := fmt.Sprintf("No task with ID %v found", taskID)
+		logger.Warn("No task with ID found", "task_id", taskID)
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: msg})
+		return nil, false
+	}
+
+	t := res.(*task.Task)
+	if t.ContainerID == "" {
+		msg := fmt.Sprintf("Task %v has no container", taskID)
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: msg})
+		return nil, false
+	}
+
+	tail := r.URL.Query().Get("tail")
+	if !utils.ValidLogTail(tail) {
+		msg := fmt.Sprintf("Invalid tail %q, expected a number of lines or \"all\"", tail)
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return nil, false
+	}
+
+	logs, err := a.Worker.TaskLogs(r.Context(), *t, follow, tail)
+	if err != nil {
+		msg := fmt.Sprintf("Error getting logs for task %v: %v", taskID, err)
+		logger.Error("Error getting task logs", "task_id", taskID, "container_id", t.ContainerID, "error", err)
+		w.WriteHeader(500)
+		encode(w, ErrResponse{HTTPStatusCode: 500, Message: msg})
+		return nil, false
+	}
+	return logs, true
+}
+
 // Stats
+// GetTaskHandler returns a task with the state of its container
+func (a *Api) GetTaskHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := chi.URLParam(r, "taskID")
+	tID, err := uuid.Parse(taskID)
+	if err != nil {
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: "Invalid task ID"})
+		return
+	}
+	in, err := a.Worker.Inspect(tID)
+	if err != nil {
+		msg := fmt.Sprintf("No task with ID %v found", taskID)
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: msg})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, in)
+}
+
+// GetTaskResultHandler returns the output and exit code of a finished job
+func (a *Api) GetTaskResultHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := chi.URLParam(r, "taskID")
+	id, err := uuid.Parse(taskID)
+	if err != nil {
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: "Invalid task ID"})
+		return
+	}
+	result, ok := a.Worker.Result(id)
+	if !ok {
+		msg := fmt.Sprintf("No result for task %v, it is not a finished job", taskID)
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: msg})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, result)
+}
+
+// GetTaskStatsHandler returns the resource usage last sampled for a task
+func (a *Api) GetTaskStatsHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := chi.URLParam(r, "taskID")
+	res, err := a.Worker.Db.Get(taskID)
+	if err != nil {
+		msg := fmt.Sprintf("No task with ID %v found", taskID)
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: msg})
+		return
+	}
+
+	t := res.(*task.Task)
+	if t.Usage == nil {
+		msg := fmt.Sprintf("No resource usage sampled for task %v yet", taskID)
+		w.WriteHeader(404)
+		encode(w, ErrResponse{HTTPStatusCode: 404, Message: msg})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, t.Usage)
+}
+
+// GetEventStreamHandler sends the worker's task and container events as they happen,
+// as "task" and "container" events carrying a worker.Event
+func (a *Api) GetEventStreamHandler(w http.ResponseWriter, r *http.Request) {
+	events, unsubscribe := a.Worker.SubscribeEvents()
+	defer unsubscribe()
+
+	sse := utils.NewSSEWriter(w)
+	w.WriteHeader(200)
+	// Sends the headers, the first event may take a while
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go sse.KeepAlive(ctx)
+
+	for {
+		select {
+		case e := <-events:
+			data, err := json.Marshal(e)
+			if err != nil {
+				logger.Error("Error encoding event", "type", e.Type, "error", err)
+				continue
+			}
+			if sse.Event(e.Type, string(data)) != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 func (a *Api) GetStatsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(200)
-	json.NewEncoder(w).Encode(a.Worker.Stats)
+	encode(w, a.Worker.Stats)
+}
+
+// GetStatsHistoryHandler returns the last host stats samples oldest first, the last
+// limit of them when set
+func (a *Api) GetStatsHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			w.WriteHeader(400)
+			encode(w, ErrResponse{HTTPStatusCode: 400, Message: fmt.Sprintf("limit must be a non-negative integer, got %q", v)})
+			return
+		}
+		limit = n
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, a.Worker.StatsHistory.Samples(limit))
+}
+
+// Drain
+func (a *Api) DrainHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	req := node.DrainRequest{}
+	if err := d.Decode(&req); err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body: %v\n", err)
+		logger.Warn(msg)
+		w.WriteHeader(400)
+		encode(w, ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	a.Worker.SetDrain(req)
+	a.GetDrainHandler(w, r)
+}
+
+func (a *Api) GetDrainHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, a.Worker.Drain())
+}
+
+// Config
+func (a *Api) GetConfigHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, a.Worker.Settings().Redacted())
+}
+
+// Containers
+func (a *Api) GetContainersHandler(w http.ResponseWriter, r *http.Request) {
+	containers, err := a.Worker.ListContainers()
+	if err != nil {
+		msg := fmt.Sprintf("Error listing containers: %v", err)
+		logger.Error("Error listing containers", "error", err)
+		w.WriteHeader(500)
+		encode(w, ErrResponse{HTTPStatusCode: 500, Message: msg})
+		return
+	}
+
+	if r.URL.Query().Get("managed") == "false" {
+		var unmanaged []worker.Container
+		for _, c := range containers {
+			if !c.ManagedByCube {
+				unmanaged = append(unmanaged, c)
+			}
+		}
+		containers = unmanaged
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, containers)
+}
+
+// CleanupContainersHandler removes the worker's orphaned containers and returns them
+func (a *Api) CleanupContainersHandler(w http.ResponseWriter, r *http.Request) {
+	removed, err := a.Worker.CleanupOrphans()
+	if err != nil {
+		msg := fmt.Sprintf("Error cleaning up containers: %v", err)
+		logger.Error("Error cleaning up orphaned containers", "error", err)
+		w.WriteHeader(500)
+		encode(w, ErrResponse{HTTPStatusCode: 500, Message: msg})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	encode(w, removed)
+}
+
+type AdoptRequest struct {
+	Name string
+}
+
+func (a *Api) AdoptContainerHandler(w http.ResponseWriter, r *http.Request) {
+	containerID := chi.URLParam(r, "containerID")
+
+	req := AdoptRequest{}
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			msg := fmt.Sprintf("Error unmarshalling body: %v", err)
+			logger.Warn("Error unmarshalling adopt request", "container_id", containerID, "error", err)
+			w.WriteHeader(400)
+			encode(w, ErrResponse{HTTPStatusCode: 400, Message: msg})
+			return
+		}
+	}
+
+	t, err := a.Worker.AdoptContainer(containerID, req.Name)
+	if err != nil {
+		msg := fmt.Sprintf("Error adopting container %s: %v", containerID, err)
+		logger.Error("Error adopting container", "container_id", containerID, "name", req.Name, "error", err)
+		w.WriteHeader(409)
+		encode(w, ErrResponse{HTTPStatusCode: 409, Message: msg})
+		return
+	}
+
+	w.WriteHeader(201)
+	encode(w, t)
 }
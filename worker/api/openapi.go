@@ -0,0 +1,38 @@
+package workerApi
+
+import (
+	"cube/config"
+	"cube/node"
+	"cube/openapi"
+	"cube/stats"
+	"cube/task"
+	"cube/utils"
+	"cube/worker"
+)
+
+// Operations of the worker API, see openapi.Spec
+var spec = openapi.Spec{
+	Title:   "Cube worker API",
+	Version: config.Version,
+	Error:   ErrResponse{},
+	Operations: map[string]openapi.Operation{
+		"POST /tasks":                          {Summary: "Queue a task event", Request: task.TaskEvent{}, Response: task.Task{}, Status: 201},
+		"GET /tasks":                           {Summary: "List the worker's tasks", Query: []string{"state", "image", "label", "sort", "limit", "offset"}, Response: []task.Task{}},
+		"GET /tasks/{taskID}":                  {Summary: "Inspect a task and its container", Response: task.Inspection{}},
+		"DELETE /tasks/{taskID}":               {Summary: "Stop a task", Status: 204},
+		"GET /tasks/{taskID}/logs":             {Summary: "Stream the logs of a task", Query: []string{"follow", "tail"}, ContentType: "text/plain"},
+		"GET /tasks/{taskID}/logs/stream":      {Summary: "Follow the logs of a task as server-sent events", Query: []string{"tail"}, ContentType: utils.SSEContentType},
+		"GET /tasks/{taskID}/stats":            {Summary: "Get the resource usage of a task", Response: task.ContainerStats{}},
+		"GET /events/stream":                   {Summary: "Follow task state changes and container lifecycle events as server-sent events", ContentType: utils.SSEContentType},
+		"GET /tasks/{taskID}/result":           {Summary: "Get the output and exit code of a finished job", Response: task.Result{}},
+		"GET /stats":                           {Summary: "Get the host and workload stats of the worker", Response: stats.Stats{}},
+		"GET /stats/history":                   {Summary: "Get the last host stats samples of the worker", Query: []string{"limit"}, Response: []stats.Sample{}},
+		"GET /containers":                      {Summary: "List the containers on the host", Query: []string{"managed"}, Response: []worker.Container{}},
+		"POST /containers/cleanup":             {Summary: "Remove orphaned task containers", Response: []worker.Container{}},
+		"POST /containers/{containerID}/adopt": {Summary: "Import a container as a task", Request: AdoptRequest{}, Response: task.Task{}, Status: 201},
+		"GET /drain":                           {Summary: "Get the drain status of the worker", Response: node.DrainRequest{}},
+		"PUT /drain":                           {Summary: "Drain or undrain the worker", Request: node.DrainRequest{}, Response: node.DrainRequest{}},
+		"GET /config":                          {Summary: "Get the worker's effective settings", Response: config.Settings{}},
+		"GET /metrics":                         {Summary: "Prometheus metrics", ContentType: "text/plain"},
+	},
+}
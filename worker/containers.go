@@ -0,0 +1,115 @@
+package worker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/google/uuid"
+
+	"cube/task"
+)
+
+/**
+* Host containers
+* Lists every container on the worker host, flagging the ones Cube manages, so operators
+* can spot conflicts with manually run containers and adopt them as imported tasks.
+ */
+type Container struct {
+	ID            string
+	Name          string
+	Image         string
+	State         string
+	Status        string
+	Created       time.Time
+	ManagedByCube bool
+	TaskID        *uuid.UUID `json:",omitempty"`
+}
+
+func (w *Worker) ListContainers() ([]Container, error) {
+	summaries, err := w.runtime(&task.Config{}).List()
+	if err != nil {
+		return nil, err
+	}
+
+	managed := make(map[string]uuid.UUID)
+	for _, t := range w.GetTasks() {
+		if t.ContainerID != "" {
+			managed[t.ContainerID] = t.ID
+		}
+	}
+
+	containers := make([]Container, 0, len(summaries))
+	for _, s := range summaries {
+		var taskID *uuid.UUID
+		if id, ok := managed[s.ID]; ok {
+			taskID = &id
+		}
+		containers = append(containers, newContainer(s, taskID))
+	}
+	return containers, nil
+}
+
+// newContainer summarizes a listed container, managed by Cube when it has a task
+func newContainer(s container.Summary, taskID *uuid.UUID) Container {
+	c := Container{
+		ID:            s.ID,
+		Image:         s.Image,
+		State:         s.State,
+		Status:        s.Status,
+		Created:       time.Unix(s.Created, 0).UTC(),
+		ManagedByCube: taskID != nil,
+		TaskID:        taskID,
+	}
+	if len(s.Names) > 0 {
+		c.Name = strings.TrimPrefix(s.Names[0], "/")
+	}
+	return c
+}
+
+// AdoptContainer creates a task record from an existing container's inspect data
+// so the worker starts tracking its lifecycle
+func (w *Worker) AdoptContainer(containerID string, name string) (*task.Task, error) {
+	for _, t := range w.GetTasks() {
+		if t.ContainerID == containerID || strings.HasPrefix(t.ContainerID, containerID) {
+			return nil, fmt.Errorf("container %s is already managed by task %v", containerID, t.ID)
+		}
+	}
+
+	resp := w.runtime(&task.Config{}).Inspect(containerID)
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	c := resp.Container
+
+	if name == "" {
+		name = strings.TrimPrefix(c.Name, "/")
+	}
+	t := task.Task{
+		ID:            uuid.New(),
+		ContainerID:   c.ID,
+		ContainerName: strings.TrimPrefix(c.Name, "/"),
+		Name:          name,
+		Image:         c.Config.Image,
+		State:         task.Completed,
+	}
+	if c.State != nil && c.State.Running {
+		t.State = task.Running
+	}
+	if c.State != nil {
+		t.StartTime, _ = time.Parse(time.RFC3339Nano, c.State.StartedAt)
+	}
+	t.ExposedPorts = c.Config.ExposedPorts
+	if c.NetworkSettings != nil {
+		t.HostPorts = c.NetworkSettings.NetworkSettingsBase.Ports
+	}
+	t.QoSClass = task.QoSClassFor(t)
+
+	err := w.Db.Put(t.ID.String(), &t)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Adopted container", "container_id", c.ID, "task_id", t.ID)
+	return &t, nil
+}
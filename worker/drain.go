@@ -0,0 +1,37 @@
+package worker
+
+import (
+	"cube/node"
+)
+
+/**
+* Draining
+* A drained worker keeps running its tasks but advertises the drain in its stats,
+* so the manager stops placing tasks on it and, when Evict is set, moves its tasks
+* to other workers. The drain lasts until it is lifted or the worker restarts.
+ */
+
+// SetDrain drains or undrains the worker
+func (w *Worker) SetDrain(d node.DrainRequest) {
+	w.mu.Lock()
+	w.drain = d
+	w.mu.Unlock()
+	// Advertise the change right away instead of on the next stats collection
+	if w.Stats != nil {
+		s := *w.Stats
+		s.Drained, s.Evict = d.Drained, d.Evict && d.Drained
+		w.Stats = &s
+	}
+	if d.Drained {
+		logger.Info("Worker drained", "evict", d.Evict)
+	} else {
+		logger.Info("Worker drain lifted")
+	}
+}
+
+// Drain returns the drain status of the worker
+func (w *Worker) Drain() node.DrainRequest {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.drain
+}
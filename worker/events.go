@@ -0,0 +1,124 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"cube/task"
+	"cube/utils"
+)
+
+/**
+* Event stream
+* GET /events/stream sends every task state change on the worker, and the
+* lifecycle events of its containers as reported by the container runtime, to
+* its subscribers as server-sent events, so they need not poll /tasks. Each
+* subscriber has its own buffer, events a subscriber has no room for are dropped
+* instead of slowing the worker down.
+ */
+const (
+	TaskEventType      = "task"
+	ContainerEventType = "container"
+)
+
+// Events a subscriber can queue before the following ones are dropped
+const eventBuffer = 256
+
+// Delays between reconnections to the runtime's event stream
+const (
+	watchBackoff    = time.Second
+	maxWatchBackoff = time.Minute
+)
+
+type Event struct {
+	// TaskEventType or ContainerEventType
+	Type string
+	Time time.Time
+	// The task as it reached its new state, and the state it left
+	Task     *task.Task `json:",omitempty"`
+	Previous string     `json:",omitempty"`
+	// The container event
+	Container *task.ContainerEvent `json:",omitempty"`
+}
+
+type eventStream struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]bool
+}
+
+// SubscribeEvents returns the channel the worker's events are sent on and the
+// function ending the subscription
+func (w *Worker) SubscribeEvents() (<-chan Event, func()) {
+	ch := make(chan Event, eventBuffer)
+	w.events.mu.Lock()
+	defer w.events.mu.Unlock()
+	if w.events.subscribers == nil {
+		w.events.subscribers = make(map[chan Event]bool)
+	}
+	w.events.subscribers[ch] = true
+	return ch, func() {
+		w.events.mu.Lock()
+		defer w.events.mu.Unlock()
+		delete(w.events.subscribers, ch)
+	}
+}
+
+func (w *Worker) publishEvent(e Event) {
+	w.events.mu.Lock()
+	defer w.events.mu.Unlock()
+	for ch := range w.events.subscribers {
+		select {
+		case ch <- e:
+		default:
+			logger.Warn("Event stream subscriber is falling behind, dropping event", "type", e.Type)
+		}
+	}
+}
+
+// publishTransition is the States hook sending task state changes to subscribers
+func (w *Worker) publishTransition(t task.Task, from task.State, to task.State) {
+	t = t.Redacted()
+	w.publishEvent(Event{Type: TaskEventType, Time: time.Now().UTC(), Task: &t, Previous: from.String()})
+}
+
+// WatchContainers sends the lifecycle events of the worker's containers to the
+// event stream subscribers until ctx is done, reconnecting to the runtime when
+// its stream ends
+func (w *Worker) WatchContainers(ctx context.Context) {
+	delay := watchBackoff
+	for {
+		rc, err := w.runtimeClient()
+		if err == nil {
+			err = w.watchContainers(ctx, rc, func() { delay = watchBackoff })
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, task.ErrEventsUnsupported) {
+			logger.Info("Container runtime does not stream events, only task events are sent", "runtime", w.Runtime)
+			return
+		}
+		logger.Warn("Container event stream ended, reconnecting", "error", err, "delay", delay)
+		if !utils.SleepContext(ctx, delay) {
+			return
+		}
+		delay = min(delay*2, maxWatchBackoff)
+	}
+}
+
+// watchContainers relays the runtime's events until its stream fails, calling
+// received for every event
+func (w *Worker) watchContainers(ctx context.Context, rc *task.RuntimeClient, received func()) error {
+	events, errs := rc.Events(ctx, w.Name)
+	for {
+		select {
+		case e := <-events:
+			received()
+			w.publishEvent(Event{Type: ContainerEventType, Time: e.Time, Container: &e})
+		case err := <-errs:
+			return err
+		}
+	}
+}
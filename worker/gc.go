@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"cube/task"
+	"cube/utils"
+)
+
+/**
+* Task garbage collection
+* Completed, Stopped and Failed tasks are deleted from the worker's datastore, and
+* their exited containers removed, once they finished more than TaskRetention ago.
+* Zero keeps them forever. Orphaned containers are removed on every collection.
+ */
+const defaultTaskRetention = 24 * time.Hour
+
+// Upper bound on the time between collections
+const maxGCInterval = 5 * time.Minute
+
+func gcInterval(retention time.Duration) time.Duration {
+	if retention <= 0 {
+		return maxGCInterval
+	}
+	return min(retention, maxGCInterval)
+}
+
+func (w *Worker) CollectGarbage(ctx context.Context) {
+	interval := gcInterval(w.TaskRetention)
+	w.Watchdog.Register("taskGC", interval)
+	for {
+		w.Watchdog.Beat("taskGC")
+		if w.TaskRetention > 0 {
+			w.collectTasks(time.Now().UTC())
+		}
+		if _, err := w.CleanupOrphans(); err != nil {
+			logger.Error("Error cleaning up orphaned containers", "error", err)
+		}
+		if !utils.SleepContext(ctx, interval) {
+			return
+		}
+	}
+}
+
+// collectTasks deletes the tasks that finished before now minus TaskRetention
+func (w *Worker) collectTasks(now time.Time) {
+	collected := 0
+	for _, t := range w.GetTasks() {
+		if !isFinished(t.State) || t.FinishTime.IsZero() || now.Sub(t.FinishTime) < w.TaskRetention {
+			continue
+		}
+		// The manager may be restarting the task
+		if !w.claim(t.ID) {
+			continue
+		}
+		if t.ContainerID != "" {
+			config := task.NewConfig(t)
+			if result := w.runtime(config).Stop(t.ContainerID); result.Error != nil {
+				logger.Error("Error removing container", "task_id", t.ID, "container_id", t.ContainerID, "error", result.Error)
+			}
+		}
+		if err := w.Db.Delete(t.ID.String()); err != nil {
+			logger.Error("Error deleting task", "task_id", t.ID, "error", err)
+		} else {
+			w.forgetState(t.ID)
+			collected++
+		}
+		w.done(t.ID)
+	}
+	if collected > 0 {
+		logger.Info("Collected finished tasks", "tasks", collected)
+	}
+}
+
+func isFinished(s task.State) bool {
+	return s == task.Completed || s == task.Stopped || s == task.Failed
+}
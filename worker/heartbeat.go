@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"cube/config"
+	"cube/features"
+	"cube/node"
+	"cube/task"
+	"cube/utils"
+)
+
+/**
+* Heartbeats
+* A worker configured with a Manager POSTs a heartbeat to its /heartbeat endpoint,
+* first every defaultHeartbeatInterval and then at the interval the manager answers
+* with. The capabilities it advertises there, and on every API response, are those of
+* the build, the enabled feature gates, gpu when GPUs were detected and the ones
+* declared by the operator; tasks requiring a capability are only placed on nodes
+* advertising it.
+ */
+const defaultHeartbeatInterval = 5 * time.Second
+
+// AdvertisedCapabilities returns the capabilities of the worker, sorted and without duplicates
+func (w *Worker) AdvertisedCapabilities() []string {
+	capabilities := slices.Concat(config.Capabilities, features.Gates.EnabledList(), w.Capabilities)
+	if w.Stats != nil && w.Stats.GpuCount > 0 {
+		capabilities = append(capabilities, task.GpuCapability)
+	}
+	slices.Sort(capabilities)
+	return slices.Compact(capabilities)
+}
+
+// SendHeartbeats pushes heartbeats to the manager until ctx is cancelled
+func (w *Worker) SendHeartbeats(ctx context.Context) {
+	if w.Manager == "" {
+		return
+	}
+	interval := defaultHeartbeatInterval
+	compatible := true
+	for {
+		if !utils.SleepContext(ctx, interval) {
+			return
+		}
+		if w.Stats == nil {
+			continue
+		}
+		resp, err := w.sendHeartbeat()
+		if err != nil {
+			logger.Warn("Error sending heartbeat", "manager", w.Manager, "error", err)
+			continue
+		}
+		if resp.Compatible != compatible {
+			compatible = resp.Compatible
+			if !compatible {
+				logger.Warn("Manager API version is not compatible with this worker",
+					"manager_version", resp.Version, "manager_api_version", resp.ApiVersion, "api_version", config.ApiVersion)
+			}
+		}
+		if resp.Interval > 0 {
+			interval = resp.Interval
+		}
+	}
+}
+
+func (w *Worker) sendHeartbeat() (*node.HeartbeatResponse, error) {
+	hb := node.Heartbeat{
+		Worker:       w.Address,
+		Version:      config.Version,
+		ApiVersion:   config.ApiVersion,
+		Capabilities: w.AdvertisedCapabilities(),
+		Labels:       w.Labels,
+		Stats:        *w.Stats,
+		Timestamp:    time.Now().UTC(),
+	}
+	data, err := json.Marshal(hb)
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("http://%s/heartbeat", w.Manager)
+	resp, err := w.Client.Post(url, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("manager returned %d", resp.StatusCode)
+	}
+	var hr node.HeartbeatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&hr); err != nil {
+		return nil, fmt.Errorf("error decoding heartbeat response: %v", err)
+	}
+	return &hr, nil
+}
@@ -0,0 +1,88 @@
+package worker
+
+import (
+	"net/http"
+
+	"cube/metrics"
+	"cube/task"
+)
+
+// Worker metrics served on /metrics
+type workerMetrics struct {
+	registry    *metrics.Registry
+	tasks       *metrics.Gauge
+	queueDepth  *metrics.Gauge
+	inProgress  *metrics.Gauge
+	taskRuns    *metrics.Counter
+	runDuration *metrics.Histogram
+	evictions   *metrics.Counter
+	restarts    *metrics.Counter
+	transitions *metrics.Counter
+	// Failed health probes by probe type
+	probeFailures *metrics.Counter
+	cpuUsage      *metrics.Gauge
+	memoryUsed    *metrics.Gauge
+	memoryTotal   *metrics.Gauge
+	diskUsed      *metrics.Gauge
+}
+
+func newWorkerMetrics(w *Worker) *workerMetrics {
+	r := metrics.NewRegistry()
+	wm := &workerMetrics{
+		registry:      r,
+		tasks:         r.NewGauge("cube_worker_tasks", "Tasks on the worker by state.", "state"),
+		queueDepth:    r.NewGauge("cube_worker_queue_depth", "Tasks waiting to run."),
+		inProgress:    r.NewGauge("cube_worker_tasks_in_progress", "Tasks being started, stopped or updated."),
+		taskRuns:      r.NewCounter("cube_worker_task_runs_total", "Queued tasks run by requested state and result.", "state", "result"),
+		runDuration:   r.NewHistogram("cube_worker_task_run_duration_seconds", "Time taken to run a queued task.", metrics.DefaultBuckets),
+		evictions:     r.NewCounter("cube_worker_evictions_total", "Tasks evicted under memory pressure."),
+		restarts:      r.NewCounter("cube_worker_task_restarts_total", "Exited containers restarted in place by their restart policy."),
+		transitions:   r.NewCounter("cube_worker_task_transitions_total", "Task state transitions by previous and new state.", "from", "to"),
+		probeFailures: r.NewCounter("cube_worker_probe_failures_total", "Failed task health probes by type.", "type"),
+		cpuUsage:      r.NewGauge("cube_worker_cpu_usage_ratio", "CPU time spent non-idle since boot."),
+		memoryUsed:    r.NewGauge("cube_worker_memory_used_bytes", "Memory used on the host."),
+		memoryTotal:   r.NewGauge("cube_worker_memory_total_bytes", "Total memory on the host."),
+		diskUsed:      r.NewGauge("cube_worker_disk_used_bytes", "Disk used on the host."),
+	}
+	r.OnScrape(func() { wm.collect(w) })
+	return wm
+}
+
+// transition counts a task moving from a state to another
+func (wm *workerMetrics) transition(t task.Task, from task.State, to task.State) {
+	wm.transitions.Inc(from.String(), to.String())
+}
+
+// collect sets the gauges derived from the worker's current state
+func (wm *workerMetrics) collect(w *Worker) {
+	wm.tasks.Reset()
+	for _, t := range w.GetTasks() {
+		wm.tasks.Add(1, t.State.String())
+	}
+
+	w.mu.Lock()
+	wm.queueDepth.Set(float64(w.Queue.Len()))
+	wm.inProgress.Set(float64(len(w.inProgress)))
+	w.mu.Unlock()
+
+	s := w.Stats
+	if s == nil {
+		return
+	}
+	if s.CpuStats != nil {
+		usage, _, _, _ := s.CpuUsage()
+		wm.cpuUsage.Set(usage)
+	}
+	if s.MemStats != nil {
+		wm.memoryUsed.Set(float64(s.MemUsed()))
+		wm.memoryTotal.Set(float64(s.MemTotal()))
+	}
+	if s.DiskStats != nil {
+		wm.diskUsed.Set(float64(s.DiskUsed()))
+	}
+}
+
+// MetricsHandler serves the worker metrics in the Prometheus text format
+func (w *Worker) MetricsHandler() http.Handler {
+	return w.metrics.registry.Handler()
+}
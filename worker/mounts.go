@@ -0,0 +1,53 @@
+package worker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"cube/task"
+)
+
+// resolveMounts returns t with the sources of its bind mounts resolved, so the
+// runtime mounts the paths that were checked. Bind mounts are refused unless the
+// source exists and resolves to a path inside one of AllowedBindPaths.
+func (w *Worker) resolveMounts(t task.Task) (task.Task, error) {
+	mounts := slices.Clone(t.Mounts)
+	for i, m := range mounts {
+		if m.Type != task.BindMount {
+			continue
+		}
+		if len(w.AllowedBindPaths) == 0 {
+			return t, fmt.Errorf("bind mount source %q refused, the worker allows no bind mount paths", m.Source)
+		}
+		if !filepath.IsAbs(m.Source) {
+			return t, fmt.Errorf("bind mount source %q must be an absolute path", m.Source)
+		}
+		source, err := filepath.EvalSymlinks(m.Source)
+		if err != nil {
+			return t, fmt.Errorf("bind mount source %q: %v", m.Source, err)
+		}
+		if !allowedPath(source, w.AllowedBindPaths) {
+			return t, fmt.Errorf("bind mount source %q is outside the allowed paths %v", m.Source, w.AllowedBindPaths)
+		}
+		mounts[i].Source = source
+	}
+	t.Mounts = mounts
+	return t, nil
+}
+
+func allowedPath(p string, allowed []string) bool {
+	for _, root := range allowed {
+		root, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(root, p)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"github.com/docker/docker/api/types/container"
+	"github.com/google/uuid"
+
+	"cube/task"
+)
+
+/**
+* Orphaned containers
+* Containers labeled with the worker's name whose task is gone from the task store,
+* or has moved on to another container, are leaked by failed starts, stops and
+* updates. They are removed on every garbage collection, and on demand through
+* POST /containers/cleanup.
+ */
+
+// owns reports whether the container was started by this worker
+func (w *Worker) owns(s container.Summary) bool {
+	_, ok := s.Labels[task.TaskIDLabel]
+	return ok && s.Labels[task.WorkerLabel] == w.Name
+}
+
+// CleanupOrphans removes the orphaned containers of the worker and returns them
+func (w *Worker) CleanupOrphans() ([]Container, error) {
+	rt := w.runtime(&task.Config{})
+	summaries, err := rt.List()
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []Container{}
+	for _, s := range summaries {
+		if !w.owns(s) {
+			continue
+		}
+		id, err := uuid.Parse(s.Labels[task.TaskIDLabel])
+		if err != nil {
+			continue
+		}
+		// A task being started or updated has a container the store does not know about yet
+		if !w.claim(id) {
+			continue
+		}
+		orphaned := true
+		if res, err := w.Db.Get(id.String()); err == nil {
+			orphaned = res.(*task.Task).ContainerID != s.ID
+		}
+		if orphaned {
+			logger.Info("Removing orphaned container", "task_id", id, "container_id", s.ID, "status", s.State)
+			if result := rt.Stop(s.ID); result.Error != nil {
+				logger.Error("Error removing orphaned container", "task_id", id, "container_id", s.ID, "error", result.Error)
+			} else {
+				removed = append(removed, newContainer(s, &id))
+			}
+		}
+		w.done(id)
+	}
+	if len(removed) > 0 {
+		logger.Info("Removed orphaned containers", "containers", len(removed))
+	}
+	return removed, nil
+}
@@ -0,0 +1,132 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/task"
+)
+
+/**
+* Task pool
+* AddTask wakes RunTasks, which runs queued tasks on up to Concurrency goroutines.
+* A task is only ever handled by one goroutine at a time: events for a task that is
+* still being started, stopped or updated stay queued, in order, until it is done.
+ */
+const defaultConcurrency = 4
+
+func (w *Worker) AddTask(t task.Task) {
+	w.mu.Lock()
+	w.Queue.Enqueue(t)
+	w.mu.Unlock()
+	w.notify()
+}
+
+// RunTasks processes the task queue until ctx is cancelled, then drains what is left in it
+func (w *Worker) RunTasks(ctx context.Context) {
+	w.Watchdog.Register("runTasks", w.RunInterval)
+	slots := make(chan struct{}, max(1, w.Concurrency))
+	var running sync.WaitGroup
+	for {
+		w.Watchdog.Beat("runTasks")
+		w.runQueued(slots, &running)
+
+		select {
+		case <-w.wake:
+		case <-time.After(w.RunInterval):
+		case <-ctx.Done():
+			logger.Info("Draining queued tasks before shutdown", "queued", w.QueueLen())
+			for {
+				w.runQueued(slots, &running)
+				running.Wait()
+				if w.QueueLen() == 0 {
+					return
+				}
+			}
+		}
+	}
+}
+
+// runQueued starts every queued task that is not already in progress, bounded by slots
+func (w *Worker) runQueued(slots chan struct{}, running *sync.WaitGroup) {
+	for {
+		t, ok := w.dequeue()
+		if !ok {
+			return
+		}
+		slots <- struct{}{}
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			defer func() { <-slots }()
+			defer w.done(t.ID)
+			result := w.runTask(t)
+			if result.Error != nil {
+				logger.Error("Error running task", "task_id", t.ID, "state", t.State.String(), "error", result.Error)
+			}
+		}()
+		w.Watchdog.Beat("runTasks")
+	}
+}
+
+// dequeue removes the first queued task that is not in progress and claims it,
+// keeping the order of everything left in the queue
+func (w *Worker) dequeue() (task.Task, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var next task.Task
+	found := false
+	for n := w.Queue.Len(); n > 0; n-- {
+		t := w.Queue.Dequeue().(task.Task)
+		if !found && !w.inProgress[t.ID] {
+			next, found = t, true
+			continue
+		}
+		w.Queue.Enqueue(t)
+	}
+	if found {
+		w.inProgress[next.ID] = true
+		if next.State == task.Completed {
+			w.stopping[next.ID] = true
+		}
+	}
+	return next, found
+}
+
+// claim marks a task as in progress, reporting false if it already was
+func (w *Worker) claim(id uuid.UUID) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.inProgress[id] {
+		return false
+	}
+	w.inProgress[id] = true
+	return true
+}
+
+// done releases a claimed task and wakes RunTasks for events queued behind it
+func (w *Worker) done(id uuid.UUID) {
+	w.mu.Lock()
+	delete(w.inProgress, id)
+	delete(w.stopping, id)
+	w.mu.Unlock()
+	w.notify()
+}
+
+func (w *Worker) notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// QueueLen returns the number of tasks waiting to run
+func (w *Worker) QueueLen() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.Queue.Len()
+}
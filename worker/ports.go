@@ -0,0 +1,86 @@
+package worker
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"cube/task"
+)
+
+// reservePorts claims the host ports t binds explicitly. It fails when another task
+// on this worker holds one of them, or when the port is taken outside of cube.
+// Reservations only cover starting a container, running tasks hold their ports
+// through their PortBindings.
+func (w *Worker) reservePorts(t task.Task) error {
+	ports := t.BoundHostPorts()
+	if len(ports) == 0 {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, p := range ports {
+		if id, ok := w.ports[p]; ok && id != t.ID {
+			return fmt.Errorf("host port %s is being bound by task %v", p, id)
+		}
+	}
+	for _, other := range w.GetTasks() {
+		if other.ID == t.ID || (other.State != task.Running && other.State != task.Stopping) {
+			continue
+		}
+		for _, p := range other.BoundHostPorts() {
+			if slices.Contains(ports, p) {
+				return fmt.Errorf("host port %s is bound by task %v", p, other.ID)
+			}
+		}
+	}
+	for _, p := range ports {
+		if err := portAvailable(p); err != nil {
+			return fmt.Errorf("host port %s is not available: %v", p, err)
+		}
+	}
+	for _, p := range ports {
+		w.ports[p] = t.ID
+	}
+	return nil
+}
+
+// releasePorts drops the reservations of t once its container started or failed to
+func (w *Worker) releasePorts(t task.Task) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for p, id := range w.ports {
+		if id == t.ID {
+			delete(w.ports, p)
+		}
+	}
+}
+
+// portAvailable checks a "port/proto" host port can be bound. Only tcp and udp are
+// checked, sctp ports are left to the runtime.
+func portAvailable(spec string) error {
+	port, proto, _ := strings.Cut(spec, "/")
+	switch proto {
+	case "tcp":
+		l, err := net.Listen("tcp", ":"+port)
+		if err != nil {
+			return err
+		}
+		return l.Close()
+	case "udp":
+		c, err := net.ListenPacket("udp", ":"+port)
+		if err != nil {
+			return err
+		}
+		return c.Close()
+	}
+	return nil
+}
+
+// sharesHostPorts reports whether a and b bind one of the same host ports
+func sharesHostPorts(a, b task.Task) bool {
+	ports := a.BoundHostPorts()
+	return slices.ContainsFunc(b.BoundHostPorts(), func(p string) bool { return slices.Contains(ports, p) })
+}
@@ -0,0 +1,249 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/google/uuid"
+
+	"cube/task"
+	"cube/utils"
+)
+
+// How often running tasks are checked for due probes
+const probeTick = time.Second
+
+// Consecutive probe results of a running task
+type probeState struct {
+	last      time.Time
+	failures  int
+	container string
+	// When the container started, failures are not counted before the probe's initial delay
+	started time.Time
+	// Whether the startup probe succeeded, true when the task has none
+	ready bool
+}
+
+// ProbeTasks runs the health probes of running tasks, failing tasks that exceed their failure threshold
+func (w *Worker) ProbeTasks(ctx context.Context) {
+	w.Watchdog.Register("probeTasks", probeTick)
+	states := make(map[uuid.UUID]*probeState)
+	for {
+		w.Watchdog.Beat("probeTasks")
+		w.probeTasks(ctx, states, time.Now())
+		if !utils.SleepContext(ctx, probeTick) {
+			return
+		}
+	}
+}
+
+func (w *Worker) probeTasks(ctx context.Context, states map[uuid.UUID]*probeState, now time.Time) {
+	type due struct {
+		t       task.Task
+		p       task.Probe
+		startup bool
+		err     error
+	}
+	var probes []*due
+	running := make(map[uuid.UUID]bool)
+	for _, t := range w.GetTasks() {
+		if t.State != task.Running || (t.HealthProbe() == nil && t.StartupProbe == nil) {
+			continue
+		}
+		running[t.ID] = true
+		s, ok := states[t.ID]
+		if !ok || s.container != t.ContainerID {
+			// The first probe runs one interval after the container started
+			s = &probeState{last: now, container: t.ContainerID, started: now, ready: t.StartupProbe == nil}
+			if !t.StartTime.IsZero() && t.StartTime.Before(now) {
+				s.started = t.StartTime
+			}
+			states[t.ID] = s
+		}
+		// Until the startup probe succeeds, it runs instead of the health probe
+		p, startup := t.HealthProbe(), !s.ready
+		if startup {
+			p = t.StartupProbe
+		}
+		if p == nil || now.Sub(s.last) < p.Interval() {
+			continue
+		}
+		s.last = now
+		probes = append(probes, &due{t: *t, p: *p, startup: startup})
+	}
+	for id := range states {
+		if !running[id] {
+			delete(states, id)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, d := range probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rt := w.runtime(task.NewConfig(&d.t))
+			d.err = w.probe(ctx, rt, d.p, d.t.ContainerID, d.t.HostPorts)
+		}()
+	}
+	wg.Wait()
+
+	for _, d := range probes {
+		s := states[d.t.ID]
+		if d.err == nil {
+			s.failures = 0
+			if d.startup {
+				logger.Info("Startup probe succeeded", "task_id", d.t.ID, "probe", d.p.Type, "after", now.Sub(s.started).Round(time.Second))
+				s.ready = true
+			}
+			w.setHealth(d.t, task.Healthy)
+			continue
+		}
+		if now.Before(s.started.Add(d.p.InitialDelay())) {
+			logger.Debug("Probe failed during its initial delay", "task_id", d.t.ID, "probe", d.p.Type, "startup", d.startup, "error", d.err)
+			continue
+		}
+		s.failures++
+		w.metrics.probeFailures.Inc(string(d.p.Type))
+		logger.Warn("Probe failed", "task_id", d.t.ID, "probe", d.p.Type, "startup", d.startup, "failures", s.failures, "threshold", d.p.Threshold(), "error", d.err)
+		if s.failures >= d.p.Threshold() {
+			reason := task.ReasonUnhealthy
+			if d.startup {
+				reason = task.ReasonStartupProbeFailed
+			}
+			w.failUnhealthy(d.t, reason)
+			delete(states, d.t.ID)
+		}
+	}
+}
+
+// probe runs p once against a container, returning nil when it is healthy
+func (w *Worker) probe(ctx context.Context, rt task.ContainerRuntime, p task.Probe, containerID string, ports nat.PortMap) error {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout())
+	defer cancel()
+
+	switch p.Type {
+	case task.HTTPProbe:
+		port, err := probePort(p, ports)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://localhost:%s%s", port, p.Path), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			return fmt.Errorf("GET %s returned %d", p.Path, resp.StatusCode)
+		}
+	case task.TCPProbe:
+		port, err := probePort(p, ports)
+		if err != nil {
+			return err
+		}
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort("localhost", port))
+		if err != nil {
+			return err
+		}
+		conn.Close()
+	case task.ExecProbe:
+		code, err := rt.Exec(ctx, containerID, p.Command)
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			return fmt.Errorf("%s exited with code %d", strings.Join(p.Command, " "), code)
+		}
+	default:
+		return fmt.Errorf("unknown probe type %q", p.Type)
+	}
+	return nil
+}
+
+// probePort returns the host port published for the probed container port
+func probePort(p task.Probe, ports nat.PortMap) (string, error) {
+	if p.Port != "" {
+		port := nat.Port(p.Port)
+		if !strings.Contains(p.Port, "/") {
+			port = nat.Port(p.Port + "/tcp")
+		}
+		if bindings := ports[port]; len(bindings) > 0 {
+			return bindings[0].HostPort, nil
+		}
+		return "", fmt.Errorf("port %s is not published", port)
+	}
+
+	keys := make([]string, 0, len(ports))
+	for k, bindings := range ports {
+		if len(bindings) > 0 {
+			keys = append(keys, string(k))
+		}
+	}
+	if len(keys) == 0 {
+		return "", fmt.Errorf("no published ports to probe")
+	}
+	sort.Strings(keys)
+	return ports[nat.Port(keys[0])][0].HostPort, nil
+}
+
+// setHealth records the health of a running task, reporting changes to the manager
+func (w *Worker) setHealth(t task.Task, health task.HealthStatus) {
+	if t.Health == health || !w.claim(t.ID) {
+		return
+	}
+	defer w.done(t.ID)
+	res, err := w.Db.Get(t.ID.String())
+	if err != nil {
+		return
+	}
+	current := res.(*task.Task)
+	if current.State != task.Running || current.ContainerID != t.ContainerID {
+		return
+	}
+	current.Health = health
+	w.Db.Put(current.ID.String(), current)
+	w.reportState(*current)
+}
+
+// failUnhealthy stops the container of a task that failed its probes and marks the task Failed for reason
+func (w *Worker) failUnhealthy(t task.Task, reason task.FailureReason) {
+	if !w.claim(t.ID) {
+		return
+	}
+	defer w.done(t.ID)
+	res, err := w.Db.Get(t.ID.String())
+	if err != nil {
+		return
+	}
+	current := res.(*task.Task)
+	if current.State != task.Running || current.ContainerID != t.ContainerID {
+		return
+	}
+	w.stopUnhealthy(current, reason)
+}
+
+// stopUnhealthy stops the container of a claimed unhealthy task and marks the task Failed for reason
+func (w *Worker) stopUnhealthy(current *task.Task, reason task.FailureReason) {
+	logger.Warn("Task is unhealthy, stopping container", "task_id", current.ID, "container_id", current.ContainerID)
+	if result := w.runtime(task.NewConfig(current)).Stop(current.ContainerID); result.Error != nil {
+		logger.Error("Error stopping unhealthy container", "task_id", current.ID, "container_id", current.ContainerID, "error", result.Error)
+	}
+	current.Health = task.Unhealthy
+	current.FailureReason = reason
+	current.FinishTime = time.Now().UTC()
+	current.State = task.Failed
+	w.Db.Put(current.ID.String(), current)
+	w.reportState(*current)
+}
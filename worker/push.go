@@ -0,0 +1,76 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/features"
+	"cube/task"
+)
+
+/**
+* Pushed task updates
+* With the PushUpdates feature gate enabled and a Manager configured, every task state
+* change is queued here and POSTed to the manager's /task-updates endpoint in order.
+* Tasks failing to start are pushed without the gate too, so the manager learns the
+* error right away instead of at its next poll.
+* Updates that cannot be delivered are dropped, the manager's polling reconciles them.
+ */
+const pushQueueSize = 256
+
+// reportState queues the current state of t for the manager
+func (w *Worker) reportState(t task.Task) {
+	w.transition(t)
+	if w.Manager == "" || !features.Enabled(features.PushUpdates) && !t.StartFailed() {
+		return
+	}
+	te := task.TaskEvent{
+		ID:        uuid.New(),
+		State:     t.State,
+		Timestamp: time.Now().UTC(),
+		Task:      t,
+		Worker:    w.Address,
+	}
+	select {
+	case w.updates <- te:
+	default:
+		logger.Warn("Push queue full, dropping task update", "task_id", t.ID, "state", t.State.String())
+	}
+}
+
+// PushUpdates delivers queued task updates to the manager until ctx is cancelled
+func (w *Worker) PushUpdates(ctx context.Context) {
+	for {
+		select {
+		case te := <-w.updates:
+			if err := w.pushUpdate(te); err != nil {
+				logger.Error("Error pushing task update", "task_id", te.Task.ID, "state", te.Task.State.String(), "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *Worker) pushUpdate(te task.TaskEvent) error {
+	data, err := json.Marshal(te)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("http://%s/task-updates", w.Manager)
+	resp, err := w.Client.Post(url, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("manager returned %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package worker
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"cube/task"
+)
+
+/**
+* Container recovery
+* A restarted worker re-adopts the containers it started before it stopped, which
+* requires a stable --name like the persistent store does. Every container labeled
+* with the worker's name is matched with the task store: tasks missing from it,
+* all of them with the memory store, are rebuilt from the container's labels, and
+* tasks that lost track of their container point to it again. The adopted tasks
+* are Running, so updateTasks resumes monitoring them and picks up the containers
+* that exited in the meantime.
+*
+* Container names carry the short task ID, so they only collide with the container a
+* previous attempt at the same task left behind. Starting a task removes such leftovers,
+* or with ReuseContainers adopts the one still running and healthy instead.
+ */
+func (w *Worker) RecoverContainers() error {
+	rt := w.runtime(&task.Config{})
+	summaries, err := rt.List()
+	if err != nil {
+		return err
+	}
+	exists := make(map[string]bool, len(summaries))
+	for _, s := range summaries {
+		exists[s.ID] = true
+	}
+
+	adopted := 0
+	for _, s := range summaries {
+		if !w.owns(s) {
+			continue
+		}
+		// Listings may cut label values short, the spec is read from the inspection
+		resp := rt.Inspect(s.ID)
+		if resp.Error != nil || resp.Container.Config == nil {
+			logger.Error("Error inspecting task container", "container_id", s.ID, "error", resp.Error)
+			continue
+		}
+		t, err := task.TaskFromLabels(resp.Container.Config.Labels)
+		if err != nil {
+			logger.Warn("Ignoring container with invalid task labels", "container_id", s.ID, "error", err)
+			continue
+		}
+
+		if res, err := w.Db.Get(t.ID.String()); err == nil {
+			current := res.(*task.Task)
+			switch {
+			case current.ContainerID == s.ID:
+				continue
+			case current.State == task.Completed || exists[current.ContainerID]:
+				// Left behind by a stop or a rolling update the worker did not finish
+				logger.Info("Removing leftover container of task", "task_id", t.ID, "container_id", s.ID)
+				rt.Stop(s.ID)
+				continue
+			}
+			t = current
+		}
+
+		t.ContainerID = s.ID
+		if len(s.Names) > 0 {
+			t.ContainerName = strings.TrimPrefix(s.Names[0], "/")
+		}
+		t.State = task.Running
+		if t.StartTime.IsZero() {
+			t.StartTime = time.Unix(s.Created, 0).UTC()
+		}
+		if err := w.Db.Put(t.ID.String(), t); err != nil {
+			logger.Error("Error storing recovered task", "task_id", t.ID, "error", err)
+			continue
+		}
+		w.reportState(*t)
+		adopted++
+		logger.Info("Adopted container of task", "task_id", t.ID, "container_id", s.ID, "status", s.State)
+	}
+	logger.Info("Recovered task containers", "adopted", adopted)
+	return nil
+}
+
+// reusableContainer returns the ID of the running, healthy container a previous attempt
+// left for t under its name, when ReuseContainers is set. Other containers of the task
+// holding the name are removed, so it can be created again.
+func (w *Worker) reusableContainer(t task.Task) string {
+	if t.ContainerName == "" {
+		return ""
+	}
+	rt := w.runtime(&task.Config{})
+	summaries, err := rt.List()
+	if err != nil {
+		return ""
+	}
+	reused := ""
+	for _, s := range summaries {
+		if !w.owns(s) || s.Labels[task.TaskIDLabel] != t.ID.String() || !slices.Contains(s.Names, "/"+t.ContainerName) {
+			continue
+		}
+		if w.ReuseContainers && reused == "" && s.State == "running" && !strings.Contains(s.Status, "(unhealthy)") {
+			reused = s.ID
+			continue
+		}
+		logger.Info("Removing leftover container holding the name of task", "task_id", t.ID, "container_id", s.ID, "name", t.ContainerName, "status", s.Status)
+		rt.Stop(s.ID)
+	}
+	return reused
+}
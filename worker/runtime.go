@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"context"
+	"io"
+
+	"github.com/docker/docker/api/types/container"
+
+	"cube/task"
+)
+
+// unavailableRuntime fails every operation with the error that prevented creating the runtime
+type unavailableRuntime struct {
+	err error
+}
+
+func (u unavailableRuntime) Run() task.DockerResult {
+	return task.DockerResult{Error: u.err}
+}
+
+func (u unavailableRuntime) Stop(id string) task.DockerResult {
+	return task.DockerResult{Error: u.err}
+}
+
+func (u unavailableRuntime) Inspect(containerID string) task.DockerInspectResponse {
+	return task.DockerInspectResponse{Error: u.err}
+}
+
+func (u unavailableRuntime) Exec(ctx context.Context, containerID string, cmd []string) (int, error) {
+	return 0, u.err
+}
+
+func (u unavailableRuntime) Logs(ctx context.Context, containerID string, follow bool, tail string) (io.ReadCloser, error) {
+	return nil, u.err
+}
+
+func (u unavailableRuntime) Stats(ctx context.Context, containerID string) (*task.ContainerStats, error) {
+	return nil, u.err
+}
+
+func (u unavailableRuntime) List() ([]container.Summary, error) {
+	return nil, u.err
+}
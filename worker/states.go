@@ -0,0 +1,28 @@
+package worker
+
+import (
+	"github.com/google/uuid"
+
+	"cube/task"
+)
+
+// transition runs the hooks of States when t reached a state other than the one
+// last reported for it. Tasks seen for the first time come from Pending.
+func (w *Worker) transition(t task.Task) {
+	w.mu.Lock()
+	from, ok := w.states[t.ID]
+	w.states[t.ID] = t.State
+	w.mu.Unlock()
+	if !ok {
+		from = task.Pending
+	}
+	w.States.Fire(t, from, t.State)
+}
+
+// forgetState drops the last reported state and the result of a collected task
+func (w *Worker) forgetState(id uuid.UUID) {
+	w.mu.Lock()
+	delete(w.states, id)
+	delete(w.results, id)
+	w.mu.Unlock()
+}
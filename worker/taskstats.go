@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cube/task"
+	"cube/utils"
+)
+
+/**
+* Task resource usage
+* Running tasks are sampled through the container runtime's stats and the usage is
+* recorded on the task, so it reaches the manager with the rest of the task state.
+ */
+const (
+	defaultTaskStatsInterval = 15 * time.Second
+	taskStatsTimeout         = 10 * time.Second
+)
+
+// CollectTaskStats samples the resource usage of running tasks every TaskStatsInterval
+func (w *Worker) CollectTaskStats(ctx context.Context) {
+	w.Watchdog.Register("collectTaskStats", w.TaskStatsInterval)
+	for {
+		w.Watchdog.Beat("collectTaskStats")
+		w.collectTaskStats(ctx)
+		if !utils.SleepContext(ctx, w.TaskStatsInterval) {
+			return
+		}
+	}
+}
+
+func (w *Worker) collectTaskStats(ctx context.Context) {
+	for _, t := range w.GetTasks() {
+		if t.State != task.Running || t.ContainerID == "" {
+			continue
+		}
+		sampleCtx, cancel := context.WithTimeout(ctx, taskStatsTimeout)
+		usage, err := w.runtime(task.NewConfig(t)).Stats(sampleCtx, t.ContainerID)
+		cancel()
+		if err != nil {
+			logger.Warn("Error sampling task resource usage", "task_id", t.ID, "container_id", t.ContainerID, "error", err)
+			continue
+		}
+		w.recordUsage(t.ID, t.ContainerID, usage)
+	}
+}
+
+// recordUsage stores a usage sample on the task, unless it moved on to another
+// container or state while it was sampled
+func (w *Worker) recordUsage(id uuid.UUID, containerID string, usage *task.ContainerStats) {
+	if !w.claim(id) {
+		return
+	}
+	defer w.done(id)
+	res, err := w.Db.Get(id.String())
+	if err != nil {
+		return
+	}
+	t := res.(*task.Task)
+	if t.State != task.Running || t.ContainerID != containerID {
+		return
+	}
+	t.Usage = usage
+	w.Db.Put(t.ID.String(), t)
+}
@@ -0,0 +1,122 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+
+	"cube/task"
+)
+
+// How long a new revision may take to become running and healthy
+const (
+	updateTimeout      = 60 * time.Second
+	updatePollInterval = 1 * time.Second
+)
+
+// UpdateTask performs a rolling replace of a running task: the next revision is started
+// next to the current container, and the current container is only stopped once the
+// next one is running and healthy. On failure the current container keeps running.
+func (w *Worker) UpdateTask(current task.Task, next task.Task) task.DockerResult {
+	logger.Info("Rolling task to the next revision", "task_id", current.ID, "from", current.Revision, "to", next.Revision)
+	resolved, err := w.resolveMounts(next)
+	if err != nil {
+		logger.Error("Error starting task revision", "task_id", next.ID, "revision", next.Revision, "error", err)
+		return task.DockerResult{Error: err}
+	}
+	// Both revisions cannot bind the same host port, so the current one is stopped first
+	if sharesHostPorts(current, next) {
+		return w.recreateTask(current, next)
+	}
+	if err := w.reservePorts(next); err != nil {
+		logger.Error("Error starting task revision", "task_id", next.ID, "revision", next.Revision, "error", err)
+		return task.DockerResult{Error: err}
+	}
+	defer w.releasePorts(next)
+	rt := w.runtime(w.runConfig(resolved))
+	result := rt.Run()
+	if result.Error != nil {
+		logger.Error("Error starting task revision", "task_id", next.ID, "revision", next.Revision, "error", result.Error)
+		return result
+	}
+
+	ports, err := w.waitUntilReady(rt, next, result.ContainerID)
+	if err != nil {
+		logger.Warn("Task revision did not become ready, keeping the current one", "task_id", next.ID, "revision", next.Revision, "current", current.Revision, "error", err)
+		rt.Stop(result.ContainerID)
+		return task.DockerResult{Error: err}
+	}
+
+	stopped := w.runtime(task.NewConfig(&current)).Stop(current.ContainerID)
+	if stopped.Error != nil {
+		logger.Error("Error stopping previous container", "task_id", current.ID, "container_id", current.ContainerID, "error", stopped.Error)
+	}
+
+	next.ContainerID = result.ContainerID
+	next.ContainerName = next.NewContainerName()
+	next.HostPorts = ports
+	next.State = task.Running
+	next.StartTime = time.Now().UTC()
+	w.Db.Put(next.ID.String(), &next)
+	w.reportState(next)
+	logger.Info("Task is now running the next revision", "task_id", next.ID, "revision", next.Revision, "container_id", next.ContainerID, "state", next.State.String())
+	return result
+}
+
+// recreateTask replaces a running task by stopping its container before starting the
+// next revision. The task fails when the next revision does not start.
+func (w *Worker) recreateTask(current task.Task, next task.Task) task.DockerResult {
+	logger.Info("Task revisions bind the same host ports, stopping the current one first", "task_id", current.ID, "from", current.Revision, "to", next.Revision)
+	stopped := w.runtime(task.NewConfig(&current)).Stop(current.ContainerID)
+	if stopped.Error != nil {
+		logger.Error("Error stopping previous container", "task_id", current.ID, "container_id", current.ContainerID, "error", stopped.Error)
+		return stopped
+	}
+	next.ContainerID = ""
+	next.HostPorts = nil
+	next.State = task.Scheduled
+	w.Db.Put(next.ID.String(), &next)
+	return w.StartTask(next)
+}
+
+// waitUntilReady polls the container until it is running and, if the task has
+// a startup probe or a health check, until they succeed. A startup probe extends
+// the timeout to its initial delay plus its failure threshold in intervals.
+func (w *Worker) waitUntilReady(rt task.ContainerRuntime, t task.Task, containerID string) (nat.PortMap, error) {
+	timeout := updateTimeout
+	started := t.StartupProbe == nil
+	if !started {
+		p := t.StartupProbe
+		timeout = max(timeout, p.InitialDelay()+time.Duration(p.Threshold())*p.Interval())
+	}
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(updatePollInterval)
+
+		resp := rt.Inspect(containerID)
+		if resp.Error != nil {
+			return nil, resp.Error
+		}
+		state := resp.Container.State
+		if state == nil || state.Status == "exited" || state.Status == "dead" {
+			return nil, fmt.Errorf("container %v stopped before becoming ready", containerID)
+		}
+		if !state.Running {
+			continue
+		}
+
+		ports := resp.Container.NetworkSettings.NetworkSettingsBase.Ports
+		if !started {
+			if w.probe(context.Background(), rt, *t.StartupProbe, containerID, ports) != nil {
+				continue
+			}
+			started = true
+		}
+		if p := t.HealthProbe(); p == nil || w.probe(context.Background(), rt, *p, containerID, ports) == nil {
+			return ports, nil
+		}
+	}
+	return nil, fmt.Errorf("timed out after %v", timeout)
+}
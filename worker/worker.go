@@ -1,30 +1,133 @@
 package worker
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/golang-collections/collections/queue"
+	"github.com/google/uuid"
+	"github.com/moby/moby/pkg/stdcopy"
 
+	"cube/config"
+	"cube/features"
+	"cube/logging"
+	"cube/node"
 	"cube/stats"
 	"cube/store"
+	"cube/systemd"
 	"cube/task"
+	"cube/utils"
 )
 
+var logger = logging.For("worker")
+
 type Worker struct {
-	Name      string
+	Name string
+	// mu guards Queue, inProgress, stopping, ports, drain, states, results and lastStartLatency
+	mu         sync.Mutex
+	wake       chan struct{}
+	inProgress map[uuid.UUID]bool
+	// Tasks in progress being stopped
+	stopping map[uuid.UUID]bool
+	// Host ports reserved by tasks being started, keyed by "port/proto"
+	ports map[string]uuid.UUID
+	drain node.DrainRequest
+	// Last state reported for each task
+	states map[uuid.UUID]task.State
+	// Output of finished jobs, kept until they are collected
+	results map[uuid.UUID]task.Result
+	// Subscribers of GET /events/stream
+	events    eventStream
 	Queue     queue.Queue
 	Db        store.Store
 	TaskCount int
 	Stats     *stats.Stats
+	// Last host stats samples, served on /stats/history
+	StatsHistory *stats.History
+	DbType       string
+	Watchdog     *systemd.Watchdog
+	metrics      *workerMetrics
+	// Task state transitions, with hooks run as tasks change state
+	States *task.StateMachine
+	// How long the container of the last started task took to start
+	lastStartLatency time.Duration
+	// Manager task state changes are pushed to, and the address it reaches this worker at
+	Manager string
+	Address string
+	// Client used for manager API calls
+	Client  *http.Client
+	updates chan task.TaskEvent
+	// Container runtime tasks run on, one of task.Runtimes
+	Runtime string
+	// Client shared by every container operation, created for Runtime on first use when nil
+	RuntimeClient *task.RuntimeClient
+	clientOnce    sync.Once
+	clientErr     error
+	// Labels tasks select this node by through NodeSelector and Constraints
+	Labels map[string]string
+	// Capabilities declared by the operator, such as gpu, see AdvertisedCapabilities
+	Capabilities []string
+	// Adopt the running container a previous attempt left for a task instead of replacing it
+	ReuseContainers bool
+	// Bytes of stdout and of stderr kept in the result of a finished job
+	MaxResultOutput int
+	// Host directories bind mounts may use, bind mounts are refused when empty
+	AllowedBindPaths []string
+	// Credentials images are pulled with, per registry domain
+	Registries task.Registries
+	// Maximum number of queued tasks run concurrently
+	Concurrency int
+	// Most active tasks the worker accepts, zero for no limit, reported to the manager
+	MaxTasks int
+	// Memory used percent above which non-Guaranteed tasks are evicted
+	EvictionThreshold float64
+	// How long finished tasks and their containers are kept, zero keeps them forever
+	TaskRetention time.Duration
+	// Background loop intervals
+	RunInterval       time.Duration
+	StatsInterval     time.Duration
+	UpdateInterval    time.Duration
+	TaskStatsInterval time.Duration
 }
 
-func New(name string, taskDbType string) *Worker {
+func New(name string, taskDbType string, dataDir string) *Worker {
 	w := Worker{
-		Name:  name,
-		Queue: *queue.New(),
+		Name:        name,
+		Queue:       *queue.New(),
+		wake:        make(chan struct{}, 1),
+		updates:     make(chan task.TaskEvent, pushQueueSize),
+		Client:      http.DefaultClient,
+		inProgress:  make(map[uuid.UUID]bool),
+		stopping:    make(map[uuid.UUID]bool),
+		ports:       make(map[string]uuid.UUID),
+		states:      make(map[uuid.UUID]task.State),
+		results:     make(map[uuid.UUID]task.Result),
+		States:      task.NewStateMachine(),
+		DbType:      taskDbType,
+		Watchdog:    systemd.NewWatchdog(),
+		Runtime:     task.DockerRuntime,
+		Concurrency: defaultConcurrency,
+
+		MaxResultOutput: task.DefaultMaxResultOutput,
+
+		StatsHistory: stats.NewHistory(stats.DefaultHistorySize),
+
+		ReuseContainers: true,
+
+		EvictionThreshold: 90,
+		TaskRetention:     defaultTaskRetention,
+
+		RunInterval:       10 * time.Second,
+		StatsInterval:     15 * time.Second,
+		UpdateInterval:    15 * time.Second,
+		TaskStatsInterval: defaultTaskStatsInterval,
 	}
 
 	var s store.Store
@@ -33,76 +136,161 @@ func New(name string, taskDbType string) *Worker {
 	case "memory":
 		s = store.NewInMemoryTaskStore()
 	case "persistent":
-		filename := fmt.Sprintf("%s_tasks.db", name)
+		filename := filepath.Join(dataDir, fmt.Sprintf("%s_tasks.db", name))
 		s, err = store.NewTaskStore(filename, 0600, "tasks")
 	}
 
 	if err != nil {
-		log.Printf("Unable to create new task store: %v", err)
+		logger.Error("Unable to create new task store", "error", err)
 	}
 	w.Db = s
+	w.metrics = newWorkerMetrics(&w)
+	w.States.OnTransition(task.AnyState, task.AnyState, task.TransitionHookFunc(w.metrics.transition))
+	w.States.OnTransition(task.AnyState, task.AnyState, task.TransitionHookFunc(w.publishTransition))
 	return &w
 }
 
-func (w *Worker) CollectStats() {
+func (w *Worker) Settings() config.Settings {
+	return config.Settings{
+		Component:    "worker",
+		Name:         w.Name,
+		Runtime:      w.Runtime,
+		Labels:       w.Labels,
+		DbType:       w.DbType,
+		FeatureGates: features.Gates.Map(),
+		Intervals: config.Intervals(map[string]time.Duration{
+			"runTasks":         w.RunInterval,
+			"collectStats":     w.StatsInterval,
+			"collectTaskStats": w.TaskStatsInterval,
+			"updateTasks":      w.UpdateInterval,
+			"taskGC":           gcInterval(w.TaskRetention),
+			"probeTasks":       probeTick,
+		}),
+		Build: config.GetBuildInfo(),
+	}
+}
+
+func (w *Worker) CollectStats(ctx context.Context) {
+	w.Watchdog.Register("collectStats", w.StatsInterval)
 	for {
-		log.Println("Collecting stats")
-		w.Stats = stats.GetStats()
-		w.Stats.TaskCount = w.TaskCount
-		time.Sleep(15 * time.Second)
+		w.Watchdog.Beat("collectStats")
+		logger.Debug("Collecting stats")
+		s := stats.GetStats()
+		s.TaskCount = w.TaskCount
+		s.MaxTasks = w.MaxTasks
+		d := w.Drain()
+		s.Drained, s.Evict = d.Drained, d.Evict && d.Drained
+		w.collectWorkload(s)
+		w.Stats = s
+		w.StatsHistory.Add(*s)
+		w.evictUnderPressure()
+		if !utils.SleepContext(ctx, w.StatsInterval) {
+			return
+		}
+	}
+}
+
+// evictUnderPressure stops the running task with the lowest QoS class when host memory
+// usage crosses the eviction threshold. Guaranteed tasks are never evicted.
+func (w *Worker) evictUnderPressure() {
+	if w.EvictionThreshold <= 0 || w.Stats.MemStats == nil {
+		return
+	}
+	if float64(w.Stats.MemUsedPercent()) < w.EvictionThreshold {
+		return
+	}
+
+	var victim *task.Task
+	for _, t := range w.GetTasks() {
+		if t.State != task.Running {
+			continue
+		}
+		if t.QoSClass == "" {
+			t.QoSClass = task.QoSClassFor(*t)
+		}
+		if victim == nil || t.QoSClass.Rank() < victim.QoSClass.Rank() {
+			victim = t
+		}
+	}
+	if victim == nil || victim.QoSClass == task.Guaranteed {
+		logger.Warn("Memory pressure but no evictable tasks", "memory_used_percent", w.Stats.MemUsedPercent())
+		return
+	}
+
+	if !w.claim(victim.ID) {
+		return
+	}
+	defer w.done(victim.ID)
+
+	logger.Warn("Memory pressure, evicting task", "task_id", victim.ID, "qos_class", victim.QoSClass, "memory_used_percent", w.Stats.MemUsedPercent())
+	result := w.runtime(task.NewConfig(victim)).Stop(victim.ContainerID)
+	if result.Error != nil {
+		logger.Error("Error evicting task", "task_id", victim.ID, "error", result.Error)
+		return
 	}
+	w.metrics.evictions.Inc()
+	victim.FinishTime = time.Now().UTC()
+	victim.State = task.Failed
+	w.Db.Put(victim.ID.String(), victim)
+	w.reportState(*victim)
 }
 
 func (w *Worker) GetTasks() []*task.Task {
 	tasks, err := w.Db.List()
 	if err != nil {
-		log.Printf("Error getting list of tasks: %v\n", err)
+		logger.Error("Error getting list of tasks", "error", err)
 		return nil
 	}
 	return tasks.([]*task.Task)
 }
 
-func (w *Worker) AddTask(t task.Task) {
-	w.Queue.Enqueue(t)
+// QueryTasks returns the page of tasks matching q and the number of matching tasks
+func (w *Worker) QueryTasks(q store.TaskQuery) ([]*task.Task, int, error) {
+	return store.QueryTasks(w.Db, q)
 }
 
-func (w *Worker) RunTasks() {
-	for {
-		if w.Queue.Len() != 0 {
-			result := w.RunTask()
-			if result.Error != nil {
-				log.Printf("Error running task: %v\n", result.Error)
-			}
-		} else {
-			log.Printf("No tasks to process currently.\n")
-		}
-		log.Println("Sleeping for 10 seconds.")
-		time.Sleep(10 * time.Second)
+func (w *Worker) RunTask() task.DockerResult {
+	taskQueued, ok := w.dequeue()
+	if !ok {
+		logger.Debug("No tasks in the queue")
+		return task.DockerResult{Error: nil}
 	}
-
+	defer w.done(taskQueued.ID)
+	return w.runTask(taskQueued)
 }
 
-func (w *Worker) RunTask() task.DockerResult {
-	t := w.Queue.Dequeue()
-	if t == nil {
-		log.Println("No tasks in the queue")
-		return task.DockerResult{Error: nil}
+func (w *Worker) runTask(taskQueued task.Task) task.DockerResult {
+	start := time.Now()
+	result := w.executeTask(taskQueued)
+	w.metrics.runDuration.Observe(time.Since(start).Seconds())
+	status := "success"
+	if result.Error != nil {
+		status = "error"
 	}
+	w.metrics.taskRuns.Inc(taskQueued.State.String(), status)
+	return result
+}
 
-	taskQueued := t.(task.Task)
-	fmt.Printf("Found task in queue: %v:\n", taskQueued)
+func (w *Worker) executeTask(taskQueued task.Task) task.DockerResult {
+	logger.Info("Found task in queue", "task_id", taskQueued.ID, "state", taskQueued.State.String())
+
+	// A newer revision of a running task is rolled out next to the current container
+	if res, err := w.Db.Get(taskQueued.ID.String()); err == nil {
+		current := *res.(*task.Task)
+		if current.State == task.Running && taskQueued.State == task.Running && taskQueued.Revision > current.Revision {
+			return w.UpdateTask(current, taskQueued)
+		}
+	}
 
 	err := w.Db.Put(taskQueued.ID.String(), &taskQueued)
 	if err != nil {
-		msg := fmt.Errorf("error storing task '%s': %v", taskQueued.ID.String(), err)
-		log.Println(msg)
+		logger.Error("Error storing task", "task_id", taskQueued.ID, "error", err)
 		return task.DockerResult{Error: err}
 	}
 
 	res, err := w.Db.Get(taskQueued.ID.String())
 	if err != nil {
-		msg := fmt.Errorf("error getting task '%s': %v", taskQueued.ID.String(), err)
-		log.Println(msg)
+		logger.Error("Error getting task", "task_id", taskQueued.ID, "error", err)
 		return task.DockerResult{Error: err}
 	}
 
@@ -112,14 +300,14 @@ func (w *Worker) RunTask() task.DockerResult {
 	}
 
 	var result task.DockerResult
-	if task.ValidStateTransition(taskPersisted.State, taskQueued.State) {
+	if w.States.Valid(taskPersisted.State, taskQueued.State) {
 		switch taskQueued.State {
 		case task.Scheduled:
 			result = w.StartTask(taskQueued)
 		case task.Completed:
 			result = w.StopTask(taskQueued)
 		default:
-			fmt.Printf("This is a mistake. taskPersisted: %v, taskQueued: %v\n", taskPersisted, taskQueued)
+			logger.Error("Unexpected task state", "task_id", taskQueued.ID, "state", taskQueued.State.String(), "persisted_state", taskPersisted.State.String())
 			result.Error = errors.New("we should not get here")
 		}
 	} else {
@@ -132,49 +320,242 @@ func (w *Worker) RunTask() task.DockerResult {
 
 func (w *Worker) StartTask(t task.Task) task.DockerResult {
 	t.StartTime = time.Now().UTC()
-	config := task.NewConfig(&t)
-	d := task.NewDocker(config)
-
-	result := d.Run()
+	t.FailureReason = ""
+	t.Error = ""
+	t.ErrorCode = ""
+	t.OOMKilled = false
+	t.ContainerName = t.NewContainerName()
+	// The container is run with the resolved mounts, the task keeps its own
+	resolved, err := w.resolveMounts(t)
+	if err != nil {
+		return w.failStart(t, err)
+	}
+	// Tasks accepted at the same time are only checked against each other here
+	if err := w.Admit(t); err != nil {
+		return w.failStart(t, err)
+	}
+	if err := w.reservePorts(t); err != nil {
+		return w.failStart(t, err)
+	}
+	defer w.releasePorts(t)
+	var result task.DockerResult
+	if id := w.reusableContainer(t); id != "" {
+		logger.Info("Reusing the running container of task", "task_id", t.ID, "container_id", id, "name", t.ContainerName)
+		result = task.DockerResult{Action: "start", Result: "reused", ContainerID: id}
+	} else {
+		started := time.Now()
+		result = w.run(resolved)
+		if result.Error == nil {
+			w.recordStartLatency(time.Since(started))
+		}
+	}
 	if result.Error != nil {
-		log.Printf("Error running task %v: %v\n", t.ID, result.Error)
+		logger.Error("Error running task", "task_id", t.ID, "error", result.Error)
 		t.State = task.Failed
+		t.FailureReason = task.StartFailureReason(result.Error)
+		t.Error = result.Error.Error()
+		t.ErrorCode = task.ClassifyStartError(result.Error)
 	} else {
 		t.ContainerID = result.ContainerID
 		t.State = task.Running
+		// Record the published ports right away, so pushed updates carry them
+		if resp := w.InspectTask(t); resp.Container != nil && resp.Container.NetworkSettings != nil {
+			t.HostPorts = resp.Container.NetworkSettings.Ports
+		}
 	}
 	w.Db.Put(t.ID.String(), &t)
+	w.reportState(t)
 	return result
 }
 
+// failStart fails t with err when it is refused before its container is started
+func (w *Worker) failStart(t task.Task, err error) task.DockerResult {
+	logger.Error("Error running task", "task_id", t.ID, "error", err)
+	t.State = task.Failed
+	t.FailureReason = task.ReasonStartFailed
+	t.Error = err.Error()
+	w.Db.Put(t.ID.String(), &t)
+	w.reportState(t)
+	return task.DockerResult{Error: err}
+}
+
 func (w *Worker) StopTask(t task.Task) task.DockerResult {
 	config := task.NewConfig(&t)
-	d := task.NewDocker(config)
-
-	result := d.Stop(t.ContainerID)
+	result := w.runtime(config).Stop(t.ContainerID)
 	if result.Error != nil {
-		log.Printf("Error stopping container %v: %v\n", t.ContainerID, result.Error)
+		logger.Error("Error stopping container", "task_id", t.ID, "container_id", t.ContainerID, "error", result.Error)
 	}
 	t.FinishTime = time.Now().UTC()
 	t.State = task.Completed
 	w.Db.Put(t.ID.String(), &t)
-	log.Printf("Stopped and removed container %v for task %v\n", t.ContainerID, t.ID)
+	w.reportState(t)
+	if result.Killed {
+		logger.Warn("Killed and removed container, it did not stop gracefully", "task_id", t.ID, "container_id", t.ContainerID, "state", t.State.String())
+	} else {
+		logger.Info("Stopped and removed container", "task_id", t.ID, "container_id", t.ContainerID, "state", t.State.String())
+	}
 	return result
 }
 
 func (w *Worker) InspectTask(t task.Task) task.DockerInspectResponse {
 	config := task.NewConfig(&t)
-	d := task.NewDocker(config)
-	return d.Inspect(t.ContainerID)
+	return w.runtime(config).Inspect(t.ContainerID)
+}
+
+// Inspect returns a task with the state of its container, if it has one
+func (w *Worker) Inspect(id uuid.UUID) (*task.Inspection, error) {
+	res, err := w.Db.Get(id.String())
+	if err != nil {
+		return nil, err
+	}
+	in := &task.Inspection{Task: *res.(*task.Task)}
+	if in.Task.ContainerID == "" {
+		return in, nil
+	}
+	resp := w.InspectTask(in.Task)
+	switch {
+	case resp.Error != nil:
+		in.ContainerError = resp.Error.Error()
+	case resp.Container != nil:
+		in.Container = task.NewContainerState(resp.Container)
+	}
+	return in, nil
+}
+
+func (w *Worker) TaskLogs(ctx context.Context, t task.Task, follow bool, tail string) (io.ReadCloser, error) {
+	config := task.NewConfig(&t)
+	return w.runtime(config).Logs(ctx, t.ContainerID, follow, tail)
+}
+
+// Attempts at starting a container whose image pull failed on a transient error,
+// waiting pullBackoff after the first failure and twice as long after each next one
+const (
+	pullAttempts = 3
+	pullBackoff  = 2 * time.Second
+)
+
+// run starts the container of t, retrying transient pull errors such as an
+// unreachable registry. Other errors, e.g. a missing image, fail at once.
+func (w *Worker) run(t task.Task) task.DockerResult {
+	delay := pullBackoff
+	for attempt := 1; ; attempt++ {
+		result := w.runtime(w.runConfig(t)).Run()
+		code := task.ClassifyStartError(result.Error)
+		if result.Error == nil || !code.Transient() || attempt == pullAttempts {
+			return result
+		}
+		logger.Warn("Transient error pulling image, retrying", "task_id", t.ID, "image", t.Image, "code", code, "attempt", attempt, "delay", delay, "error", result.Error)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// runConfig returns the container config t is started with, including the credentials
+// of its registry and the labels it is recovered by
+func (w *Worker) runConfig(t task.Task) *task.Config {
+	config := task.NewConfig(&t)
+	config.RegistryAuth = w.Registries.For(t)
+	config.Labels = task.ContainerLabels(t, w.Name)
+	return config
+}
+
+// runtime returns the worker's container runtime configured for c. The runtime
+// name is validated on startup, so failing to create it here means the host changed.
+func (w *Worker) runtime(c *task.Config) task.ContainerRuntime {
+	rc, err := w.runtimeClient()
+	if err == nil {
+		var rt task.ContainerRuntime
+		if rt, err = rc.Runtime(c); err == nil {
+			return rt
+		}
+	}
+	logger.Error("Error creating container runtime", "runtime", w.Runtime, "error", err)
+	return unavailableRuntime{err: err}
+}
+
+func (w *Worker) runtimeClient() (*task.RuntimeClient, error) {
+	w.clientOnce.Do(func() {
+		if w.RuntimeClient == nil {
+			w.RuntimeClient, w.clientErr = task.NewRuntimeClient(w.Runtime)
+		}
+	})
+	return w.RuntimeClient, w.clientErr
+}
+
+// completeJob records the exit code and output tail of a finished job task, and
+// keeps its output as the job's result. Jobs exiting with code 0 are Completed,
+// any other code leaves them Failed.
+func (w *Worker) completeJob(t *task.Task, exitCode int) {
+	t.ExitCode = exitCode
+	t.FinishTime = time.Now().UTC()
+	if exitCode == 0 {
+		t.State = task.Completed
+	}
+
+	logs, err := w.TaskLogs(context.Background(), *t, false, "all")
+	if err != nil {
+		logger.Error("Error getting output of job", "task_id", t.ID, "error", err)
+		return
+	}
+	defer logs.Close()
+
+	stdout := &task.LimitedBuffer{Limit: w.MaxResultOutput}
+	stderr := &task.LimitedBuffer{Limit: w.MaxResultOutput}
+	// The tail interleaves both streams, as they were logged
+	var out bytes.Buffer
+	tee := func(b *task.LimitedBuffer) io.Writer { return io.MultiWriter(b, tailWriter{&out}) }
+	if _, err := stdcopy.StdCopy(tee(stdout), tee(stderr), logs); err != nil {
+		logger.Error("Error reading output of job", "task_id", t.ID, "error", err)
+	}
+	t.OutputTail = out.String()
+
+	w.mu.Lock()
+	w.results[t.ID] = task.Result{
+		TaskID:          t.ID,
+		State:           t.State,
+		ExitCode:        exitCode,
+		FinishTime:      t.FinishTime,
+		Stdout:          stdout.String(),
+		Stderr:          stderr.String(),
+		StdoutTruncated: stdout.Truncated,
+		StderrTruncated: stderr.Truncated,
+	}
+	w.mu.Unlock()
+	logger.Info("Job finished", "task_id", t.ID, "exit_code", exitCode, "state", t.State.String())
+}
+
+// tailWriter keeps the last MaxOutputTail bytes written to its buffer
+type tailWriter struct {
+	buf *bytes.Buffer
 }
 
-func (w *Worker) UpdateTasks() {
+func (t tailWriter) Write(p []byte) (int, error) {
+	t.buf.Write(p)
+	if extra := t.buf.Len() - task.MaxOutputTail; extra > 0 {
+		t.buf.Next(extra)
+	}
+	return len(p), nil
+}
+
+// Result returns the result of a finished job
+func (w *Worker) Result(id uuid.UUID) (task.Result, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	r, ok := w.results[id]
+	return r, ok
+}
+
+func (w *Worker) UpdateTasks(ctx context.Context) {
+	w.Watchdog.Register("updateTasks", w.UpdateInterval)
 	for {
-		log.Println("Checking status of tasks")
+		w.Watchdog.Beat("updateTasks")
+		logger.Info("Checking status of tasks")
 		w.updateTasks()
-		log.Println("Task updates completed")
-		log.Println("Sleeping for 15 seconds")
-		time.Sleep(15 * time.Second)
+		logger.Info("Task updates completed")
+		logger.Debug("Sleeping", "interval", w.UpdateInterval)
+		if !utils.SleepContext(ctx, w.UpdateInterval) {
+			return
+		}
 	}
 }
 
@@ -187,34 +568,126 @@ func (w *Worker) UpdateTasks() {
 func (w *Worker) updateTasks() {
 	tasks, err := w.Db.List()
 	if err != nil {
-		log.Printf("Error getting list of Tasks: %v\n", err)
+		logger.Error("Error getting list of tasks", "error", err)
 		return
 	}
 
 	for _, t := range tasks.([]*task.Task) {
-		if t.State == task.Running {
-			resp := w.InspectTask(*t)
-			if resp.Error != nil {
-				fmt.Printf("ERROR: %v\n", resp.Error)
-			}
-
-			if resp.Container == nil {
-				log.Printf("No container for running task %s\n", t.ID)
-				t.State = task.Failed
-				w.Db.Put(t.ID.String(), t)
-			}
-
-			if resp.Container.State.Status == "exited" {
-				log.Printf(
-					"Container for task %s in non-running state %s",
-					t.ID, resp.Container.State.Status,
-				)
-				t.State = task.Failed
-				w.Db.Put(t.ID.String(), t)
-			}
-
-			t.HostPorts = resp.Container.NetworkSettings.NetworkSettingsBase.Ports
-			w.Db.Put(t.ID.String(), t)
+		// Tasks being started, stopped or updated are written by their own goroutine
+		if !w.claim(t.ID) {
+			continue
+		}
+		// Re-read the task, it may have changed since it was listed
+		if res, err := w.Db.Get(t.ID.String()); err == nil {
+			w.updateTask(res.(*task.Task))
+		}
+		w.done(t.ID)
+	}
+}
+
+// updateTask refreshes a running task from its container
+func (w *Worker) updateTask(t *task.Task) {
+	if t.State == task.Restarting {
+		w.restartWhenDue(t)
+		return
+	}
+	if t.State != task.Running {
+		return
+	}
+	resp := w.InspectTask(*t)
+	if resp.Error != nil {
+		logger.Error("Error inspecting task", "task_id", t.ID, "error", resp.Error)
+	}
+
+	if resp.Container == nil {
+		logger.Warn("No container for running task", "task_id", t.ID)
+		t.FinishTime = time.Now().UTC()
+		t.State = task.Failed
+		t.FailureReason = task.ReasonContainerMissing
+		w.Db.Put(t.ID.String(), t)
+		w.reportState(*t)
+		return
+	}
+
+	if resp.Container.State.Status == "exited" {
+		logger.Warn("Container for task in non-running state", "task_id", t.ID, "status", resp.Container.State.Status)
+		t.FinishTime = time.Now().UTC()
+		t.State = task.Failed
+		t.ExitCode = resp.Container.State.ExitCode
+		t.OOMKilled = resp.Container.State.OOMKilled
+		if t.Kind == task.JobKind {
+			w.completeJob(t, resp.Container.State.ExitCode)
+		}
+		if t.State == task.Failed {
+			t.FailureReason = task.ExitReason(t.ExitCode, t.OOMKilled)
 		}
+		if t.RestartPolicy.ShouldRestart(t.State == task.Failed, t.RestartCount) {
+			w.scheduleRestart(t)
+		}
+		w.Db.Put(t.ID.String(), t)
+		w.reportState(*t)
+		return
+	}
+
+	if t.DeadlineExceeded(time.Now()) {
+		w.failDeadline(t)
+		return
+	}
+
+	// Health reported by the runtime's healthcheck, probes set it themselves
+	health := task.ContainerHealth(resp.Container)
+	if health == task.Unhealthy {
+		w.stopUnhealthy(t, task.ReasonUnhealthy)
+		return
+	}
+	changed := health != "" && health != t.Health && t.HealthProbe() == nil && t.StartupProbe == nil
+	if changed {
+		t.Health = health
+	}
+
+	t.HostPorts = resp.Container.NetworkSettings.NetworkSettingsBase.Ports
+	w.Db.Put(t.ID.String(), t)
+	if changed {
+		w.reportState(*t)
+	}
+}
+
+// failDeadline kills the container of a task past its timeout or deadline and marks the task Failed
+func (w *Worker) failDeadline(t *task.Task) {
+	logger.Warn("Task exceeded its deadline, killing container", "task_id", t.ID, "container_id", t.ContainerID, "deadline", t.DeadlineAt())
+	if result := w.runtime(task.NewConfig(t)).Stop(t.ContainerID); result.Error != nil {
+		logger.Error("Error stopping container past its deadline", "task_id", t.ID, "container_id", t.ContainerID, "error", result.Error)
+	}
+	t.FailureReason = task.ReasonDeadlineExceeded
+	t.FinishTime = time.Now().UTC()
+	t.State = task.Failed
+	w.Db.Put(t.ID.String(), t)
+	w.reportState(*t)
+}
+
+// scheduleRestart removes the exited container of t and schedules it to be started
+// again once the backoff of its restart policy expires
+func (w *Worker) scheduleRestart(t *task.Task) {
+	if result := w.runtime(task.NewConfig(t)).Stop(t.ContainerID); result.Error != nil {
+		logger.Error("Error removing exited container", "task_id", t.ID, "container_id", t.ContainerID, "error", result.Error)
+	}
+	delay := t.RestartPolicy.Backoff(t.RestartCount)
+	t.RestartCount++
+	t.State = task.Restarting
+	t.ContainerID = ""
+	t.HostPorts = nil
+	t.NextRestart = time.Now().UTC().Add(delay)
+	w.metrics.restarts.Inc()
+	logger.Info("Restarting task after backoff", "task_id", t.ID, "restart", t.RestartCount, "delay", delay, "state", t.State.String())
+}
+
+// restartWhenDue queues a task waiting for a restart once its backoff expired
+func (w *Worker) restartWhenDue(t *task.Task) {
+	if time.Now().Before(t.NextRestart) {
+		return
 	}
+	t.NextRestart = time.Time{}
+	t.State = task.Scheduled
+	w.Db.Put(t.ID.String(), t)
+	w.AddTask(*t)
 }
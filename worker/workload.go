@@ -0,0 +1,61 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"cube/stats"
+	"cube/task"
+)
+
+// collectWorkload adds the worker's queue, tasks and containers to its stats, so the
+// manager can weigh workload pressure and runtime health when placing tasks
+func (w *Worker) collectWorkload(s *stats.Stats) {
+	s.TasksByState = make(map[string]int)
+	for _, t := range w.GetTasks() {
+		s.TasksByState[t.State.String()]++
+	}
+
+	w.mu.Lock()
+	s.QueueLength = w.Queue.Len()
+	s.LastStartLatency = w.lastStartLatency
+	w.mu.Unlock()
+
+	if err := w.checkRuntime(); err != nil {
+		s.RuntimeError = err.Error()
+		return
+	}
+	containers, err := w.runtime(&task.Config{}).List()
+	if err != nil {
+		s.RuntimeError = err.Error()
+		return
+	}
+	for _, c := range containers {
+		if c.State == "running" {
+			s.RunningContainers++
+		}
+	}
+}
+
+// checkRuntime pings the container runtime, reconnecting its client when the
+// connection was lost
+func (w *Worker) checkRuntime() error {
+	rc, err := w.runtimeClient()
+	if err != nil {
+		return err
+	}
+	reconnected, err := rc.CheckHealth(context.Background())
+	if err != nil {
+		return err
+	}
+	if reconnected {
+		logger.Info("Reconnected to container runtime", "runtime", rc.Name)
+	}
+	return nil
+}
+
+func (w *Worker) recordStartLatency(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastStartLatency = d
+}